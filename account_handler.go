@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountHandler handles data export and account deletion
+type AccountHandler struct {
+	accountService *AccountService
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(accountService *AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+	}
+}
+
+// ExportData handles exporting the caller's data
+// @Summary Export my data
+// @Description Download a zip archive of JSON files with the authenticated user's profile, identities, messages, AI chat, handshakes and matches
+// @Tags Account
+// @Produce application/zip
+// @Security Bearer
+// @Success 200 {file} file "Zip archive"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 500 {object} ErrorResponse "Export failed"
+// @Router /users/me/export [get]
+func (h *AccountHandler) ExportData(c *gin.Context) {
+	userID := CallerID(c)
+
+	data, err := h.accountService.ExportUserData(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "export_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=export.zip")
+	c.Data(http.StatusOK, "application/zip", data)
+}
+
+// DeleteAccount handles deleting the caller's account
+// @Summary Delete my account
+// @Description Delete the authenticated user's account. Identities are detached, sessions and Stream tokens revoked, the AI chat deleted, sent messages anonymized and handshakes removed. Runs in the background and resumes after failures.
+// @Tags Account
+// @Produce json
+// @Security Bearer
+// @Success 202 {object} AccountDeletion "Deletion job"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 500 {object} ErrorResponse "Deletion could not be started"
+// @Router /users/me [delete]
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	userID := CallerID(c)
+
+	job, err := h.accountService.RequestDeletion(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "deletion_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListDeletions handles listing unfinished account deletions
+// @Summary List unfinished account deletions
+// @Description List account deletion jobs that are pending, running or failed. Requires the users:admin permission.
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} AccountDeletion "Deletion jobs"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to list deletions"
+// @Router /admin/account-deletions [get]
+func (h *AccountHandler) ListDeletions(c *gin.Context) {
+	jobs, err := h.accountService.ListUnfinishedDeletions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "failed_to_list_deletions",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// RetryDeletion handles retrying a failed account deletion
+// @Summary Retry account deletion
+// @Description Run the remaining steps of a user's account deletion in the background. Requires the users:admin permission.
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param user_id path string true "User ID"
+// @Success 202 {object} object{message=string} "Deletion resumed"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "No deletion requested for the user"
+// @Failure 409 {object} ErrorResponse "Deletion already running"
+// @Router /admin/account-deletions/{user_id}/retry [post]
+func (h *AccountHandler) RetryDeletion(c *gin.Context) {
+	if err := h.accountService.RetryDeletion(c.Param("user_id")); err != nil {
+		switch {
+		case errors.Is(err, ErrDeletionNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "deletion_not_found", Message: err.Error()})
+		case errors.Is(err, ErrDeletionInProgress):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "deletion_in_progress", Message: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "retry_failed", Message: err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Deletion resumed",
+	})
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Account deletion errors
+var (
+	ErrDeletionInProgress = errors.New("account deletion is already in progress")
+	ErrDeletionNotFound   = errors.New("no account deletion was requested for this user")
+)
+
+// deletionStep is one idempotent step of deleting an account
+type deletionStep struct {
+	name string
+	run  func(ctx context.Context, userID string) error
+}
+
+// AccountService exports a user's data and deletes accounts
+type AccountService struct {
+	userRepo         UserRepository
+	messageRepo      MessageRepository
+	streamService    *StreamService
+	sessionService   *SessionService
+	handshakeService *HandshakeService
+
+	mu      sync.Mutex
+	running map[string]bool // User IDs with a deletion running in this process
+}
+
+// NewAccountService creates a new account service
+func NewAccountService(userRepo UserRepository, messageRepo MessageRepository, streamService *StreamService, sessionService *SessionService, handshakeService *HandshakeService) *AccountService {
+	return &AccountService{
+		userRepo:         userRepo,
+		messageRepo:      messageRepo,
+		streamService:    streamService,
+		sessionService:   sessionService,
+		handshakeService: handshakeService,
+		running:          make(map[string]bool),
+	}
+}
+
+// ExportUserData returns a zip archive with everything stored about a user, as JSON files
+func (s *AccountService) ExportUserData(ctx context.Context, userID string) ([]byte, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	identities, err := s.userRepo.ListIdentities(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sent, err := s.messageRepo.GetMessagesBySender(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The AI chat holds the assistant's replies to the user as well
+	aiChat, err := s.allChannelMessages("ai-chat-" + userID)
+	if err != nil {
+		return nil, err
+	}
+
+	handshakes, err := s.handshakeService.GetHistory(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := s.streamService.GetMatchChannels(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matches: %w", err)
+	}
+
+	proposals, err := s.userRepo.ListMatchProposals(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", map[string]interface{}{"user": user, "identities": identities}},
+		{"messages.json", sent},
+		{"ai_chat.json", aiChat},
+		{"handshakes.json", handshakes},
+		{"matches.json", matches},
+		{"match_proposals.json", proposals},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to export: %w", file.name, err)
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish export: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// allChannelMessages pages back through a channel's whole history, oldest first
+func (s *AccountService) allChannelMessages(channelID string) ([]Message, error) {
+	query := MessagePageQuery{Limit: 1000}
+	var pages [][]Message
+	total := 0
+	for {
+		page, err := s.messageRepo.GetChannelMessages(channelID, query)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page.Messages)
+		total += len(page.Messages)
+		if !page.HasMore {
+			break
+		}
+
+		cursor := cursorOf(page.Messages[0])
+		query.Before = &cursor
+	}
+
+	all := make([]Message, 0, total)
+	for i := len(pages) - 1; i >= 0; i-- {
+		all = append(all, pages[i]...)
+	}
+	return all, nil
+}
+
+// RequestDeletion records a deletion job for a user and starts it in the background
+func (s *AccountService) RequestDeletion(userID string) (*AccountDeletion, error) {
+	job, err := s.userRepo.GetAccountDeletion(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if job == nil {
+		now := time.Now().UTC()
+		job = &AccountDeletion{
+			UserID:         userID,
+			Status:         DeletionPending,
+			CompletedSteps: []string{},
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := s.userRepo.SaveAccountDeletion(job); err != nil {
+			return nil, err
+		}
+		log.Printf("[ACCOUNT] Deletion requested for user %s", userID)
+	}
+
+	if job.Status != DeletionCompleted {
+		go s.runInBackground(userID)
+	}
+
+	return job, nil
+}
+
+// ListUnfinishedDeletions returns deletion jobs that are pending, running or failed
+func (s *AccountService) ListUnfinishedDeletions() ([]AccountDeletion, error) {
+	return s.userRepo.ListUnfinishedAccountDeletions()
+}
+
+// RetryDeletion restarts an unfinished deletion job in the background
+func (s *AccountService) RetryDeletion(userID string) error {
+	job, err := s.userRepo.GetAccountDeletion(userID)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return ErrDeletionNotFound
+	}
+
+	s.mu.Lock()
+	running := s.running[userID]
+	s.mu.Unlock()
+	if running {
+		return ErrDeletionInProgress
+	}
+
+	go s.runInBackground(userID)
+	return nil
+}
+
+// ResumeDeletions runs every unfinished deletion job, e.g. after a restart
+func (s *AccountService) ResumeDeletions(ctx context.Context) {
+	jobs, err := s.userRepo.ListUnfinishedAccountDeletions()
+	if err != nil {
+		log.Printf("[ACCOUNT] Failed to list unfinished deletions: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if err := s.RunDeletion(ctx, job.UserID); err != nil && !errors.Is(err, ErrDeletionInProgress) {
+			log.Printf("[ACCOUNT] Deletion of user %s failed: %v", job.UserID, err)
+		}
+	}
+}
+
+// RunDeletion runs the remaining steps of a user's deletion job. Finished steps are
+// recorded as they complete, so a failed job can be retried from where it stopped.
+func (s *AccountService) RunDeletion(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	if s.running[userID] {
+		s.mu.Unlock()
+		return ErrDeletionInProgress
+	}
+	s.running[userID] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, userID)
+		s.mu.Unlock()
+	}()
+
+	job, err := s.userRepo.GetAccountDeletion(userID)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return ErrDeletionNotFound
+	}
+	if job.Status == DeletionCompleted {
+		return nil
+	}
+
+	done := make(map[string]bool, len(job.CompletedSteps))
+	for _, step := range job.CompletedSteps {
+		done[step] = true
+	}
+
+	job.Status = DeletionRunning
+	job.Attempts++
+	job.LastError = ""
+	if err := s.saveJob(job); err != nil {
+		return err
+	}
+
+	for _, step := range s.deletionSteps() {
+		if done[step.name] {
+			continue
+		}
+
+		if err := step.run(ctx, userID); err != nil {
+			job.Status = DeletionFailed
+			job.LastError = fmt.Sprintf("%s: %v", step.name, err)
+			if saveErr := s.saveJob(job); saveErr != nil {
+				log.Printf("[ACCOUNT] Failed to record deletion failure for user %s: %v", userID, saveErr)
+			}
+			return fmt.Errorf("deletion step %s failed: %w", step.name, err)
+		}
+
+		job.CompletedSteps = append(job.CompletedSteps, step.name)
+		if err := s.saveJob(job); err != nil {
+			return err
+		}
+	}
+
+	job.Status = DeletionCompleted
+	if err := s.saveJob(job); err != nil {
+		return err
+	}
+
+	log.Printf("[ACCOUNT] Deleted user %s", userID)
+	return nil
+}
+
+// runInBackground runs a deletion job detached from the request that started it
+func (s *AccountService) runInBackground(userID string) {
+	if err := s.RunDeletion(context.Background(), userID); err != nil && !errors.Is(err, ErrDeletionInProgress) {
+		log.Printf("[ACCOUNT] Deletion of user %s failed: %v", userID, err)
+	}
+}
+
+// saveJob persists a job with a fresh updated_at
+func (s *AccountService) saveJob(job *AccountDeletion) error {
+	job.UpdatedAt = time.Now().UTC()
+	return s.userRepo.SaveAccountDeletion(job)
+}
+
+// deletionSteps lists the steps of an account deletion in order. Each step must be
+// safe to run again after a partial failure.
+func (s *AccountService) deletionSteps() []deletionStep {
+	return []deletionStep{
+		{"detach_identities", s.detachIdentities},
+		{"revoke_tokens", s.revokeTokens},
+		{"delete_ai_chat", s.deleteAIChat},
+		{"anonymize_messages", func(ctx context.Context, userID string) error {
+			return s.messageRepo.AnonymizeSenderMessages(userID)
+		}},
+		{"delete_handshakes", func(ctx context.Context, userID string) error {
+			return s.userRepo.DeleteHandshakes(userID)
+		}},
+		{"delete_stream_user", s.streamService.HardDeleteUser},
+		{"delete_user", func(ctx context.Context, userID string) error {
+			return s.userRepo.DeleteUserRow(userID)
+		}},
+	}
+}
+
+// detachIdentities frees the user's wallets and email so they can no longer sign in to this account
+func (s *AccountService) detachIdentities(ctx context.Context, userID string) error {
+	if err := s.userRepo.DeleteIdentities(userID); err != nil {
+		return err
+	}
+
+	_, err := s.userRepo.UpdateUser(userID, map[string]interface{}{
+		"wallet_address": nil,
+		"chain_type":     nil,
+	})
+	return err
+}
+
+// revokeTokens ends every session and invalidates the user's Stream tokens
+func (s *AccountService) revokeTokens(ctx context.Context, userID string) error {
+	if err := s.sessionService.RevokeAllSessions(userID, "account_deleted"); err != nil {
+		return err
+	}
+
+	// Users who never connected to Stream have no tokens there
+	if _, err := s.streamService.GetUser(ctx, userID); errors.Is(err, ErrStreamUserNotFound) {
+		return nil
+	}
+
+	now := time.Now()
+	return s.streamService.RevokeUserToken(ctx, userID, &now)
+}
+
+// deleteAIChat removes the user's AI chat channel and its stored messages
+func (s *AccountService) deleteAIChat(ctx context.Context, userID string) error {
+	channelID := "ai-chat-" + userID
+	if err := s.messageRepo.DeleteChannelMessages(channelID); err != nil {
+		return err
+	}
+	return s.streamService.DeleteChannel(ctx, channelID)
+}
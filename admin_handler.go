@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles administrative HTTP requests
+type AdminHandler struct {
+	authService   *AuthService
+	streamService *StreamService
+	apiKeyService *APIKeyService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(authService *AuthService, streamService *StreamService, apiKeyService *APIKeyService) *AdminHandler {
+	return &AdminHandler{
+		authService:   authService,
+		streamService: streamService,
+		apiKeyService: apiKeyService,
+	}
+}
+
+// UpdateUserRole handles role changes
+// @Summary Change a user's role
+// @Description Set a user's role to user, moderator or admin and sync it to Stream Chat. Requires the users:admin permission.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param user_id path string true "User ID"
+// @Param request body UpdateRoleRequest true "New role"
+// @Success 200 {object} User "Updated user"
+// @Failure 400 {object} ErrorResponse "Invalid role"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Role update failed"
+// @Router /admin/users/{user_id}/role [put]
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	role, err := ParseRole(req.Role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_role",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Admins can't demote themselves, so there is always someone left to fix mistakes
+	userID := c.Param("user_id")
+	if userID == CallerID(c) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "cannot_change_own_role",
+			Message: "Admins cannot change their own role",
+		})
+		return
+	}
+
+	if _, err := h.authService.GetUser(userID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "user_not_found",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	user, err := h.authService.SetUserRole(userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "role_update_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Keep the Stream Chat role in sync with ours
+	if err := h.streamService.CreateOrUpdateUser(c.Request.Context(), user); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "stream_sync_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateAPIKey handles API key creation
+// @Summary Create API key
+// @Description Create a scoped API key for service-to-service calls. Callers can only grant scopes they hold themselves. The raw key is only returned once.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body CreateAPIKeyRequest true "API key name, scopes and expiry"
+// @Success 201 {object} CreateAPIKeyResponse "Created API key"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "API key creation failed"
+// @Router /admin/api-keys [post]
+func (h *AdminHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	scopes := make([]Permission, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		scope, err := ParsePermission(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_scope",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		// Prevent privilege escalation through new keys
+		if !CallerCan(c, scope) {
+			RespondAuthorizationError(c, ErrForbidden)
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	key, secret, err := h.apiKeyService.CreateKey(req.Name, scopes, CallerID(c), expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "api_key_creation_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{
+		APIKey: *key,
+		Key:    secret,
+	})
+}
+
+// ListAPIKeys handles listing API keys
+// @Summary List API keys
+// @Description List all API keys with their scopes and last use. Key values are never returned.
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} APIKey "API keys"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to list API keys"
+// @Router /admin/api-keys [get]
+func (h *AdminHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeyService.ListKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "failed_to_list_api_keys",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey handles API key revocation
+// @Summary Revoke API key
+// @Description Revoke an API key so it can no longer be used
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param key_id path string true "API key ID"
+// @Success 200 {object} object{message=string} "API key revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Revocation failed"
+// @Router /admin/api-keys/{key_id} [delete]
+func (h *AdminHandler) RevokeAPIKey(c *gin.Context) {
+	if err := h.apiKeyService.RevokeKey(c.Param("key_id")); err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "api_key_not_found",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "api_key_revocation_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked",
+	})
+}
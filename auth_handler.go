@@ -1,27 +1,32 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
 	authService   *AuthService
 	streamService *StreamService
+	apiKeyService *APIKeyService
 }
 
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(authService *AuthService, streamService *StreamService) *AuthHandler {
+func NewAuthHandler(authService *AuthService, streamService *StreamService, apiKeyService *APIKeyService) *AuthHandler {
 	return &AuthHandler{
 		authService:   authService,
 		streamService: streamService,
+		apiKeyService: apiKeyService,
 	}
 }
 
 // createAuthResponse creates a complete authentication response with Stream token
-func (h *AuthHandler) createAuthResponse(c *gin.Context, user *User, token string, statusCode int) {
+func (h *AuthHandler) createAuthResponse(c *gin.Context, user *User, tokens *TokenPair, statusCode int) {
 	// Create Stream Chat token
 	streamToken, err := h.streamService.CreateToken(user.ID, nil)
 	if err != nil {
@@ -58,15 +63,49 @@ func (h *AuthHandler) createAuthResponse(c *gin.Context, user *User, token strin
 	}
 
 	c.JSON(statusCode, AuthResponse{
-		User:        *user,
-		Token:       token,
-		StreamToken: streamToken,
+		User:         *user,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+		StreamToken:  streamToken,
 	})
 }
 
+// GetNonce issues a nonce for a Sign-In with Ethereum message
+// @Summary Get sign-in nonce
+// @Description Issue a single-use nonce to embed in an EIP-4361 (SIWE) or Sign-In with Solana message. The nonce is bound to the returned domain and chain ID and expires after a few minutes.
+// @Tags Authentication
+// @Produce json
+// @Param chain query string false "Wallet chain: evm or solana" default(evm)
+// @Success 200 {object} NonceResponse "Nonce issued"
+// @Failure 400 {object} ErrorResponse "Unsupported chain"
+// @Failure 500 {object} ErrorResponse "Nonce generation failed"
+// @Router /auth/nonce [get]
+func (h *AuthHandler) GetNonce(c *gin.Context) {
+	chain := ChainType(c.DefaultQuery("chain", string(ChainEVM)))
+	if _, err := GetWalletVerifier(chain); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "unsupported_chain",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	nonce, err := h.authService.IssueNonce(chain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "nonce_generation_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, nonce)
+}
+
 // Login handles user login
 // @Summary User login
-// @Description Authenticate user by username or wallet address
+// @Description Authenticate an Ethereum or Solana wallet with a signed SIWE/SIWS message. The message must embed a nonce from /auth/nonce.
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -74,6 +113,7 @@ func (h *AuthHandler) createAuthResponse(c *gin.Context, user *User, token strin
 // @Success 200 {object} AuthResponse "Successfully authenticated"
 // @Failure 400 {object} ErrorResponse "Invalid request"
 // @Failure 401 {object} ErrorResponse "Authentication failed"
+// @Failure 403 {object} ErrorResponse "User is banned"
 // @Failure 500 {object} ErrorResponse "Stream token error"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -85,12 +125,16 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		})
 		return
 	}
-	
-	// Debug logging
-	println("Login request - WalletAddress:", req.WalletAddress)
 
 	// Authenticate user
-	user, token, err := h.authService.Login(&req)
+	user, tokens, err := h.authService.Login(&req, clientInfo(c))
+	if errors.Is(err, ErrUserBanned) {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Error:   "user_banned",
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, ErrorResponse{
 			Error:   "authentication_failed",
@@ -99,18 +143,19 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	h.createAuthResponse(c, user, token, http.StatusOK)
+	h.createAuthResponse(c, user, tokens, http.StatusOK)
 }
 
 // Register handles user registration
 // @Summary User registration
-// @Description Create a new user account
+// @Description Create a new user account for the wallet that signed the SIWE message
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param request body RegisterRequest true "Registration data"
 // @Success 201 {object} AuthResponse "Successfully registered"
 // @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Signature verification failed"
 // @Failure 409 {object} ErrorResponse "Registration failed"
 // @Failure 500 {object} ErrorResponse "Stream token error"
 // @Router /auth/register [post]
@@ -125,19 +170,189 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Create user account
-	user, token, err := h.authService.Register(&req)
+	user, tokens, err := h.authService.Register(&req, clientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusConflict, ErrorResponse{
+		status := http.StatusUnauthorized
+		if errors.Is(err, ErrUserExists) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, ErrorResponse{
 			Error:   "registration_failed",
 			Message: err.Error(),
 		})
 		return
 	}
 
-	h.createAuthResponse(c, user, token, http.StatusCreated)
+	h.createAuthResponse(c, user, tokens, http.StatusCreated)
 }
 
-// AuthMiddleware validates JWT tokens
+// Refresh exchanges a refresh token for a new access token
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Refresh tokens are single-use; reusing one revokes its session.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "Refresh token"
+// @Success 200 {object} TokenPair "New token pair"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Invalid, expired or reused refresh token"
+// @Failure 403 {object} ErrorResponse "User is banned"
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(req.RefreshToken)
+	if errors.Is(err, ErrUserBanned) {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Error:   "user_banned",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		errorCode := "invalid_refresh_token"
+		if errors.Is(err, ErrRefreshTokenReused) {
+			errorCode = "refresh_token_reused"
+		}
+		c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error:   errorCode,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout revokes the current session and the user's Stream tokens
+// @Summary Logout
+// @Description Revoke the current session (or all sessions) and the user's Stream Chat tokens
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body LogoutRequest false "Logout options"
+// @Success 200 {object} object{message=string} "Logged out"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 500 {object} ErrorResponse "Logout failed"
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req LogoutRequest
+	// Body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	userID := c.GetString("user_id")
+	if err := h.authService.Logout(userID, c.GetString("session_id"), req.AllSessions); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "logout_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Kill Stream tokens issued up to now so the chat connection dies with the session
+	now := time.Now()
+	if err := h.streamService.RevokeUserToken(c.Request.Context(), userID, &now); err != nil {
+		c.Header("X-Stream-Warning", "Failed to revoke Stream token: "+err.Error())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// ListSessions lists the caller's active sessions
+// @Summary List sessions
+// @Description List the active sessions of the authenticated user
+// @Tags Authentication
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} Session "Active sessions"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 500 {object} ErrorResponse "Failed to list sessions"
+// @Router /auth/sessions [get]
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.authService.ListSessions(c.GetString("user_id"), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "sessions_retrieval_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession revokes one of the caller's sessions
+// @Summary Revoke session
+// @Description Revoke one of the authenticated user's sessions, e.g. a lost device
+// @Tags Authentication
+// @Produce json
+// @Security Bearer
+// @Param session_id path string true "Session ID"
+// @Success 200 {object} object{message=string} "Session revoked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 404 {object} ErrorResponse "Session not found"
+// @Router /auth/sessions/{session_id} [delete]
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	err := h.authService.RevokeSession(c.GetString("user_id"), c.Param("session_id"))
+	if errors.Is(err, ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "session_not_found",
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "session_revocation_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// JWKS publishes the public keys access tokens can be verified with
+// @Summary JSON Web Key Set
+// @Description Public keys (RS256/EdDSA) for verifying access tokens issued by this API, selected by the token's kid header. Retired keys stay listed until their tokens expire.
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} JWKS "Verification keys"
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.authService.JWKS())
+}
+
+// clientInfo extracts the client details recorded on new sessions
+func clientInfo(c *gin.Context) ClientInfo {
+	return ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// AuthMiddleware validates JWT tokens or API keys. Users get "user_id", "session_id"
+// and "role" set; API keys get "api_key_id" and "scopes" and no user.
 func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -154,7 +369,24 @@ func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 			tokenString = authHeader[7:]
 		}
 
-		userID, err := h.authService.ValidateJWT(tokenString)
+		if IsAPIKey(tokenString) {
+			key, err := h.apiKeyService.Authenticate(tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, ErrorResponse{
+					Error:   "invalid_api_key",
+					Message: err.Error(),
+				})
+				c.Abort()
+				return
+			}
+
+			c.Set("api_key_id", key.ID)
+			c.Set("scopes", key.Scopes)
+			c.Next()
+			return
+		}
+
+		claims, err := h.authService.ParseJWT(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, ErrorResponse{
 				Error:   "invalid_token",
@@ -164,7 +396,40 @@ func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user_id", userID)
+		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("role", string(claims.Role.OrDefault()))
 		c.Next()
 	}
+}
+
+// WebSocketTokenProtocol is the subprotocol a WebSocket client offers, followed by its
+// access token, to authenticate: new WebSocket(url, ["access_token", token])
+const WebSocketTokenProtocol = "access_token"
+
+// WebSocketAuthMiddleware authenticates WebSocket upgrades like AuthMiddleware. Browsers
+// can't set headers on an upgrade, so the token may also come as the access_token query
+// parameter or, to keep it out of URLs and logs, after WebSocketTokenProtocol in the
+// Sec-WebSocket-Protocol header.
+func (h *AuthHandler) WebSocketAuthMiddleware() gin.HandlerFunc {
+	authenticate := h.AuthMiddleware()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := webSocketToken(c.Request); token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		authenticate(c)
+	}
+}
+
+// webSocketToken returns the access token of a WebSocket upgrade request, if it has one
+func webSocketToken(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == WebSocketTokenProtocol {
+			return protocols[i+1]
+		}
+	}
+	return r.URL.Query().Get("access_token")
 }
\ No newline at end of file
@@ -2,82 +2,247 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// Auth errors
+var (
+	ErrUserExists = errors.New("user already exists")
+	ErrUserBanned = errors.New("user is banned")
+)
+
+// AuthConfig holds the settings used to issue and verify credentials
+type AuthConfig struct {
+	JWTSecret     string  // HS256 secret; optional once SigningKeys is set
+	SigningKeys   *KeySet // Asymmetric keys, published at /.well-known/jwks.json
+	Issuer        string  // "iss" claim set on and required of access tokens, if non-empty
+	DevMode       bool    // Allows booting with DefaultJWTSecret
+	SIWEDomain    string  // Domain wallets must sign in for (EIP-4361 "domain")
+	SIWEChainID   int     // EVM chain ID nonces are bound to
+	SolanaCluster string  // Solana cluster nonces are bound to (e.g. "mainnet")
+}
+
 // AuthService handles authentication operations
 type AuthService struct {
-	jwtSecret       string
-	supabaseService *SupabaseService
+	jwtSecret      string
+	signingKeys    *KeySet
+	issuer         string
+	siweDomain     string
+	siweChainID    int
+	solanaCluster  string
+	userRepo       UserRepository
+	sessionService *SessionService
 }
 
-// NewAuthService creates a new authentication service
-func NewAuthService(jwtSecret string, supabaseService *SupabaseService) *AuthService {
-	if jwtSecret == "" {
-		jwtSecret = DefaultJWTSecret
+// NewAuthService creates a new authentication service. It refuses to run with the
+// well-known default secret unless dev mode is enabled.
+func NewAuthService(config AuthConfig, userRepo UserRepository, sessionService *SessionService) (*AuthService, error) {
+	if config.JWTSecret == "" && config.SigningKeys == nil {
+		if !config.DevMode {
+			return nil, errors.New("no JWT signing key configured: set JWT_KEYS_DIR or JWT_SECRET")
+		}
+		log.Println("Warning: using default JWT secret, do not run this in production")
+		config.JWTSecret = DefaultJWTSecret
+	}
+	if config.JWTSecret == DefaultJWTSecret && !config.DevMode {
+		return nil, errors.New("refusing to start with the default JWT secret outside dev mode")
+	}
+	if config.SIWEDomain == "" {
+		config.SIWEDomain = DefaultSIWEDomain
+	}
+	if config.SIWEChainID == 0 {
+		config.SIWEChainID = DefaultSIWEChainID
+	}
+	if config.SolanaCluster == "" {
+		config.SolanaCluster = DefaultSolanaCluster
 	}
 	
 	return &AuthService{
-		jwtSecret:       jwtSecret,
-		supabaseService: supabaseService,
-	}
+		jwtSecret:      config.JWTSecret,
+		signingKeys:    config.SigningKeys,
+		issuer:         config.Issuer,
+		siweDomain:     config.SIWEDomain,
+		siweChainID:    config.SIWEChainID,
+		solanaCluster:  config.SolanaCluster,
+		userRepo:       userRepo,
+		sessionService: sessionService,
+	}, nil
 }
 
 // JWTClaims represents JWT token claims
 type JWTClaims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
+	Role      Role   `json:"role"`
 	jwt.RegisteredClaims
 }
 
-// Login authenticates a user by wallet address only
-func (a *AuthService) Login(req *LoginRequest) (*User, string, error) {
-	if req.WalletAddress == "" {
-		return nil, "", errors.New("wallet address required")
+// chainID returns the chain ID sign-in messages for a chain must carry
+func (a *AuthService) chainID(chain ChainType) (string, error) {
+	switch chain {
+	case ChainEVM:
+		return strconv.Itoa(a.siweChainID), nil
+	case ChainSolana:
+		return a.solanaCluster, nil
+	default:
+		return "", fmt.Errorf("unsupported chain type %q", chain)
+	}
+}
+
+// IssueNonce creates a single-use nonce bound to the configured domain and the chain's ID
+func (a *AuthService) IssueNonce(chain ChainType) (*NonceResponse, error) {
+	if chain == "" {
+		chain = ChainEVM
+	}
+
+	chainID, err := a.chainID(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := GenerateNonce(NonceLength)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	authNonce := &AuthNonce{
+		Nonce:     nonce,
+		Domain:    a.siweDomain,
+		ChainType: chain,
+		ChainID:   chainID,
+		ExpiresAt: now.Add(NonceTTL),
+	}
+
+	if err := a.userRepo.CreateNonce(authNonce); err != nil {
+		return nil, err
+	}
+
+	// Opportunistically clean up nonces nobody redeemed
+	if err := a.userRepo.DeleteExpiredNonces(); err != nil {
+		log.Printf("[AUTH] Failed to delete expired nonces: %v", err)
+	}
+
+	return &NonceResponse{
+		Nonce:     authNonce.Nonce,
+		Domain:    authNonce.Domain,
+		ChainType: authNonce.ChainType,
+		ChainID:   authNonce.ChainID,
+		IssuedAt:  now,
+		ExpiresAt: authNonce.ExpiresAt,
+	}, nil
+}
+
+// VerifySIWE checks a signed SIWE/SIWS message and returns the wallet that signed it.
+// The message nonce is consumed, so each message can only be used once.
+func (a *AuthService) VerifySIWE(message, signature string) (WalletIdentity, error) {
+	siweMsg, err := ParseSIWEMessage(message)
+	if err != nil {
+		return WalletIdentity{}, err
+	}
+
+	chainID, err := a.chainID(siweMsg.Chain)
+	if err != nil {
+		return WalletIdentity{}, err
+	}
+
+	now := time.Now()
+	if err := siweMsg.Validate(a.siweDomain, chainID, now); err != nil {
+		return WalletIdentity{}, err
+	}
+
+	wallet, err := NewWalletIdentity(siweMsg.Chain, siweMsg.Address)
+	if err != nil {
+		return WalletIdentity{}, err
+	}
+
+	// Consume the nonce before checking the signature so a failed attempt can't be retried
+	nonce, err := a.userRepo.ConsumeNonce(siweMsg.Nonce)
+	if err != nil {
+		return WalletIdentity{}, err
+	}
+	if nonce == nil {
+		return WalletIdentity{}, errors.New("unknown or already used nonce")
+	}
+	if now.After(nonce.ExpiresAt) {
+		return WalletIdentity{}, errors.New("nonce has expired")
+	}
+	if !strings.EqualFold(nonce.Domain, siweMsg.Domain) || nonce.ChainType != siweMsg.Chain || nonce.ChainID != siweMsg.ChainID {
+		return WalletIdentity{}, errors.New("nonce was issued for a different domain or chain")
+	}
+
+	verifier, err := GetWalletVerifier(wallet.Chain)
+	if err != nil {
+		return WalletIdentity{}, err
+	}
+	if err := verifier.VerifySignature(wallet.Address, message, signature); err != nil {
+		return WalletIdentity{}, err
+	}
+
+	return wallet, nil
+}
+
+// Login authenticates a user by a signed SIWE/SIWS message and starts a session
+func (a *AuthService) Login(req *LoginRequest, client ClientInfo) (*User, *TokenPair, error) {
+	wallet, err := a.VerifySIWE(req.Message, req.Signature)
+	if err != nil {
+		return nil, nil, err
 	}
 	
-	// Look up user by wallet address
-	user, err := a.supabaseService.GetUserByWallet(req.WalletAddress)
+	// Look up user by wallet
+	user, err := a.userRepo.GetUserByWallet(wallet)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	
-	// If user doesn't exist, auto-create with wallet address
+	// Banned users can't start new sessions
+	if user != nil && user.IsBanned(time.Now()) {
+		return nil, nil, ErrUserBanned
+	}
+
+	// If user doesn't exist, auto-create now that wallet ownership is proven
 	if user == nil {
 		newUser := &User{
-			WalletAddress: req.WalletAddress,
+			WalletAddress: wallet.Address,
+			ChainType:     wallet.Chain,
 			Name:          "User", // Simple default name
 		}
 		
-		user, err = a.supabaseService.CreateUser(newUser)
+		user, err = a.userRepo.CreateUser(newUser)
 		if err != nil {
-			return nil, "", err
+			return nil, nil, err
 		}
 	}
 
-	token, err := a.GenerateJWT(user.ID)
+	tokens, err := a.startSession(user, client)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil
 }
 
-// Register creates a new user account
-func (a *AuthService) Register(req *RegisterRequest) (*User, string, error) {
-	if req.WalletAddress == "" {
-		return nil, "", errors.New("wallet address required")
+// Register creates a new user account for the wallet that signed the SIWE/SIWS message
+func (a *AuthService) Register(req *RegisterRequest, client ClientInfo) (*User, *TokenPair, error) {
+	wallet, err := a.VerifySIWE(req.Message, req.Signature)
+	if err != nil {
+		return nil, nil, err
 	}
 	
-	// Check if user already exists by wallet address only
-	existingUser, err := a.supabaseService.GetUserByWallet(req.WalletAddress)
+	// Check if user already exists by wallet only
+	existingUser, err := a.userRepo.GetUserByWallet(wallet)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	
 	if existingUser != nil {
-		return nil, "", errors.New("user already exists")
+		return nil, nil, ErrUserExists
 	}
 
 	// Set defaults
@@ -88,58 +253,199 @@ func (a *AuthService) Register(req *RegisterRequest) (*User, string, error) {
 
 	user := &User{
 		Name:          name,
-		WalletAddress: req.WalletAddress,
+		WalletAddress: wallet.Address,
+		ChainType:     wallet.Chain,
 		ProfilePicURL: req.ProfilePicURL,
 		Bio:           req.Bio,
 	}
 
-	createdUser, err := a.supabaseService.CreateUser(user)
+	createdUser, err := a.userRepo.CreateUser(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := a.startSession(createdUser, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return createdUser, tokens, nil
+}
+
+// startSession creates a session and issues its first access and refresh tokens
+func (a *AuthService) startSession(user *User, client ClientInfo) (*TokenPair, error) {
+	session, refreshToken, err := a.sessionService.CreateSession(user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.issueTokenPair(user, session.ID, refreshToken)
+}
+
+// issueTokenPair signs an access token for a session and pairs it with its refresh token
+func (a *AuthService) issueTokenPair(user *User, sessionID, refreshToken string) (*TokenPair, error) {
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	accessToken, err := a.GenerateJWT(user.ID, sessionID, user.Role, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+		SessionID:    sessionID,
+	}, nil
+}
+
+// Refresh rotates a refresh token and issues a new access token for its session.
+// The user is reloaded so role changes and bans take effect on the next refresh.
+func (a *AuthService) Refresh(refreshToken string) (*TokenPair, error) {
+	session, newRefreshToken, err := a.sessionService.RotateRefreshToken(refreshToken)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	token, err := a.GenerateJWT(createdUser.ID)
+	user, err := a.GetUser(session.UserID)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	if user.IsBanned(time.Now()) {
+		if err := a.sessionService.RevokeSession(user.ID, session.ID, "banned"); err != nil {
+			log.Printf("[AUTH] Failed to revoke session %s of banned user %s: %v", session.ID, user.ID, err)
+		}
+		return nil, ErrUserBanned
 	}
 
-	return createdUser, token, nil
+	return a.issueTokenPair(user, session.ID, newRefreshToken)
 }
 
-// GenerateJWT creates a JWT token for a user
-func (a *AuthService) GenerateJWT(userID string) (string, error) {
+// Logout revokes the caller's session, or all of the user's sessions
+func (a *AuthService) Logout(userID, sessionID string, allSessions bool) error {
+	if allSessions {
+		return a.sessionService.RevokeAllSessions(userID, "logout_all")
+	}
+	return a.sessionService.RevokeSession(userID, sessionID, "logout")
+}
+
+// ListSessions returns the user's active sessions, flagging the caller's own
+func (a *AuthService) ListSessions(userID, currentSessionID string) ([]Session, error) {
+	sessions, err := a.sessionService.ListSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes one of the user's sessions by ID
+func (a *AuthService) RevokeSession(userID, sessionID string) error {
+	return a.sessionService.RevokeSession(userID, sessionID, "revoked_by_user")
+}
+
+// GenerateJWT creates a JWT access token for a user session. Tokens are signed with
+// the active asymmetric key (with its kid in the header) when one is configured,
+// otherwise with the HS256 secret.
+func (a *AuthService) GenerateJWT(userID, sessionID string, role Role, expiresAt time.Time) (string, error) {
 	claims := &JWTClaims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      role.OrDefault(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			Issuer:    a.issuer,
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	if a.signingKeys != nil {
+		key := a.signingKeys.Active()
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.PrivateKey)
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(a.jwtSecret))
 }
 
-// ValidateJWT validates a JWT token and returns the user ID
-func (a *AuthService) ValidateJWT(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(a.jwtSecret), nil
-	})
+// verificationKey picks the key to verify a token with from its kid and algorithm
+func (a *AuthService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && a.signingKeys != nil {
+		key, found := a.signingKeys.Lookup(kid)
+		if !found {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+		return key.PublicKey, nil
+	}
+
+	// Tokens without a kid are HS256 tokens signed with the shared secret
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || a.jwtSecret == "" {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return []byte(a.jwtSecret), nil
+}
+
+// JWKS returns the public verification keys, empty when only HS256 is configured
+func (a *AuthService) JWKS() JWKS {
+	if a.signingKeys == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return a.signingKeys.JWKS()
+}
+
+// ParseJWT validates a JWT token and its session, returning the claims
+func (a *AuthService) ParseJWT(tokenString string) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, a.verificationKey)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims.UserID, nil
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+
+	// Reject tokens whose session was logged out or revoked
+	if claims.SessionID == "" {
+		return nil, errors.New("token has no session")
+	}
+	session, err := a.sessionService.GetActiveSession(claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.UserID != claims.UserID {
+		return nil, errors.New("session has been revoked or expired")
 	}
 
-	return "", errors.New("invalid token")
+	return claims, nil
+}
+
+// ValidateJWT validates a JWT token and returns the user ID
+func (a *AuthService) ValidateJWT(tokenString string) (string, error) {
+	claims, err := a.ParseJWT(tokenString)
+	if err != nil {
+		return "", err
+	}
+	return claims.UserID, nil
 }
 
 // GetUser retrieves a user by ID
 func (a *AuthService) GetUser(userID string) (*User, error) {
-	user, err := a.supabaseService.GetUserByID(userID)
+	user, err := a.userRepo.GetUserByID(userID)
 	if err != nil {
 		return nil, err
 	}
@@ -153,5 +459,23 @@ func (a *AuthService) GetUser(userID string) (*User, error) {
 
 // UpdateUser updates user information
 func (a *AuthService) UpdateUser(userID string, updates map[string]interface{}) (*User, error) {
-	return a.supabaseService.UpdateUser(userID, updates)
+	return a.userRepo.UpdateUser(userID, updates)
+}
+
+// SetUserRole changes a user's role. Existing access tokens keep the old role
+// until they are refreshed, at most AccessTokenTTL later.
+func (a *AuthService) SetUserRole(userID string, role Role) (*User, error) {
+	if _, err := a.GetUser(userID); err != nil {
+		return nil, err
+	}
+
+	user, err := a.userRepo.UpdateUser(userID, map[string]interface{}{
+		"role": role,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	log.Printf("[AUTH] Role of user %s changed to %s", userID, role)
+	return user, nil
 }
\ No newline at end of file
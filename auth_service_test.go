@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// testWallet is an Ethereum wallet that signs sign-in messages like personal_sign
+type testWallet struct {
+	key     *secp256k1.PrivateKey
+	address string
+}
+
+func newTestWallet(t *testing.T) *testWallet {
+	t.Helper()
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	addr := keccak256(key.PubKey().SerializeUncompressed()[1:])[12:]
+	return &testWallet{key: key, address: ChecksumAddress("0x" + hex.EncodeToString(addr))}
+}
+
+// sign returns the r || s || v signature a wallet gives for a message
+func (w *testWallet) sign(message string) string {
+	compact := ecdsa.SignCompact(w.key, personalSignHash(message), false)
+	sig := append(compact[1:], compact[0])
+	return "0x" + hex.EncodeToString(sig)
+}
+
+// siweMessage writes an EIP-4361 message for a nonce issued by /auth/nonce
+func siweMessage(address string, nonce *NonceResponse) string {
+	return fmt.Sprintf(`%s wants you to sign in with your Ethereum account:
+%s
+
+Sign in to Social Messenger.
+
+URI: http://%s
+Version: 1
+Chain ID: %s
+Nonce: %s
+Issued At: %s`, nonce.Domain, address, nonce.Domain, nonce.ChainID, nonce.Nonce, nonce.IssuedAt.Format(time.RFC3339))
+}
+
+func newTestAuthService(t *testing.T) (*AuthService, *MemoryUserRepository) {
+	t.Helper()
+	repo := NewMemoryUserRepository()
+	authService, err := NewAuthService(AuthConfig{JWTSecret: "test-secret"}, repo, NewSessionService(repo))
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+	return authService, repo
+}
+
+// login signs in with a fresh nonce
+func login(t *testing.T, authService *AuthService, wallet *testWallet) (*User, *TokenPair) {
+	t.Helper()
+	nonce, err := authService.IssueNonce(ChainEVM)
+	if err != nil {
+		t.Fatalf("IssueNonce: %v", err)
+	}
+	message := siweMessage(wallet.address, nonce)
+	user, tokens, err := authService.Login(&LoginRequest{Message: message, Signature: wallet.sign(message)}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return user, tokens
+}
+
+func TestLoginCreatesUserAndSession(t *testing.T) {
+	authService, repo := newTestAuthService(t)
+	wallet := newTestWallet(t)
+
+	user, tokens := login(t, authService, wallet)
+	if !strings.EqualFold(user.WalletAddress, wallet.address) || user.ChainType != ChainEVM {
+		t.Errorf("user wallet = %s on %s, want %s on %s", user.WalletAddress, user.ChainType, wallet.address, ChainEVM)
+	}
+
+	claims, err := authService.ParseJWT(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseJWT: %v", err)
+	}
+	if claims.UserID != user.ID || claims.SessionID != tokens.SessionID {
+		t.Errorf("claims = user %s session %s, want user %s session %s", claims.UserID, claims.SessionID, user.ID, tokens.SessionID)
+	}
+	if session, _ := repo.GetSession(tokens.SessionID); session == nil || session.UserID != user.ID {
+		t.Errorf("session %s not stored for user %s", tokens.SessionID, user.ID)
+	}
+
+	// Signing in again finds the same user
+	again, _ := login(t, authService, wallet)
+	if again.ID != user.ID {
+		t.Errorf("second login user = %s, want %s", again.ID, user.ID)
+	}
+}
+
+func TestLoginRejectsInvalidMessages(t *testing.T) {
+	authService, _ := newTestAuthService(t)
+	wallet := newTestWallet(t)
+
+	tests := []struct {
+		name string
+		sign func(nonce *NonceResponse) (message, signature string)
+	}{
+		{"other signer", func(nonce *NonceResponse) (string, string) {
+			message := siweMessage(wallet.address, nonce)
+			return message, newTestWallet(t).sign(message)
+		}},
+		{"tampered message", func(nonce *NonceResponse) (string, string) {
+			message := siweMessage(wallet.address, nonce)
+			return message + "\nRequest ID: 1", wallet.sign(message)
+		}},
+		{"other domain", func(nonce *NonceResponse) (string, string) {
+			other := *nonce
+			other.Domain = "evil.example"
+			message := siweMessage(wallet.address, &other)
+			return message, wallet.sign(message)
+		}},
+		{"other chain", func(nonce *NonceResponse) (string, string) {
+			other := *nonce
+			other.ChainID = "137"
+			message := siweMessage(wallet.address, &other)
+			return message, wallet.sign(message)
+		}},
+		{"unknown nonce", func(nonce *NonceResponse) (string, string) {
+			other := *nonce
+			other.Nonce = "abcdefghijklmnop"
+			message := siweMessage(wallet.address, &other)
+			return message, wallet.sign(message)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce, err := authService.IssueNonce(ChainEVM)
+			if err != nil {
+				t.Fatalf("IssueNonce: %v", err)
+			}
+			message, signature := tt.sign(nonce)
+			if _, _, err := authService.Login(&LoginRequest{Message: message, Signature: signature}, ClientInfo{}); err == nil {
+				t.Error("Login succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestLoginNonceIsSingleUse(t *testing.T) {
+	authService, _ := newTestAuthService(t)
+	wallet := newTestWallet(t)
+
+	nonce, err := authService.IssueNonce(ChainEVM)
+	if err != nil {
+		t.Fatalf("IssueNonce: %v", err)
+	}
+	req := &LoginRequest{Message: siweMessage(wallet.address, nonce)}
+	req.Signature = wallet.sign(req.Message)
+
+	if _, _, err := authService.Login(req, ClientInfo{}); err != nil {
+		t.Fatalf("first Login: %v", err)
+	}
+	if _, _, err := authService.Login(req, ClientInfo{}); err == nil {
+		t.Error("replayed Login succeeded, want error")
+	}
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	authService, _ := newTestAuthService(t)
+	_, tokens := login(t, authService, newTestWallet(t))
+
+	refreshed, err := authService.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if refreshed.RefreshToken == tokens.RefreshToken {
+		t.Error("Refresh returned the same refresh token")
+	}
+	if refreshed.SessionID != tokens.SessionID {
+		t.Errorf("session = %s, want %s", refreshed.SessionID, tokens.SessionID)
+	}
+
+	// The new token rotates in turn
+	if _, err := authService.Refresh(refreshed.RefreshToken); err != nil {
+		t.Errorf("Refresh with rotated token: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	authService, repo := newTestAuthService(t)
+	_, tokens := login(t, authService, newTestWallet(t))
+
+	refreshed, err := authService.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if _, err := authService.Refresh(tokens.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing refresh token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	session, err := repo.GetSession(tokens.SessionID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if session.RevokedAt == nil {
+		t.Error("session not revoked after refresh token reuse")
+	}
+
+	// The token rotated before the reuse is dead with its session
+	if _, err := authService.Refresh(refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after revocation: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestRefreshRejectsUnknownToken(t *testing.T) {
+	authService, _ := newTestAuthService(t)
+	if _, err := authService.Refresh("not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestBannedUserCannotSignIn(t *testing.T) {
+	authService, repo := newTestAuthService(t)
+	wallet := newTestWallet(t)
+	user, tokens := login(t, authService, wallet)
+
+	bannedAt := time.Now().UTC()
+	if _, err := repo.UpdateUser(user.ID, map[string]interface{}{"banned_at": &bannedAt}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	if _, err := authService.Refresh(tokens.RefreshToken); !errors.Is(err, ErrUserBanned) {
+		t.Errorf("Refresh: err = %v, want %v", err, ErrUserBanned)
+	}
+	nonce, err := authService.IssueNonce(ChainEVM)
+	if err != nil {
+		t.Fatalf("IssueNonce: %v", err)
+	}
+	message := siweMessage(wallet.address, nonce)
+	if _, _, err := authService.Login(&LoginRequest{Message: message, Signature: wallet.sign(message)}, ClientInfo{}); !errors.Is(err, ErrUserBanned) {
+		t.Errorf("Login: err = %v, want %v", err, ErrUserBanned)
+	}
+
+	// Expired bans no longer apply
+	expired := bannedAt.Add(-time.Minute)
+	if _, err := repo.UpdateUser(user.ID, map[string]interface{}{"ban_expires_at": &expired}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	login(t, authService, wallet)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrForbidden is returned when the caller may not act on a resource
+var ErrForbidden = errors.New("forbidden")
+
+// Authorizer decides whether the authenticated caller may act on a user or channel.
+// It must run after AuthHandler.AuthMiddleware, which sets the "user_id" context value.
+type Authorizer struct {
+	streamService *StreamService
+}
+
+// NewAuthorizer creates a new authorizer
+func NewAuthorizer(streamService *StreamService) *Authorizer {
+	return &Authorizer{
+		streamService: streamService,
+	}
+}
+
+// AuthorizeUser checks that the caller owns the given user
+func (a *Authorizer) AuthorizeUser(callerID, userID string) error {
+	if callerID == "" || callerID != userID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeChannel checks that the caller is a member of the given channel
+func (a *Authorizer) AuthorizeChannel(ctx context.Context, callerID, channelID string) error {
+	if callerID == "" || channelID == "" {
+		return ErrForbidden
+	}
+
+	// A user's own AI chat channel needs no Stream lookup
+	if channelID == "ai-chat-"+callerID {
+		return nil
+	}
+
+	// Accept CIDs ("messaging:abc") as well as bare channel IDs
+	if i := strings.Index(channelID, ":"); i >= 0 {
+		channelID = channelID[i+1:]
+	}
+
+	isMember, err := a.streamService.IsChannelMember(ctx, channelID, callerID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// RequireUserParam is middleware that only lets the owner of the user in the path param
+// through, or callers holding the override permission
+func (a *Authorizer) RequireUserParam(param string, override Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CallerCan(c, override) {
+			c.Next()
+			return
+		}
+		if err := a.AuthorizeUser(CallerID(c), c.Param(param)); err != nil {
+			RespondAuthorizationError(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireChannelParam is middleware that only lets members of the channel in the path
+// param through, or callers holding the override permission
+func (a *Authorizer) RequireChannelParam(param string, override Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CallerCan(c, override) {
+			c.Next()
+			return
+		}
+		if err := a.AuthorizeChannel(c.Request.Context(), CallerID(c), c.Param(param)); err != nil {
+			RespondAuthorizationError(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission is middleware that only lets callers whose role or API key scopes grant the permission through
+func (a *Authorizer) RequirePermission(permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CallerCan(c, permission) {
+			RespondAuthorizationError(c, ErrForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireUser is middleware that only lets callers signed in as a user through. API keys
+// don't act as a user, so routes about "the current user" reject them.
+func (a *Authorizer) RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CallerID(c) == "" {
+			respondUserRequired(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CallerID returns the authenticated user ID set by AuthMiddleware
+func CallerID(c *gin.Context) string {
+	return c.GetString("user_id")
+}
+
+// CallerRole returns the authenticated user's role set by AuthMiddleware
+func CallerRole(c *gin.Context) Role {
+	return Role(c.GetString("role"))
+}
+
+// CallerCan reports whether the caller holds a permission, through its API key scopes
+// or, for users, its role
+func CallerCan(c *gin.Context, permission Permission) bool {
+	if c.GetString("api_key_id") != "" {
+		value, _ := c.Get("scopes")
+		scopes, _ := value.([]Permission)
+		for _, scope := range scopes {
+			if scope == permission {
+				return true
+			}
+		}
+		return false
+	}
+
+	return CallerID(c) != "" && CallerRole(c).Can(permission)
+}
+
+// RespondAuthorizationError writes a 403 for ErrForbidden and a 500 for lookup failures
+func RespondAuthorizationError(c *gin.Context, err error) {
+	if errors.Is(err, ErrForbidden) {
+		c.JSON(http.StatusForbidden, ErrorResponse{
+			Error:   "forbidden",
+			Message: "You do not have access to this resource",
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Error:   "authorization_failed",
+		Message: err.Error(),
+	})
+}
+
+// respondUserRequired rejects callers that aren't signed in as a user, such as API keys
+func respondUserRequired(c *gin.Context) {
+	c.JSON(http.StatusForbidden, ErrorResponse{
+		Error:   "user_required",
+		Message: "This endpoint requires a user access token",
+	})
+}
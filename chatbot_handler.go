@@ -9,32 +9,42 @@ import (
 
 // ChatbotHandler handles chatbot-related HTTP requests
 type ChatbotHandler struct {
-	messageService *MessageService
+	messageRepo    MessageRepository
 	chatGPTService *ChatGPTService
 	authService    *AuthService
 	streamService  *StreamService
+	authorizer     *Authorizer
+	threadService  *MessageThreadService
+	conversations  *ConversationMachine
 }
 
 // NewChatbotHandler creates a new chatbot handler
-func NewChatbotHandler(messageService *MessageService, chatGPTService *ChatGPTService, authService *AuthService, streamService *StreamService) *ChatbotHandler {
+func NewChatbotHandler(messageRepo MessageRepository, chatGPTService *ChatGPTService, authService *AuthService, streamService *StreamService, authorizer *Authorizer, threadService *MessageThreadService, conversations *ConversationMachine) *ChatbotHandler {
 	return &ChatbotHandler{
-		messageService: messageService,
+		messageRepo:    messageRepo,
 		chatGPTService: chatGPTService,
 		authService:    authService,
 		streamService:  streamService,
+		authorizer:     authorizer,
+		threadService:  threadService,
+		conversations:  conversations,
 	}
 }
 
 // ChatWithBot handles chatbot interaction requests
 // @Summary Chat with AI bot
-// @Description Send a message to the AI chatbot and get a response based on channel history. Specify model in request body (gpt-3.5-turbo or gpt-4).
+// @Description Send a message to the AI chatbot and get a response based on channel history. Specify model in request body (gpt-3.5-turbo or gpt-4). With reply_to_id, the message and response are posted in that message's thread and the thread is used as context instead. Messages drive the same conversation as the Stream AI channel: users without a profile are asked for their name and a profile picture (sent as an image attachment), and matches are proposed and confirmed there.
 // @Tags Chatbot
 // @Accept json
 // @Produce json
+// @Security Bearer
 // @Param request body ChatbotRequest true "Chatbot request"
 // @Success 200 {object} ChatbotResponse "AI response generated"
 // @Failure 400 {object} ErrorResponse "Invalid request"
-// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a member of the channel, or not a user"
+// @Failure 404 {object} ErrorResponse "User or replied-to message not found"
+// @Failure 409 {object} ErrorResponse "Replied-to message was deleted"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /chatbot/chat [post]
 func (h *ChatbotHandler) ChatWithBot(c *gin.Context) {
@@ -47,8 +57,16 @@ func (h *ChatbotHandler) ChatWithBot(c *gin.Context) {
 		return
 	}
 
+	userID := CallerID(c)
+
+	// The caller must belong to the channel they are chatting in
+	if err := h.authorizer.AuthorizeChannel(c.Request.Context(), userID, req.ChannelID); err != nil {
+		RespondAuthorizationError(c, err)
+		return
+	}
+
 	// Get user info for message creation
-	user, err := h.authService.GetUser(req.UserID)
+	user, err := h.authService.GetUser(userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{
 			Error:   "user_not_found",
@@ -57,127 +75,30 @@ func (h *ChatbotHandler) ChatWithBot(c *gin.Context) {
 		return
 	}
 
-	// Check if user needs profile setup
-	if h.chatGPTService.NeedsProfileSetup(user) {
-		// Try to parse profile information from the message and attachments
-		var attachments []StreamMessageAttachment
-		// Note: You would need to get attachments from the request or Stream webhook
-		// For now, we'll assume empty attachments and handle in webhook
-		
-		profile, err := h.chatGPTService.ParseProfileFromStreamMessage(req.Message, attachments)
+	// Replies are posted in the thread of the message replied to
+	var thread *Message
+	var replyToID *string
+	if req.ReplyToID != "" {
+		thread, err = h.threadService.ReplyTarget(req.ReplyToID, req.ChannelID)
 		if err != nil {
-			// If parsing fails, ask for profile setup
-			response, err := h.chatGPTService.GenerateProfileSetupResponse(user)
-			if err != nil {
-				response = "Hi! Welcome to the chat! To get started, please share your name and upload a profile picture. What's your name?"
-			}
-			
-			// Store the bot's profile setup request
-			botMessage := &Message{
-				MessageText:    response,
-				SenderID:       "chatbot",
-				SenderUsername: "AI Assistant",
-				ChannelID:      req.ChannelID,
-				MessageType:    "assistant",
-				Type:           "text",
-			}
-			
-			createdBotMessage, err := h.messageService.CreateMessage(botMessage)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{
-					Error:   "failed_to_store_bot_response",
-					Message: err.Error(),
-				})
-				return
-			}
-			
-			c.JSON(http.StatusOK, ChatbotResponse{
-				Response:  response,
-				MessageID: createdBotMessage.ID,
-			})
-			return
-		}
-		
-		// Validate the parsed profile
-		if err := h.chatGPTService.ValidateProfileData(profile); err != nil {
-			// If validation fails, ask for complete information
-			response := fmt.Sprintf("I need a bit more information to set up your profile. %s Please share your name and upload a profile picture.", err.Error())
-			
-			botMessage := &Message{
-				MessageText:    response,
-				SenderID:       "chatbot", 
-				SenderUsername: "AI Assistant",
-				ChannelID:      req.ChannelID,
-				MessageType:    "assistant",
-				Type:           "text",
-			}
-			
-			createdBotMessage, err := h.messageService.CreateMessage(botMessage)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{
-					Error:   "failed_to_store_bot_response", 
-					Message: err.Error(),
-				})
-				return
-			}
-			
-			c.JSON(http.StatusOK, ChatbotResponse{
-				Response:  response,
-				MessageID: createdBotMessage.ID,
-			})
-			return
-		}
-		
-		// If we have complete profile data, update the user
-		if h.chatGPTService.IsProfileComplete(profile) {
-			if err := h.chatGPTService.UpdateUserProfileInDB(user.ID, profile, h.authService.supabaseService, h.streamService); err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{
-					Error:   "failed_to_update_profile",
-					Message: err.Error(),
-				})
-				return
-			}
-			
-			// Generate confirmation message
-			response := h.chatGPTService.GenerateProfileConfirmationMessage(profile)
-			
-			botMessage := &Message{
-				MessageText:    response,
-				SenderID:       "chatbot",
-				SenderUsername: "AI Assistant", 
-				ChannelID:      req.ChannelID,
-				MessageType:    "assistant",
-				Type:           "text",
-			}
-			
-			createdBotMessage, err := h.messageService.CreateMessage(botMessage)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{
-					Error:   "failed_to_store_bot_response",
-					Message: err.Error(),
-				})
-				return
-			}
-			
-			c.JSON(http.StatusOK, ChatbotResponse{
-				Response:  response,
-				MessageID: createdBotMessage.ID,
-			})
+			respondThreadError(c, err)
 			return
 		}
+		replyToID = &thread.ID
 	}
 
 	// Store the user's message first
 	userMessage := &Message{
 		MessageText:    req.Message,
-		SenderID:       req.UserID,
+		SenderID:       userID,
 		SenderUsername: user.Username,
 		ChannelID:      req.ChannelID,
 		MessageType:    "user",
 		Type:           "text",
+		ReplyToID:      replyToID,
 	}
 
-	_, err = h.messageService.CreateMessage(userMessage)
+	_, err = h.messageRepo.CreateMessage(userMessage)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:   "failed_to_store_message",
@@ -186,8 +107,55 @@ func (h *ChatbotHandler) ChatWithBot(c *gin.Context) {
 		return
 	}
 
-	// Get recent messages for context
-	recentMessages, err := h.messageService.GetRecentChannelMessages(req.ChannelID, DefaultContextLimit)
+	// Move the user's conversation along: onboarding and matching replies come from the
+	// conversation machine, anything else gets a response from the channel context. The
+	// conversation only runs in the user's own AI chat, outside of threads.
+	reply := &ConversationReply{}
+	if req.ChannelID == "ai-chat-"+userID && req.ReplyToID == "" {
+		reply, err = h.conversations.Handle(c.Request.Context(), user, ConversationInput{Text: req.Message, Attachments: req.Attachments})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "conversation_failed",
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+	if reply.Handled {
+		botMessage := &Message{
+			MessageText:    reply.Text,
+			SenderID:       "chatbot",
+			SenderUsername: "AI Assistant",
+			ChannelID:      req.ChannelID,
+			MessageType:    "assistant",
+			Type:           "text",
+			ReplyToID:      replyToID,
+		}
+
+		createdBotMessage, err := h.messageRepo.CreateMessage(botMessage)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "failed_to_store_bot_response",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, ChatbotResponse{
+			Response:  reply.Text,
+			MessageID: createdBotMessage.ID,
+			ReplyToID: createdBotMessage.ReplyToID,
+		})
+		return
+	}
+
+	// Get recent messages for context: the thread when replying, otherwise the channel
+	var recentMessages []Message
+	if thread != nil {
+		recentMessages, err = h.threadService.ThreadContext(thread, DefaultContextLimit)
+	} else {
+		recentMessages, err = h.messageRepo.GetRecentChannelMessages(req.ChannelID, DefaultContextLimit)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:   "failed_to_get_context",
@@ -220,9 +188,10 @@ func (h *ChatbotHandler) ChatWithBot(c *gin.Context) {
 		ChannelID:      req.ChannelID,
 		MessageType:    "assistant",
 		Type:           "text",
+		ReplyToID:      replyToID,
 	}
 
-	createdBotMessage, err := h.messageService.CreateMessage(botMessage)
+	createdBotMessage, err := h.messageRepo.CreateMessage(botMessage)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:   "failed_to_store_bot_response",
@@ -235,24 +204,30 @@ func (h *ChatbotHandler) ChatWithBot(c *gin.Context) {
 	c.JSON(http.StatusOK, ChatbotResponse{
 		Response:  aiResponse,
 		MessageID: createdBotMessage.ID,
+		ReplyToID: createdBotMessage.ReplyToID,
 	})
 }
 
 
-// GetChannelMessages retrieves messages for a channel
+// GetChannelMessages retrieves a page of messages for a channel
 // @Summary Get channel messages
-// @Description Retrieve messages for a specific channel with pagination
+// @Description Retrieve a page of a channel's messages, oldest first, with reply_count on messages that have replies. Without a cursor the newest messages are returned. Pass prev_cursor as before to page back through older messages, or next_cursor as after to fetch newer ones; has_more tells whether more exist in that direction.
 // @Tags Messages
 // @Accept json
 // @Produce json
+// @Security Bearer
 // @Param channel_id path string true "Channel ID"
-// @Param limit query int false "Number of messages to retrieve" default(50)
-// @Param offset query int false "Offset for pagination" default(0)
-// @Success 200 {array} Message "Channel messages"
+// @Param limit query int false "Number of messages to retrieve (max 200)" default(50)
+// @Param before query string false "Cursor: return messages older than this"
+// @Param after query string false "Cursor: return messages newer than this"
+// @Success 200 {object} MessagePage "Channel messages"
 // @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a member of the channel"
 // @Failure 500 {object} ErrorResponse "Internal server error"
 // @Router /messages/channel/{channel_id} [get]
 func (h *ChatbotHandler) GetChannelMessages(c *gin.Context) {
+	// Membership is enforced by Authorizer.RequireChannelParam on the route
 	channelID := c.Param("channel_id")
 	if channelID == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
@@ -262,22 +237,15 @@ func (h *ChatbotHandler) GetChannelMessages(c *gin.Context) {
 		return
 	}
 
-	// Get query parameters with defaults
-	limit := DefaultMessageLimit
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := parseIntParam(l); err == nil && parsed > 0 {
-			limit = parsed
-		}
+	query, ok := messagePageParams(c)
+	if !ok {
+		return
 	}
 
-	offset := 0
-	if o := c.Query("offset"); o != "" {
-		if parsed, err := parseIntParam(o); err == nil && parsed >= 0 {
-			offset = parsed
-		}
+	page, err := h.messageRepo.GetChannelMessages(channelID, query)
+	if err == nil {
+		err = h.threadService.AttachReplyCounts(page.Messages)
 	}
-
-	messages, err := h.messageService.GetChannelMessages(channelID, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:   "failed_to_get_messages",
@@ -286,7 +254,44 @@ func (h *ChatbotHandler) GetChannelMessages(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	c.JSON(http.StatusOK, page)
+}
+
+// messagePageParams reads the limit, before and after query params, answering 400 for bad cursors
+func messagePageParams(c *gin.Context) (MessagePageQuery, bool) {
+	query := MessagePageQuery{Limit: DefaultMessageLimit}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := parseIntParam(l); err == nil && parsed > 0 {
+			query.Limit = parsed
+		}
+	}
+	if query.Limit > MaxMessageLimit {
+		query.Limit = MaxMessageLimit
+	}
+
+	before, after := c.Query("before"), c.Query("after")
+	if before != "" && after != "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_cursor",
+			Message: "Pass either before or after, not both",
+		})
+		return query, false
+	}
+
+	var err error
+	if before != "" {
+		query.Before, err = DecodeMessageCursor(before)
+	} else if after != "" {
+		query.After, err = DecodeMessageCursor(after)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_cursor",
+			Message: "Cursor is malformed; use next_cursor or prev_cursor from a previous page",
+		})
+		return query, false
+	}
+	return query, true
 }
 
 // parseIntParam is a helper function to parse integer parameters
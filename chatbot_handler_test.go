@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// chatbotHarness serves /chatbot/chat on the memory repositories, with a user signed in
+// through SIWE and fake OpenAI and Stream APIs
+type chatbotHarness struct {
+	router      *gin.Engine
+	userRepo    *MemoryUserRepository
+	messageRepo *MemoryMessageRepository
+	openAI      *fakeOpenAI
+	apiKeys     *APIKeyService
+	user        *User
+	token       string
+}
+
+func newChatbotHarness(t *testing.T, reply func(req openai.ChatCompletionRequest) string) *chatbotHarness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	authService, userRepo := newTestAuthService(t)
+	messageRepo := NewMemoryMessageRepository()
+	streamService, _ := newFakeStream(t)
+	chatGPTService, openAI := newFakeOpenAI(t, reply)
+
+	apiKeys := NewAPIKeyService(userRepo)
+	authHandler := NewAuthHandler(authService, streamService, apiKeys)
+	authorizer := NewAuthorizer(streamService)
+	conversations := NewConversationMachine(userRepo, chatGPTService, streamService, NewMatchConsentService(userRepo, streamService, NewJobQueue(NewMemoryJobRepository())))
+	chatbotHandler := NewChatbotHandler(messageRepo, chatGPTService, authService, streamService, authorizer, NewMessageThreadService(messageRepo, userRepo), conversations)
+	router := gin.New()
+	router.POST("/chatbot/chat", authHandler.AuthMiddleware(), authorizer.RequireUser(), chatbotHandler.ChatWithBot)
+
+	user, tokens := login(t, authService, newTestWallet(t))
+	user, err := userRepo.UpdateUser(user.ID, map[string]interface{}{
+		"name":            "Alice",
+		"username":        "alice",
+		"profile_pic_url": "https://example.com/alice.png",
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	return &chatbotHarness{
+		router:      router,
+		userRepo:    userRepo,
+		messageRepo: messageRepo,
+		openAI:      openAI,
+		apiKeys:     apiKeys,
+		user:        user,
+		token:       tokens.AccessToken,
+	}
+}
+
+// chat posts a message to the chatbot as the signed-in user
+func (h *chatbotHarness) chat(t *testing.T, channelID, message string) *httptest.ResponseRecorder {
+	t.Helper()
+	return h.send(t, ChatbotRequest{ChannelID: channelID, Message: message})
+}
+
+// send posts a chatbot request as the signed-in user
+func (h *chatbotHarness) send(t *testing.T, request ChatbotRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(request)
+	req := httptest.NewRequest(http.MethodPost, "/chatbot/chat", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	rec := httptest.NewRecorder()
+	h.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChatWithBotRoundTrip(t *testing.T) {
+	replies := []string{"Try the farmers market!", "It opens at 8."}
+	h := newChatbotHarness(t, func(req openai.ChatCompletionRequest) string {
+		if strings.Contains(req.Messages[0].Content, `"YES"`) {
+			return ""
+		}
+		reply := replies[0]
+		replies = replies[1:]
+		return reply
+	})
+	channelID := "ai-chat-" + h.user.ID
+
+	rec := h.chat(t, channelID, "What should I do this weekend?")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ChatbotResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Response != "Try the farmers market!" || resp.MessageID == "" {
+		t.Errorf("response = %+v, want the model's reply with a message ID", resp)
+	}
+	if got := h.openAI.lastUserMessage(); got != "What should I do this weekend?" {
+		t.Errorf("OpenAI was asked %q", got)
+	}
+
+	// The second message is answered with the first exchange as context
+	if rec := h.chat(t, channelID, "When does it open?"); rec.Code != http.StatusOK {
+		t.Fatalf("second message: status %d: %s", rec.Code, rec.Body.String())
+	}
+	sent := h.openAI.requests[len(h.openAI.requests)-1].Messages
+	var history []string
+	for _, message := range sent[1 : len(sent)-1] {
+		history = append(history, message.Content)
+	}
+	wantHistory := []string{"alice: What should I do this weekend?", "Try the farmers market!", "alice: When does it open?"}
+	if len(history) != len(wantHistory) {
+		t.Fatalf("context = %q, want %q", history, wantHistory)
+	}
+	for i := range wantHistory {
+		if history[i] != wantHistory[i] {
+			t.Errorf("context[%d] = %q, want %q", i, history[i], wantHistory[i])
+		}
+	}
+
+	page, err := h.messageRepo.GetChannelMessages(channelID, MessagePageQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetChannelMessages: %v", err)
+	}
+	stored := page.Messages
+	if len(stored) != 4 {
+		t.Fatalf("stored %d messages, want 4", len(stored))
+	}
+	for _, message := range stored {
+		if message.MessageType == "user" && message.SenderID != h.user.ID {
+			t.Errorf("user message %q stored from %s, want %s", message.MessageText, message.SenderID, h.user.ID)
+		}
+	}
+}
+
+func TestChatWithBotThreadRepliesSkipTheConversation(t *testing.T) {
+	h := newChatbotHarness(t, func(req openai.ChatCompletionRequest) string { return "Sure, happy to help." })
+	channelID := "ai-chat-" + h.user.ID
+
+	if rec := h.chat(t, channelID, "Hello"); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	page, err := h.messageRepo.GetChannelMessages(channelID, MessagePageQuery{Limit: 10})
+	if err != nil || len(page.Messages) == 0 {
+		t.Fatalf("GetChannelMessages: %d messages, %v", len(page.Messages), err)
+	}
+	root := page.Messages[len(page.Messages)-1]
+
+	// A user who still has to onboard is greeted in the channel, but not in a thread
+	if _, err := h.userRepo.UpdateUser(h.user.ID, map[string]interface{}{"profile_pic_url": ""}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	rec := h.send(t, ChatbotRequest{ChannelID: channelID, Message: "About that...", ReplyToID: root.ID})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ChatbotResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Response != "Sure, happy to help." {
+		t.Errorf("response = %q, want the plain chatbot reply", resp.Response)
+	}
+	if state, _ := h.userRepo.GetConversationState(h.user.ID); state != nil && state.State != ConversationIdle {
+		t.Errorf("conversation moved to %s on a thread reply", state.State)
+	}
+}
+
+func TestChatWithBotRequiresChannelMembership(t *testing.T) {
+	h := newChatbotHarness(t, func(req openai.ChatCompletionRequest) string { return "Hi!" })
+
+	if rec := h.chat(t, "ai-chat-someone-else", "Hello"); rec.Code != http.StatusForbidden {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if len(h.openAI.requests) != 0 {
+		t.Errorf("OpenAI called %d times, want 0", len(h.openAI.requests))
+	}
+}
+
+func TestChatWithBotRequiresToken(t *testing.T) {
+	h := newChatbotHarness(t, func(req openai.ChatCompletionRequest) string { return "Hi!" })
+	h.token = "not-a-token"
+
+	if rec := h.chat(t, "ai-chat-"+h.user.ID, "Hello"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestChatWithBotRejectsAPIKeys(t *testing.T) {
+	h := newChatbotHarness(t, func(req openai.ChatCompletionRequest) string { return "Hi!" })
+	_, secret, err := h.apiKeys.CreateKey("cron", []Permission{PermissionChat, PermissionReadMessages}, h.user.ID, nil)
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	h.token = secret
+
+	rec := h.chat(t, "ai-chat-"+h.user.ID, "Hello")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "user_required") {
+		t.Errorf("status %d: %s, want %d user_required", rec.Code, rec.Body.String(), http.StatusForbidden)
+	}
+	if len(h.openAI.requests) != 0 {
+		t.Errorf("OpenAI called %d times, want 0", len(h.openAI.requests))
+	}
+}
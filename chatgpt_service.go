@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
@@ -11,17 +13,67 @@ import (
 
 // ChatGPTService handles OpenAI ChatGPT integration
 type ChatGPTService struct {
-	client *openai.Client
+	client     *openai.Client
+	configured bool
 }
 
 // NewChatGPTService creates a new ChatGPT service instance
 func NewChatGPTService(apiKey string) *ChatGPTService {
 	client := openai.NewClient(apiKey)
 	return &ChatGPTService{
-		client: client,
+		client:     client,
+		configured: apiKey != "",
 	}
 }
 
+// Configured reports whether an OpenAI API key was given
+func (s *ChatGPTService) Configured() bool {
+	return s.configured
+}
+
+// IsTransientOpenAIError reports whether a failed OpenAI call may succeed when retried: rate
+// limits, server errors and network failures, unlike bad requests or a bad API key
+func IsTransientOpenAIError(err error) bool {
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	default:
+		// Network errors come back from the HTTP client as they are
+		return true
+	}
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// CreateEmbeddings returns an embedding vector for each text, in order
+func (s *ChatGPTService) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := s.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.SmallEmbedding3,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embeddings: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, embedding := range resp.Data {
+		if embedding.Index < 0 || embedding.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", embedding.Index)
+		}
+		vectors[embedding.Index] = embedding.Embedding
+	}
+	return vectors, nil
+}
+
 // GenerateResponse generates a ChatGPT response based on message history
 func (s *ChatGPTService) GenerateResponse(messages []Message, userMessage string, model string) (string, error) {
 	return s.GenerateResponseWithCustomSystem(messages, userMessage, "", model)
@@ -281,11 +333,12 @@ func (s *ChatGPTService) GenerateProfileConfirmationMessage(profile *ProfileSetu
 	return msg
 }
 
-// RecommendUser finds and returns a user recommendation based on preferences
-func (s *ChatGPTService) RecommendUser(preferences string, currentUserID string, supabaseService *SupabaseService) (*User, error) {
+// RecommendUser finds and returns a user recommendation based on preferences, skipping
+// the users in excludeIDs
+func (s *ChatGPTService) RecommendUser(preferences string, currentUserID string, excludeIDs []string, userRepo UserRepository) (*User, error) {
 	// Get all users except current user
 	log.Printf("[CHATGPT] Fetching users excluding current user ID: %s", currentUserID)
-	users, err := supabaseService.GetUsersExcluding(currentUserID, 20)
+	users, err := userRepo.GetUsersExcluding(currentUserID, 20+len(excludeIDs))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
@@ -295,13 +348,23 @@ func (s *ChatGPTService) RecommendUser(preferences string, currentUserID string,
 		return nil, fmt.Errorf("no other users found")
 	}
 
+	excluded := make(map[string]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		excluded[id] = true
+	}
+
 	// print out all of the users
 	for _, u := range users {
-		log.Printf("User: ID=%s, Name=%s, Bio=%s", u.ID, u.Name, u.Bio)
+		log.Printf("User: ID=%s, Name=%s, Bio=%s, excluded=%t", u.ID, u.Name, u.Bio, excluded[u.ID])
 	}
 
-	// Simply return the first user
-	return &users[0], nil
+	// Simply return the first user who wasn't excluded
+	for i := range users {
+		if !excluded[users[i].ID] {
+			return &users[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no other users left to recommend")
 }
 
 // GenerateMatchResponse creates a user recommendation message
@@ -322,7 +385,7 @@ Would you like me to connect you with %s? Just say "yes" and I'll create a chat
 }
 
 // UpdateUserProfileInDB updates the user profile in Supabase with parsed information
-func (s *ChatGPTService) UpdateUserProfileInDB(userID string, profile *ProfileSetupData, supabaseService *SupabaseService, streamService *StreamService) error {
+func (s *ChatGPTService) UpdateUserProfileInDB(userID string, profile *ProfileSetupData, userRepo UserRepository, streamService *StreamService) error {
 	// Prepare update data
 	updates := map[string]any{
 		"name":            profile.Name,
@@ -335,7 +398,7 @@ func (s *ChatGPTService) UpdateUserProfileInDB(userID string, profile *ProfileSe
 	}
 
 	// Update user in database
-	updatedUser, err := supabaseService.UpdateUser(userID, updates)
+	updatedUser, err := userRepo.UpdateUser(userID, updates)
 	if err != nil {
 		return fmt.Errorf("failed to update user profile: %w", err)
 	}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Conversation timeouts
+const (
+	conversationOnboardingTimeout = 24 * time.Hour   // Waiting for a name or photo, then greet again
+	conversationProposalTimeout   = 30 * time.Minute // Waiting for an answer to a match proposal
+)
+
+// ConversationInput is a user's message to the chatbot
+type ConversationInput struct {
+	Text        string
+	Attachments []StreamMessageAttachment
+}
+
+// ConversationReply is the chatbot's answer to a message. Messages the machine doesn't
+// handle are small talk, which the caller answers with its own chat completion.
+type ConversationReply struct {
+	Text    string
+	Handled bool
+}
+
+// ConversationMachine drives each user's conversation with the chatbot through explicit,
+// persisted states:
+//
+//	onboarding → awaiting_name → awaiting_photo → idle → match_proposed → match_confirmed
+//
+// Onboarding and awaiting states time out back to onboarding. Proposed matches are kept as
+// MatchProposals, which expire back to idle. A yes only accepts the open proposal, and
+// asks the proposed user through the MatchConsentService, which creates the match channel
+// once they accept too. The webhook handler and /chatbot/chat both drive this machine.
+type ConversationMachine struct {
+	userRepo       UserRepository
+	chatGPTService *ChatGPTService
+	streamService  *StreamService
+	consents       *MatchConsentService
+
+	mu    sync.Mutex
+	locks map[string]*conversationLock // Serializes each user's messages, by user ID
+}
+
+type conversationLock struct {
+	sync.Mutex
+	holders int // Goroutines holding or waiting for the lock
+}
+
+// NewConversationMachine creates a new conversation machine
+func NewConversationMachine(userRepo UserRepository, chatGPTService *ChatGPTService, streamService *StreamService, consents *MatchConsentService) *ConversationMachine {
+	return &ConversationMachine{
+		userRepo:       userRepo,
+		chatGPTService: chatGPTService,
+		streamService:  streamService,
+		consents:       consents,
+		locks:          make(map[string]*conversationLock),
+	}
+}
+
+// Handle moves a user's conversation along with their message and returns the reply
+func (m *ConversationMachine) Handle(ctx context.Context, user *User, input ConversationInput) (*ConversationReply, error) {
+	unlock := m.lock(user.ID)
+	defer unlock()
+
+	state, proposal, err := m.load(user)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[CONVERSATION] User %s is in state %s", user.ID, state.State)
+
+	switch state.State {
+	case ConversationOnboarding:
+		return m.greet(user, state)
+	case ConversationAwaitingName:
+		return m.takeName(user, state, input)
+	case ConversationAwaitingPhoto:
+		return m.takePhoto(user, state, input)
+	case ConversationMatchProposed:
+		return m.answerProposal(ctx, user, state, proposal, input)
+	default:
+		return m.chat(ctx, user, state, input)
+	}
+}
+
+// CancelProposals cancels the open proposals to or about a user, such as one who was deleted or banned
+func (m *ConversationMachine) CancelProposals(userID string) error {
+	// Only local users, whose IDs are UUIDs, have conversations
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil
+	}
+	return m.userRepo.CancelMatchProposals(userID, time.Now().UTC())
+}
+
+// load returns a user's stored state, reconciled with their profile and timeouts, and in
+// match_proposed the open proposal. A user without a stored state starts in onboarding,
+// or idle if their profile is complete.
+func (m *ConversationMachine) load(user *User) (*ConversationState, *MatchProposal, error) {
+	state, err := m.userRepo.GetConversationState(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	onboarding := m.chatGPTService.NeedsProfileSetup(user)
+	if state == nil {
+		state = &ConversationState{UserID: user.ID, State: ConversationIdle}
+		if onboarding {
+			state.State = ConversationOnboarding
+		}
+		return state, nil, nil
+	}
+
+	switch state.State {
+	case ConversationOnboarding, ConversationAwaitingName, ConversationAwaitingPhoto:
+		switch {
+		case !onboarding:
+			// The profile was completed elsewhere, such as through the API
+			return state, nil, m.transition(state, ConversationIdle, nil)
+		case state.ExpiresAt != nil && now.After(*state.ExpiresAt):
+			log.Printf("[CONVERSATION] %s timed out for user %s", state.State, user.ID)
+			return state, nil, m.transition(state, ConversationOnboarding, nil)
+		}
+	case ConversationMatchProposed:
+		if onboarding {
+			return state, nil, m.transition(state, ConversationOnboarding, nil)
+		}
+		proposal, err := m.openProposal(user.ID, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		if proposal == nil {
+			return state, nil, m.transition(state, ConversationIdle, nil)
+		}
+		return state, proposal, nil
+	default:
+		if onboarding {
+			return state, nil, m.transition(state, ConversationOnboarding, nil)
+		}
+	}
+	return state, nil, nil
+}
+
+// openProposal returns a user's open proposal, expiring it if its time has passed
+func (m *ConversationMachine) openProposal(userID string, now time.Time) (*MatchProposal, error) {
+	proposal, err := m.userRepo.GetOpenMatchProposal(userID)
+	if err != nil || proposal == nil {
+		return nil, err
+	}
+	if now.Before(proposal.ExpiresAt) {
+		return proposal, nil
+	}
+
+	log.Printf("[MATCHING] Proposal %s of %s to user %s expired", proposal.ID, proposal.ProposedUserID, userID)
+	if _, err := m.userRepo.ResolveMatchProposal(proposal.ID, ProposalExpired, now); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// greet asks a user who needs a profile for their name, or for a photo if they have one
+func (m *ConversationMachine) greet(user *User, state *ConversationState) (*ConversationReply, error) {
+	if strings.TrimSpace(user.Name) != "" {
+		reply := fmt.Sprintf("Hi %s! Welcome to the chat! To finish your profile, please upload a profile picture.", user.Name)
+		return m.reply(state, ConversationAwaitingPhoto, reply)
+	}
+
+	reply, err := m.chatGPTService.GenerateProfileSetupResponse(user)
+	if err != nil {
+		log.Printf("[CONVERSATION] Error generating profile setup response: %v", err)
+		reply = "Hi! Welcome to the chat! To get started, I need to set up your profile. What's your name?"
+	}
+	return m.reply(state, ConversationAwaitingName, reply)
+}
+
+// takeName saves the name in a user's message, along with a bio and photo if they sent them
+func (m *ConversationMachine) takeName(user *User, state *ConversationState, input ConversationInput) (*ConversationReply, error) {
+	profile, err := m.chatGPTService.ParseProfileFromStreamMessage(input.Text, input.Attachments)
+	if err != nil {
+		log.Printf("[CONVERSATION] Error parsing profile: %v", err)
+		return m.reply(state, ConversationAwaitingName, "Sorry, I didn't catch that. What's your name?")
+	}
+
+	name := strings.TrimSpace(profile.Name)
+	if name == "" {
+		return m.reply(state, ConversationAwaitingName, "I didn't catch your name. What should I call you?")
+	}
+	if len(name) > MaxNameLength {
+		return m.reply(state, ConversationAwaitingName,
+			fmt.Sprintf("That name is a bit long. Please keep it under %d characters.", MaxNameLength))
+	}
+	profile.Name = name
+
+	updates := map[string]interface{}{"name": profile.Name}
+	if profile.Bio != "" && len(profile.Bio) <= MaxBioLength {
+		updates["bio"] = profile.Bio
+	}
+	if profile.ProfilePicURL != "" {
+		updates["profile_pic_url"] = profile.ProfilePicURL
+	}
+	if err := m.updateProfile(user.ID, updates); err != nil {
+		return nil, err
+	}
+
+	if profile.ProfilePicURL != "" {
+		return m.reply(state, ConversationIdle, m.chatGPTService.GenerateProfileConfirmationMessage(profile))
+	}
+	reply := fmt.Sprintf("Nice to meet you, %s! Now please upload a profile picture so others can recognize you.", profile.Name)
+	return m.reply(state, ConversationAwaitingPhoto, reply)
+}
+
+// takePhoto saves the first image a user sent as their profile picture
+func (m *ConversationMachine) takePhoto(user *User, state *ConversationState, input ConversationInput) (*ConversationReply, error) {
+	var picURL string
+	for _, attachment := range input.Attachments {
+		if attachment.Type == "image" && attachment.ImageURL != "" {
+			picURL = attachment.ImageURL
+			break
+		}
+	}
+	if picURL == "" {
+		return m.reply(state, ConversationAwaitingPhoto, "I still need a profile picture. Please upload an image!")
+	}
+
+	if err := m.updateProfile(user.ID, map[string]interface{}{"profile_pic_url": picURL}); err != nil {
+		return nil, err
+	}
+
+	profile := &ProfileSetupData{Name: user.Name, ProfilePicURL: picURL, Bio: user.Bio}
+	return m.reply(state, ConversationIdle, m.chatGPTService.GenerateProfileConfirmationMessage(profile))
+}
+
+// chat proposes a match when an idle user asks to meet someone, and leaves other messages
+// to the caller
+func (m *ConversationMachine) chat(ctx context.Context, user *User, state *ConversationState, input ConversationInput) (*ConversationReply, error) {
+	if m.isMatchingRequest(ctx, input.Text) {
+		return m.propose(user, state, input.Text)
+	}
+
+	if state.State == ConversationMatchConfirmed {
+		if err := m.transition(state, ConversationIdle, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &ConversationReply{}, nil
+}
+
+// propose recommends a user matching the preferences, other than those the user already
+// accepted or declined or who declined them, and waits for an answer
+func (m *ConversationMachine) propose(user *User, state *ConversationState, preferences string) (*ConversationReply, error) {
+	log.Printf("[MATCHING] Processing matching request for user %s with preferences: %s", user.ID, preferences)
+
+	history, err := m.userRepo.ListMatchProposals(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var answered []string
+	for _, proposal := range history {
+		switch proposal.Status {
+		case ProposalAwaitingConsent, ProposalAccepted, ProposalDeclined, ProposalRejected:
+			answered = append(answered, proposal.ProposedUserID)
+		}
+	}
+
+	recommended, err := m.chatGPTService.RecommendUser(preferences, user.ID, answered, m.userRepo)
+	if err != nil {
+		log.Printf("[MATCHING] Error getting recommendation: %v", err)
+		reply := "I'm sorry, I couldn't find anyone matching your preferences right now. There might not be other users available, or you might want to try describing what you're looking for differently."
+		return m.reply(state, ConversationIdle, reply)
+	}
+
+	now := time.Now().UTC()
+	proposal := &MatchProposal{
+		UserID:         user.ID,
+		ProposedUserID: recommended.ID,
+		Preferences:    preferences,
+		Status:         ProposalProposed,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(conversationProposalTimeout),
+	}
+	if err := m.userRepo.CreateMatchProposal(proposal); err != nil {
+		return nil, err
+	}
+	log.Printf("[MATCHING] Proposing %s (%s) to user %s as proposal %s", recommended.Name, recommended.ID, user.ID, proposal.ID)
+
+	if err := m.transition(state, ConversationMatchProposed, nil); err != nil {
+		return nil, err
+	}
+	return &ConversationReply{Text: m.chatGPTService.GenerateMatchResponse(recommended), Handled: true}, nil
+}
+
+// answerProposal accepts or declines the open proposal. "No" or "someone else" declines it
+// and proposes someone new; "no thanks" or "not now" declines it and stops. Other messages
+// are handled as in idle, and leave the proposal open.
+func (m *ConversationMachine) answerProposal(ctx context.Context, user *User, state *ConversationState, proposal *MatchProposal, input ConversationInput) (*ConversationReply, error) {
+	switch {
+	case isStopMessage(input.Text):
+		if err := m.resolve(proposal, ProposalDeclined); err != nil {
+			return nil, err
+		}
+		return m.reply(state, ConversationIdle, "No problem! Just tell me whenever you'd like to meet someone.")
+	case isConfirmationMessage(input.Text):
+		return m.confirm(user, state, proposal)
+	case isDeclineMessage(input.Text):
+		if err := m.resolve(proposal, ProposalDeclined); err != nil {
+			return nil, err
+		}
+		return m.propose(user, state, proposal.Preferences)
+	default:
+		return m.chat(ctx, user, state, input)
+	}
+}
+
+// confirm accepts the open proposal and asks the proposed user whether they want to meet
+// too. The match channel is created once they accept.
+func (m *ConversationMachine) confirm(user *User, state *ConversationState, proposal *MatchProposal) (*ConversationReply, error) {
+	log.Printf("[MATCHING] Processing meeting confirmation for user %s", user.ID)
+
+	recommended, err := m.userRepo.GetUserByID(proposal.ProposedUserID)
+	if err != nil {
+		return nil, err
+	}
+	if recommended == nil {
+		if err := m.resolve(proposal, ProposalCancelled); err != nil {
+			return nil, err
+		}
+		return m.reply(state, ConversationIdle, "Sorry, that person is no longer available. Ask me to find someone else for you to meet!")
+	}
+
+	requested, err := m.consents.Request(user, recommended, proposal)
+	if err != nil {
+		log.Printf("[MATCHING] Error asking %s to meet %s: %v", recommended.ID, user.ID, err)
+		return m.reply(state, ConversationIdle, fmt.Sprintf("I'm sorry, I couldn't reach %s right now. Please try again later.", recommended.Name))
+	}
+	if !requested {
+		// Cancelled meanwhile, because one of them left
+		return m.reply(state, ConversationIdle, "Sorry, that person is no longer available. Ask me to find someone else for you to meet!")
+	}
+
+	reply := fmt.Sprintf("Great! I've asked %s if they'd like to meet you too. I'll let you know as soon as they answer.", recommended.Name)
+	return m.reply(state, ConversationMatchConfirmed, reply)
+}
+
+// resolve records the answer to a proposal. A proposal that was cancelled meanwhile, because
+// the other user left, keeps its status.
+func (m *ConversationMachine) resolve(proposal *MatchProposal, status string) error {
+	resolved, err := m.userRepo.ResolveMatchProposal(proposal.ID, status, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if resolved {
+		log.Printf("[MATCHING] Proposal %s of %s to user %s %s", proposal.ID, proposal.ProposedUserID, proposal.UserID, status)
+	} else {
+		log.Printf("[MATCHING] Proposal %s was no longer open, leaving it", proposal.ID)
+	}
+	return nil
+}
+
+// reply moves to a state and answers with text. Onboarding states get a fresh timeout.
+func (m *ConversationMachine) reply(state *ConversationState, to, text string) (*ConversationReply, error) {
+	var expiresAt *time.Time
+	if to == ConversationAwaitingName || to == ConversationAwaitingPhoto {
+		at := time.Now().UTC().Add(conversationOnboardingTimeout)
+		expiresAt = &at
+	}
+	if err := m.transition(state, to, expiresAt); err != nil {
+		return nil, err
+	}
+	return &ConversationReply{Text: text, Handled: true}, nil
+}
+
+// transition moves a conversation to a state and saves it
+func (m *ConversationMachine) transition(state *ConversationState, to string, expiresAt *time.Time) error {
+	if state.State != to {
+		log.Printf("[CONVERSATION] User %s: %s → %s", state.UserID, state.State, to)
+	}
+	state.State = to
+	state.ExpiresAt = expiresAt
+	state.UpdatedAt = time.Now().UTC()
+	if err := m.userRepo.SaveConversationState(state); err != nil {
+		return fmt.Errorf("failed to move conversation to %s: %w", to, err)
+	}
+	return nil
+}
+
+// updateProfile saves profile fields and syncs the user to Stream Chat
+func (m *ConversationMachine) updateProfile(userID string, updates map[string]interface{}) error {
+	updated, err := m.userRepo.UpdateUser(userID, updates)
+	if err != nil {
+		return fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	if err := m.streamService.CreateOrUpdateUser(context.Background(), updated); err != nil {
+		// The profile is saved, so don't fail the conversation over Stream
+		log.Printf("[CONVERSATION] Failed to sync profile of %s with Stream Chat: %v", userID, err)
+	}
+	return nil
+}
+
+// lock serializes the messages of one user, so concurrent webhook jobs and API requests
+// can't both move the same conversation. It returns the unlock function.
+func (m *ConversationMachine) lock(userID string) func() {
+	m.mu.Lock()
+	l := m.locks[userID]
+	if l == nil {
+		l = &conversationLock{}
+		m.locks[userID] = l
+	}
+	l.holders++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		l.holders--
+		if l.holders == 0 {
+			delete(m.locks, userID)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// isMatchingRequest uses AI to determine if the user wants to meet someone
+func (m *ConversationMachine) isMatchingRequest(ctx context.Context, text string) bool {
+	systemPrompt := `You are an AI that determines if a user is asking to meet or connect with other people.
+
+Look for requests like:
+- Wanting to meet someone with specific interests/qualities
+- Looking for connections or introductions
+- Asking for recommendations for people to talk to
+- Expressing loneliness or desire for social connections
+- Asking about finding friends, dates, or conversation partners
+
+Respond with only "YES" if they want to meet someone, or "NO" if they don't.`
+
+	request := openai.ChatCompletionRequest{
+		Model: openai.GPT3Dot5Turbo,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: systemPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf("User message: \"%s\"", text),
+			},
+		},
+		MaxTokens:   10,
+		Temperature: 0.1,
+	}
+
+	resp, err := m.chatGPTService.client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		log.Printf("[MATCHING] Error checking if matching request: %v", err)
+		return false
+	}
+
+	if len(resp.Choices) == 0 {
+		return false
+	}
+
+	response := strings.ToUpper(strings.TrimSpace(resp.Choices[0].Message.Content))
+	return response == "YES"
+}
+
+// isConfirmationMessage checks if the user is confirming they want to meet someone
+func isConfirmationMessage(text string) bool {
+	return matchesReply(text, []string{"yes", "yeah", "yep", "sure", "okay", "ok", "connect", "meet them"})
+}
+
+// isDeclineMessage checks if the user is turning down a proposed match for someone else
+func isDeclineMessage(text string) bool {
+	return matchesReply(text, []string{"no", "nope", "nah", "pass", "skip", "next", "someone else", "another", "somebody else"})
+}
+
+// isStopMessage checks if the user is turning down a proposed match and doesn't want another
+func isStopMessage(text string) bool {
+	return matchesReply(text, []string{"no thanks", "no thank you", "not now", "not interested", "stop", "cancel", "never mind"})
+}
+
+// matchesReply reports whether text is one of the words, or starts or ends with one
+func matchesReply(text string, words []string) bool {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for _, word := range words {
+		if text == word || strings.HasPrefix(text, word+" ") || strings.HasSuffix(text, " "+word) {
+			return true
+		}
+	}
+	return false
+}
@@ -24,51 +24,65 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/auth/login": {
-            "post": {
-                "description": "Authenticate user by username or wallet address",
-                "consumes": [
-                    "application/json"
-                ],
+        "/.well-known/jwks.json": {
+            "get": {
+                "description": "Public keys (RS256/EdDSA) for verifying access tokens issued by this API, selected by the token's kid header. Retired keys stay listed until their tokens expire.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Authentication"
                 ],
-                "summary": "User login",
-                "parameters": [
-                    {
-                        "description": "Login credentials",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
+                "summary": "JSON Web Key Set",
+                "responses": {
+                    "200": {
+                        "description": "Verification keys",
                         "schema": {
-                            "$ref": "#/definitions/main.LoginRequest"
+                            "$ref": "#/definitions/main.JWKS"
                         }
                     }
+                }
+            }
+        },
+        "/admin/account-deletions": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
                 ],
+                "description": "List account deletion jobs that are pending, running or failed. Requires the users:admin permission.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List unfinished account deletions",
                 "responses": {
                     "200": {
-                        "description": "Successfully authenticated",
+                        "description": "Deletion jobs",
                         "schema": {
-                            "$ref": "#/definitions/main.AuthResponse"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.AccountDeletion"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Invalid request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "401": {
-                        "description": "Authentication failed",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Stream token error",
+                        "description": "Failed to list deletions",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
@@ -76,51 +90,62 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/register": {
+        "/admin/account-deletions/{user_id}/retry": {
             "post": {
-                "description": "Create a new user account",
-                "consumes": [
-                    "application/json"
+                "security": [
+                    {
+                        "Bearer": []
+                    }
                 ],
+                "description": "Run the remaining steps of a user's account deletion in the background. Requires the users:admin permission.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Authentication"
+                    "Admin"
                 ],
-                "summary": "User registration",
+                "summary": "Retry account deletion",
                 "parameters": [
                     {
-                        "description": "Registration data",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/main.RegisterRequest"
-                        }
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Successfully registered",
+                    "202": {
+                        "description": "Deletion resumed",
                         "schema": {
-                            "$ref": "#/definitions/main.AuthResponse"
+                            "type": "object",
+                            "properties": {
+                                "message": {
+                                    "type": "string"
+                                }
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Invalid request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "Registration failed",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Stream token error",
+                    "404": {
+                        "description": "No deletion requested for the user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Deletion already running",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
@@ -128,89 +153,58 @@ const docTemplate = `{
                 }
             }
         },
-        "/chatbot/chat": {
-            "post": {
-                "description": "Send a message to the AI chatbot and get a response based on channel history. Specify model in request body (gpt-3.5-turbo or gpt-4).",
-                "consumes": [
-                    "application/json"
+        "/admin/api-keys": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
                 ],
+                "description": "List all API keys with their scopes and last use. Key values are never returned.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Chatbot"
-                ],
-                "summary": "Chat with AI bot",
-                "parameters": [
-                    {
-                        "description": "Chatbot request",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/main.ChatbotRequest"
-                        }
-                    }
+                    "Admin"
                 ],
+                "summary": "List API keys",
                 "responses": {
                     "200": {
-                        "description": "AI response generated",
+                        "description": "API keys",
                         "schema": {
-                            "$ref": "#/definitions/main.ChatbotResponse"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.APIKey"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Invalid request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "User not found",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal server error",
+                        "description": "Failed to list API keys",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/handshake/active": {
-            "get": {
-                "description": "Get list of users currently connected to handshake events",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "Handshake"
-                ],
-                "summary": "Get active users",
-                "responses": {
-                    "200": {
-                        "description": "List of active users",
-                        "schema": {
-                            "type": "object",
-                            "properties": {
-                                "users": {
-                                    "type": "array",
-                                    "items": {
-                                        "type": "string"
-                                    }
-                                }
-                            }
-                        }
-                    }
-                }
-            }
-        },
-        "/handshake/send": {
+            },
             "post": {
-                "description": "Send a handshake event to specific user or broadcast to all",
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Create a scoped API key for service-to-service calls. Callers can only grant scopes they hold themselves. The raw key is only returned once.",
                 "consumes": [
                     "application/json"
                 ],
@@ -218,37 +212,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Handshake"
+                    "Admin"
                 ],
-                "summary": "Send handshake",
+                "summary": "Create API key",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "User ID of sender",
-                        "name": "uid",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "description": "Handshake request",
+                        "description": "API key name, scopes and expiry",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/main.HandshakeRequest"
+                            "$ref": "#/definitions/main.CreateAPIKeyRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Handshake sent successfully",
+                    "201": {
+                        "description": "Created API key",
                         "schema": {
-                            "type": "object",
-                            "properties": {
-                                "message": {
-                                    "type": "string"
-                                }
-                            }
+                            "$ref": "#/definitions/main.CreateAPIKeyResponse"
                         }
                     },
                     "400": {
@@ -256,35 +238,21 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
-                    }
-                }
-            }
-        },
-        "/handshake/ws": {
-            "get": {
-                "description": "Establish WebSocket connection to receive real-time handshake events",
-                "tags": [
-                    "Handshake"
-                ],
-                "summary": "Connect to handshake WebSocket",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "User ID",
-                        "name": "uid",
-                        "in": "query",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "101": {
-                        "description": "Switching Protocols",
+                    },
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "400": {
-                        "description": "Invalid request",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "API key creation failed",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
@@ -292,60 +260,62 @@ const docTemplate = `{
                 }
             }
         },
-        "/messages/channel/{channel_id}": {
-            "get": {
-                "description": "Retrieve messages for a specific channel with pagination",
-                "consumes": [
-                    "application/json"
+        "/admin/api-keys/{key_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
                 ],
+                "description": "Revoke an API key so it can no longer be used",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Messages"
+                    "Admin"
                 ],
-                "summary": "Get channel messages",
+                "summary": "Revoke API key",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Channel ID",
-                        "name": "channel_id",
+                        "description": "API key ID",
+                        "name": "key_id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "default": 50,
-                        "description": "Number of messages to retrieve",
-                        "name": "limit",
-                        "in": "query"
-                    },
-                    {
-                        "type": "integer",
-                        "default": 0,
-                        "description": "Offset for pagination",
-                        "name": "offset",
-                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Channel messages",
+                        "description": "API key revoked",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/main.Message"
+                            "type": "object",
+                            "properties": {
+                                "message": {
+                                    "type": "string"
+                                }
                             }
                         }
                     },
-                    "400": {
-                        "description": "Invalid request",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal server error",
+                        "description": "Revocation failed",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
@@ -353,21 +323,60 @@ const docTemplate = `{
                 }
             }
         },
-        "/stream/channels/{user_id}": {
+        "/admin/test-db": {
             "get": {
                 "security": [
                     {
                         "Bearer": []
                     }
                 ],
-                "description": "Get all channels that a user is a member of",
+                "description": "Check that the user store can be reached. Requires users:admin.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Stream Chat"
+                    "Admin"
                 ],
-                "summary": "Get user channels",
+                "summary": "Test database connection",
+                "responses": {
+                    "200": {
+                        "description": "Database test result",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "reachable": {
+                                    "type": "boolean"
+                                }
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/users/{user_id}/role": {
+            "put": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Set a user's role to user, moderator or admin and sync it to Stream Chat. Requires the users:admin permission.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Change a user's role",
                 "parameters": [
                     {
                         "type": "string",
@@ -375,32 +384,199 @@ const docTemplate = `{
                         "name": "user_id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "New role",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.UpdateRoleRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "User channels",
+                        "description": "Updated user",
+                        "schema": {
+                            "$ref": "#/definitions/main.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid role",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Role update failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "List verified Stream Chat webhooks as they were received, newest first, with the outcome of processing them. Requires the users:admin permission.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only this event type, e.g. message.new",
+                        "name": "event_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only this status (queued, processed, failed, dead_lettered, duplicate)",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only deliveries with this X-Webhook-Id",
+                        "name": "webhook_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only webhooks received at or after this RFC 3339 time",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only webhooks received at or before this RFC 3339 time",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Number of results (max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Webhook deliveries",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/main.StreamChannel"
+                                "$ref": "#/definitions/main.WebhookDelivery"
                             }
                         }
                     },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list deliveries",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/webhooks/{delivery_id}/replay": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Queue a stored webhook to be processed again through the event handlers, skipping webhook deduplication. Works for dead-lettered and processed webhooks alike. Requires the users:admin permission.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Replay webhook delivery",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook delivery ID",
+                        "name": "delivery_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Replay queued",
+                        "schema": {
+                            "$ref": "#/definitions/main.Job"
+                        }
+                    },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
                     "404": {
-                        "description": "User not found",
+                        "description": "Delivery not found",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to retrieve channels",
+                        "description": "Failed to queue replay",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
@@ -408,9 +584,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/stream/token": {
+        "/auth/login": {
             "post": {
-                "description": "Generate a Stream Chat token for a user",
+                "description": "Authenticate an Ethereum or Solana wallet with a signed SIWE/SIWS message. The message must embed a nonce from /auth/nonce.",
                 "consumes": [
                     "application/json"
                 ],
@@ -418,25 +594,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Stream Chat"
+                    "Authentication"
                 ],
-                "summary": "Generate Stream Chat token",
+                "summary": "User login",
                 "parameters": [
                     {
-                        "description": "Token generation request",
+                        "description": "Login credentials",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/main.TokenRequest"
+                            "$ref": "#/definitions/main.LoginRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully generated token",
+                        "description": "Successfully authenticated",
                         "schema": {
-                            "$ref": "#/definitions/main.TokenResponse"
+                            "$ref": "#/definitions/main.AuthResponse"
                         }
                     },
                     "400": {
@@ -445,14 +621,20 @@ const docTemplate = `{
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "User not found",
+                    "401": {
+                        "description": "Authentication failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "User is banned",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Token generation failed",
+                        "description": "Stream token error",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
@@ -460,9 +642,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/stream/user": {
+        "/auth/logout": {
             "post": {
-                "description": "Create or update a user in Stream Chat",
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Revoke the current session (or all sessions) and the user's Stream Chat tokens",
                 "consumes": [
                     "application/json"
                 ],
@@ -470,220 +657,2883 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Stream Chat"
+                    "Authentication"
                 ],
-                "summary": "Create or update Stream user",
+                "summary": "Logout",
                 "parameters": [
                     {
-                        "description": "User creation/update request",
+                        "description": "Logout options",
                         "name": "request",
                         "in": "body",
-                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/main.StreamUserRequest"
+                            "$ref": "#/definitions/main.LogoutRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "User created/updated successfully",
+                        "description": "Logged out",
                         "schema": {
                             "type": "object",
                             "properties": {
                                 "message": {
                                     "type": "string"
-                                },
-                                "user_id": {
-                                    "type": "string"
                                 }
                             }
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Logout failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/nonce": {
+            "get": {
+                "description": "Issue a single-use nonce to embed in an EIP-4361 (SIWE) or Sign-In with Solana message. The nonce is bound to the returned domain and chain ID and expires after a few minutes.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Get sign-in nonce",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "evm",
+                        "description": "Wallet chain: evm or solana",
+                        "name": "chain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Nonce issued",
+                        "schema": {
+                            "$ref": "#/definitions/main.NonceResponse"
+                        }
+                    },
                     "400": {
-                        "description": "Invalid request",
+                        "description": "Unsupported chain",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Stream user creation failed",
+                        "description": "Nonce generation failed",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "main.AuthResponse": {
+        },
+        "/auth/refresh": {
+            "post": {
+                "description": "Exchange a refresh token for a new access token and a new refresh token. Refresh tokens are single-use; reusing one revokes its session.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Refresh access token",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.RefreshRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "New token pair",
+                        "schema": {
+                            "$ref": "#/definitions/main.TokenPair"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid, expired or reused refresh token",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "User is banned",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/register": {
+            "post": {
+                "description": "Create a new user account for the wallet that signed the SIWE message",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "User registration",
+                "parameters": [
+                    {
+                        "description": "Registration data",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Successfully registered",
+                        "schema": {
+                            "$ref": "#/definitions/main.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Signature verification failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Registration failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Stream token error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/sessions": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "List the active sessions of the authenticated user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "List sessions",
+                "responses": {
+                    "200": {
+                        "description": "Active sessions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Session"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list sessions",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/sessions/{session_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Revoke one of the authenticated user's sessions, e.g. a lost device",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Revoke session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Session ID",
+                        "name": "session_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Session revoked",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "message": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Session not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chatbot/chat": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Send a message to the AI chatbot and get a response based on channel history. Specify model in request body (gpt-3.5-turbo or gpt-4). With reply_to_id, the message and response are posted in that message's thread and the thread is used as context instead. Messages drive the same conversation as the Stream AI channel: users without a profile are asked for their name and a profile picture (sent as an image attachment), and matches are proposed and confirmed there.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Chatbot"
+                ],
+                "summary": "Chat with AI bot",
+                "parameters": [
+                    {
+                        "description": "Chatbot request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ChatbotRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "AI response generated",
+                        "schema": {
+                            "$ref": "#/definitions/main.ChatbotResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a member of the channel, or not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User or replied-to message not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Replied-to message was deleted",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chatbot/matches/{proposal_id}/accept": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Accept meeting a user who accepted the chatbot's suggestion to meet the caller. Creates a channel between both users and tells both in their AI chats. This is the accept_match button of the match request message, whose value is the proposal ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Chatbot"
+                ],
+                "summary": "Accept match request",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Match proposal ID",
+                        "name": "proposal_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Accepted match proposal",
+                        "schema": {
+                            "$ref": "#/definitions/main.MatchProposal"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Match request not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Match request already answered, expired or cancelled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to accept match",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/chatbot/matches/{proposal_id}/decline": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Decline meeting a user who accepted the chatbot's suggestion to meet the caller. The other user is told, and no channel is created. This is the decline_match button of the match request message, whose value is the proposal ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Chatbot"
+                ],
+                "summary": "Decline match request",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Match proposal ID",
+                        "name": "proposal_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Rejected match proposal",
+                        "schema": {
+                            "$ref": "#/definitions/main.MatchProposal"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Match request not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Match request already answered, expired or cancelled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to decline match",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/handshake/active": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Get list of users currently connected to handshake events",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Handshake"
+                ],
+                "summary": "Get active users",
+                "responses": {
+                    "200": {
+                        "description": "List of active users",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "users": {
+                                    "type": "array",
+                                    "items": {
+                                        "type": "string"
+                                    }
+                                }
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/handshake/send": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Send a handshake event to specific user or broadcast to all. Users send as themselves; sending as another user with uid, or with an API key, requires the handshake:publish permission.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Handshake"
+                ],
+                "summary": "Send handshake",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID of sender, when publishing for another user",
+                        "name": "uid",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Handshake request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.HandshakeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Handshake sent successfully",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "message": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/handshake/ws": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Establish WebSocket connection to receive the caller's real-time handshake events. Browsers, which can't set the Authorization header, pass the access token as the access_token query parameter or as the subprotocols [\"access_token\", token].",
+                "tags": [
+                    "Handshake"
+                ],
+                "summary": "Connect to handshake WebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Access token, when the Authorization header can't be set",
+                        "name": "access_token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Check if the server is running",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "Server is healthy",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "status": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/channel/{channel_id}": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Retrieve a page of a channel's messages, oldest first, with reply_count on messages that have replies. Without a cursor the newest messages are returned. Pass prev_cursor as before to page back through older messages, or next_cursor as after to fetch newer ones; has_more tells whether more exist in that direction.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Get channel messages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Channel ID",
+                        "name": "channel_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Number of messages to retrieve (max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return messages older than this",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return messages newer than this",
+                        "name": "after",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Channel messages",
+                        "schema": {
+                            "$ref": "#/definitions/main.MessagePage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a member of the channel",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/search": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Search stored messages in channels the caller belongs to, or in one channel with channel_id. Keyword mode matches every word of q (Postgres websearch syntax on the postgres and supabase backends) and returns the newest matches first. Semantic mode ranks the caller's most recent messages by OpenAI embedding similarity to q. Snippets are HTML-escaped with matches in \u003cmark\u003e tags.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Search messages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search text",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "keyword",
+                        "description": "keyword or semantic",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only search this channel",
+                        "name": "channel_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages from this sender",
+                        "name": "sender_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages of this type (user, assistant, system)",
+                        "name": "message_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages created at or after this RFC 3339 time",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages created at or before this RFC 3339 time",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 20,
+                        "description": "Number of results (max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Search results",
+                        "schema": {
+                            "$ref": "#/definitions/main.MessageSearchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a member of the channel",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Search failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Semantic search is not configured",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/{message_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Turn a message into a tombstone: its text is cleared and kept as a revision, and the deleter, time and reason are recorded. Senders may delete their own messages; callers with the messages:moderate permission may delete any message, giving a reason for other users' messages.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Delete a message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "message_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Reason for the delete",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.DeleteMessageRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Tombstone",
+                        "schema": {
+                            "$ref": "#/definitions/main.Message"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or missing reason",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not the sender or a moderator",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Message not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Message was already deleted",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Delete failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Replace the text of a message the caller sent. The previous text is kept as a revision.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Edit a message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "message_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New text",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.EditMessageRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Edited message",
+                        "schema": {
+                            "$ref": "#/definitions/main.Message"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not the sender",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Message not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Message was deleted",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Edit failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/{message_id}/revisions": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Get a message with the texts it had before each edit or delete, oldest first. Available to the sender and to callers with the messages:moderate permission.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Get message revisions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "message_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Message and revisions",
+                        "schema": {
+                            "$ref": "#/definitions/main.MessageHistory"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not the sender or a moderator",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Message not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to get revisions",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/{message_id}/thread": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Get the root of a message's thread with its reply count and a page of its replies, oldest first. Given a reply, the thread it is in is returned. Paging works as for channel history: pass prev_cursor as before for older replies or next_cursor as after for newer ones.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Get a message thread",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "message_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Number of replies to retrieve (max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return replies older than this",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return replies newer than this",
+                        "name": "after",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Thread",
+                        "schema": {
+                            "$ref": "#/definitions/main.MessageThread"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a member of the channel",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Message not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to get thread",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Post a reply in a message's thread, as the signed-in user. Replying to a reply posts in the same thread, so reply_to_id of the stored message is the thread's root.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Reply to a message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "message_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Reply text",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ReplyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Stored reply",
+                        "schema": {
+                            "$ref": "#/definitions/main.Message"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a member of the channel, or not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Message not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Message was deleted",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to store reply",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream/channels/{user_id}": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Get all channels that a user is a member of",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stream Chat"
+                ],
+                "summary": "Get user channels",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User channels",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.StreamChannel"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not the caller's user ID",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to retrieve channels",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream/token": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Generate a Stream Chat token for the authenticated user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stream Chat"
+                ],
+                "summary": "Generate Stream Chat token",
+                "responses": {
+                    "200": {
+                        "description": "Successfully generated token",
+                        "schema": {
+                            "$ref": "#/definitions/main.TokenResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Token generation failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream/user": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Create or update the authenticated user in Stream Chat",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stream Chat"
+                ],
+                "summary": "Create or update Stream user",
+                "parameters": [
+                    {
+                        "description": "User creation/update request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.StreamUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User created/updated successfully",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "message": {
+                                    "type": "string"
+                                },
+                                "user_id": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Cannot update another user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Stream user creation failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/me": {
+            "delete": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Delete the authenticated user's account. Identities are detached, sessions and Stream tokens revoked, the AI chat deleted, sent messages anonymized and handshakes removed. Runs in the background and resumes after failures.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Account"
+                ],
+                "summary": "Delete my account",
+                "responses": {
+                    "202": {
+                        "description": "Deletion job",
+                        "schema": {
+                            "$ref": "#/definitions/main.AccountDeletion"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Deletion could not be started",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/me/export": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Download a zip archive of JSON files with the authenticated user's profile, identities, messages, AI chat, handshakes and matches",
+                "produces": [
+                    "application/zip"
+                ],
+                "tags": [
+                    "Account"
+                ],
+                "summary": "Export my data",
+                "responses": {
+                    "200": {
+                        "description": "Zip archive",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Export failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/me/identities": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "List the wallets and email addresses linked to the authenticated user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Identities"
+                ],
+                "summary": "List linked identities",
+                "responses": {
+                    "200": {
+                        "description": "Linked identities",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Identity"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to list identities",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/me/identities/email": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Send a verification code to an email address to link it to the authenticated user",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Identities"
+                ],
+                "summary": "Link email",
+                "parameters": [
+                    {
+                        "description": "Email address",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.LinkEmailRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Verification code sent",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "message": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid email",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email is linked to another account",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/me/identities/email/verify": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Link an email address to the authenticated user with the code sent to it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Identities"
+                ],
+                "summary": "Verify email",
+                "parameters": [
+                    {
+                        "description": "Email address and code",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.VerifyEmailRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Linked email",
+                        "schema": {
+                            "$ref": "#/definitions/main.Identity"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid or expired code",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email is linked to another account",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/me/identities/wallet": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Link another wallet to the authenticated user. The wallet must sign a SIWE/SIWS message for a nonce from /auth/nonce.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Identities"
+                ],
+                "summary": "Link wallet",
+                "parameters": [
+                    {
+                        "description": "Signed message from the new wallet",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.LinkWalletRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Linked wallet",
+                        "schema": {
+                            "$ref": "#/definitions/main.Identity"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or signature",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Wallet is linked to another account",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/me/identities/{identity_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Unlink a wallet or email from the authenticated user. The last identity cannot be unlinked.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Identities"
+                ],
+                "summary": "Unlink identity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Identity ID",
+                        "name": "identity_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Identity unlinked",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "message": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Not a user",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Identity not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Cannot unlink the last identity",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/stream": {
+            "post": {
+                "description": "Receive a webhook from Stream Chat. The X-Signature header must be the hex HMAC-SHA256 of the body with the Stream secret. Verified events are stored and queued for the event handlers, and a retry of an X-Webhook-Id already queued is answered already_processed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Stream Chat webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "HMAC-SHA256 of the body",
+                        "name": "X-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Stream's ID of the webhook, used to drop retries",
+                        "name": "X-Webhook-Id",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Webhook event",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.StreamWebhookEvent"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Webhook queued or already processed",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "status": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid API key or signature",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to queue event",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "main.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "First characters of the key, to tell keys apart",
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Permission"
+                    }
+                }
+            }
+        },
+        "main.AccountDeletion": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "completed_steps": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.AuthResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "Access token expiry",
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "stream_token": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                },
+                "user": {
+                    "$ref": "#/definitions/main.User"
+                }
+            }
+        },
+        "main.ChainType": {
+            "type": "string",
+            "enum": [
+                "evm",
+                "solana"
+            ],
+            "x-enum-varnames": [
+                "ChainEVM",
+                "ChainSolana"
+            ]
+        },
+        "main.ChatbotRequest": {
+            "type": "object",
+            "required": [
+                "channel_id",
+                "message"
+            ],
+            "properties": {
+                "attachments": {
+                    "description": "Images sent with the message, such as the profile picture during onboarding",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.StreamMessageAttachment"
+                    }
+                },
+                "channel_id": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "model": {
+                    "description": "\"gpt-3.5-turbo\" or \"gpt-4\", defaults to gpt-3.5-turbo",
+                    "type": "string"
+                },
+                "reply_to_id": {
+                    "description": "Reply in the thread of this message, using the thread as context",
+                    "type": "string"
+                }
+            }
+        },
+        "main.ChatbotResponse": {
+            "type": "object",
+            "properties": {
+                "message_id": {
+                    "type": "string"
+                },
+                "reply_to_id": {
+                    "description": "Thread the response was posted in",
+                    "type": "string"
+                },
+                "response": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.CreateAPIKeyRequest": {
+            "type": "object",
+            "required": [
+                "name",
+                "scopes"
+            ],
+            "properties": {
+                "expires_in_days": {
+                    "description": "0 means the key never expires",
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.CreateAPIKeyResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "First characters of the key, to tell keys apart",
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Permission"
+                    }
+                }
+            }
+        },
+        "main.DeleteMessageRequest": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "description": "Required when a moderator deletes another user's message",
+                    "type": "string"
+                }
+            }
+        },
+        "main.EditMessageRequest": {
+            "type": "object",
+            "required": [
+                "message_text"
+            ],
+            "properties": {
+                "message_text": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.HandshakeRequest": {
+            "type": "object",
+            "required": [
+                "type"
+            ],
+            "properties": {
+                "message": {
+                    "description": "Optional message",
+                    "type": "string"
+                },
+                "to_uid": {
+                    "description": "Specific user or empty for broadcast",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "\"wave\", \"high_five\", \"fist_bump\", etc.",
+                    "type": "string"
+                }
+            }
+        },
+        "main.Identity": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "provider": {
+                    "$ref": "#/definitions/main.IdentityProvider"
+                },
+                "subject": {
+                    "description": "Normalized wallet address or lowercase email",
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.IdentityProvider": {
+            "type": "string",
+            "enum": [
+                "email"
+            ],
+            "x-enum-varnames": [
+                "ProviderEmail"
+            ]
+        },
+        "main.JWK": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "string"
+                },
+                "crv": {
+                    "description": "OKP curve",
+                    "type": "string"
+                },
+                "e": {
+                    "description": "RSA exponent",
+                    "type": "string"
+                },
+                "kid": {
+                    "type": "string"
+                },
+                "kty": {
+                    "type": "string"
+                },
+                "n": {
+                    "description": "RSA modulus",
+                    "type": "string"
+                },
+                "use": {
+                    "type": "string"
+                },
+                "x": {
+                    "description": "OKP public key",
+                    "type": "string"
+                }
+            }
+        },
+        "main.JWKS": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.JWK"
+                    }
+                }
+            }
+        },
+        "main.Job": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "description": "Selects the handler, see JobQueue.Handle",
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "locked_until": {
+                    "type": "string"
+                },
+                "max_attempts": {
+                    "type": "integer"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "run_at": {
+                    "description": "Not claimed before this",
+                    "type": "string"
+                }
+            }
+        },
+        "main.LinkEmailRequest": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.LinkWalletRequest": {
+            "type": "object",
+            "required": [
+                "message",
+                "signature"
+            ],
+            "properties": {
+                "message": {
+                    "description": "SIWE/SIWS message signed by the new wallet",
+                    "type": "string"
+                },
+                "signature": {
+                    "description": "Signature of Message",
+                    "type": "string"
+                }
+            }
+        },
+        "main.LoginRequest": {
+            "type": "object",
+            "required": [
+                "message",
+                "signature"
+            ],
+            "properties": {
+                "message": {
+                    "description": "EIP-4361 message issued for a nonce from /auth/nonce",
+                    "type": "string"
+                },
+                "signature": {
+                    "description": "0x-prefixed personal_sign signature of Message",
+                    "type": "string"
+                }
+            }
+        },
+        "main.LogoutRequest": {
+            "type": "object",
+            "properties": {
+                "all_sessions": {
+                    "description": "Revoke every session of the user, not just this one",
+                    "type": "boolean"
+                }
+            }
+        },
+        "main.MatchProposal": {
+            "type": "object",
+            "properties": {
+                "consent_responded_at": {
+                    "description": "When the proposed user answered",
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "When the pending answer is due",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "preferences": {
+                    "description": "What the user asked for",
+                    "type": "string"
+                },
+                "proposed_user_id": {
+                    "type": "string"
+                },
+                "responded_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Message": {
+            "type": "object",
+            "properties": {
+                "channel_id": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delete_reason": {
+                    "type": "string"
+                },
+                "deleted_at": {
+                    "description": "Set on tombstones, whose text is cleared",
+                    "type": "string"
+                },
+                "deleted_by": {
+                    "type": "string"
+                },
+                "edited_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "message_text": {
+                    "type": "string"
+                },
+                "message_type": {
+                    "description": "'user', 'assistant', 'system'",
+                    "type": "string"
+                },
+                "reply_count": {
+                    "description": "Replies that aren't deleted, filled in for channel pages and threads",
+                    "type": "integer"
+                },
+                "reply_to_id": {
+                    "description": "Root of the thread the message replies in",
+                    "type": "string"
+                },
+                "sender_id": {
+                    "type": "string"
+                },
+                "sender_username": {
+                    "type": "string"
+                },
+                "stream_message_id": {
+                    "type": "string"
+                },
+                "type": {
+                    "description": "'text', 'image', etc.",
+                    "type": "string"
+                }
+            }
+        },
+        "main.MessageHistory": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "$ref": "#/definitions/main.Message"
+                },
+                "revisions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.MessageRevision"
+                    }
+                }
+            }
+        },
+        "main.MessagePage": {
+            "type": "object",
+            "properties": {
+                "has_more": {
+                    "description": "More messages exist in the direction paged",
+                    "type": "boolean"
+                },
+                "messages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Message"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Pass as after to get newer messages",
+                    "type": "string"
+                },
+                "prev_cursor": {
+                    "description": "Pass as before to get older messages",
+                    "type": "string"
+                }
+            }
+        },
+        "main.MessageRevision": {
+            "type": "object",
+            "properties": {
+                "edited_at": {
+                    "type": "string"
+                },
+                "edited_by": {
+                    "description": "Who replaced the text",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "message_id": {
+                    "type": "string"
+                },
+                "message_text": {
+                    "type": "string"
+                },
+                "sender_id": {
+                    "description": "Author of the message",
+                    "type": "string"
+                }
+            }
+        },
+        "main.MessageSearchResponse": {
+            "type": "object",
+            "properties": {
+                "mode": {
+                    "type": "string"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.MessageSearchResult"
+                    }
+                }
+            }
+        },
+        "main.MessageSearchResult": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "$ref": "#/definitions/main.Message"
+                },
+                "score": {
+                    "description": "Cosine similarity, for semantic search",
+                    "type": "number"
+                },
+                "snippet": {
+                    "description": "HTML-escaped text around the match, with matches in \u003cmark\u003e tags",
+                    "type": "string"
+                }
+            }
+        },
+        "main.MessageThread": {
+            "type": "object",
+            "properties": {
+                "has_more": {
+                    "description": "More replies exist in the direction paged",
+                    "type": "boolean"
+                },
+                "next_cursor": {
+                    "description": "Pass as after to get newer replies",
+                    "type": "string"
+                },
+                "parent": {
+                    "$ref": "#/definitions/main.Message"
+                },
+                "prev_cursor": {
+                    "description": "Pass as before to get older replies",
+                    "type": "string"
+                },
+                "replies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Message"
+                    }
+                }
+            }
+        },
+        "main.NonceResponse": {
+            "type": "object",
+            "properties": {
+                "chain_id": {
+                    "type": "string"
+                },
+                "chain_type": {
+                    "$ref": "#/definitions/main.ChainType"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "issued_at": {
+                    "type": "string"
+                },
+                "nonce": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Permission": {
+            "type": "string",
+            "enum": [
+                "chat:write",
+                "messages:read",
+                "messages:moderate",
+                "handshake:publish",
+                "users:admin"
+            ],
+            "x-enum-comments": {
+                "PermissionReadMessages": "Read any channel, not just ones the caller is in"
+            },
+            "x-enum-descriptions": [
+                "",
+                "Read any channel, not just ones the caller is in",
+                "",
+                "",
+                ""
+            ],
+            "x-enum-varnames": [
+                "PermissionChat",
+                "PermissionReadMessages",
+                "PermissionModerateMessages",
+                "PermissionPublishHandshake",
+                "PermissionAdminUsers"
+            ]
+        },
+        "main.RefreshRequest": {
+            "type": "object",
+            "required": [
+                "refresh_token"
+            ],
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.RegisterRequest": {
+            "type": "object",
+            "required": [
+                "message",
+                "signature"
+            ],
+            "properties": {
+                "bio": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "profile_pic_url": {
+                    "type": "string"
+                },
+                "signature": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ReplyRequest": {
+            "type": "object",
+            "required": [
+                "message_text"
+            ],
+            "properties": {
+                "message_text": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Role": {
+            "type": "string",
+            "enum": [
+                "user",
+                "moderator",
+                "admin"
+            ],
+            "x-enum-varnames": [
+                "RoleUser",
+                "RoleModerator",
+                "RoleAdmin"
+            ]
+        },
+        "main.Session": {
             "type": "object",
             "properties": {
-                "stream_token": {
+                "created_at": {
                     "type": "string"
                 },
-                "token": {
+                "current": {
+                    "description": "Set when listing: the session of the calling token",
+                    "type": "boolean"
+                },
+                "expires_at": {
                     "type": "string"
                 },
-                "user": {
-                    "$ref": "#/definitions/main.User"
+                "id": {
+                    "type": "string"
+                },
+                "ip_address": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "revoke_reason": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
                 }
             }
         },
-        "main.ChatbotRequest": {
+        "main.StreamAction": {
             "type": "object",
-            "required": [
-                "channel_id",
-                "message",
-                "user_id"
-            ],
             "properties": {
-                "channel_id": {
+                "name": {
                     "type": "string"
                 },
-                "message": {
+                "style": {
                     "type": "string"
                 },
-                "model": {
-                    "description": "\"gpt-3.5-turbo\" or \"gpt-4\", defaults to gpt-3.5-turbo",
+                "text": {
                     "type": "string"
                 },
-                "user_id": {
+                "type": {
+                    "type": "string"
+                },
+                "value": {
                     "type": "string"
                 }
             }
         },
-        "main.ChatbotResponse": {
+        "main.StreamAttachment": {
             "type": "object",
             "properties": {
-                "message_id": {
+                "actions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.StreamAction"
+                    }
+                },
+                "asset_url": {
                     "type": "string"
                 },
-                "response": {
+                "color": {
+                    "type": "string"
+                },
+                "fallback": {
+                    "type": "string"
+                },
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.StreamField"
+                    }
+                },
+                "image_url": {
+                    "type": "string"
+                },
+                "og_scrape_url": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                },
+                "thumb_url": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "title_link": {
+                    "type": "string"
+                },
+                "type": {
                     "type": "string"
                 }
             }
         },
-        "main.ErrorResponse": {
+        "main.StreamChannel": {
             "type": "object",
             "properties": {
-                "error": {
+                "cid": {
                     "type": "string"
                 },
-                "message": {
+                "config": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "id": {
+                    "type": "string"
+                },
+                "members": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.StreamUser"
+                    }
+                },
+                "type": {
                     "type": "string"
                 }
             }
         },
-        "main.HandshakeRequest": {
+        "main.StreamField": {
             "type": "object",
-            "required": [
-                "type"
-            ],
             "properties": {
-                "message": {
-                    "description": "Optional message",
-                    "type": "string"
+                "short": {
+                    "type": "boolean"
                 },
-                "to_uid": {
-                    "description": "Specific user or empty for broadcast",
+                "title": {
                     "type": "string"
                 },
-                "type": {
-                    "description": "\"wave\", \"high_five\", \"fist_bump\", etc.",
+                "value": {
                     "type": "string"
                 }
             }
         },
-        "main.LoginRequest": {
+        "main.StreamMember": {
             "type": "object",
-            "required": [
-                "wallet_address"
-            ],
             "properties": {
-                "wallet_address": {
+                "role": {
+                    "type": "string"
+                },
+                "user": {
+                    "$ref": "#/definitions/main.StreamUser"
+                },
+                "user_id": {
                     "type": "string"
                 }
             }
         },
-        "main.Message": {
+        "main.StreamMessage": {
             "type": "object",
             "properties": {
+                "args": {
+                    "type": "string"
+                },
+                "attachments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.StreamAttachment"
+                    }
+                },
                 "channel_id": {
                     "type": "string"
                 },
+                "cid": {
+                    "type": "string"
+                },
+                "command": {
+                    "type": "string"
+                },
                 "created_at": {
                     "type": "string"
                 },
-                "id": {
+                "deleted_at": {
                     "type": "string"
                 },
-                "message_text": {
+                "html": {
                     "type": "string"
                 },
-                "message_type": {
-                    "description": "'user', 'assistant', 'system'",
+                "id": {
                     "type": "string"
                 },
-                "reply_to_id": {
+                "parent_id": {
+                    "description": "Stream ID of the message this replies to in a thread",
                     "type": "string"
                 },
-                "sender_id": {
+                "reply_count": {
+                    "type": "integer"
+                },
+                "text": {
                     "type": "string"
                 },
-                "sender_username": {
+                "type": {
                     "type": "string"
                 },
-                "stream_message_id": {
+                "updated_at": {
+                    "type": "string"
+                },
+                "user": {
+                    "$ref": "#/definitions/main.StreamUser"
+                }
+            }
+        },
+        "main.StreamMessageAttachment": {
+            "type": "object",
+            "properties": {
+                "image_url": {
                     "type": "string"
                 },
                 "type": {
-                    "description": "'text', 'image', etc.",
                     "type": "string"
                 }
             }
         },
-        "main.RegisterRequest": {
+        "main.StreamReaction": {
             "type": "object",
-            "required": [
-                "wallet_address"
-            ],
             "properties": {
-                "bio": {
+                "created_at": {
                     "type": "string"
                 },
-                "name": {
+                "message_id": {
                     "type": "string"
                 },
-                "profile_pic_url": {
+                "type": {
                     "type": "string"
                 },
-                "wallet_address": {
+                "user_id": {
                     "type": "string"
                 }
             }
         },
-        "main.StreamChannel": {
+        "main.StreamRequestInfo": {
             "type": "object",
             "properties": {
-                "cid": {
+                "ext": {
                     "type": "string"
                 },
-                "config": {
-                    "type": "object",
-                    "additionalProperties": true
-                },
-                "id": {
+                "ip": {
                     "type": "string"
                 },
-                "members": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/main.StreamUser"
-                    }
+                "sdk": {
+                    "type": "string"
                 },
                 "type": {
                     "type": "string"
+                },
+                "user_agent": {
+                    "type": "string"
                 }
             }
         },
@@ -713,12 +3563,12 @@ const docTemplate = `{
         "main.StreamUserRequest": {
             "type": "object",
             "required": [
-                "id",
                 "name",
                 "username"
             ],
             "properties": {
                 "id": {
+                    "description": "Defaults to the authenticated user",
                     "type": "string"
                 },
                 "image": {
@@ -727,21 +3577,67 @@ const docTemplate = `{
                 "name": {
                     "type": "string"
                 },
-                "role": {
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.StreamWebhookEvent": {
+            "type": "object",
+            "properties": {
+                "channel": {
+                    "$ref": "#/definitions/main.StreamChannel"
+                },
+                "channel_id": {
                     "type": "string"
                 },
-                "username": {
+                "cid": {
                     "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "expiration": {
+                    "description": "When a timed ban ends",
+                    "type": "string"
+                },
+                "member": {
+                    "$ref": "#/definitions/main.StreamMember"
+                },
+                "message": {
+                    "$ref": "#/definitions/main.StreamMessage"
+                },
+                "reaction": {
+                    "$ref": "#/definitions/main.StreamReaction"
+                },
+                "reason": {
+                    "description": "Given with bans",
+                    "type": "string"
+                },
+                "request_info": {
+                    "$ref": "#/definitions/main.StreamRequestInfo"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "user": {
+                    "$ref": "#/definitions/main.StreamUser"
                 }
             }
         },
-        "main.TokenRequest": {
+        "main.TokenPair": {
             "type": "object",
-            "required": [
-                "user_id"
-            ],
             "properties": {
-                "user_id": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "token": {
                     "type": "string"
                 }
             }
@@ -757,12 +3653,34 @@ const docTemplate = `{
                 }
             }
         },
+        "main.UpdateRoleRequest": {
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "role": {
+                    "description": "\"user\", \"moderator\" or \"admin\"",
+                    "type": "string"
+                }
+            }
+        },
         "main.User": {
             "type": "object",
             "properties": {
+                "ban_expires_at": {
+                    "type": "string"
+                },
+                "banned_at": {
+                    "description": "Set while the user is banned from the whole app in Stream Chat; a nil BanExpiresAt\nmeans until they are unbanned",
+                    "type": "string"
+                },
                 "bio": {
                     "type": "string"
                 },
+                "chain_type": {
+                    "$ref": "#/definitions/main.ChainType"
+                },
                 "created_at": {
                     "type": "string"
                 },
@@ -775,10 +3693,78 @@ const docTemplate = `{
                 "profile_pic_url": {
                     "type": "string"
                 },
+                "role": {
+                    "description": "Only changeable through the admin role endpoint",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.Role"
+                        }
+                    ]
+                },
                 "username": {
                     "type": "string"
                 },
                 "wallet_address": {
+                    "description": "Normalized per chain, see WalletVerifier",
+                    "type": "string"
+                }
+            }
+        },
+        "main.VerifyEmailRequest": {
+            "type": "object",
+            "required": [
+                "code",
+                "email"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "Processing attempts, replays included",
+                    "type": "integer"
+                },
+                "body": {
+                    "description": "Raw request body",
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "processed_at": {
+                    "type": "string"
+                },
+                "received_at": {
+                    "type": "string"
+                },
+                "replay_count": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "description": "X-Webhook-Id",
                     "type": "string"
                 }
             }
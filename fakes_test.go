@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	stream "github.com/GetStream/stream-chat-go/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	testStreamKey    = "test-key"
+	testStreamSecret = "test-secret"
+)
+
+// fakeOpenAI is an OpenAI API that answers chat completions with a reply function
+type fakeOpenAI struct {
+	mu       sync.Mutex
+	requests []openai.ChatCompletionRequest
+	reply    func(req openai.ChatCompletionRequest) string
+}
+
+// newFakeOpenAI returns a ChatGPT service backed by a fake OpenAI API. The chatbot's YES/NO
+// classifications are answered NO unless reply says otherwise.
+func newFakeOpenAI(t *testing.T, reply func(req openai.ChatCompletionRequest) string) (*ChatGPTService, *fakeOpenAI) {
+	t.Helper()
+	fake := &fakeOpenAI{reply: reply}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, req)
+		fake.mu.Unlock()
+
+		content := fake.reply(req)
+		if content == "" && strings.Contains(req.Messages[0].Content, `"YES"`) {
+			content = "NO"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Object: "chat.completion",
+			Model:  req.Model,
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL
+	return &ChatGPTService{client: openai.NewClientWithConfig(config)}, fake
+}
+
+// lastUserMessage returns the user message of the latest completion request
+func (f *fakeOpenAI) lastUserMessage() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		return ""
+	}
+	messages := f.requests[len(f.requests)-1].Messages
+	return messages[len(messages)-1].Content
+}
+
+// streamRequest is a request the fake Stream API received
+type streamRequest struct {
+	method string
+	path   string
+	body   string
+}
+
+// fakeStream is a Stream Chat API that records requests and answers them with an empty object
+type fakeStream struct {
+	mu       sync.Mutex
+	requests []streamRequest
+}
+
+// newFakeStream returns a Stream service backed by a fake Stream Chat API. It is built
+// directly, since NewStreamService configures the webhook URL on start.
+func newFakeStream(t *testing.T) (*StreamService, *fakeStream) {
+	t.Helper()
+	fake := &fakeStream{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, streamRequest{method: r.Method, path: r.URL.Path, body: string(body)})
+		fake.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := stream.NewClient(testStreamKey, testStreamSecret)
+	if err != nil {
+		t.Fatalf("stream.NewClient: %v", err)
+	}
+	client.BaseURL = server.URL
+	return &StreamService{client: client, apiKey: testStreamKey}, fake
+}
+
+// sentMessages returns the text of the messages sent to a channel, oldest first
+func (f *fakeStream) sentMessages(channelType, channelID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var texts []string
+	for _, req := range f.requests {
+		if req.method != http.MethodPost || req.path != "/channels/"+channelType+"/"+channelID+"/message" {
+			continue
+		}
+		var payload struct {
+			Message struct {
+				Text string `json:"text"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(req.body), &payload); err == nil {
+			texts = append(texts, payload.Message.Text)
+		}
+	}
+	return texts
+}
@@ -21,6 +21,8 @@ func NewHandshakeHandler(handshakeService *HandshakeService, pubsub *PubSubServi
 		CheckOrigin: func(r *http.Request) bool {
 			return true // Allow all origins for simplicity
 		},
+		// Echo the token subprotocol, which browsers require when they offer one
+		Subprotocols: []string{WebSocketTokenProtocol},
 	}
 	
 	return &HandshakeHandler{
@@ -32,21 +34,33 @@ func NewHandshakeHandler(handshakeService *HandshakeService, pubsub *PubSubServi
 
 // SendHandshake handles sending a handshake event
 // @Summary Send handshake
-// @Description Send a handshake event to specific user or broadcast to all
+// @Description Send a handshake event to specific user or broadcast to all. Users send as themselves; sending as another user with uid, or with an API key, requires the handshake:publish permission.
 // @Tags Handshake
 // @Accept json
 // @Produce json
-// @Param uid query string true "User ID of sender"
+// @Security Bearer
+// @Param uid query string false "User ID of sender, when publishing for another user"
 // @Param request body HandshakeRequest true "Handshake request"
 // @Success 200 {object} object{message=string} "Handshake sent successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
 // @Router /handshake/send [post]
 func (hh *HandshakeHandler) SendHandshake(c *gin.Context) {
-	uid := c.Query("uid")
+	// The sender is the caller. Sending as someone else takes handshake:publish, as does any
+	// send with an API key, which has no user of its own.
+	uid := CallerID(c)
+	if from := c.Query("uid"); from != "" && from != uid {
+		if !CallerCan(c, PermissionPublishHandshake) {
+			RespondAuthorizationError(c, ErrForbidden)
+			return
+		}
+		uid = from
+	}
 	if uid == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error: "missing_uid",
-			Message: "uid query parameter is required",
+			Message: "uid query parameter is required with an API key",
 		})
 		return
 	}
@@ -76,21 +90,17 @@ func (hh *HandshakeHandler) SendHandshake(c *gin.Context) {
 
 // WebSocketConnect handles WebSocket connections for real-time handshake events
 // @Summary Connect to handshake WebSocket
-// @Description Establish WebSocket connection to receive real-time handshake events
+// @Description Establish WebSocket connection to receive the caller's real-time handshake events. Browsers, which can't set the Authorization header, pass the access token as the access_token query parameter or as the subprotocols ["access_token", token].
 // @Tags Handshake
-// @Param uid query string true "User ID"
+// @Security Bearer
+// @Param access_token query string false "Access token, when the Authorization header can't be set"
 // @Success 101 {string} string "Switching Protocols"
-// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
 // @Router /handshake/ws [get]
 func (hh *HandshakeHandler) WebSocketConnect(c *gin.Context) {
-	uid := c.Query("uid")
-	if uid == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error: "missing_uid",
-			Message: "uid query parameter is required",
-		})
-		return
-	}
+	// Connections receive the caller's own events
+	uid := CallerID(c)
 	
 	conn, err := hh.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -120,7 +130,9 @@ func (hh *HandshakeHandler) WebSocketConnect(c *gin.Context) {
 // @Description Get list of users currently connected to handshake events
 // @Tags Handshake
 // @Produce json
+// @Security Bearer
 // @Success 200 {object} object{users=[]string} "List of active users"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
 // @Router /handshake/active [get]
 func (hh *HandshakeHandler) GetActiveUsers(c *gin.Context) {
 	users := hh.handshakeService.GetActiveUsers()
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// newHandshakeServer serves the handshake WebSocket on the memory repositories and returns
+// its ws:// URL, the handshake service and a signed-in user
+func newHandshakeServer(t *testing.T) (string, *HandshakeService, *User, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	authService, userRepo := newTestAuthService(t)
+	pubsub := NewPubSubService()
+	handshakeService := NewHandshakeService(pubsub, userRepo)
+	authHandler := NewAuthHandler(authService, nil, NewAPIKeyService(userRepo))
+	handshakeHandler := NewHandshakeHandler(handshakeService, pubsub)
+
+	router := gin.New()
+	router.GET("/handshake/ws", authHandler.WebSocketAuthMiddleware(), NewAuthorizer(nil).RequireUser(), handshakeHandler.WebSocketConnect)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	user, tokens := login(t, authService, newTestWallet(t))
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/handshake/ws", handshakeService, user, tokens.AccessToken
+}
+
+// waitForActive waits until uid is subscribed, since the handler subscribes after the upgrade
+func waitForActive(t *testing.T, handshakeService *HandshakeService, uid string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		for _, active := range handshakeService.GetActiveUsers() {
+			if active == uid {
+				return
+			}
+		}
+	}
+	t.Fatalf("%s never became active", uid)
+}
+
+func TestHandshakeWebSocketAuthenticates(t *testing.T) {
+	url, handshakeService, user, token := newHandshakeServer(t)
+
+	tests := []struct {
+		name   string
+		url    string
+		dialer websocket.Dialer
+		header http.Header
+	}{
+		{"header", url, websocket.Dialer{}, http.Header{"Authorization": {"Bearer " + token}}},
+		{"subprotocol", url, websocket.Dialer{Subprotocols: []string{WebSocketTokenProtocol, token}}, nil},
+		{"query", url + "?access_token=" + token, websocket.Dialer{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _, err := tt.dialer.Dial(tt.url, tt.header)
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer conn.Close()
+			waitForActive(t, handshakeService, user.ID)
+		})
+	}
+}
+
+func TestHandshakeWebSocketRejectsMissingToken(t *testing.T) {
+	url, _, user, _ := newHandshakeServer(t)
+
+	for _, target := range []string{url + "?uid=" + user.ID, url + "?access_token=not-a-token"} {
+		_, resp, err := websocket.DefaultDialer.Dial(target, nil)
+		if err == nil {
+			t.Fatalf("Dial %s succeeded, want an error", target)
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Dial %s: response %v, want status %d", target, resp, http.StatusUnauthorized)
+		}
+	}
+}
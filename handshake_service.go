@@ -1,18 +1,21 @@
 package main
 
 import (
+	"log"
 	"time"
 )
 
 // HandshakeService handles handshake-related business logic
 type HandshakeService struct {
-	pubsub *PubSubService
+	pubsub   *PubSubService
+	userRepo UserRepository
 }
 
 // NewHandshakeService creates a new handshake service
-func NewHandshakeService(pubsub *PubSubService) *HandshakeService {
+func NewHandshakeService(pubsub *PubSubService, userRepo UserRepository) *HandshakeService {
 	return &HandshakeService{
-		pubsub: pubsub,
+		pubsub:   pubsub,
+		userRepo: userRepo,
 	}
 }
 
@@ -26,13 +29,23 @@ func (hs *HandshakeService) SendHandshake(fromUID string, request HandshakeReque
 		Timestamp: time.Now(),
 	}
 	
+	// Record the handshake for the user's history; delivery doesn't depend on it
+	if err := hs.userRepo.CreateHandshake(&event); err != nil {
+		log.Printf("[HANDSHAKE] Failed to store handshake from %s: %v", fromUID, err)
+	}
+	
 	// Broadcast the handshake event
 	hs.pubsub.PublishHandshake(event)
 	
 	return nil
 }
 
+// GetHistory returns the handshakes a user sent or received
+func (hs *HandshakeService) GetHistory(userID string) ([]HandshakeEvent, error) {
+	return hs.userRepo.ListHandshakes(userID)
+}
+
 // GetActiveUsers returns a list of users currently connected
 func (hs *HandshakeService) GetActiveUsers() []string {
 	return hs.pubsub.GetActiveUsers()
-}
\ No newline at end of file
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdentityHandler handles linking wallets and email addresses to the logged-in user
+type IdentityHandler struct {
+	identityService *IdentityService
+}
+
+// NewIdentityHandler creates a new identity handler
+func NewIdentityHandler(identityService *IdentityService) *IdentityHandler {
+	return &IdentityHandler{
+		identityService: identityService,
+	}
+}
+
+// ListIdentities handles listing the caller's linked identities
+// @Summary List linked identities
+// @Description List the wallets and email addresses linked to the authenticated user
+// @Tags Identities
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} Identity "Linked identities"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 500 {object} ErrorResponse "Failed to list identities"
+// @Router /users/me/identities [get]
+func (h *IdentityHandler) ListIdentities(c *gin.Context) {
+	identities, err := h.identityService.ListIdentities(CallerID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "failed_to_list_identities",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// LinkWallet handles linking another wallet
+// @Summary Link wallet
+// @Description Link another wallet to the authenticated user. The wallet must sign a SIWE/SIWS message for a nonce from /auth/nonce.
+// @Tags Identities
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body LinkWalletRequest true "Signed message from the new wallet"
+// @Success 201 {object} Identity "Linked wallet"
+// @Failure 400 {object} ErrorResponse "Invalid request or signature"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 409 {object} ErrorResponse "Wallet is linked to another account"
+// @Router /users/me/identities/wallet [post]
+func (h *IdentityHandler) LinkWallet(c *gin.Context) {
+	var req LinkWalletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	identity, err := h.identityService.LinkWallet(CallerID(c), req.Message, req.Signature)
+	if err != nil {
+		if errors.Is(err, ErrIdentityInUse) {
+			respondIdentityError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "wallet_verification_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, identity)
+}
+
+// LinkEmail handles starting to link an email address
+// @Summary Link email
+// @Description Send a verification code to an email address to link it to the authenticated user
+// @Tags Identities
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body LinkEmailRequest true "Email address"
+// @Success 202 {object} object{message=string} "Verification code sent"
+// @Failure 400 {object} ErrorResponse "Invalid email"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 409 {object} ErrorResponse "Email is linked to another account"
+// @Router /users/me/identities/email [post]
+func (h *IdentityHandler) LinkEmail(c *gin.Context) {
+	var req LinkEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.identityService.StartEmailLink(CallerID(c), req.Email); err != nil {
+		respondIdentityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Verification code sent",
+	})
+}
+
+// VerifyEmail handles completing an email link
+// @Summary Verify email
+// @Description Link an email address to the authenticated user with the code sent to it
+// @Tags Identities
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body VerifyEmailRequest true "Email address and code"
+// @Success 201 {object} Identity "Linked email"
+// @Failure 400 {object} ErrorResponse "Invalid or expired code"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 409 {object} ErrorResponse "Email is linked to another account"
+// @Router /users/me/identities/email/verify [post]
+func (h *IdentityHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	identity, err := h.identityService.VerifyEmail(CallerID(c), req.Email, req.Code)
+	if err != nil {
+		respondIdentityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, identity)
+}
+
+// UnlinkIdentity handles unlinking an identity
+// @Summary Unlink identity
+// @Description Unlink a wallet or email from the authenticated user. The last identity cannot be unlinked.
+// @Tags Identities
+// @Produce json
+// @Security Bearer
+// @Param identity_id path string true "Identity ID"
+// @Success 200 {object} object{message=string} "Identity unlinked"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 404 {object} ErrorResponse "Identity not found"
+// @Failure 409 {object} ErrorResponse "Cannot unlink the last identity"
+// @Router /users/me/identities/{identity_id} [delete]
+func (h *IdentityHandler) UnlinkIdentity(c *gin.Context) {
+	if err := h.identityService.Unlink(CallerID(c), c.Param("identity_id")); err != nil {
+		respondIdentityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Identity unlinked",
+	})
+}
+
+// respondIdentityError maps identity errors to HTTP responses
+func respondIdentityError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrIdentityInUse):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "identity_in_use", Message: err.Error()})
+	case errors.Is(err, ErrLastIdentity):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "last_identity", Message: err.Error()})
+	case errors.Is(err, ErrIdentityNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "identity_not_found", Message: err.Error()})
+	case errors.Is(err, ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid_email", Message: err.Error()})
+	case errors.Is(err, ErrInvalidEmailCode):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid_code", Message: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "identity_operation_failed", Message: err.Error()})
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity errors
+var (
+	ErrIdentityInUse    = errors.New("identity is already linked to an account")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrLastIdentity     = errors.New("cannot unlink the last identity of an account")
+	ErrInvalidEmail     = errors.New("invalid email address")
+	ErrInvalidEmailCode = errors.New("invalid or expired verification code")
+)
+
+// IdentityService links and unlinks the wallets and email addresses of a user
+type IdentityService struct {
+	authService *AuthService
+	userRepo    UserRepository
+	mailer      Mailer
+}
+
+// NewIdentityService creates a new identity service
+func NewIdentityService(authService *AuthService, userRepo UserRepository, mailer Mailer) *IdentityService {
+	return &IdentityService{
+		authService: authService,
+		userRepo:    userRepo,
+		mailer:      mailer,
+	}
+}
+
+// ListIdentities returns every identity linked to a user
+func (s *IdentityService) ListIdentities(userID string) ([]Identity, error) {
+	return s.userRepo.ListIdentities(userID)
+}
+
+// LinkWallet links the wallet that signed a SIWE/SIWS message to a user
+func (s *IdentityService) LinkWallet(userID, message, signature string) (*Identity, error) {
+	wallet, err := s.authService.VerifySIWE(message, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.link(userID, IdentityProvider(wallet.Chain), wallet.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users left without a primary wallet adopt the new one
+	user, err := s.authService.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.WalletAddress == "" {
+		if _, err := s.authService.UpdateUser(userID, map[string]interface{}{
+			"wallet_address": wallet.Address,
+			"chain_type":     wallet.Chain,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return identity, nil
+}
+
+// StartEmailLink sends a verification code to an email address the user wants to link
+func (s *IdentityService) StartEmailLink(userID, email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.userRepo.GetIdentity(ProviderEmail, email)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if existing.UserID == userID {
+			return nil
+		}
+		return ErrIdentityInUse
+	}
+
+	code, err := generateEmailCode(EmailCodeLength)
+	if err != nil {
+		return err
+	}
+
+	err = s.userRepo.SaveEmailVerification(&EmailVerification{
+		UserID:    userID,
+		Email:     email,
+		CodeHash:  hashToken(code),
+		ExpiresAt: time.Now().UTC().Add(EmailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, int(EmailVerificationTTL.Minutes()))
+	return s.mailer.Send(email, "Verify your email address", body)
+}
+
+// VerifyEmail links an email address once the user proves they received its code.
+// Codes are single-use, so a wrong guess requires requesting a new one.
+func (s *IdentityService) VerifyEmail(userID, email, code string) (*Identity, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	verification, err := s.userRepo.ConsumeEmailVerification(userID, email)
+	if err != nil {
+		return nil, err
+	}
+	if verification == nil || time.Now().After(verification.ExpiresAt) {
+		return nil, ErrInvalidEmailCode
+	}
+	if subtle.ConstantTimeCompare([]byte(verification.CodeHash), []byte(hashToken(code))) != 1 {
+		return nil, ErrInvalidEmailCode
+	}
+
+	return s.link(userID, ProviderEmail, email)
+}
+
+// Unlink removes an identity from a user, refusing to remove the last one
+func (s *IdentityService) Unlink(userID, identityID string) error {
+	identities, err := s.userRepo.ListIdentities(userID)
+	if err != nil {
+		return err
+	}
+
+	var target *Identity
+	for i := range identities {
+		if identities[i].ID == identityID {
+			target = &identities[i]
+		}
+	}
+	if target == nil {
+		return ErrIdentityNotFound
+	}
+
+	// The repository refuses to delete the last identity, so concurrent unlinks can't
+	// leave the account with none
+	deleted, err := s.userRepo.DeleteIdentity(userID, identityID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrIdentityNotFound
+	}
+
+	log.Printf("[IDENTITY] User %s unlinked %s identity %s", userID, target.Provider, target.Subject)
+
+	// If the primary wallet was unlinked, promote another linked wallet or clear it
+	user, err := s.authService.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if IdentityProvider(user.ChainType) != target.Provider || user.WalletAddress != target.Subject {
+		return nil
+	}
+
+	updates := map[string]interface{}{
+		"wallet_address": nil,
+		"chain_type":     nil,
+	}
+	for _, identity := range identities {
+		if identity.ID != identityID && identity.Provider != ProviderEmail {
+			updates["wallet_address"] = identity.Subject
+			updates["chain_type"] = identity.Provider
+			break
+		}
+	}
+	_, err = s.authService.UpdateUser(userID, updates)
+	return err
+}
+
+// link creates an identity for a user unless another user already has it
+func (s *IdentityService) link(userID string, provider IdentityProvider, subject string) (*Identity, error) {
+	existing, err := s.userRepo.GetIdentity(provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.UserID == userID {
+			return existing, nil
+		}
+		return nil, ErrIdentityInUse
+	}
+
+	// Wallets from before identities existed are only recorded on the user row
+	if provider != ProviderEmail {
+		owner, err := s.userRepo.GetUserByWallet(WalletIdentity{Chain: ChainType(provider), Address: subject})
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil && owner.ID != userID {
+			return nil, ErrIdentityInUse
+		}
+	}
+
+	identity := &Identity{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Provider:  provider,
+		Subject:   subject,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.userRepo.CreateIdentity(identity); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[IDENTITY] User %s linked %s identity %s", userID, provider, subject)
+	return identity, nil
+}
+
+// normalizeEmail validates a bare email address and lowercases it
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// generateEmailCode returns a random numeric code of the given length
+func generateEmailCode(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate verification code: %w", err)
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
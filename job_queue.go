@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job queue defaults
+const (
+	jobWorkers      = 4
+	jobMaxAttempts  = 6
+	jobLease        = 5 * time.Minute // Longer than a handler may run, see JobQueue.execute
+	jobPollInterval = 2 * time.Second
+	jobBackoffBase  = 5 * time.Second
+	jobBackoffMax   = 15 * time.Minute
+)
+
+// JobHandler runs one job. Jobs run at least once: a job is retried when its handler fails
+// and claimed again when a worker dies holding it, so handlers must be idempotent.
+type JobHandler func(ctx context.Context, job *Job) error
+
+// JobQueue runs jobs from a JobRepository on a pool of workers. Failed jobs are retried with
+// exponential backoff, and moved to the dead letters after MaxAttempts.
+type JobQueue struct {
+	jobRepo JobRepository
+	wake    chan struct{} // Nudges an idle worker when a job is enqueued
+
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+}
+
+// NewJobQueue creates a job queue with no handlers
+func NewJobQueue(jobRepo JobRepository) *JobQueue {
+	return &JobQueue{
+		jobRepo:  jobRepo,
+		wake:     make(chan struct{}, 1),
+		handlers: make(map[string]JobHandler),
+	}
+}
+
+// Handle sets the handler for a kind of job
+func (q *JobQueue) Handle(kind string, handler JobHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = handler
+}
+
+// Enqueue stores a job with a JSON payload to run as soon as a worker is free
+func (q *JobQueue) Enqueue(kind string, payload interface{}) (*Job, error) {
+	return q.EnqueueAt(kind, payload, time.Now().UTC())
+}
+
+// EnqueueAt stores a job with a JSON payload to run once runAt has passed
+func (q *JobQueue) EnqueueAt(kind string, payload interface{}, runAt time.Time) (*Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:          uuid.New().String(),
+		Kind:        kind,
+		Payload:     raw,
+		MaxAttempts: jobMaxAttempts,
+		RunAt:       runAt,
+		CreatedAt:   now,
+	}
+	if err := q.jobRepo.EnqueueJob(job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Start runs workers until ctx is done
+func (q *JobQueue) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go q.work(ctx)
+	}
+	log.Printf("[JOBS] Started %d workers", workers)
+}
+
+// work claims and runs due jobs, waiting for a nudge or the poll interval when there are none
+func (q *JobQueue) work(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		now := time.Now().UTC()
+		job, err := q.jobRepo.ClaimJob(now, now.Add(jobLease))
+		if err != nil {
+			log.Printf("[JOBS] Failed to claim a job: %v", err)
+		}
+		if job != nil {
+			q.run(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs a claimed job and completes, retries or dead-letters it
+func (q *JobQueue) run(ctx context.Context, job *Job) {
+	q.mu.RLock()
+	handler := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	var err error
+	if handler == nil {
+		// Retrying won't help a job nobody can run
+		err = fmt.Errorf("no handler for job kind %q", job.Kind)
+		job.MaxAttempts = job.Attempts
+	} else {
+		err = q.execute(ctx, handler, job)
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case err == nil:
+		if err := q.jobRepo.CompleteJob(job.ID); err != nil {
+			log.Printf("[JOBS] Failed to complete %s job %s: %v", job.Kind, job.ID, err)
+		}
+
+	case job.Attempts >= job.MaxAttempts:
+		log.Printf("[JOBS] %s job %s failed attempt %d of %d, moving it to the dead letters: %v",
+			job.Kind, job.ID, job.Attempts, job.MaxAttempts, err)
+		if err := q.jobRepo.DeadLetterJob(job, err.Error(), now); err != nil {
+			log.Printf("[JOBS] Failed to dead-letter %s job %s: %v", job.Kind, job.ID, err)
+		}
+
+	default:
+		retryAt := now.Add(jobBackoff(job.Attempts))
+		log.Printf("[JOBS] %s job %s failed attempt %d of %d, retrying at %s: %v",
+			job.Kind, job.ID, job.Attempts, job.MaxAttempts, retryAt.Format(time.RFC3339), err)
+		if err := q.jobRepo.RetryJob(job, retryAt, err.Error()); err != nil {
+			log.Printf("[JOBS] Failed to retry %s job %s: %v", job.Kind, job.ID, err)
+		}
+	}
+}
+
+// execute runs a handler within the job's lease, turning panics into errors
+func (q *JobQueue) execute(ctx context.Context, handler JobHandler, job *Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, jobLease)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// jobBackoff returns how long to wait before the attempt after the given one: doubling from
+// jobBackoffBase up to jobBackoffMax, with up to 20% jitter so failed jobs spread out
+func jobBackoff(attempt int) time.Duration {
+	// Attempts count from 1; a negative shift would panic
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := jobBackoffMax
+	if attempt < 20 {
+		if doubled := jobBackoffBase << (attempt - 1); doubled < jobBackoffMax {
+			backoff = doubled
+		}
+	}
+	return backoff + time.Duration(rand.Int63n(int64(backoff)/5+1))
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestJobBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		min     int64
+	}{
+		{-1, int64(jobBackoffBase)},
+		{0, int64(jobBackoffBase)},
+		{1, int64(jobBackoffBase)},
+		{2, int64(jobBackoffBase) * 2},
+		{100, int64(jobBackoffMax)},
+	}
+
+	for _, tt := range tests {
+		got := int64(jobBackoff(tt.attempt))
+		if got < tt.min || got > tt.min+tt.min/5 {
+			t.Errorf("jobBackoff(%d) = %d, want %d plus up to 20%%", tt.attempt, got, tt.min)
+		}
+	}
+}
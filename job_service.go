@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	supa "github.com/supabase-community/supabase-go"
+)
+
+// jobClaimCandidates is how many due jobs a PostgREST claim tries before giving up
+const jobClaimCandidates = 10
+
+// JobService handles job queue database operations; it is the PostgREST JobRepository.
+// PostgREST has no row locks, so a claim is an update conditioned on the attempt count
+// read with the job: whichever worker updates first wins, and the others try the next job.
+type JobService struct {
+	client *supa.Client
+}
+
+// NewJobService creates a new job service instance
+func NewJobService(supabaseClient *supa.Client) *JobService {
+	return &JobService{
+		client: supabaseClient,
+	}
+}
+
+// EnqueueJob stores a new job
+func (s *JobService) EnqueueJob(job *Job) error {
+	_, _, err := s.client.From("jobs").
+		Insert(job, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return nil
+}
+
+// ClaimJob leases the due job that has waited longest
+func (s *JobService) ClaimJob(now, lockedUntil time.Time) (*Job, error) {
+	at := now.UTC().Format(time.RFC3339Nano)
+	result, _, err := s.client.From("jobs").
+		Select("*", "", false).
+		Lte("run_at", at).
+		Or("locked_until.is.null,locked_until.lt."+quotePostgRESTValue(at), "").
+		Order("run_at", oldestFirst).
+		Limit(jobClaimCandidates, "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due jobs: %w", err)
+	}
+
+	var candidates []Job
+	if err := json.Unmarshal(result, &candidates); err != nil {
+		return nil, fmt.Errorf("failed to decode jobs: %w", err)
+	}
+
+	for _, candidate := range candidates {
+		result, _, err := s.client.From("jobs").
+			Update(map[string]interface{}{
+				"attempts":     candidate.Attempts + 1,
+				"locked_until": lockedUntil.UTC().Format(time.RFC3339Nano),
+			}, "", "").
+			Eq("id", candidate.ID).
+			Eq("attempts", strconv.Itoa(candidate.Attempts)).
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim job: %w", err)
+		}
+
+		var claimed []Job
+		if err := json.Unmarshal(result, &claimed); err != nil {
+			return nil, fmt.Errorf("failed to decode claimed job: %w", err)
+		}
+		if len(claimed) > 0 {
+			return &claimed[0], nil
+		}
+	}
+	return nil, nil
+}
+
+// CompleteJob deletes a finished job
+func (s *JobService) CompleteJob(jobID string) error {
+	_, _, err := s.client.From("jobs").
+		Delete("minimal", "").
+		Eq("id", jobID).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+	return nil
+}
+
+// RetryJob releases a claimed job to run again at runAt
+func (s *JobService) RetryJob(job *Job, runAt time.Time, lastError string) error {
+	_, _, err := s.client.From("jobs").
+		Update(map[string]interface{}{
+			"run_at":       runAt.UTC().Format(time.RFC3339Nano),
+			"locked_until": nil,
+			"last_error":   lastError,
+		}, "minimal", "").
+		Eq("id", job.ID).
+		Eq("attempts", strconv.Itoa(job.Attempts)).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+	return nil
+}
+
+// DeadLetterJob moves a job to the dead letters. PostgREST has no transactions, so the
+// dead letter is written first and the job is never lost.
+func (s *JobService) DeadLetterJob(job *Job, lastError string, failedAt time.Time) error {
+	_, _, err := s.client.From("dead_letter_jobs").
+		Insert(DeadLetterJob{
+			ID:        job.ID,
+			Kind:      job.Kind,
+			Payload:   job.Payload,
+			Attempts:  job.Attempts,
+			LastError: lastError,
+			CreatedAt: job.CreatedAt,
+			FailedAt:  failedAt,
+		}, true, "id", "minimal", "").
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter job: %w", err)
+	}
+
+	return s.CompleteJob(job.ID)
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strconv"
 
 	_ "social-messenger-backend/docs" // Import generated docs
 
@@ -32,37 +34,34 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
 
-// handleDatabaseTest creates a handler for database testing
-func handleDatabaseTest(supabaseService *SupabaseService) gin.HandlerFunc {
+// handleHealth reports that the server is running
+// @Summary Health check
+// @Description Check if the server is running
+// @Tags Health
+// @Produce json
+// @Success 200 {object} object{status=string} "Server is healthy"
+// @Router /health [get]
+func handleHealth(c *gin.Context) {
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+// handleDatabaseTest creates a handler for database testing. The error is only logged,
+// since it can carry the database's address or response.
+// @Summary Test database connection
+// @Description Check that the user store can be reached. Requires users:admin.
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} object{reachable=bool} "Database test result"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Router /admin/test-db [get]
+func handleDatabaseTest(userRepo UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Test 1: Try a simple select first
-		selectResult, selectCount, selectErr := supabaseService.client.From("users").
-			Select("*", "", false).
-			Execute()
-		
-		// Check what's in the environment
-		supabaseURL := os.Getenv("SUPABASE_URL")
-		supabaseKey := os.Getenv("SUPABASE_SERVICE_KEY")
-		
-		c.JSON(200, gin.H{
-			"select_result": string(selectResult),
-			"select_count": selectCount,
-			"select_error": func() string {
-				if selectErr != nil {
-					return selectErr.Error()
-				}
-				return ""
-			}(),
-			"message": "Direct insert methods removed - use auth endpoints for user creation",
-			"supabase_url": supabaseURL,
-			"key_length": len(supabaseKey),
-			"key_prefix": func() string {
-				if len(supabaseKey) > 20 {
-					return supabaseKey[:20] + "..."
-				}
-				return supabaseKey
-			}(),
-		})
+		pingErr := userRepo.Ping()
+		if pingErr != nil {
+			log.Printf("[ADMIN] Database test failed: %v", pingErr)
+		}
+		c.JSON(200, gin.H{"reachable": pingErr == nil})
 	}
 }
 
@@ -72,14 +71,29 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
-	// Initialize Supabase service
-	supabaseService, err := NewSupabaseService(
-		os.Getenv("SUPABASE_URL"),
-		os.Getenv("SUPABASE_SERVICE_KEY"),
-	)
+	// `migrate up|down|status` manages the database schema instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	// `backfill [channel-id...]` mirrors Stream Chat history into the messages table
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		os.Exit(runBackfill(os.Args[2:]))
+	}
+
+	// `webhook replay --id <delivery-id>` queues a stored webhook to be processed again
+	if len(os.Args) > 1 && os.Args[1] == "webhook" {
+		os.Exit(runWebhookCommand(os.Args[2:]))
+	}
+
+	// Open storage: Supabase (PostgREST) by default, or Postgres directly, or in memory
+	storageConfig := StorageConfigFromEnv()
+	repos, err := OpenRepositories(context.Background(), storageConfig)
 	if err != nil {
-		log.Fatal("Failed to initialize Supabase service:", err)
+		log.Fatal("Failed to initialize storage:", err)
 	}
+	defer repos.Close()
+	userRepo, messageRepo := repos.Users, repos.Messages
 
 	// Initialize Stream client
 	streamService := NewStreamService(
@@ -87,27 +101,111 @@ func main() {
 		os.Getenv("STREAM_SECRET"),
 	)
 
-	// Initialize message service
-	messageService := NewMessageService(supabaseService.client)
-
 	// Initialize ChatGPT service
 	chatGPTService := NewChatGPTService(os.Getenv("OPENAI_API_KEY"))
 
+	// Initialize session service for refresh tokens and revocation
+	sessionService := NewSessionService(userRepo)
+
+	// Load asymmetric JWT signing keys, if configured
+	signingKeys, err := LoadKeySet(os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+
 	// Initialize auth service with Supabase
-	authService := NewAuthService(os.Getenv("JWT_SECRET"), supabaseService)
+	siweChainID, _ := strconv.Atoi(os.Getenv("SIWE_CHAIN_ID"))
+	devMode, _ := strconv.ParseBool(os.Getenv("DEV_MODE"))
+	authService, err := NewAuthService(AuthConfig{
+		JWTSecret:     os.Getenv("JWT_SECRET"),
+		SigningKeys:   signingKeys,
+		Issuer:        os.Getenv("JWT_ISSUER"),
+		DevMode:       devMode,
+		SIWEDomain:    os.Getenv("SIWE_DOMAIN"),
+		SIWEChainID:   siweChainID,
+		SolanaCluster: os.Getenv("SOLANA_CLUSTER"),
+	}, userRepo, sessionService)
+	if err != nil {
+		log.Fatal("Failed to initialize auth service:", err)
+	}
 
 	// Initialize pub/sub service for handshakes
 	pubsubService := NewPubSubService()
 
 	// Initialize handshake service
-	handshakeService := NewHandshakeService(pubsubService)
+	handshakeService := NewHandshakeService(pubsubService, userRepo)
+
+	// Initialize API key service for service-to-service credentials
+	apiKeyService := NewAPIKeyService(userRepo)
+
+	// Initialize mailer for verification codes; without SMTP settings emails are only logged
+	var mailer Mailer = LogMailer{}
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		mailer = NewSMTPMailer(smtpAddr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_FROM"))
+	} else if !devMode {
+		log.Println("Warning: SMTP_ADDR is not set, verification emails will only be logged")
+	}
+
+	// Initialize identity service for linked wallets and emails
+	identityService := NewIdentityService(authService, userRepo, mailer)
+
+	// Initialize account service for data export and deletion, resuming deletions interrupted by a restart
+	accountService := NewAccountService(userRepo, messageRepo, streamService, sessionService, handshakeService)
+	go accountService.ResumeDeletions(context.Background())
+
+	// Initialize authorizer for ownership and channel membership checks
+	authorizer := NewAuthorizer(streamService)
+
+	// Initialize message editing, which keeps edited and deleted text as revisions
+	messageEditService := NewMessageEditService(messageRepo)
+
+	// Initialize message search, with semantic mode when an OpenAI key is set
+	messageSearchService := NewMessageSearchService(messageRepo, streamService, chatGPTService)
+
+	// Initialize threaded replies
+	messageThreadService := NewMessageThreadService(messageRepo, userRepo)
+
+	// Initialize the Stream Chat mirror, which stores webhook message events
+	streamMirrorService := NewStreamMirrorService(messageRepo, streamService)
+
+	// Initialize the webhook dispatcher. Local state is updated before the chatbot's
+	// handlers, registered by the webhook handler, run.
+	webhookDispatcher := NewWebhookDispatcher()
+	NewStreamEventHandlers(streamMirrorService, messageRepo, userRepo, accountService, sessionService).Register(webhookDispatcher)
+
+	// Initialize webhook deduplication: in memory for the memory backend, otherwise in the
+	// database so processed IDs survive restarts and are shared between replicas
+	var webhookDedupeStore WebhookDedupeStore = NewPersistentWebhookDedupeStore(repos.Webhooks, webhookDedupeTTL)
+	if storageConfig.Backend == StorageMemory {
+		webhookDedupeStore = NewLRUWebhookDedupeStore(webhookDedupeCapacity, webhookDedupeTTL)
+	}
+
+	// Initialize the job queue, and the webhook deliveries it processes in the background
+	jobQueue := NewJobQueue(repos.Jobs)
+	webhookDeliveryService := NewWebhookDeliveryService(repos.Webhooks, webhookDispatcher, jobQueue)
+
+	// Initialize the chatbot conversations, driven by both the webhook and /chatbot/chat.
+	// Accepted matches wait for the proposed user's consent before a channel is created.
+	matchConsentService := NewMatchConsentService(userRepo, streamService, jobQueue)
+	conversationMachine := NewConversationMachine(userRepo, chatGPTService, streamService, matchConsentService)
 
 	// Initialize handlers
-	authHandler := NewAuthHandler(authService, streamService)
-	streamHandler := NewStreamHandler(streamService, authService)
-	chatbotHandler := NewChatbotHandler(messageService, chatGPTService, authService, streamService)
-	webhookHandler := NewWebhookHandler(chatGPTService, streamService, authService)
+	authHandler := NewAuthHandler(authService, streamService, apiKeyService)
+	streamHandler := NewStreamHandler(streamService, authService, authorizer)
+	chatbotHandler := NewChatbotHandler(messageRepo, chatGPTService, authService, streamService, authorizer, messageThreadService, conversationMachine)
+	webhookHandler := NewWebhookHandler(chatGPTService, streamService, authService, webhookDispatcher, webhookDedupeStore, webhookDeliveryService, conversationMachine, streamMirrorService, messageThreadService)
 	handshakeHandler := NewHandshakeHandler(handshakeService, pubsubService)
+	identityHandler := NewIdentityHandler(identityService)
+	adminHandler := NewAdminHandler(authService, streamService, apiKeyService)
+	accountHandler := NewAccountHandler(accountService)
+	messageSearchHandler := NewMessageSearchHandler(messageSearchService, authorizer)
+	messageEditHandler := NewMessageEditHandler(messageEditService)
+	messageThreadHandler := NewMessageThreadHandler(messageThreadService, authorizer)
+	webhookDeliveryHandler := NewWebhookDeliveryHandler(webhookDeliveryService)
+	matchConsentHandler := NewMatchConsentHandler(matchConsentService)
+
+	// Start the job queue's workers now that the services have registered their job kinds
+	jobQueue.Start(context.Background(), jobWorkers)
 
 	// Setup router
 	r := gin.Default()
@@ -115,7 +213,7 @@ func main() {
 	// Configure CORS
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Accept", "X-Requested-With"}
 	config.ExposeHeaders = []string{"Content-Length", "Authorization"}
 	config.AllowCredentials = true
@@ -131,65 +229,160 @@ func main() {
 	// @Produce json
 	// @Success 200 {object} object{status=string} "Server is healthy"
 	// @Router /health [get]
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	r.GET("/health", handleHealth)
 
-	// Database test endpoint
-	// @Summary Test database connection
-	// @Description Test inserting data into the users table
-	// @Tags Testing
-	// @Produce json
-	// @Success 200 {object} object{test_data=string,result=string,count=int,error=string} "Database test result"
-	// @Router /test-db [get]
-	r.GET("/test-db", handleDatabaseTest(supabaseService))
+	// Public verification keys for tokens issued by this service
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
 
 	// Auth routes
+	r.GET("/auth/nonce", authHandler.GetNonce)
 	r.POST("/auth/login", authHandler.Login)
 	r.POST("/auth/register", authHandler.Register)
+	r.POST("/auth/refresh", authHandler.Refresh)
+
+	// Session routes (require a user access token; API keys are rejected)
+	sessionRoutes := r.Group("/auth", authHandler.AuthMiddleware(), authorizer.RequireUser())
+	sessionRoutes.POST("/logout", authHandler.Logout)
+	sessionRoutes.GET("/sessions", authHandler.ListSessions)
+	sessionRoutes.DELETE("/sessions/:session_id", authHandler.RevokeSession)
+
+	// Current user routes (require a user access token; API keys are rejected)
+	userRoutes := r.Group("/users/me", authHandler.AuthMiddleware(), authorizer.RequireUser())
 
-	// Handshake routes
+	// @Summary List linked identities
+	// @Description List the wallets and email addresses linked to the authenticated user
+	// @Tags Identities
+	// @Produce json
+	// @Security Bearer
+	// @Success 200 {array} Identity "Linked identities"
+	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /users/me/identities [get]
+	userRoutes.GET("/identities", identityHandler.ListIdentities)
+
+	// @Summary Link wallet
+	// @Description Link another wallet by signing a SIWE/SIWS message with it
+	// @Tags Identities
+	// @Accept json
+	// @Produce json
+	// @Security Bearer
+	// @Param request body LinkWalletRequest true "Signed message from the new wallet"
+	// @Success 201 {object} Identity "Linked wallet"
+	// @Failure 409 {object} ErrorResponse "Wallet is linked to another account"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /users/me/identities/wallet [post]
+	userRoutes.POST("/identities/wallet", identityHandler.LinkWallet)
+
+	// @Summary Link email
+	// @Description Send a verification code to an email address
+	// @Tags Identities
+	// @Accept json
+	// @Produce json
+	// @Security Bearer
+	// @Param request body LinkEmailRequest true "Email address"
+	// @Success 202 {object} object{message=string} "Verification code sent"
+	// @Failure 409 {object} ErrorResponse "Email is linked to another account"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /users/me/identities/email [post]
+	userRoutes.POST("/identities/email", identityHandler.LinkEmail)
+
+	// @Summary Verify email
+	// @Description Link an email address with the code sent to it
+	// @Tags Identities
+	// @Accept json
+	// @Produce json
+	// @Security Bearer
+	// @Param request body VerifyEmailRequest true "Email address and code"
+	// @Success 201 {object} Identity "Linked email"
+	// @Failure 400 {object} ErrorResponse "Invalid or expired code"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /users/me/identities/email/verify [post]
+	userRoutes.POST("/identities/email/verify", identityHandler.VerifyEmail)
+
+	// @Summary Unlink identity
+	// @Description Unlink a wallet or email; the last identity cannot be unlinked
+	// @Tags Identities
+	// @Produce json
+	// @Security Bearer
+	// @Param identity_id path string true "Identity ID"
+	// @Success 200 {object} object{message=string} "Identity unlinked"
+	// @Failure 409 {object} ErrorResponse "Cannot unlink the last identity"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /users/me/identities/{identity_id} [delete]
+	userRoutes.DELETE("/identities/:identity_id", identityHandler.UnlinkIdentity)
+
+	// @Summary Export my data
+	// @Description Download a zip archive of everything stored about the authenticated user
+	// @Tags Account
+	// @Produce application/zip
+	// @Security Bearer
+	// @Success 200 {file} file "Zip archive"
+	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /users/me/export [get]
+	userRoutes.GET("/export", accountHandler.ExportData)
+
+	// @Summary Delete my account
+	// @Description Delete the authenticated user's account in the background
+	// @Tags Account
+	// @Produce json
+	// @Security Bearer
+	// @Success 202 {object} AccountDeletion "Deletion job"
+	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /users/me [delete]
+	userRoutes.DELETE("", accountHandler.DeleteAccount)
+
+	// Handshake routes. All require a valid access token; the WebSocket rejects API keys.
 	// @Summary Send handshake
-	// @Description Send a handshake event to specific user or broadcast to all
+	// @Description Send a handshake event to specific user or broadcast to all, as the caller
 	// @Tags Handshake
 	// @Accept json
 	// @Produce json
-	// @Param uid query string true "User ID of sender"
+	// @Security Bearer
+	// @Param uid query string false "User ID of sender, with handshake:publish"
 	// @Param request body HandshakeRequest true "Handshake request"
 	// @Success 200 {object} object{message=string} "Handshake sent successfully"
 	// @Failure 400 {object} ErrorResponse "Invalid request"
+	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Forbidden"
 	// @Router /handshake/send [post]
-	r.POST("/handshake/send", handshakeHandler.SendHandshake)
+	r.POST("/handshake/send", authHandler.AuthMiddleware(), handshakeHandler.SendHandshake)
 
 	// @Summary Connect to handshake WebSocket
-	// @Description Establish WebSocket connection to receive real-time handshake events
+	// @Description Establish WebSocket connection to receive the caller's real-time handshake events
 	// @Tags Handshake
-	// @Param uid query string true "User ID"
+	// @Security Bearer
+	// @Param access_token query string false "Access token, when the Authorization header can't be set"
 	// @Success 101 {string} string "Switching Protocols"
-	// @Failure 400 {object} ErrorResponse "Invalid request"
+	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not a user"
 	// @Router /handshake/ws [get]
-	r.GET("/handshake/ws", handshakeHandler.WebSocketConnect)
+	r.GET("/handshake/ws", authHandler.WebSocketAuthMiddleware(), authorizer.RequireUser(), handshakeHandler.WebSocketConnect)
 
 	// @Summary Get active users
 	// @Description Get list of users currently connected to handshake events
 	// @Tags Handshake
 	// @Produce json
+	// @Security Bearer
 	// @Success 200 {object} object{users=[]string} "List of active users"
+	// @Failure 401 {object} ErrorResponse "Unauthorized"
 	// @Router /handshake/active [get]
-	r.GET("/handshake/active", handshakeHandler.GetActiveUsers)
+	r.GET("/handshake/active", authHandler.AuthMiddleware(), handshakeHandler.GetActiveUsers)
+
+	// Stream routes (require a valid access token)
+	streamRoutes := r.Group("/stream", authHandler.AuthMiddleware())
 
-	// Stream token routes
 	// @Summary Generate Stream token
 	// @Description Generate a Stream Chat token for authenticated user
 	// @Tags Stream
-	// @Accept json
 	// @Produce json
 	// @Security Bearer
-	// @Param request body TokenRequest true "Token request"
 	// @Success 200 {object} TokenResponse "Token generated successfully"
 	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not a user"
 	// @Router /stream/token [post]
-	r.POST("/stream/token", streamHandler.GenerateToken)
+	streamRoutes.POST("/token", authorizer.RequireUser(), streamHandler.GenerateToken)
 	
 	// @Summary Create or update Stream user
 	// @Description Create or update user in Stream Chat
@@ -200,8 +393,9 @@ func main() {
 	// @Param request body StreamUserRequest true "Stream user data"
 	// @Success 200 {object} object{message=string} "User created/updated successfully"
 	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Cannot update another user"
 	// @Router /stream/user [post]
-	r.POST("/stream/user", streamHandler.CreateOrUpdateUser)
+	streamRoutes.POST("/user", streamHandler.CreateOrUpdateUser)
 	
 	// @Summary Get user channels
 	// @Description Get all channels that a user is a member of
@@ -211,12 +405,15 @@ func main() {
 	// @Param user_id path string true "User ID"
 	// @Success 200 {array} StreamChannel "User channels"
 	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not the caller's user ID"
 	// @Failure 404 {object} ErrorResponse "User not found"
 	// @Failure 500 {object} ErrorResponse "Failed to retrieve channels"
 	// @Router /stream/channels/{user_id} [get]
-	r.GET("/stream/channels/:user_id", streamHandler.GetUserChannels)
+	streamRoutes.GET("/channels/:user_id", authorizer.RequireUserParam("user_id", PermissionAdminUsers), streamHandler.GetUserChannels)
+
+	// Chatbot routes (require a user access token; API keys are rejected)
+	chatbotRoutes := r.Group("/chatbot", authHandler.AuthMiddleware(), authorizer.RequireUser())
 
-	// Chatbot routes
 	// @Summary Chat with bot
 	// @Description Send a message to the chatbot and get a response
 	// @Tags Chatbot
@@ -227,20 +424,228 @@ func main() {
 	// @Success 200 {object} ChatbotResponse "Bot response"
 	// @Failure 400 {object} ErrorResponse "Invalid request"
 	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not a member of the channel, or not a user"
 	// @Router /chatbot/chat [post]
-	r.POST("/chatbot/chat", chatbotHandler.ChatWithBot)
+	chatbotRoutes.POST("/chat", chatbotHandler.ChatWithBot)
+
+	// @Summary Accept match request
+	// @Description Accept meeting a user who accepted the chatbot's suggestion to meet the caller, creating a channel between both
+	// @Tags Chatbot
+	// @Produce json
+	// @Security Bearer
+	// @Param proposal_id path string true "Match proposal ID"
+	// @Success 200 {object} MatchProposal "Accepted match proposal"
+	// @Failure 404 {object} ErrorResponse "Match request not found"
+	// @Failure 409 {object} ErrorResponse "Match request closed"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /chatbot/matches/{proposal_id}/accept [post]
+	chatbotRoutes.POST("/matches/:proposal_id/accept", matchConsentHandler.AcceptMatch)
+
+	// @Summary Decline match request
+	// @Description Decline meeting a user who accepted the chatbot's suggestion to meet the caller
+	// @Tags Chatbot
+	// @Produce json
+	// @Security Bearer
+	// @Param proposal_id path string true "Match proposal ID"
+	// @Success 200 {object} MatchProposal "Rejected match proposal"
+	// @Failure 404 {object} ErrorResponse "Match request not found"
+	// @Failure 409 {object} ErrorResponse "Match request closed"
+	// @Failure 403 {object} ErrorResponse "Not a user"
+	// @Router /chatbot/matches/{proposal_id}/decline [post]
+	chatbotRoutes.POST("/matches/:proposal_id/decline", matchConsentHandler.DeclineMatch)
+
+	// Message routes (require a valid access token)
+	messageRoutes := r.Group("/messages", authHandler.AuthMiddleware())
 
-	// Message routes
 	// @Summary Get channel messages
-	// @Description Retrieve messages from a specific channel
+	// @Description Retrieve a page of messages from a specific channel, paged with before/after cursors
 	// @Tags Messages
 	// @Produce json
 	// @Security Bearer
 	// @Param channel_id path string true "Channel ID"
-	// @Success 200 {array} Message "Channel messages"
+	// @Success 200 {object} MessagePage "Channel messages"
 	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not a member of the channel"
 	// @Router /messages/channel/{channel_id} [get]
-	r.GET("/messages/channel/:channel_id", chatbotHandler.GetChannelMessages)
+	messageRoutes.GET("/channel/:channel_id", authorizer.RequireChannelParam("channel_id", PermissionReadMessages), chatbotHandler.GetChannelMessages)
+
+	// @Summary Search messages
+	// @Description Search messages by keyword or meaning in the caller's channels
+	// @Tags Messages
+	// @Produce json
+	// @Security Bearer
+	// @Param q query string true "Search text"
+	// @Success 200 {object} MessageSearchResponse "Search results"
+	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Not a member of the channel"
+	// @Router /messages/search [get]
+	messageRoutes.GET("/search", messageSearchHandler.SearchMessages)
+
+	// @Summary Edit a message
+	// @Description Replace the text of the caller's message, keeping the old text as a revision
+	// @Tags Messages
+	// @Accept json
+	// @Produce json
+	// @Security Bearer
+	// @Param message_id path string true "Message ID"
+	// @Param request body EditMessageRequest true "New text"
+	// @Success 200 {object} Message "Edited message"
+	// @Failure 403 {object} ErrorResponse "Not the sender"
+	// @Router /messages/{message_id} [patch]
+	messageRoutes.PATCH("/:message_id", messageEditHandler.EditMessage)
+
+	// @Summary Delete a message
+	// @Description Turn a message into a tombstone with a reason; senders and moderators only
+	// @Tags Messages
+	// @Accept json
+	// @Produce json
+	// @Security Bearer
+	// @Param message_id path string true "Message ID"
+	// @Success 200 {object} Message "Tombstone"
+	// @Failure 403 {object} ErrorResponse "Not the sender or a moderator"
+	// @Router /messages/{message_id} [delete]
+	messageRoutes.DELETE("/:message_id", messageEditHandler.DeleteMessage)
+
+	// @Summary Get message revisions
+	// @Description Get a message's earlier texts; senders and moderators only
+	// @Tags Messages
+	// @Produce json
+	// @Security Bearer
+	// @Param message_id path string true "Message ID"
+	// @Success 200 {object} MessageHistory "Message and revisions"
+	// @Router /messages/{message_id}/revisions [get]
+	messageRoutes.GET("/:message_id/revisions", messageEditHandler.GetRevisions)
+
+	// @Summary Get a message thread
+	// @Description Get a thread's root and a page of its replies, paged with before/after cursors
+	// @Tags Messages
+	// @Produce json
+	// @Security Bearer
+	// @Param message_id path string true "Message ID"
+	// @Success 200 {object} MessageThread "Thread"
+	// @Failure 403 {object} ErrorResponse "Not a member of the channel"
+	// @Router /messages/{message_id}/thread [get]
+	messageRoutes.GET("/:message_id/thread", messageThreadHandler.GetThread)
+
+	// @Summary Reply to a message
+	// @Description Post a reply in a message's thread as the signed-in user
+	// @Tags Messages
+	// @Accept json
+	// @Produce json
+	// @Security Bearer
+	// @Param message_id path string true "Message ID"
+	// @Param request body ReplyRequest true "Reply text"
+	// @Success 201 {object} Message "Stored reply"
+	// @Failure 403 {object} ErrorResponse "Not a member of the channel, or not a user"
+	// @Router /messages/{message_id}/thread [post]
+	messageRoutes.POST("/:message_id/thread", authorizer.RequireUser(), messageThreadHandler.Reply)
+
+	// Admin routes (require the users:admin permission)
+	adminRoutes := r.Group("/admin", authHandler.AuthMiddleware(), authorizer.RequirePermission(PermissionAdminUsers))
+
+	// @Summary Change a user's role
+	// @Description Set a user's role and sync it to Stream Chat
+	// @Tags Admin
+	// @Accept json
+	// @Produce json
+	// @Security Bearer
+	// @Param user_id path string true "User ID"
+	// @Param request body UpdateRoleRequest true "New role"
+	// @Success 200 {object} User "Updated user"
+	// @Failure 400 {object} ErrorResponse "Invalid role"
+	// @Failure 401 {object} ErrorResponse "Unauthorized"
+	// @Failure 403 {object} ErrorResponse "Forbidden"
+	// @Router /admin/users/{user_id}/role [put]
+	adminRoutes.PUT("/users/:user_id/role", adminHandler.UpdateUserRole)
+
+	// @Summary Create API key
+	// @Description Create a scoped API key; the raw key is only returned once
+	// @Tags Admin
+	// @Accept json
+	// @Produce json
+	// @Security Bearer
+	// @Param request body CreateAPIKeyRequest true "API key name, scopes and expiry"
+	// @Success 201 {object} CreateAPIKeyResponse "Created API key"
+	// @Failure 400 {object} ErrorResponse "Invalid request"
+	// @Failure 403 {object} ErrorResponse "Forbidden"
+	// @Router /admin/api-keys [post]
+	adminRoutes.POST("/api-keys", adminHandler.CreateAPIKey)
+
+	// @Summary List API keys
+	// @Description List all API keys with their scopes and last use
+	// @Tags Admin
+	// @Produce json
+	// @Security Bearer
+	// @Success 200 {array} APIKey "API keys"
+	// @Failure 403 {object} ErrorResponse "Forbidden"
+	// @Router /admin/api-keys [get]
+	adminRoutes.GET("/api-keys", adminHandler.ListAPIKeys)
+
+	// @Summary Revoke API key
+	// @Description Revoke an API key so it can no longer be used
+	// @Tags Admin
+	// @Produce json
+	// @Security Bearer
+	// @Param key_id path string true "API key ID"
+	// @Success 200 {object} object{message=string} "API key revoked"
+	// @Failure 404 {object} ErrorResponse "API key not found"
+	// @Router /admin/api-keys/{key_id} [delete]
+	adminRoutes.DELETE("/api-keys/:key_id", adminHandler.RevokeAPIKey)
+
+	// @Summary List unfinished account deletions
+	// @Description List account deletion jobs that are pending, running or failed
+	// @Tags Admin
+	// @Produce json
+	// @Security Bearer
+	// @Success 200 {array} AccountDeletion "Deletion jobs"
+	// @Failure 403 {object} ErrorResponse "Forbidden"
+	// @Router /admin/account-deletions [get]
+	adminRoutes.GET("/account-deletions", accountHandler.ListDeletions)
+
+	// @Summary Retry account deletion
+	// @Description Run the remaining steps of a user's account deletion
+	// @Tags Admin
+	// @Produce json
+	// @Security Bearer
+	// @Param user_id path string true "User ID"
+	// @Success 202 {object} object{message=string} "Deletion resumed"
+	// @Failure 404 {object} ErrorResponse "No deletion requested for the user"
+	// @Failure 409 {object} ErrorResponse "Deletion already running"
+	// @Router /admin/account-deletions/{user_id}/retry [post]
+	adminRoutes.POST("/account-deletions/:user_id/retry", accountHandler.RetryDeletion)
+
+	// @Summary List webhook deliveries
+	// @Description List stored Stream Chat webhooks, newest first, filtered by event type, status, webhook ID or time
+	// @Tags Admin
+	// @Produce json
+	// @Security Bearer
+	// @Success 200 {array} WebhookDelivery "Webhook deliveries"
+	// @Failure 400 {object} ErrorResponse "Invalid request"
+	// @Failure 403 {object} ErrorResponse "Forbidden"
+	// @Router /admin/webhooks [get]
+	adminRoutes.GET("/webhooks", webhookDeliveryHandler.ListDeliveries)
+
+	// @Summary Replay webhook delivery
+	// @Description Queue a stored webhook to be processed again, skipping deduplication
+	// @Tags Admin
+	// @Produce json
+	// @Security Bearer
+	// @Param delivery_id path string true "Webhook delivery ID"
+	// @Success 202 {object} Job "Replay queued"
+	// @Failure 404 {object} ErrorResponse "Delivery not found"
+	// @Router /admin/webhooks/{delivery_id}/replay [post]
+	adminRoutes.POST("/webhooks/:delivery_id/replay", webhookDeliveryHandler.ReplayDelivery)
+
+	// Database test endpoint
+	// @Summary Test database connection
+	// @Description Check that the user store can be reached. Requires users:admin.
+	// @Tags Admin
+	// @Produce json
+	// @Security Bearer
+	// @Success 200 {object} object{reachable=bool} "Database test result"
+	// @Failure 403 {object} ErrorResponse "Forbidden"
+	// @Router /admin/test-db [get]
+	adminRoutes.GET("/test-db", handleDatabaseTest(userRepo))
 
 	// Webhook routes
 	// @Summary Handle Stream webhook
@@ -249,8 +654,10 @@ func main() {
 	// @Accept json
 	// @Produce json
 	// @Param request body StreamWebhookEvent true "Webhook event"
-	// @Success 200 {object} WebhookResponse "Webhook processed"
+	// @Success 200 {object} object{status=string} "Webhook queued or already processed"
 	// @Failure 400 {object} ErrorResponse "Invalid request"
+	// @Failure 401 {object} ErrorResponse "Invalid API key or signature"
+	// @Failure 500 {object} ErrorResponse "Failed to queue event"
 	// @Router /webhooks/stream [post]
 	r.POST("/webhooks/stream", webhookHandler.HandleStreamWebhook)
 
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MatchConsentHandler handles proposed users' answers to match requests
+type MatchConsentHandler struct {
+	consents *MatchConsentService
+}
+
+// NewMatchConsentHandler creates a new match consent handler
+func NewMatchConsentHandler(consents *MatchConsentService) *MatchConsentHandler {
+	return &MatchConsentHandler{
+		consents: consents,
+	}
+}
+
+// AcceptMatch handles accepting a match request
+// @Summary Accept match request
+// @Description Accept meeting a user who accepted the chatbot's suggestion to meet the caller. Creates a channel between both users and tells both in their AI chats. This is the accept_match button of the match request message, whose value is the proposal ID.
+// @Tags Chatbot
+// @Produce json
+// @Security Bearer
+// @Param proposal_id path string true "Match proposal ID"
+// @Success 200 {object} MatchProposal "Accepted match proposal"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 404 {object} ErrorResponse "Match request not found"
+// @Failure 409 {object} ErrorResponse "Match request already answered, expired or cancelled"
+// @Failure 500 {object} ErrorResponse "Failed to accept match"
+// @Router /chatbot/matches/{proposal_id}/accept [post]
+func (h *MatchConsentHandler) AcceptMatch(c *gin.Context) {
+	h.respond(c, true)
+}
+
+// DeclineMatch handles declining a match request
+// @Summary Decline match request
+// @Description Decline meeting a user who accepted the chatbot's suggestion to meet the caller. The other user is told, and no channel is created. This is the decline_match button of the match request message, whose value is the proposal ID.
+// @Tags Chatbot
+// @Produce json
+// @Security Bearer
+// @Param proposal_id path string true "Match proposal ID"
+// @Success 200 {object} MatchProposal "Rejected match proposal"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
+// @Failure 404 {object} ErrorResponse "Match request not found"
+// @Failure 409 {object} ErrorResponse "Match request already answered, expired or cancelled"
+// @Failure 500 {object} ErrorResponse "Failed to decline match"
+// @Router /chatbot/matches/{proposal_id}/decline [post]
+func (h *MatchConsentHandler) DeclineMatch(c *gin.Context) {
+	h.respond(c, false)
+}
+
+// respond records the caller's answer to a match request
+func (h *MatchConsentHandler) respond(c *gin.Context, accept bool) {
+	proposal, err := h.consents.Respond(c.Request.Context(), c.Param("proposal_id"), CallerID(c), accept)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrProposalNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "match_request_not_found", Message: err.Error()})
+		case errors.Is(err, ErrProposalNotOpen):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "match_request_closed", Message: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "match_response_failed", Message: err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, proposal)
+}
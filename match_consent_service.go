@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// matchConsentTimeout is how long a proposed user has to accept meeting a user
+const matchConsentTimeout = 24 * time.Hour
+
+// matchConsentExpiryJob is the kind of job that expires an unanswered match request
+const matchConsentExpiryJob = "match_consent_expiry"
+
+// Match request actions, the names of the buttons sent to the proposed user. Each button's
+// value is the proposal ID, to post to /chatbot/matches/{proposal_id}/accept or decline.
+const (
+	matchConsentAccept  = "accept_match"
+	matchConsentDecline = "decline_match"
+)
+
+// Match consent errors
+var (
+	ErrProposalNotFound = errors.New("match proposal not found")
+	ErrProposalNotOpen  = errors.New("match proposal is no longer awaiting an answer")
+)
+
+// matchConsentJobPayload is the payload of a match_consent_expiry job
+type matchConsentJobPayload struct {
+	ProposalID string `json:"proposal_id"`
+}
+
+// MatchConsentService asks proposed users whether they want to meet the users who accepted
+// them, in their own AI chat. Match channels are only created once both users accept.
+type MatchConsentService struct {
+	userRepo      UserRepository
+	streamService *StreamService
+	jobQueue      *JobQueue
+}
+
+// NewMatchConsentService creates a match consent service, registering request expiry with
+// the job queue
+func NewMatchConsentService(userRepo UserRepository, streamService *StreamService, jobQueue *JobQueue) *MatchConsentService {
+	s := &MatchConsentService{
+		userRepo:      userRepo,
+		streamService: streamService,
+		jobQueue:      jobQueue,
+	}
+	jobQueue.Handle(matchConsentExpiryJob, s.expire)
+	return s
+}
+
+// Request records that a user accepted a proposal and sends the proposed user accept and
+// decline buttons. It reports false if the proposal was no longer open.
+func (s *MatchConsentService) Request(user, recommended *User, proposal *MatchProposal) (bool, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(matchConsentTimeout)
+	requested, err := s.userRepo.RequestMatchConsent(proposal.ID, now, expiresAt)
+	if err != nil || !requested {
+		return false, err
+	}
+	proposal.Status = ProposalAwaitingConsent
+	proposal.RespondedAt = &now
+	proposal.ExpiresAt = expiresAt
+
+	// Answers after the deadline are refused anyway, so a missing expiry job only delays
+	// telling the users
+	if _, err := s.jobQueue.EnqueueAt(matchConsentExpiryJob, matchConsentJobPayload{ProposalID: proposal.ID}, expiresAt); err != nil {
+		log.Printf("[MATCHING] Failed to schedule expiry of proposal %s: %v", proposal.ID, err)
+	}
+
+	text := fmt.Sprintf("%s would like to meet you! Should I connect you two? This request expires in 24 hours.", user.Name)
+	attachment := StreamAttachment{
+		Type:     "match_request",
+		Title:    user.Name,
+		Text:     user.Bio,
+		ThumbURL: user.ProfilePicURL,
+		Fallback: text,
+		Actions: []StreamAction{
+			{Name: matchConsentAccept, Text: "Accept", Type: "button", Value: proposal.ID, Style: "primary"},
+			{Name: matchConsentDecline, Text: "Decline", Type: "button", Value: proposal.ID},
+		},
+	}
+	if err := s.streamService.SendMessageWithAttachments(aiChatCID(recommended.ID), text, "ai-assistant", []StreamAttachment{attachment}); err != nil {
+		// Nobody can answer a request that never arrived, so withdraw it
+		if _, err := s.userRepo.AnswerMatchConsent(proposal.ID, ProposalCancelled, time.Now().UTC()); err != nil {
+			log.Printf("[MATCHING] Failed to cancel undelivered request %s: %v", proposal.ID, err)
+		}
+		return false, fmt.Errorf("failed to send match request to %s: %w", recommended.ID, err)
+	}
+
+	log.Printf("[MATCHING] Asked %s whether to meet %s for proposal %s", recommended.ID, user.ID, proposal.ID)
+	return true, nil
+}
+
+// Respond records the proposed user's answer to a match request and tells both users. When
+// they accept, both users get a channel with an introduction.
+func (s *MatchConsentService) Respond(ctx context.Context, proposalID, userID string, accept bool) (*MatchProposal, error) {
+	proposal, err := s.get(proposalID)
+	if err != nil {
+		return nil, err
+	}
+	// Other users can't tell whether a request exists
+	if proposal.ProposedUserID != userID {
+		return nil, ErrProposalNotFound
+	}
+	if proposal.Status != ProposalAwaitingConsent {
+		return nil, ErrProposalNotOpen
+	}
+
+	now := time.Now().UTC()
+	if !now.Before(proposal.ExpiresAt) {
+		if err := s.expireProposal(proposal, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrProposalNotOpen
+	}
+
+	requester, err := s.userRepo.GetUserByID(proposal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	recommended, err := s.userRepo.GetUserByID(proposal.ProposedUserID)
+	if err != nil {
+		return nil, err
+	}
+	if requester == nil || recommended == nil {
+		return nil, ErrProposalNotFound
+	}
+
+	if !accept {
+		return s.reject(proposal, requester, recommended, now)
+	}
+	return s.connect(ctx, proposal, requester, recommended, now)
+}
+
+// connect creates a channel between two users who both accepted, and introduces them
+func (s *MatchConsentService) connect(ctx context.Context, proposal *MatchProposal, requester, recommended *User, now time.Time) (*MatchProposal, error) {
+	// The request stays open until the channel exists, so accepting again retries
+	matchChannelID, err := s.streamService.CreateUserMatchChannel(ctx, requester.ID, recommended.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	answered, err := s.userRepo.AnswerMatchConsent(proposal.ID, ProposalAccepted, now)
+	if err != nil {
+		return nil, err
+	}
+	if !answered {
+		return nil, ErrProposalNotOpen
+	}
+	proposal.Status = ProposalAccepted
+	proposal.ConsentRespondedAt = &now
+
+	introMessage := fmt.Sprintf(`Hi! I'm Oliver, and I've connected you two because I thought you might hit it off!
+
+👋 %s, meet %s
+👋 %s, meet %s
+
+Feel free to introduce yourselves and start chatting. Have fun getting to know each other!`,
+		requester.Name, recommended.Name,
+		recommended.Name, requester.Name)
+
+	matchChannelCID := fmt.Sprintf("messaging:%s", matchChannelID)
+	if err := s.streamService.SendMessage(matchChannelCID, introMessage, "ai-assistant"); err != nil {
+		log.Printf("[MATCHING] Error sending introduction message: %v", err)
+	}
+
+	s.notify(requester.ID, fmt.Sprintf("Good news! %s wants to meet you too, so I've created a chat between you two. Check your channels to start the conversation!", recommended.Name))
+	s.notify(recommended.ID, fmt.Sprintf("Perfect! I've created a chat between you and %s. Check your channels to start the conversation!", requester.Name))
+
+	log.Printf("[MATCHING] Successfully connected users %s and %s", requester.ID, recommended.ID)
+	return proposal, nil
+}
+
+// reject records that the proposed user declined, and tells both users
+func (s *MatchConsentService) reject(proposal *MatchProposal, requester, recommended *User, now time.Time) (*MatchProposal, error) {
+	answered, err := s.userRepo.AnswerMatchConsent(proposal.ID, ProposalRejected, now)
+	if err != nil {
+		return nil, err
+	}
+	if !answered {
+		return nil, ErrProposalNotOpen
+	}
+	proposal.Status = ProposalRejected
+	proposal.ConsentRespondedAt = &now
+
+	s.notify(requester.ID, fmt.Sprintf("%s isn't able to meet right now. Just tell me whenever you'd like to meet someone else!", recommended.Name))
+	s.notify(recommended.ID, fmt.Sprintf("No problem, I won't connect you with %s.", requester.Name))
+
+	log.Printf("[MATCHING] User %s declined meeting %s for proposal %s", recommended.ID, requester.ID, proposal.ID)
+	return proposal, nil
+}
+
+// expire runs a match_consent_expiry job, expiring the request if it's still unanswered
+func (s *MatchConsentService) expire(ctx context.Context, job *Job) error {
+	var payload matchConsentJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse job payload: %w", err)
+	}
+
+	proposal, err := s.userRepo.GetMatchProposal(payload.ProposalID)
+	if err != nil {
+		return err
+	}
+	if proposal == nil || proposal.Status != ProposalAwaitingConsent {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	if now.Before(proposal.ExpiresAt) {
+		return fmt.Errorf("proposal %s doesn't expire until %s", proposal.ID, proposal.ExpiresAt.Format(time.RFC3339))
+	}
+	return s.expireProposal(proposal, now)
+}
+
+// expireProposal expires an unanswered match request and tells both users
+func (s *MatchConsentService) expireProposal(proposal *MatchProposal, now time.Time) error {
+	expired, err := s.userRepo.AnswerMatchConsent(proposal.ID, ProposalExpired, now)
+	if err != nil || !expired {
+		return err
+	}
+	log.Printf("[MATCHING] Request to %s for proposal %s expired", proposal.ProposedUserID, proposal.ID)
+
+	requester, err := s.userRepo.GetUserByID(proposal.UserID)
+	if err != nil {
+		return err
+	}
+	recommended, err := s.userRepo.GetUserByID(proposal.ProposedUserID)
+	if err != nil {
+		return err
+	}
+	if requester == nil || recommended == nil {
+		return nil
+	}
+
+	s.notify(requester.ID, fmt.Sprintf("%s didn't answer in time, so I haven't connected you. Just tell me whenever you'd like to meet someone else!", recommended.Name))
+	s.notify(recommended.ID, fmt.Sprintf("The request to meet %s has expired.", requester.Name))
+	return nil
+}
+
+// get retrieves a proposal, treating malformed IDs as not found
+func (s *MatchConsentService) get(proposalID string) (*MatchProposal, error) {
+	if _, err := uuid.Parse(proposalID); err != nil {
+		return nil, ErrProposalNotFound
+	}
+	proposal, err := s.userRepo.GetMatchProposal(proposalID)
+	if err != nil {
+		return nil, err
+	}
+	if proposal == nil {
+		return nil, ErrProposalNotFound
+	}
+	return proposal, nil
+}
+
+// notify sends a user a message from the chatbot in their AI chat
+func (s *MatchConsentService) notify(userID, text string) {
+	if err := s.streamService.SendMessage(aiChatCID(userID), text, "ai-assistant"); err != nil {
+		log.Printf("[MATCHING] Error notifying %s: %v", userID, err)
+	}
+}
+
+// aiChatCID returns the CID of a user's AI chat channel
+func aiChatCID(userID string) string {
+	return "messaging:ai-chat-" + userID
+}
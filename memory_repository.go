@@ -0,0 +1,1513 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryUserRepository is a thread-safe, in-process UserRepository for tests and local
+// development. It follows the Supabase schema's constraints and cascades.
+type MemoryUserRepository struct {
+	mu                 sync.RWMutex
+	users              map[string]User
+	nonces             map[string]AuthNonce
+	sessions           map[string]Session
+	refreshTokens      map[string]RefreshToken
+	apiKeys            map[string]APIKey
+	identities         map[string]Identity
+	emailVerifications map[string]EmailVerification // Keyed by user ID and email
+	handshakes         []HandshakeEvent
+	accountDeletions   map[string]AccountDeletion
+	conversations      map[string]ConversationState
+	proposals          []MatchProposal // In insertion order
+}
+
+// NewMemoryUserRepository creates an empty in-memory user repository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:              make(map[string]User),
+		nonces:             make(map[string]AuthNonce),
+		sessions:           make(map[string]Session),
+		refreshTokens:      make(map[string]RefreshToken),
+		apiKeys:            make(map[string]APIKey),
+		identities:         make(map[string]Identity),
+		emailVerifications: make(map[string]EmailVerification),
+		accountDeletions:   make(map[string]AccountDeletion),
+		conversations:      make(map[string]ConversationState),
+	}
+}
+
+// Ping always succeeds
+func (r *MemoryUserRepository) Ping() error {
+	return nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *MemoryUserRepository) GetUserByID(id string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if user, ok := r.users[id]; ok {
+		return &user, nil
+	}
+	return nil, nil
+}
+
+// GetUserByUsername retrieves a user by username
+func (r *MemoryUserRepository) GetUserByUsername(username string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetUserByWallet retrieves the user a wallet is linked to, by chain and normalized address
+func (r *MemoryUserRepository) GetUserByWallet(wallet WalletIdentity) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user := r.userByWallet(wallet); user != nil || wallet.Chain != ChainEVM {
+		return user, nil
+	}
+
+	// Rows from before chain_type existed are EVM wallets in whatever case they were
+	// registered in. Claim them for EVM on first sign-in, as migration 0001 does.
+	for id, user := range r.users {
+		if user.ChainType == "" && strings.EqualFold(user.WalletAddress, wallet.Address) {
+			user.ChainType = ChainEVM
+			user.WalletAddress = wallet.Address
+			r.users[id] = user
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// userByWallet looks a wallet up in identities, then in primary wallet columns. Callers hold the lock.
+func (r *MemoryUserRepository) userByWallet(wallet WalletIdentity) *User {
+	for _, identity := range r.identities {
+		if identity.Provider == IdentityProvider(wallet.Chain) && identity.Subject == wallet.Address {
+			if user, ok := r.users[identity.UserID]; ok {
+				return &user
+			}
+		}
+	}
+	for _, user := range r.users {
+		if user.ChainType == wallet.Chain && user.WalletAddress == wallet.Address {
+			return &user
+		}
+	}
+	return nil
+}
+
+// CreateUser creates a user, or returns the existing one if its wallet is already known.
+// The user's wallet is also linked as an identity.
+func (r *MemoryUserRepository) CreateUser(user *User) (*User, error) {
+	if err := ValidateUserFields(user.Username, user.Name, user.Bio); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.WalletAddress != "" {
+		if existing := r.userByWallet(WalletIdentity{Chain: user.ChainType, Address: user.WalletAddress}); existing != nil {
+			return existing, nil
+		}
+	}
+
+	created := *user
+	if created.ID == "" {
+		created.ID = uuid.New().String()
+	}
+	if _, ok := r.users[created.ID]; ok {
+		return nil, fmt.Errorf("user %s already exists", created.ID)
+	}
+	if created.Username != "" {
+		for _, other := range r.users {
+			if other.Username == created.Username {
+				return nil, fmt.Errorf("username %s is already taken", created.Username)
+			}
+		}
+	}
+	if created.Role == "" {
+		created.Role = RoleUser
+	}
+	created.CreatedAt = time.Now().UTC()
+	r.users[created.ID] = created
+
+	if created.WalletAddress != "" {
+		identity := Identity{
+			ID:        uuid.New().String(),
+			UserID:    created.ID,
+			Provider:  IdentityProvider(created.ChainType),
+			Subject:   created.WalletAddress,
+			CreatedAt: created.CreatedAt,
+		}
+		r.identities[identity.ID] = identity
+	}
+
+	return &created, nil
+}
+
+// UpdateUser applies column updates, keyed by JSON field name, to a user
+func (r *MemoryUserRepository) UpdateUser(id string, updates map[string]interface{}) (*User, error) {
+	username, _ := updates["username"].(string)
+	name, _ := updates["name"].(string)
+	bio, _ := updates["bio"].(string)
+	if err := ValidateUserFields(username, name, bio); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	var updated User
+	if err := applyUpdates(user, updates, &updated); err != nil {
+		return nil, err
+	}
+	updated.ID = id
+	r.users[id] = updated
+
+	return &updated, nil
+}
+
+// GetUsersExcluding gets up to limit users other than excludeUserID, oldest first
+func (r *MemoryUserRepository) GetUsersExcluding(excludeUserID string, limit int) ([]User, error) {
+	if limit <= 0 {
+		limit = 10 // Default limit
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]User, 0, len(r.users))
+	for _, user := range r.users {
+		if user.ID != excludeUserID {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].ID < users[j].ID
+		}
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// DeleteUserRow deletes a user along with their sessions, refresh tokens, identities, email
+// codes, conversation state and match proposals
+func (r *MemoryUserRepository) DeleteUserRow(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.users, id)
+
+	for sessionID, session := range r.sessions {
+		if session.UserID != id {
+			continue
+		}
+		delete(r.sessions, sessionID)
+		for hash, token := range r.refreshTokens {
+			if token.SessionID == sessionID {
+				delete(r.refreshTokens, hash)
+			}
+		}
+	}
+	for identityID, identity := range r.identities {
+		if identity.UserID == id {
+			delete(r.identities, identityID)
+		}
+	}
+	for key, verification := range r.emailVerifications {
+		if verification.UserID == id {
+			delete(r.emailVerifications, key)
+		}
+	}
+	for keyID, key := range r.apiKeys {
+		if key.CreatedBy == id {
+			key.CreatedBy = ""
+			r.apiKeys[keyID] = key
+		}
+	}
+	delete(r.conversations, id)
+	kept := r.proposals[:0]
+	for _, proposal := range r.proposals {
+		if proposal.UserID != id && proposal.ProposedUserID != id {
+			kept = append(kept, proposal)
+		}
+	}
+	r.proposals = kept
+
+	return nil
+}
+
+// CreateNonce stores a new sign-in nonce
+func (r *MemoryUserRepository) CreateNonce(nonce *AuthNonce) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.nonces[nonce.Nonce]; ok {
+		return fmt.Errorf("failed to store nonce: nonce already exists")
+	}
+
+	stored := *nonce
+	stored.CreatedAt = time.Now().UTC()
+	r.nonces[nonce.Nonce] = stored
+	return nil
+}
+
+// ConsumeNonce deletes a nonce and returns it, or nil if it was never issued or already used
+func (r *MemoryUserRepository) ConsumeNonce(nonce string) (*AuthNonce, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.nonces[nonce]
+	if !ok {
+		return nil, nil
+	}
+	delete(r.nonces, nonce)
+	return &stored, nil
+}
+
+// DeleteExpiredNonces removes nonces that can no longer be used
+func (r *MemoryUserRepository) DeleteExpiredNonces() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, nonce := range r.nonces {
+		if nonce.ExpiresAt.Before(now) {
+			delete(r.nonces, key)
+		}
+	}
+	return nil
+}
+
+// CreateSession stores a new login session
+func (r *MemoryUserRepository) CreateSession(session *Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[session.UserID]; !ok {
+		return fmt.Errorf("failed to create session: user %s does not exist", session.UserID)
+	}
+
+	stored := *session
+	lastUsedAt := session.CreatedAt
+	stored.LastUsedAt = &lastUsedAt
+	stored.Current = false
+	r.sessions[session.ID] = stored
+	return nil
+}
+
+// GetSession retrieves a session by ID
+func (r *MemoryUserRepository) GetSession(id string) (*Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if session, ok := r.sessions[id]; ok {
+		return &session, nil
+	}
+	return nil, nil
+}
+
+// ListActiveSessions retrieves a user's sessions that are neither revoked nor expired, most recently used first
+func (r *MemoryUserRepository) ListActiveSessions(userID string) ([]Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return lastUsed(sessions[i]).After(lastUsed(sessions[j]))
+	})
+	return sessions, nil
+}
+
+// TouchSession records session activity and extends its expiry
+func (r *MemoryUserRepository) TouchSession(id string, lastUsedAt, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		session.LastUsedAt = &lastUsedAt
+		session.ExpiresAt = expiresAt
+		r.sessions[id] = session
+	}
+	return nil
+}
+
+// RevokeSession revokes a session unless it is already revoked
+func (r *MemoryUserRepository) RevokeSession(id, reason string) error {
+	return r.revokeSessions(func(session Session) bool { return session.ID == id }, reason)
+}
+
+// RevokeUserSessions revokes every not yet revoked session of a user
+func (r *MemoryUserRepository) RevokeUserSessions(userID, reason string) error {
+	return r.revokeSessions(func(session Session) bool { return session.UserID == userID }, reason)
+}
+
+// revokeSessions revokes all not yet revoked sessions that match
+func (r *MemoryUserRepository) revokeSessions(match func(Session) bool, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, session := range r.sessions {
+		if session.RevokedAt == nil && match(session) {
+			session.RevokedAt = &now
+			session.RevokeReason = reason
+			r.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+// CreateRefreshToken stores the hash of a newly issued refresh token
+func (r *MemoryUserRepository) CreateRefreshToken(token *RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[token.SessionID]; !ok {
+		return fmt.Errorf("failed to store refresh token: session %s does not exist", token.SessionID)
+	}
+	if _, ok := r.refreshTokens[token.TokenHash]; ok {
+		return fmt.Errorf("failed to store refresh token: token already exists")
+	}
+
+	stored := *token
+	stored.CreatedAt = time.Now().UTC()
+	r.refreshTokens[token.TokenHash] = stored
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token by its hash
+func (r *MemoryUserRepository) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if token, ok := r.refreshTokens[tokenHash]; ok {
+		return &token, nil
+	}
+	return nil, nil
+}
+
+// MarkRefreshTokenUsed marks an unused refresh token as used, reporting whether this call claimed it
+func (r *MemoryUserRepository) MarkRefreshTokenUsed(tokenHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.refreshTokens[tokenHash]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	token.UsedAt = &now
+	r.refreshTokens[tokenHash] = token
+	return true, nil
+}
+
+// CreateAPIKey stores a new API key
+func (r *MemoryUserRepository) CreateAPIKey(key *APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.apiKeys {
+		if existing.ID == key.ID || existing.KeyHash == key.KeyHash {
+			return fmt.Errorf("failed to create API key: key already exists")
+		}
+	}
+
+	stored := *key
+	stored.Scopes = append([]Permission(nil), key.Scopes...)
+	r.apiKeys[key.ID] = stored
+	return nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its raw value
+func (r *MemoryUserRepository) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.apiKeys {
+		if key.KeyHash == keyHash {
+			key.Scopes = append([]Permission(nil), key.Scopes...)
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListAPIKeys retrieves every API key, newest first
+func (r *MemoryUserRepository) ListAPIKeys() ([]APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(r.apiKeys))
+	for _, key := range r.apiKeys {
+		key.Scopes = append([]Permission(nil), key.Scopes...)
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key, reporting false if it was missing or already revoked
+func (r *MemoryUserRepository) RevokeAPIKey(id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok || key.RevokedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	r.apiKeys[id] = key
+	return true, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (r *MemoryUserRepository) TouchAPIKey(id string, lastUsedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.apiKeys[id]; ok {
+		key.LastUsedAt = &lastUsedAt
+		r.apiKeys[id] = key
+	}
+	return nil
+}
+
+// CreateIdentity links an identity to a user, failing with ErrIdentityInUse if it is already linked
+func (r *MemoryUserRepository) CreateIdentity(identity *Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return ErrIdentityInUse
+		}
+	}
+	if _, ok := r.users[identity.UserID]; !ok {
+		return fmt.Errorf("failed to create identity: user %s does not exist", identity.UserID)
+	}
+
+	r.identities[identity.ID] = *identity
+	return nil
+}
+
+// GetIdentity retrieves an identity by provider and normalized subject
+func (r *MemoryUserRepository) GetIdentity(provider IdentityProvider, subject string) (*Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListIdentities retrieves every identity linked to a user, oldest first
+func (r *MemoryUserRepository) ListIdentities(userID string) ([]Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var identities []Identity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].CreatedAt.Before(identities[j].CreatedAt)
+	})
+	return identities, nil
+}
+
+// DeleteIdentity unlinks one of a user's identities, reporting false if it was not found and
+// ErrLastIdentity if it is their only one
+func (r *MemoryUserRepository) DeleteIdentity(userID, identityID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity, ok := r.identities[identityID]
+	if !ok || identity.UserID != userID {
+		return false, nil
+	}
+
+	count := 0
+	for _, other := range r.identities {
+		if other.UserID == userID {
+			count++
+		}
+	}
+	if count == 1 {
+		return false, ErrLastIdentity
+	}
+
+	delete(r.identities, identityID)
+	return true, nil
+}
+
+// DeleteIdentities unlinks every identity of a user
+func (r *MemoryUserRepository) DeleteIdentities(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, identity := range r.identities {
+		if identity.UserID == userID {
+			delete(r.identities, id)
+		}
+	}
+	return nil
+}
+
+// SaveEmailVerification stores a pending email code, replacing any earlier one for the same user and email
+func (r *MemoryUserRepository) SaveEmailVerification(verification *EmailVerification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.emailVerifications[verification.UserID+"\x00"+verification.Email] = *verification
+	return nil
+}
+
+// ConsumeEmailVerification deletes and returns a pending email code, or nil if there is none
+func (r *MemoryUserRepository) ConsumeEmailVerification(userID, email string) (*EmailVerification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := userID + "\x00" + email
+	verification, ok := r.emailVerifications[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(r.emailVerifications, key)
+	return &verification, nil
+}
+
+// CreateHandshake stores a handshake event
+func (r *MemoryUserRepository) CreateHandshake(event *HandshakeEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handshakes = append(r.handshakes, *event)
+	return nil
+}
+
+// ListHandshakes retrieves the handshakes a user sent or received, oldest first
+func (r *MemoryUserRepository) ListHandshakes(userID string) ([]HandshakeEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var events []HandshakeEvent
+	for _, event := range r.handshakes {
+		if event.FromUID == userID || event.ToUID == userID {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events, nil
+}
+
+// DeleteHandshakes deletes the handshakes a user sent or received
+func (r *MemoryUserRepository) DeleteHandshakes(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.handshakes[:0]
+	for _, event := range r.handshakes {
+		if event.FromUID != userID && event.ToUID != userID {
+			kept = append(kept, event)
+		}
+	}
+	r.handshakes = kept
+	return nil
+}
+
+// SaveAccountDeletion creates or updates an account deletion job
+func (r *MemoryUserRepository) SaveAccountDeletion(job *AccountDeletion) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *job
+	stored.CompletedSteps = append([]string{}, job.CompletedSteps...)
+	r.accountDeletions[job.UserID] = stored
+	return nil
+}
+
+// GetAccountDeletion retrieves the deletion job of a user, or nil if there is none
+func (r *MemoryUserRepository) GetAccountDeletion(userID string) (*AccountDeletion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, ok := r.accountDeletions[userID]
+	if !ok {
+		return nil, nil
+	}
+	job.CompletedSteps = append([]string{}, job.CompletedSteps...)
+	return &job, nil
+}
+
+// ListUnfinishedAccountDeletions retrieves deletion jobs that have not completed, oldest first
+func (r *MemoryUserRepository) ListUnfinishedAccountDeletions() ([]AccountDeletion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var jobs []AccountDeletion
+	for _, job := range r.accountDeletions {
+		if job.Status != DeletionCompleted {
+			job.CompletedSteps = append([]string{}, job.CompletedSteps...)
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// GetConversationState retrieves a user's chatbot conversation state, or nil if there is none
+func (r *MemoryUserRepository) GetConversationState(userID string) (*ConversationState, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	state, ok := r.conversations[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// SaveConversationState creates or updates a user's chatbot conversation state
+func (r *MemoryUserRepository) SaveConversationState(state *ConversationState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[state.UserID]; !ok {
+		return fmt.Errorf("failed to save conversation state: user %s does not exist", state.UserID)
+	}
+	r.conversations[state.UserID] = *state
+	return nil
+}
+
+// CreateMatchProposal stores a new match proposal, filling in its ID
+func (r *MemoryUserRepository) CreateMatchProposal(proposal *MatchProposal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, userID := range []string{proposal.UserID, proposal.ProposedUserID} {
+		if _, ok := r.users[userID]; !ok {
+			return fmt.Errorf("failed to create match proposal: user %s does not exist", userID)
+		}
+	}
+
+	proposal.ID = uuid.New().String()
+	r.proposals = append(r.proposals, *proposal)
+	return nil
+}
+
+// GetMatchProposal retrieves a match proposal by ID, or nil if there is none
+func (r *MemoryUserRepository) GetMatchProposal(id string) (*MatchProposal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, proposal := range r.proposals {
+		if proposal.ID == id {
+			return &proposal, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetOpenMatchProposal retrieves the newest open proposal to a user, or nil if there is none
+func (r *MemoryUserRepository) GetOpenMatchProposal(userID string) (*MatchProposal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.proposals) - 1; i >= 0; i-- {
+		proposal := r.proposals[i]
+		if proposal.UserID == userID && proposal.Status == ProposalProposed {
+			return &proposal, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListMatchProposals retrieves the proposals made to a user, newest first
+func (r *MemoryUserRepository) ListMatchProposals(userID string) ([]MatchProposal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	proposals := []MatchProposal{}
+	for i := len(r.proposals) - 1; i >= 0; i-- {
+		if r.proposals[i].UserID == userID {
+			proposals = append(proposals, r.proposals[i])
+		}
+	}
+	return proposals, nil
+}
+
+// ResolveMatchProposal records the answer to an open proposal, reporting whether it was still open
+func (r *MemoryUserRepository) ResolveMatchProposal(id, status string, respondedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.proposals {
+		if r.proposals[i].ID == id && r.proposals[i].Status == ProposalProposed {
+			r.proposals[i].Status = status
+			r.proposals[i].RespondedAt = &respondedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RequestMatchConsent records that the user accepted an open proposal, reporting whether it was still open
+func (r *MemoryUserRepository) RequestMatchConsent(id string, respondedAt, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.proposals {
+		if r.proposals[i].ID == id && r.proposals[i].Status == ProposalProposed {
+			r.proposals[i].Status = ProposalAwaitingConsent
+			r.proposals[i].RespondedAt = &respondedAt
+			r.proposals[i].ExpiresAt = expiresAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AnswerMatchConsent records the proposed user's answer, reporting whether the proposal still awaited it
+func (r *MemoryUserRepository) AnswerMatchConsent(id, status string, respondedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.proposals {
+		if r.proposals[i].ID == id && r.proposals[i].Status == ProposalAwaitingConsent {
+			r.proposals[i].Status = status
+			r.proposals[i].ConsentRespondedAt = &respondedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CancelMatchProposals cancels the proposals made to or about a user that await an answer
+func (r *MemoryUserRepository) CancelMatchProposals(userID string, cancelledAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, proposal := range r.proposals {
+		if proposal.Status != ProposalProposed && proposal.Status != ProposalAwaitingConsent {
+			continue
+		}
+		if proposal.UserID != userID && proposal.ProposedUserID != userID {
+			continue
+		}
+		r.proposals[i].Status = ProposalCancelled
+		if proposal.RespondedAt == nil {
+			r.proposals[i].RespondedAt = &cancelledAt
+		}
+	}
+	return nil
+}
+
+// MemoryMessageRepository is a thread-safe, in-process MessageRepository for tests and local development
+type MemoryMessageRepository struct {
+	mu        sync.RWMutex
+	messages  []Message // In insertion order
+	revisions []MessageRevision
+	reactions []MessageReaction
+	flags     []MessageFlag
+}
+
+// NewMemoryMessageRepository creates an empty in-memory message repository
+func NewMemoryMessageRepository() *MemoryMessageRepository {
+	return &MemoryMessageRepository{}
+}
+
+// CreateMessage stores a message, filling in the same defaults as the database
+func (r *MemoryMessageRepository) CreateMessage(message *Message) (*Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.insert(message)
+}
+
+// CreateStreamMessage stores a mirrored Stream Chat message unless its Stream ID is already stored
+func (r *MemoryMessageRepository) CreateStreamMessage(message *Message) (*Message, bool, error) {
+	if message.StreamMessageID == nil {
+		return nil, false, errors.New("failed to create stream message: stream_message_id is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.messages {
+		if existing.StreamMessageID != nil && *existing.StreamMessageID == *message.StreamMessageID {
+			return &existing, false, nil
+		}
+	}
+
+	created, err := r.insert(message)
+	return created, err == nil, err
+}
+
+// GetChannelMessages retrieves a page of a channel's messages, keyed on (created_at, id)
+func (r *MemoryMessageRepository) GetChannelMessages(channelID string, page MessagePageQuery) (*MessagePage, error) {
+	return r.pageMessages(func(m Message) bool { return m.ChannelID == channelID }, page), nil
+}
+
+// GetThreadReplies retrieves a page of the replies to a message, keyed on (created_at, id)
+func (r *MemoryMessageRepository) GetThreadReplies(parentID string, page MessagePageQuery) (*MessagePage, error) {
+	return r.pageMessages(func(m Message) bool { return m.ReplyToID != nil && *m.ReplyToID == parentID }, page), nil
+}
+
+// CountReplies counts the replies to each message that aren't deleted
+func (r *MemoryMessageRepository) CountReplies(messageIDs []string) (map[string]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, message := range r.messages {
+		if message.ReplyToID != nil && message.DeletedAt == nil && containsString(messageIDs, *message.ReplyToID) {
+			counts[*message.ReplyToID]++
+		}
+	}
+	return counts, nil
+}
+
+// GetRecentChannelMessages retrieves the most recent messages of a channel that aren't deleted, oldest first
+func (r *MemoryMessageRepository) GetRecentChannelMessages(channelID string, limit int) ([]Message, error) {
+	page, err := r.GetChannelMessages(channelID, MessagePageQuery{Limit: limit, ExcludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	return page.Messages, nil
+}
+
+// GetMessageByID retrieves a specific message by ID
+func (r *MemoryMessageRepository) GetMessageByID(messageID string) (*Message, error) {
+	messages := r.filter(func(m Message) bool { return m.ID == messageID })
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return &messages[0], nil
+}
+
+// GetMessagesByStreamID retrieves messages by Stream Chat message ID
+func (r *MemoryMessageRepository) GetMessagesByStreamID(streamMessageID string) ([]Message, error) {
+	return r.filter(func(m Message) bool {
+		return m.StreamMessageID != nil && *m.StreamMessageID == streamMessageID
+	}), nil
+}
+
+// GetMessagesBySender retrieves every message a user sent, oldest first
+func (r *MemoryMessageRepository) GetMessagesBySender(senderID string) ([]Message, error) {
+	return r.filter(func(m Message) bool { return m.SenderID == senderID }), nil
+}
+
+// UpdateMessage applies column updates, keyed by JSON field name, to a message
+func (r *MemoryMessageRepository) UpdateMessage(messageID string, updates map[string]interface{}) (*Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, message := range r.messages {
+		if message.ID != messageID {
+			continue
+		}
+
+		var updated Message
+		if err := applyUpdates(message, updates, &updated); err != nil {
+			return nil, err
+		}
+		updated.ID = messageID
+		r.messages[i] = updated
+		return &updated, nil
+	}
+
+	return nil, fmt.Errorf("message not found")
+}
+
+// DeleteChannelMessages deletes every message in a channel
+func (r *MemoryMessageRepository) DeleteChannelMessages(channelID string) error {
+	r.remove(func(m Message) bool { return m.ChannelID == channelID })
+	return nil
+}
+
+// AnonymizeSenderMessages strips the sender and content from every message a user sent,
+// deletes the revisions of those messages and unlinks the user from edits and deletes they made
+func (r *MemoryMessageRepository) AnonymizeSenderMessages(senderID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.revisions[:0]
+	for _, revision := range r.revisions {
+		if revision.SenderID == senderID {
+			continue
+		}
+		if revision.EditedBy == senderID {
+			revision.EditedBy = DeletedUserID
+		}
+		kept = append(kept, revision)
+	}
+	r.revisions = kept
+
+	keptReactions := r.reactions[:0]
+	for _, reaction := range r.reactions {
+		if reaction.UserID != senderID {
+			keptReactions = append(keptReactions, reaction)
+		}
+	}
+	r.reactions = keptReactions
+
+	keptFlags := r.flags[:0]
+	for _, flag := range r.flags {
+		if flag.UserID != senderID {
+			keptFlags = append(keptFlags, flag)
+		}
+	}
+	r.flags = keptFlags
+
+	for i, message := range r.messages {
+		if message.DeletedBy == senderID {
+			r.messages[i].DeletedBy = DeletedUserID
+		}
+		if message.SenderID == senderID {
+			r.messages[i].SenderID = DeletedUserID
+			r.messages[i].SenderUsername = "Deleted user"
+			r.messages[i].MessageText = "[deleted]"
+		}
+	}
+	return nil
+}
+
+// EditMessage saves a message's text as a revision and replaces it
+func (r *MemoryMessageRepository) EditMessage(messageID, text, editorID string, editedAt time.Time) (*Message, error) {
+	return r.replaceText(messageID, editorID, editedAt, func(m *Message) {
+		m.MessageText = text
+		m.EditedAt = &editedAt
+	})
+}
+
+// TombstoneMessage saves a message's text as a revision, clears it and marks the message deleted
+func (r *MemoryMessageRepository) TombstoneMessage(messageID, deletedBy, reason string, deletedAt time.Time) (*Message, error) {
+	return r.replaceText(messageID, deletedBy, deletedAt, func(m *Message) {
+		m.MessageText = ""
+		m.DeletedAt = &deletedAt
+		m.DeletedBy = deletedBy
+		m.DeleteReason = reason
+	})
+}
+
+// ListMessageRevisions retrieves the earlier texts of a message, oldest first
+func (r *MemoryMessageRepository) ListMessageRevisions(messageID string) ([]MessageRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	revisions := []MessageRevision{}
+	for _, revision := range r.revisions {
+		if revision.MessageID == messageID {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].EditedAt.Before(revisions[j].EditedAt)
+	})
+	return revisions, nil
+}
+
+// AddReaction stores a reaction unless the user already left it on the message
+func (r *MemoryMessageRepository) AddReaction(reaction *MessageReaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.exists(reaction.MessageID) {
+		return ErrMessageNotFound
+	}
+	for _, stored := range r.reactions {
+		if stored.MessageID == reaction.MessageID && stored.UserID == reaction.UserID && stored.Type == reaction.Type {
+			return nil
+		}
+	}
+	r.reactions = append(r.reactions, *reaction)
+	return nil
+}
+
+// RemoveReaction deletes a reaction, if it is stored
+func (r *MemoryMessageRepository) RemoveReaction(messageID, userID, reactionType string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.reactions[:0]
+	for _, reaction := range r.reactions {
+		if reaction.MessageID != messageID || reaction.UserID != userID || reaction.Type != reactionType {
+			kept = append(kept, reaction)
+		}
+	}
+	r.reactions = kept
+	return nil
+}
+
+// FlagMessage stores a flag unless the user already flagged the message
+func (r *MemoryMessageRepository) FlagMessage(flag *MessageFlag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.exists(flag.MessageID) {
+		return ErrMessageNotFound
+	}
+	for _, stored := range r.flags {
+		if stored.MessageID == flag.MessageID && stored.UserID == flag.UserID {
+			return nil
+		}
+	}
+	r.flags = append(r.flags, *flag)
+	return nil
+}
+
+// replaceText saves a message's current text as a revision by editorID, then applies change to it
+func (r *MemoryMessageRepository) replaceText(messageID, editorID string, at time.Time, change func(*Message)) (*Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.messages {
+		if r.messages[i].ID != messageID {
+			continue
+		}
+
+		r.revisions = append(r.revisions, MessageRevision{
+			ID:          uuid.New().String(),
+			MessageID:   messageID,
+			SenderID:    r.messages[i].SenderID,
+			MessageText: r.messages[i].MessageText,
+			EditedBy:    editorID,
+			EditedAt:    at,
+		})
+		change(&r.messages[i])
+
+		updated := r.messages[i]
+		return &updated, nil
+	}
+
+	return nil, ErrMessageNotFound
+}
+
+// SearchMessages returns messages matching a search, newest first. Every search term
+// must start a word of the message.
+func (r *MemoryMessageRepository) SearchMessages(query MessageSearchQuery) ([]Message, error) {
+	terms := searchTerms(query.Text)
+	messages := r.filter(func(m Message) bool {
+		return containsString(query.ChannelIDs, m.ChannelID) && m.DeletedAt == nil &&
+			(query.SenderID == "" || m.SenderID == query.SenderID) &&
+			(query.MessageType == "" || m.MessageType == query.MessageType) &&
+			(query.From == nil || !m.CreatedAt.Before(*query.From)) &&
+			(query.To == nil || !m.CreatedAt.After(*query.To)) &&
+			matchesTerms(m.MessageText, terms)
+	})
+
+	results := make([]Message, 0, len(messages))
+	for i := len(messages) - 1; i >= 0 && (query.Limit <= 0 || len(results) < query.Limit); i-- {
+		results = append(results, messages[i])
+	}
+	return results, nil
+}
+
+// pageMessages retrieves a page of the matching messages
+func (r *MemoryMessageRepository) pageMessages(match func(Message) bool, page MessagePageQuery) *MessagePage {
+	messages := r.filter(func(m Message) bool {
+		if !match(m) || (page.ExcludeDeleted && m.DeletedAt != nil) {
+			return false
+		}
+		if page.After != nil && !page.After.Before(cursorOf(m)) {
+			return false
+		}
+		return page.Before == nil || cursorOf(m).Before(*page.Before)
+	})
+	sort.SliceStable(messages, func(i, j int) bool {
+		return cursorOf(messages[i]).Before(cursorOf(messages[j]))
+	})
+
+	// Fetch in the order the other backends do: newest first unless paging after a cursor
+	fetched := make([]Message, 0, page.pageLimit()+1)
+	for i := range messages {
+		if len(fetched) > page.pageLimit() {
+			break
+		}
+		if page.After != nil {
+			fetched = append(fetched, messages[i])
+		} else {
+			fetched = append(fetched, messages[len(messages)-1-i])
+		}
+	}
+
+	return buildMessagePage(fetched, page)
+}
+
+// insert fills in a message's defaults and stores it; the caller holds the write lock
+func (r *MemoryMessageRepository) insert(message *Message) (*Message, error) {
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	if message.MessageType == "" {
+		message.MessageType = "user"
+	}
+	if message.Type == "" {
+		message.Type = "text"
+	}
+
+	for _, existing := range r.messages {
+		if existing.ID == message.ID {
+			return nil, fmt.Errorf("failed to create message: message %s already exists", message.ID)
+		}
+	}
+
+	r.messages = append(r.messages, *message)
+	created := *message
+	return &created, nil
+}
+
+// filter returns copies of the matching messages, oldest first
+func (r *MemoryMessageRepository) filter(match func(Message) bool) []Message {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := []Message{}
+	for _, message := range r.messages {
+		if match(message) {
+			messages = append(messages, message)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	return messages
+}
+
+// remove deletes the matching messages with their revisions, reactions and flags
+func (r *MemoryMessageRepository) remove(match func(Message) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := make(map[string]bool)
+	kept := r.messages[:0]
+	for _, message := range r.messages {
+		if match(message) {
+			removed[message.ID] = true
+		} else {
+			kept = append(kept, message)
+		}
+	}
+	r.messages = kept
+
+	// Revisions go with their message, like the database's cascading delete
+	keptRevisions := r.revisions[:0]
+	for _, revision := range r.revisions {
+		if !removed[revision.MessageID] {
+			keptRevisions = append(keptRevisions, revision)
+		}
+	}
+	r.revisions = keptRevisions
+
+	keptReactions := r.reactions[:0]
+	for _, reaction := range r.reactions {
+		if !removed[reaction.MessageID] {
+			keptReactions = append(keptReactions, reaction)
+		}
+	}
+	r.reactions = keptReactions
+
+	keptFlags := r.flags[:0]
+	for _, flag := range r.flags {
+		if !removed[flag.MessageID] {
+			keptFlags = append(keptFlags, flag)
+		}
+	}
+	r.flags = keptFlags
+}
+
+// exists reports whether a message is stored. The caller must hold the lock.
+func (r *MemoryMessageRepository) exists(messageID string) bool {
+	for _, message := range r.messages {
+		if message.ID == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryWebhookRepository is a thread-safe, in-process WebhookRepository for tests and local development
+type MemoryWebhookRepository struct {
+	mu         sync.RWMutex
+	processed  map[string]time.Time // Processed time by webhook ID
+	deliveries []WebhookDelivery    // In insertion order
+}
+
+// NewMemoryWebhookRepository creates an empty in-memory webhook repository
+func NewMemoryWebhookRepository() *MemoryWebhookRepository {
+	return &MemoryWebhookRepository{
+		processed: make(map[string]time.Time),
+	}
+}
+
+// ClaimWebhook stores a webhook ID unless it was claimed at or after expiredBefore
+func (r *MemoryWebhookRepository) ClaimWebhook(webhookID string, claimedAt, expiredBefore time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if processedAt, ok := r.processed[webhookID]; ok && !processedAt.Before(expiredBefore) {
+		return false, nil
+	}
+	r.processed[webhookID] = claimedAt
+	return true, nil
+}
+
+// ReleaseWebhook forgets a webhook ID, so it can be claimed again
+func (r *MemoryWebhookRepository) ReleaseWebhook(webhookID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.processed, webhookID)
+	return nil
+}
+
+// DeleteProcessedWebhooks forgets webhook IDs processed before the given time
+func (r *MemoryWebhookRepository) DeleteProcessedWebhooks(before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for webhookID, processedAt := range r.processed {
+		if processedAt.Before(before) {
+			delete(r.processed, webhookID)
+		}
+	}
+	return nil
+}
+
+// CreateWebhookDelivery stores a webhook delivery, filling in its ID
+func (r *MemoryWebhookRepository) CreateWebhookDelivery(delivery *WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery.ID = uuid.New().String()
+	r.deliveries = append(r.deliveries, *delivery)
+	return nil
+}
+
+// GetWebhookDelivery retrieves a webhook delivery by ID
+func (r *MemoryWebhookRepository) GetWebhookDelivery(id string) (*WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, delivery := range r.deliveries {
+		if delivery.ID == id {
+			return &delivery, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListWebhookDeliveries retrieves the webhook deliveries matching a filter, newest first
+func (r *MemoryWebhookRepository) ListWebhookDeliveries(filter WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deliveries := []WebhookDelivery{}
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < filter.Limit; i-- {
+		delivery := r.deliveries[i]
+		if (filter.EventType != "" && delivery.EventType != filter.EventType) ||
+			(filter.Status != "" && delivery.Status != filter.Status) ||
+			(filter.WebhookID != "" && delivery.WebhookID != filter.WebhookID) ||
+			(filter.Since != nil && delivery.ReceivedAt.Before(*filter.Since)) ||
+			(filter.Until != nil && delivery.ReceivedAt.After(*filter.Until)) {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery applies column updates, keyed by JSON field name, to a webhook delivery
+func (r *MemoryWebhookRepository) UpdateWebhookDelivery(id string, updates map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, delivery := range r.deliveries {
+		if delivery.ID != id {
+			continue
+		}
+
+		var updated WebhookDelivery
+		if err := applyUpdates(delivery, updates, &updated); err != nil {
+			return err
+		}
+		r.deliveries[i] = updated
+		return nil
+	}
+	return nil
+}
+
+// MemoryJobRepository is a thread-safe, in-process JobRepository for tests and local development.
+// Jobs are lost on restart.
+type MemoryJobRepository struct {
+	mu          sync.Mutex
+	jobs        map[string]Job
+	deadLetters map[string]DeadLetterJob
+}
+
+// NewMemoryJobRepository creates an empty in-memory job repository
+func NewMemoryJobRepository() *MemoryJobRepository {
+	return &MemoryJobRepository{
+		jobs:        make(map[string]Job),
+		deadLetters: make(map[string]DeadLetterJob),
+	}
+}
+
+// EnqueueJob stores a new job
+func (r *MemoryJobRepository) EnqueueJob(job *Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.jobs[job.ID]; ok {
+		return fmt.Errorf("failed to enqueue job: %s already exists", job.ID)
+	}
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+// ClaimJob leases the due job that has waited longest
+func (r *MemoryJobRepository) ClaimJob(now, lockedUntil time.Time) (*Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var next *Job
+	for _, job := range r.jobs {
+		if job.RunAt.After(now) || (job.LockedUntil != nil && !job.LockedUntil.Before(now)) {
+			continue
+		}
+		if next == nil || job.RunAt.Before(next.RunAt) {
+			candidate := job
+			next = &candidate
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.Attempts++
+	next.LockedUntil = &lockedUntil
+	r.jobs[next.ID] = *next
+	return next, nil
+}
+
+// CompleteJob deletes a finished job
+func (r *MemoryJobRepository) CompleteJob(jobID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.jobs, jobID)
+	return nil
+}
+
+// RetryJob releases a claimed job to run again at runAt
+func (r *MemoryJobRepository) RetryJob(job *Job, runAt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.jobs[job.ID]
+	if !ok || stored.Attempts != job.Attempts {
+		return nil
+	}
+	stored.RunAt = runAt
+	stored.LockedUntil = nil
+	stored.LastError = lastError
+	r.jobs[job.ID] = stored
+	return nil
+}
+
+// DeadLetterJob moves a job to the dead letters
+func (r *MemoryJobRepository) DeadLetterJob(job *Job, lastError string, failedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.deadLetters[job.ID]; !ok {
+		r.deadLetters[job.ID] = DeadLetterJob{
+			ID:        job.ID,
+			Kind:      job.Kind,
+			Payload:   job.Payload,
+			Attempts:  job.Attempts,
+			LastError: lastError,
+			CreatedAt: job.CreatedAt,
+			FailedAt:  failedAt,
+		}
+	}
+	delete(r.jobs, job.ID)
+	return nil
+}
+
+// applyUpdates decodes current with updates merged over its JSON fields into dst, which
+// must point to a zero value so that null updates clear fields
+func applyUpdates(current interface{}, updates map[string]interface{}, dst interface{}) error {
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return fmt.Errorf("failed to decode record: %w", err)
+	}
+	for key, value := range updates {
+		fields[key] = value
+	}
+
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updates: %w", err)
+	}
+	if err := json.Unmarshal(merged, dst); err != nil {
+		return fmt.Errorf("failed to apply updates: %w", err)
+	}
+	return nil
+}
+
+// lastUsed returns when a session was last used, falling back to its creation
+func lastUsed(session Session) time.Time {
+	if session.LastUsedAt != nil {
+		return *session.LastUsedAt
+	}
+	return session.CreatedAt
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't issued by this API
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// MessageCursor is the position of a message in a channel's history, which is ordered by
+// creation time and then ID
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// cursorOf returns the cursor pointing at a message
+func cursorOf(message Message) MessageCursor {
+	return MessageCursor{CreatedAt: message.CreatedAt, ID: message.ID}
+}
+
+// Encode returns the opaque form of the cursor handed to clients
+func (c MessageCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Before reports whether the cursor sorts before another
+func (c MessageCursor) Before(other MessageCursor) bool {
+	if !c.CreatedAt.Equal(other.CreatedAt) {
+		return c.CreatedAt.Before(other.CreatedAt)
+	}
+	return c.ID < other.ID
+}
+
+// DecodeMessageCursor parses a cursor produced by Encode
+func DecodeMessageCursor(encoded string) (*MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// Message IDs are UUIDs; anything else could not have come from a page
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &MessageCursor{CreatedAt: t.UTC(), ID: strings.ToLower(id)}, nil
+}
+
+// pageLimit returns the page size to fetch, applying the default
+func (q MessagePageQuery) pageLimit() int {
+	if q.Limit <= 0 {
+		return DefaultMessageLimit
+	}
+	return q.Limit
+}
+
+// buildMessagePage turns the messages a backend fetched for a page query into the page.
+// Backends fetch up to pageLimit()+1 messages in fetch order: oldest first when paging
+// after a cursor, newest first otherwise. The extra message only signals has_more.
+func buildMessagePage(fetched []Message, query MessagePageQuery) *MessagePage {
+	limit := query.pageLimit()
+
+	page := &MessagePage{HasMore: len(fetched) > limit}
+	if page.HasMore {
+		fetched = fetched[:limit]
+	}
+
+	messages := make([]Message, len(fetched))
+	copy(messages, fetched)
+	if query.After == nil {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	page.Messages = messages
+
+	if len(messages) > 0 {
+		page.PrevCursor = cursorOf(messages[0]).Encode()
+		page.NextCursor = cursorOf(messages[len(messages)-1]).Encode()
+	}
+
+	return page
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// MessageEditHandler handles editing and deleting stored messages
+type MessageEditHandler struct {
+	editService *MessageEditService
+}
+
+// NewMessageEditHandler creates a new message edit handler
+func NewMessageEditHandler(editService *MessageEditService) *MessageEditHandler {
+	return &MessageEditHandler{
+		editService: editService,
+	}
+}
+
+// EditMessage handles editing a message
+// @Summary Edit a message
+// @Description Replace the text of a message the caller sent. The previous text is kept as a revision.
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param message_id path string true "Message ID"
+// @Param request body EditMessageRequest true "New text"
+// @Success 200 {object} Message "Edited message"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not the sender"
+// @Failure 404 {object} ErrorResponse "Message not found"
+// @Failure 409 {object} ErrorResponse "Message was deleted"
+// @Failure 500 {object} ErrorResponse "Edit failed"
+// @Router /messages/{message_id} [patch]
+func (h *MessageEditHandler) EditMessage(c *gin.Context) {
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	message, err := h.editService.EditMessage(CallerID(c), messageID, req.MessageText)
+	if err != nil {
+		respondMessageEditError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+// DeleteMessage handles deleting a message
+// @Summary Delete a message
+// @Description Turn a message into a tombstone: its text is cleared and kept as a revision, and the deleter, time and reason are recorded. Senders may delete their own messages; callers with the messages:moderate permission may delete any message, giving a reason for other users' messages.
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param message_id path string true "Message ID"
+// @Param request body DeleteMessageRequest false "Reason for the delete"
+// @Success 200 {object} Message "Tombstone"
+// @Failure 400 {object} ErrorResponse "Invalid request or missing reason"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not the sender or a moderator"
+// @Failure 404 {object} ErrorResponse "Message not found"
+// @Failure 409 {object} ErrorResponse "Message was already deleted"
+// @Failure 500 {object} ErrorResponse "Delete failed"
+// @Router /messages/{message_id} [delete]
+func (h *MessageEditHandler) DeleteMessage(c *gin.Context) {
+	// The body is optional
+	var req DeleteMessageRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	message, err := h.editService.DeleteMessage(callerActorID(c), CallerCan(c, PermissionModerateMessages), messageID, req.Reason)
+	if err != nil {
+		respondMessageEditError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+// GetRevisions handles fetching a message's edit history
+// @Summary Get message revisions
+// @Description Get a message with the texts it had before each edit or delete, oldest first. Available to the sender and to callers with the messages:moderate permission.
+// @Tags Messages
+// @Produce json
+// @Security Bearer
+// @Param message_id path string true "Message ID"
+// @Success 200 {object} MessageHistory "Message and revisions"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not the sender or a moderator"
+// @Failure 404 {object} ErrorResponse "Message not found"
+// @Failure 500 {object} ErrorResponse "Failed to get revisions"
+// @Router /messages/{message_id}/revisions [get]
+func (h *MessageEditHandler) GetRevisions(c *gin.Context) {
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	history, err := h.editService.GetHistory(CallerID(c), CallerCan(c, PermissionModerateMessages), messageID)
+	if err != nil {
+		respondMessageEditError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// messageIDParam reads the message_id path param, answering 404 for IDs that can't exist
+func messageIDParam(c *gin.Context) (string, bool) {
+	messageID := c.Param("message_id")
+	if _, err := uuid.Parse(messageID); err != nil {
+		respondMessageEditError(c, ErrMessageNotFound)
+		return "", false
+	}
+	return messageID, true
+}
+
+// callerActorID identifies the caller in audit records: the user ID, or the API key for API key callers
+func callerActorID(c *gin.Context) string {
+	if keyID := c.GetString("api_key_id"); keyID != "" {
+		return "api-key:" + keyID
+	}
+	return CallerID(c)
+}
+
+// respondMessageEditError maps message edit errors to responses
+func respondMessageEditError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "message_not_found", Message: err.Error()})
+	case errors.Is(err, ErrMessageDeleted):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "message_deleted", Message: err.Error()})
+	case errors.Is(err, ErrEmptyMessage):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "empty_message", Message: err.Error()})
+	case errors.Is(err, ErrReasonRequired):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "reason_required", Message: err.Error()})
+	case errors.Is(err, ErrForbidden):
+		RespondAuthorizationError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "message_update_failed", Message: err.Error()})
+	}
+}
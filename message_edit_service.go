@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// Message edit errors
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrMessageDeleted  = errors.New("message has been deleted")
+	ErrReasonRequired  = errors.New("a reason is required to delete another user's message")
+	ErrEmptyMessage    = errors.New("message text cannot be empty")
+)
+
+// MessageHistory is a message with the texts it had before each edit or delete
+type MessageHistory struct {
+	Message   Message           `json:"message"`
+	Revisions []MessageRevision `json:"revisions"`
+}
+
+// MessageEditService edits and deletes stored messages, keeping every replaced text as a revision
+type MessageEditService struct {
+	messageRepo MessageRepository
+}
+
+// NewMessageEditService creates a new message edit service
+func NewMessageEditService(messageRepo MessageRepository) *MessageEditService {
+	return &MessageEditService{
+		messageRepo: messageRepo,
+	}
+}
+
+// EditMessage replaces the text of a message the caller sent
+func (s *MessageEditService) EditMessage(callerID, messageID, text string) (*Message, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	if callerID == "" || message.SenderID != callerID {
+		return nil, ErrForbidden
+	}
+	if message.MessageText == text {
+		return message, nil
+	}
+
+	return s.messageRepo.EditMessage(messageID, text, callerID, time.Now().UTC())
+}
+
+// DeleteMessage turns a message into a tombstone. Senders may delete their own messages;
+// moderators may delete any message but must give a reason for other users' messages.
+func (s *MessageEditService) DeleteMessage(callerID string, moderator bool, messageID, reason string) (*Message, error) {
+	reason = strings.TrimSpace(reason)
+
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	ownMessage := callerID != "" && message.SenderID == callerID
+	if !ownMessage {
+		if !moderator {
+			return nil, ErrForbidden
+		}
+		if reason == "" {
+			return nil, ErrReasonRequired
+		}
+	}
+
+	deleted, err := s.messageRepo.TombstoneMessage(messageID, callerID, reason, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	if !ownMessage {
+		log.Printf("[MODERATION] %s deleted message %s from %s: %s", callerID, messageID, message.SenderID, reason)
+	}
+	return deleted, nil
+}
+
+// GetHistory returns a message and its revisions, to its sender or a moderator
+func (s *MessageEditService) GetHistory(callerID string, moderator bool, messageID string) (*MessageHistory, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !moderator && (callerID == "" || message.SenderID != callerID) {
+		return nil, ErrForbidden
+	}
+
+	revisions, err := s.messageRepo.ListMessageRevisions(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MessageHistory{
+		Message:   *message,
+		Revisions: revisions,
+	}, nil
+}
+
+// getMessage retrieves a message, returning ErrMessageNotFound if there is none
+func (s *MessageEditService) getMessage(messageID string) (*Message, error) {
+	message, err := s.messageRepo.GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, ErrMessageNotFound
+	}
+	return message, nil
+}
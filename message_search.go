@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Message search modes
+const (
+	SearchKeyword  = "keyword"  // Full-text match on message words
+	SearchSemantic = "semantic" // Similarity of OpenAI embeddings
+)
+
+// Message search limits
+const (
+	DefaultSearchLimit       = 20
+	MaxSearchLimit           = 100
+	SemanticCandidateLimit   = 300   // Most recent messages in scope that semantic search ranks
+	embeddingCacheSize       = 10000 // Message embeddings kept in memory before the cache is reset
+	searchSnippetRadius      = 80    // Characters of context on each side of the first match
+	searchSnippetFallbackLen = 160
+)
+
+// ErrSearchUnavailable is returned for semantic search when no OpenAI key is configured
+var ErrSearchUnavailable = errors.New("semantic search is not available")
+
+// MessageSearchQuery selects the messages to search. ChannelIDs is the scope and must not be empty.
+type MessageSearchQuery struct {
+	Text        string
+	ChannelIDs  []string
+	SenderID    string
+	MessageType string
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+}
+
+// MessageSearchResult is a message matching a search, with a highlighted snippet
+type MessageSearchResult struct {
+	Message Message `json:"message"`
+	Snippet string  `json:"snippet"`         // HTML-escaped text around the match, with matches in <mark> tags
+	Score   float64 `json:"score,omitempty"` // Cosine similarity, for semantic search
+}
+
+// MessageSearchResponse is the response of a message search
+type MessageSearchResponse struct {
+	Mode    string                `json:"mode"`
+	Results []MessageSearchResult `json:"results"`
+}
+
+// MessageSearchService searches stored messages by keyword or by meaning
+type MessageSearchService struct {
+	messageRepo    MessageRepository
+	streamService  *StreamService
+	chatGPTService *ChatGPTService
+
+	mu         sync.Mutex
+	embeddings map[string][]float32 // Message embeddings keyed by ID and text
+}
+
+// NewMessageSearchService creates a new message search service
+func NewMessageSearchService(messageRepo MessageRepository, streamService *StreamService, chatGPTService *ChatGPTService) *MessageSearchService {
+	return &MessageSearchService{
+		messageRepo:    messageRepo,
+		streamService:  streamService,
+		chatGPTService: chatGPTService,
+		embeddings:     make(map[string][]float32),
+	}
+}
+
+// ChannelScope returns the IDs of every channel a user may search: their Stream channels,
+// by ID and CID since either may be stored, and their AI chat
+func (s *MessageSearchService) ChannelScope(ctx context.Context, userID string) ([]string, error) {
+	channels, err := s.streamService.GetUserChannels(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels: %w", err)
+	}
+
+	scope := []string{"ai-chat-" + userID}
+	for _, channel := range channels {
+		if !containsString(scope, channel.ID) {
+			scope = append(scope, channel.ID)
+		}
+		if channel.CID != "" {
+			scope = append(scope, channel.CID)
+		}
+	}
+	return scope, nil
+}
+
+// Search runs a keyword or semantic search
+func (s *MessageSearchService) Search(ctx context.Context, mode string, query MessageSearchQuery) ([]MessageSearchResult, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultSearchLimit
+	}
+	if query.Limit > MaxSearchLimit {
+		query.Limit = MaxSearchLimit
+	}
+
+	if mode == SearchSemantic {
+		return s.semanticSearch(ctx, query)
+	}
+	return s.keywordSearch(query)
+}
+
+// keywordSearch returns messages containing every search term, newest first
+func (s *MessageSearchService) keywordSearch(query MessageSearchQuery) ([]MessageSearchResult, error) {
+	messages, err := s.messageRepo.SearchMessages(query)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := searchTerms(query.Text)
+	results := make([]MessageSearchResult, len(messages))
+	for i, message := range messages {
+		results[i] = MessageSearchResult{
+			Message: message,
+			Snippet: highlightSnippet(message.MessageText, terms),
+		}
+	}
+	return results, nil
+}
+
+// semanticSearch ranks the most recent messages in scope by how close their meaning is to
+// the search text
+func (s *MessageSearchService) semanticSearch(ctx context.Context, query MessageSearchQuery) ([]MessageSearchResult, error) {
+	if s.chatGPTService == nil || !s.chatGPTService.Configured() {
+		return nil, ErrSearchUnavailable
+	}
+
+	limit := query.Limit
+	candidateQuery := query
+	candidateQuery.Text = ""
+	candidateQuery.Limit = SemanticCandidateLimit
+	candidates, err := s.messageRepo.SearchMessages(candidateQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	// Blank messages carry no meaning to compare
+	messages := candidates[:0]
+	for _, message := range candidates {
+		if strings.TrimSpace(message.MessageText) != "" {
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) == 0 {
+		return []MessageSearchResult{}, nil
+	}
+
+	vectors, err := s.messageEmbeddings(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	queryVectors, err := s.chatGPTService.CreateEmbeddings(ctx, []string{query.Text})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]MessageSearchResult, len(messages))
+	for i, message := range messages {
+		results[i] = MessageSearchResult{
+			Message: message,
+			Snippet: highlightSnippet(message.MessageText, nil),
+			Score:   cosineSimilarity(queryVectors[0], vectors[i]),
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// messageEmbeddings returns an embedding for each message, only requesting those not cached
+func (s *MessageSearchService) messageEmbeddings(ctx context.Context, messages []Message) ([][]float32, error) {
+	vectors := make([][]float32, len(messages))
+	var missing []int
+	var texts []string
+
+	s.mu.Lock()
+	for i, message := range messages {
+		if vector, ok := s.embeddings[embeddingKey(message)]; ok {
+			vectors[i] = vector
+		} else {
+			missing = append(missing, i)
+			texts = append(texts, message.MessageText)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(texts) == 0 {
+		return vectors, nil
+	}
+
+	created, err := s.chatGPTService.CreateEmbeddings(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if len(s.embeddings)+len(created) > embeddingCacheSize {
+		s.embeddings = make(map[string][]float32)
+	}
+	for i, index := range missing {
+		vectors[index] = created[i]
+		s.embeddings[embeddingKey(messages[index])] = created[i]
+	}
+	s.mu.Unlock()
+
+	return vectors, nil
+}
+
+// embeddingKey identifies a message's text, so edited messages are embedded again
+func embeddingKey(message Message) string {
+	return message.ID + "\x00" + message.MessageText
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// searchTerms splits search text into lowercase words
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// matchesTerms reports whether every term starts one of the words of a text, which
+// approximates the stemming of Postgres full-text search
+func matchesTerms(text string, terms []string) bool {
+	words := searchTerms(text)
+	for _, term := range terms {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// highlightSnippet returns the text around the first word starting with a term, HTML-escaped,
+// with each such word wrapped in <mark> tags. Without a match it returns the start of the text.
+func highlightSnippet(text string, terms []string) string {
+	runes := []rune(text)
+
+	// Find word boundaries and which words match
+	type span struct{ start, end int }
+	var marks []span
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsNumber(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsNumber(runes[i])) {
+			i++
+		}
+		word := strings.ToLower(string(runes[start:i]))
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) {
+				marks = append(marks, span{start, i})
+				break
+			}
+		}
+	}
+
+	from, to := 0, len(runes)
+	if len(marks) > 0 {
+		from = max(0, marks[0].start-searchSnippetRadius)
+		to = min(len(runes), marks[0].end+searchSnippetRadius)
+	} else if to > searchSnippetFallbackLen {
+		to = searchSnippetFallbackLen
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, mark := range marks {
+		if mark.end <= from || mark.start >= to {
+			continue
+		}
+		start, end := max(mark.start, from), min(mark.end, to)
+		b.WriteString(html.EscapeString(string(runes[pos:start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[start:end])))
+		b.WriteString("</mark>")
+		pos = end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
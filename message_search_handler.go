@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MessageSearchHandler handles searching stored messages
+type MessageSearchHandler struct {
+	searchService *MessageSearchService
+	authorizer    *Authorizer
+}
+
+// NewMessageSearchHandler creates a new message search handler
+func NewMessageSearchHandler(searchService *MessageSearchService, authorizer *Authorizer) *MessageSearchHandler {
+	return &MessageSearchHandler{
+		searchService: searchService,
+		authorizer:    authorizer,
+	}
+}
+
+// SearchMessages handles searching messages in the caller's channels
+// @Summary Search messages
+// @Description Search stored messages in channels the caller belongs to, or in one channel with channel_id. Keyword mode matches every word of q (Postgres websearch syntax on the postgres and supabase backends) and returns the newest matches first. Semantic mode ranks the caller's most recent messages by OpenAI embedding similarity to q. Snippets are HTML-escaped with matches in <mark> tags.
+// @Tags Messages
+// @Produce json
+// @Security Bearer
+// @Param q query string true "Search text"
+// @Param mode query string false "keyword or semantic" default(keyword)
+// @Param channel_id query string false "Only search this channel"
+// @Param sender_id query string false "Only messages from this sender"
+// @Param message_type query string false "Only messages of this type (user, assistant, system)"
+// @Param from query string false "Only messages created at or after this RFC 3339 time"
+// @Param to query string false "Only messages created at or before this RFC 3339 time"
+// @Param limit query int false "Number of results (max 100)" default(20)
+// @Success 200 {object} MessageSearchResponse "Search results"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a member of the channel"
+// @Failure 500 {object} ErrorResponse "Search failed"
+// @Failure 503 {object} ErrorResponse "Semantic search is not configured"
+// @Router /messages/search [get]
+func (h *MessageSearchHandler) SearchMessages(c *gin.Context) {
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "missing_query",
+			Message: "Search text q is required",
+		})
+		return
+	}
+
+	mode := c.DefaultQuery("mode", SearchKeyword)
+	if mode != SearchKeyword && mode != SearchSemantic {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_mode",
+			Message: "Mode must be keyword or semantic",
+		})
+		return
+	}
+
+	query := MessageSearchQuery{
+		Text:        text,
+		SenderID:    c.Query("sender_id"),
+		MessageType: c.Query("message_type"),
+	}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := parseIntParam(l); err == nil && parsed > 0 {
+			query.Limit = parsed
+		}
+	}
+
+	for _, bound := range []struct {
+		param string
+		dst   **time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_date",
+				Message: bound.param + " must be an RFC 3339 time, e.g. 2024-01-02T15:04:05Z",
+			})
+			return
+		}
+		*bound.dst = &t
+	}
+
+	// Search one channel the caller may read, or every channel they belong to
+	callerID := CallerID(c)
+	if channelID := c.Query("channel_id"); channelID != "" {
+		if !CallerCan(c, PermissionReadMessages) {
+			if err := h.authorizer.AuthorizeChannel(c.Request.Context(), callerID, channelID); err != nil {
+				RespondAuthorizationError(c, err)
+				return
+			}
+		}
+		query.ChannelIDs = []string{channelID}
+	} else {
+		if callerID == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "missing_channel_id",
+				Message: "channel_id is required when not signed in as a user",
+			})
+			return
+		}
+
+		scope, err := h.searchService.ChannelScope(c.Request.Context(), callerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "search_failed",
+				Message: err.Error(),
+			})
+			return
+		}
+		query.ChannelIDs = scope
+	}
+
+	results, err := h.searchService.Search(c.Request.Context(), mode, query)
+	if err != nil {
+		if errors.Is(err, ErrSearchUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+				Error:   "search_unavailable",
+				Message: "Semantic search needs OPENAI_API_KEY to be set",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "search_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, MessageSearchResponse{
+		Mode:    mode,
+		Results: results,
+	})
+}
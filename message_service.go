@@ -3,13 +3,18 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
 	supa "github.com/supabase-community/supabase-go"
 )
 
-// MessageService handles message database operations
+// oldestFirst orders PostgREST results by creation time, ascending
+var oldestFirst = &postgrest.OrderOpts{Ascending: true}
+
+// MessageService handles message database operations; it is the PostgREST MessageRepository
 type MessageService struct {
 	client *supa.Client
 }
@@ -43,13 +48,9 @@ func (s *MessageService) CreateMessage(message *Message) (*Message, error) {
 		message.Type = "text"
 	}
 	
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal message: %w", err)
-	}
-	
+	// The client marshals the value itself; pre-marshaled bytes would be sent as base64
 	result, _, err := s.client.From("messages").
-		Insert(messageJSON, false, "", "", "").
+		Insert(message, false, "", "", "").
 		Execute()
 	
 	if err != nil {
@@ -69,64 +70,93 @@ func (s *MessageService) CreateMessage(message *Message) (*Message, error) {
 	return &createdMessages[0], nil
 }
 
-// GetChannelMessages retrieves messages for a specific channel, ordered by creation time
-func (s *MessageService) GetChannelMessages(channelID string, limit int, offset int) ([]Message, error) {
-	query := s.client.From("messages").
-		Select("*", "", false).
-		Eq("channel_id", channelID).
-		Order("created_at", nil) // Order by created_at ascending
-	
-	if limit > 0 {
-		query = query.Limit(limit, "")
+// CreateStreamMessage stores a mirrored Stream Chat message unless its Stream ID is already
+// stored. If a concurrent insert wins the unique stream_message_id index, its row is returned.
+func (s *MessageService) CreateStreamMessage(message *Message) (*Message, bool, error) {
+	if message.StreamMessageID == nil {
+		return nil, false, fmt.Errorf("failed to create stream message: stream_message_id is required")
 	}
-	
-	if offset > 0 {
-		query = query.Range(offset, offset+limit-1, "")
+
+	existing, err := s.GetMessagesByStreamID(*message.StreamMessageID)
+	if err != nil {
+		return nil, false, err
 	}
-	
-	result, _, err := query.Execute()
+	if len(existing) > 0 {
+		return &existing[0], false, nil
+	}
+
+	created, createErr := s.CreateMessage(message)
+	if createErr == nil {
+		return created, true, nil
+	}
+
+	existing, err = s.GetMessagesByStreamID(*message.StreamMessageID)
+	if err != nil || len(existing) == 0 {
+		return nil, false, createErr
+	}
+	return &existing[0], false, nil
+}
+
+// GetChannelMessages retrieves a page of a channel's messages, keyed on (created_at, id)
+func (s *MessageService) GetChannelMessages(channelID string, page MessagePageQuery) (*MessagePage, error) {
+	messagePage, err := s.pageMessages("channel_id", channelID, page)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get channel messages: %w", err)
 	}
-	
-	var messages []Message
-	err = json.Unmarshal(result, &messages)
+	return messagePage, nil
+}
+
+// GetThreadReplies retrieves a page of the replies to a message, keyed on (created_at, id)
+func (s *MessageService) GetThreadReplies(parentID string, page MessagePageQuery) (*MessagePage, error) {
+	messagePage, err := s.pageMessages("reply_to_id", parentID, page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode messages: %w", err)
+		return nil, fmt.Errorf("failed to get thread replies: %w", err)
 	}
-	
-	return messages, nil
+	return messagePage, nil
 }
 
-// GetRecentChannelMessages retrieves the most recent messages for ChatGPT context
-func (s *MessageService) GetRecentChannelMessages(channelID string, limit int) ([]Message, error) {
-	if limit <= 0 {
-		limit = DefaultMessageLimit // Default context window
+// CountReplies counts the replies to each message that aren't deleted
+func (s *MessageService) CountReplies(messageIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(messageIDs) == 0 {
+		return counts, nil
 	}
-	
+
+	parents := make([]string, len(messageIDs))
+	for i, messageID := range messageIDs {
+		parents[i] = quotePostgRESTValue(messageID)
+	}
+
 	result, _, err := s.client.From("messages").
-		Select("*", "", false).
-		Eq("channel_id", channelID).
-		Order("created_at", nil). // Order by created_at descending  
-		Limit(limit, "").
+		Select("reply_to_id", "", false).
+		Filter("reply_to_id", "in", "("+strings.Join(parents, ",")+")").
+		Is("deleted_at", "null").
 		Execute()
-	
 	if err != nil {
-		return nil, fmt.Errorf("failed to get recent channel messages: %w", err)
+		return nil, fmt.Errorf("failed to count replies: %w", err)
 	}
-	
-	var messages []Message
-	err = json.Unmarshal(result, &messages)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode messages: %w", err)
+
+	var replies []struct {
+		ReplyToID string `json:"reply_to_id"`
 	}
-	
-	// Reverse the order so oldest messages come first (for ChatGPT context)
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if err := json.Unmarshal(result, &replies); err != nil {
+		return nil, fmt.Errorf("failed to decode replies: %w", err)
 	}
-	
-	return messages, nil
+
+	for _, reply := range replies {
+		counts[reply.ReplyToID]++
+	}
+	return counts, nil
+}
+
+// GetRecentChannelMessages retrieves the most recent messages of a channel that aren't deleted,
+// oldest first, for ChatGPT context
+func (s *MessageService) GetRecentChannelMessages(channelID string, limit int) ([]Message, error) {
+	page, err := s.GetChannelMessages(channelID, MessagePageQuery{Limit: limit, ExcludeDeleted: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent channel messages: %w", err)
+	}
+	return page.Messages, nil
 }
 
 // GetMessageByID retrieves a specific message by ID
@@ -173,29 +203,10 @@ func (s *MessageService) GetMessagesByStreamID(streamMessageID string) ([]Messag
 	return messages, nil
 }
 
-// DeleteMessage deletes a message by ID
-func (s *MessageService) DeleteMessage(messageID string) error {
-	_, _, err := s.client.From("messages").
-		Delete("", "").
-		Eq("id", messageID).
-		Execute()
-	
-	if err != nil {
-		return fmt.Errorf("failed to delete message: %w", err)
-	}
-	
-	return nil
-}
-
 // UpdateMessage updates a message
 func (s *MessageService) UpdateMessage(messageID string, updates map[string]interface{}) (*Message, error) {
-	updatesJSON, err := json.Marshal(updates)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal updates: %w", err)
-	}
-	
 	result, _, err := s.client.From("messages").
-		Update(updatesJSON, "", "").
+		Update(updates, "", "").
 		Eq("id", messageID).
 		Execute()
 	
@@ -214,4 +225,286 @@ func (s *MessageService) UpdateMessage(messageID string, updates map[string]inte
 	}
 	
 	return &updatedMessages[0], nil
-}
\ No newline at end of file
+}
+
+// GetMessagesBySender retrieves every message a user sent, oldest first
+func (s *MessageService) GetMessagesBySender(senderID string) ([]Message, error) {
+	const pageSize = 1000
+
+	var all []Message
+	for offset := 0; ; offset += pageSize {
+		result, _, err := s.client.From("messages").
+			Select("*", "", false).
+			Eq("sender_id", senderID).
+			Order("created_at", oldestFirst).
+			Range(offset, offset+pageSize-1, "").
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get sender messages: %w", err)
+		}
+
+		var page []Message
+		if err := json.Unmarshal(result, &page); err != nil {
+			return nil, fmt.Errorf("failed to decode messages: %w", err)
+		}
+
+		all = append(all, page...)
+		if len(page) < pageSize {
+			return all, nil
+		}
+	}
+}
+
+// DeleteChannelMessages deletes every message in a channel
+func (s *MessageService) DeleteChannelMessages(channelID string) error {
+	_, _, err := s.client.From("messages").
+		Delete("", "").
+		Eq("channel_id", channelID).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to delete channel messages: %w", err)
+	}
+
+	return nil
+}
+
+// AnonymizeSenderMessages strips the sender and content from every message a user sent,
+// deletes the revisions of those messages and unlinks the user from edits and deletes they made
+func (s *MessageService) AnonymizeSenderMessages(senderID string) error {
+	_, _, err := s.client.From("message_revisions").
+		Delete("minimal", "").
+		Eq("sender_id", senderID).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to delete message revisions: %w", err)
+	}
+
+	for _, table := range []string{"message_reactions", "message_flags"} {
+		_, _, err := s.client.From(table).
+			Delete("minimal", "").
+			Eq("user_id", senderID).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+
+	updates := []struct {
+		table  string
+		column string
+		values map[string]interface{}
+	}{
+		{"message_revisions", "edited_by", map[string]interface{}{"edited_by": DeletedUserID}},
+		{"messages", "deleted_by", map[string]interface{}{"deleted_by": DeletedUserID}},
+		{"messages", "sender_id", map[string]interface{}{
+			"sender_id":       DeletedUserID,
+			"sender_username": "Deleted user",
+			"message_text":    "[deleted]",
+		}},
+	}
+	for _, update := range updates {
+		_, _, err := s.client.From(update.table).
+			Update(update.values, "minimal", "").
+			Eq(update.column, senderID).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("failed to anonymize messages: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// EditMessage saves a message's text as a revision and replaces it
+func (s *MessageService) EditMessage(messageID, text, editorID string, editedAt time.Time) (*Message, error) {
+	return s.replaceText(messageID, editorID, editedAt, map[string]interface{}{
+		"message_text": text,
+		"edited_at":    editedAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// TombstoneMessage saves a message's text as a revision, clears it and marks the message deleted
+func (s *MessageService) TombstoneMessage(messageID, deletedBy, reason string, deletedAt time.Time) (*Message, error) {
+	return s.replaceText(messageID, deletedBy, deletedAt, map[string]interface{}{
+		"message_text":  "",
+		"deleted_at":    deletedAt.UTC().Format(time.RFC3339Nano),
+		"deleted_by":    deletedBy,
+		"delete_reason": reason,
+	})
+}
+
+// ListMessageRevisions retrieves the earlier texts of a message, oldest first
+func (s *MessageService) ListMessageRevisions(messageID string) ([]MessageRevision, error) {
+	result, _, err := s.client.From("message_revisions").
+		Select("*", "", false).
+		Eq("message_id", messageID).
+		Order("edited_at", oldestFirst).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message revisions: %w", err)
+	}
+
+	var revisions []MessageRevision
+	if err := json.Unmarshal(result, &revisions); err != nil {
+		return nil, fmt.Errorf("failed to decode message revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// AddReaction stores a reaction, upserting on the primary key so a replayed reaction is kept once
+func (s *MessageService) AddReaction(reaction *MessageReaction) error {
+	_, _, err := s.client.From("message_reactions").
+		Insert(reaction, true, "message_id,user_id,type", "minimal", "").
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveReaction deletes a reaction, if it is stored
+func (s *MessageService) RemoveReaction(messageID, userID, reactionType string) error {
+	_, _, err := s.client.From("message_reactions").
+		Delete("minimal", "").
+		Eq("message_id", messageID).
+		Eq("user_id", userID).
+		Eq("type", reactionType).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return nil
+}
+
+// FlagMessage stores a flag, upserting on the primary key so a replayed flag is kept once
+func (s *MessageService) FlagMessage(flag *MessageFlag) error {
+	_, _, err := s.client.From("message_flags").
+		Insert(flag, true, "message_id,user_id", "minimal", "").
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to flag message: %w", err)
+	}
+	return nil
+}
+
+// replaceText saves a message's current text as a revision by editorID, then applies updates.
+// PostgREST has no transactions, so the revision is written first and is never lost.
+func (s *MessageService) replaceText(messageID, editorID string, at time.Time, updates map[string]interface{}) (*Message, error) {
+	message, err := s.GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	_, _, err = s.client.From("message_revisions").
+		Insert(map[string]interface{}{
+			"id":           uuid.New().String(),
+			"message_id":   messageID,
+			"sender_id":    message.SenderID,
+			"message_text": message.MessageText,
+			"edited_by":    editorID,
+			"edited_at":    at.UTC().Format(time.RFC3339Nano),
+		}, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save message revision: %w", err)
+	}
+
+	return s.UpdateMessage(messageID, updates)
+}
+
+// SearchMessages returns messages matching a search, newest first, using full-text search on search_vector
+func (s *MessageService) SearchMessages(query MessageSearchQuery) ([]Message, error) {
+	if len(query.ChannelIDs) == 0 {
+		return []Message{}, nil
+	}
+
+	channels := make([]string, len(query.ChannelIDs))
+	for i, channelID := range query.ChannelIDs {
+		channels[i] = quotePostgRESTValue(channelID)
+	}
+
+	filter := s.client.From("messages").
+		Select("*", "", false).
+		Filter("channel_id", "in", "("+strings.Join(channels, ",")+")").
+		Is("deleted_at", "null")
+
+	if query.Text != "" {
+		filter = filter.TextSearch("search_vector", query.Text, "english", "websearch")
+	}
+	if query.SenderID != "" {
+		filter = filter.Eq("sender_id", query.SenderID)
+	}
+	if query.MessageType != "" {
+		filter = filter.Eq("message_type", query.MessageType)
+	}
+	if query.From != nil {
+		filter = filter.Gte("created_at", query.From.UTC().Format(time.RFC3339Nano))
+	}
+	if query.To != nil {
+		// Filters are keyed by column, so the upper bound can't be a second created_at filter
+		filter = filter.Or("created_at.lte."+quotePostgRESTValue(query.To.UTC().Format(time.RFC3339Nano)), "")
+	}
+	if query.Limit > 0 {
+		filter = filter.Limit(query.Limit, "")
+	}
+
+	newestFirst := &postgrest.OrderOpts{Ascending: false}
+	result, _, err := filter.
+		Order("created_at", newestFirst).
+		Order("id", newestFirst).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	var messages []Message
+	if err := json.Unmarshal(result, &messages); err != nil {
+		return nil, fmt.Errorf("failed to decode messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// pageMessages retrieves a page of the messages whose column equals a value
+func (s *MessageService) pageMessages(column, value string, page MessagePageQuery) (*MessagePage, error) {
+	query := s.client.From("messages").
+		Select("*", "", false).
+		Eq(column, value)
+	if page.ExcludeDeleted {
+		query = query.Is("deleted_at", "null")
+	}
+
+	// Rows strictly past the cursor, in the direction being paged
+	ascending := page.After != nil
+	cursor, op := page.Before, "lt"
+	if ascending {
+		cursor, op = page.After, "gt"
+	}
+	if cursor != nil {
+		createdAt := quotePostgRESTValue(cursor.CreatedAt.UTC().Format(time.RFC3339Nano))
+		query = query.Or(fmt.Sprintf("created_at.%s.%s,and(created_at.eq.%s,id.%s.%s)",
+			op, createdAt, createdAt, op, quotePostgRESTValue(cursor.ID)), "")
+	}
+
+	order := &postgrest.OrderOpts{Ascending: ascending}
+	result, _, err := query.
+		Order("created_at", order).
+		Order("id", order).
+		Limit(page.pageLimit()+1, "").
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	if err := json.Unmarshal(result, &messages); err != nil {
+		return nil, fmt.Errorf("failed to decode messages: %w", err)
+	}
+
+	return buildMessagePage(messages, page), nil
+}
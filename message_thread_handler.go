@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MessageThreadHandler handles threaded replies to stored messages
+type MessageThreadHandler struct {
+	threadService *MessageThreadService
+	authorizer    *Authorizer
+}
+
+// NewMessageThreadHandler creates a new message thread handler
+func NewMessageThreadHandler(threadService *MessageThreadService, authorizer *Authorizer) *MessageThreadHandler {
+	return &MessageThreadHandler{
+		threadService: threadService,
+		authorizer:    authorizer,
+	}
+}
+
+// GetThread handles fetching a message's thread
+// @Summary Get a message thread
+// @Description Get the root of a message's thread with its reply count and a page of its replies, oldest first. Given a reply, the thread it is in is returned. Paging works as for channel history: pass prev_cursor as before for older replies or next_cursor as after for newer ones.
+// @Tags Messages
+// @Produce json
+// @Security Bearer
+// @Param message_id path string true "Message ID"
+// @Param limit query int false "Number of replies to retrieve (max 200)" default(50)
+// @Param before query string false "Cursor: return replies older than this"
+// @Param after query string false "Cursor: return replies newer than this"
+// @Success 200 {object} MessageThread "Thread"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a member of the channel"
+// @Failure 404 {object} ErrorResponse "Message not found"
+// @Failure 500 {object} ErrorResponse "Failed to get thread"
+// @Router /messages/{message_id}/thread [get]
+func (h *MessageThreadHandler) GetThread(c *gin.Context) {
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+	query, ok := messagePageParams(c)
+	if !ok {
+		return
+	}
+
+	root, err := h.threadService.Root(messageID)
+	if err != nil {
+		respondThreadError(c, err)
+		return
+	}
+	if !CallerCan(c, PermissionReadMessages) {
+		if err := h.authorizer.AuthorizeChannel(c.Request.Context(), CallerID(c), root.ChannelID); err != nil {
+			RespondAuthorizationError(c, err)
+			return
+		}
+	}
+
+	thread, err := h.threadService.GetThread(root, query)
+	if err != nil {
+		respondThreadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, thread)
+}
+
+// Reply handles replying in a message's thread
+// @Summary Reply to a message
+// @Description Post a reply in a message's thread, as the signed-in user. Replying to a reply posts in the same thread, so reply_to_id of the stored message is the thread's root.
+// @Tags Messages
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param message_id path string true "Message ID"
+// @Param request body ReplyRequest true "Reply text"
+// @Success 201 {object} Message "Stored reply"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a member of the channel, or not a user"
+// @Failure 404 {object} ErrorResponse "Message not found"
+// @Failure 409 {object} ErrorResponse "Message was deleted"
+// @Failure 500 {object} ErrorResponse "Failed to store reply"
+// @Router /messages/{message_id}/thread [post]
+func (h *MessageThreadHandler) Reply(c *gin.Context) {
+	var req ReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	messageID, ok := messageIDParam(c)
+	if !ok {
+		return
+	}
+
+	root, err := h.threadService.ReplyTarget(messageID, "")
+	if err != nil {
+		respondThreadError(c, err)
+		return
+	}
+
+	// Only channel members may post, whatever their permissions
+	callerID := CallerID(c)
+	if err := h.authorizer.AuthorizeChannel(c.Request.Context(), callerID, root.ChannelID); err != nil {
+		RespondAuthorizationError(c, err)
+		return
+	}
+
+	reply, err := h.threadService.Reply(callerID, root, req.MessageText)
+	if err != nil {
+		respondThreadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, reply)
+}
+
+// respondThreadError maps thread errors to responses
+func respondThreadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrReplyChannelMismatch):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "reply_channel_mismatch", Message: err.Error()})
+	case errors.Is(err, ErrMessageNotFound), errors.Is(err, ErrMessageDeleted),
+		errors.Is(err, ErrEmptyMessage), errors.Is(err, ErrForbidden):
+		respondMessageEditError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "thread_failed", Message: err.Error()})
+	}
+}
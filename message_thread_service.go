@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrReplyChannelMismatch is returned when a reply names a message in another channel
+var ErrReplyChannelMismatch = errors.New("the message replied to is in another channel")
+
+// MessageThreadService posts and reads threaded replies. Threads are one level deep: a reply
+// to a reply joins its parent's thread, so ReplyToID always points at the thread's root.
+type MessageThreadService struct {
+	messageRepo MessageRepository
+	userRepo    UserRepository
+}
+
+// NewMessageThreadService creates a new message thread service
+func NewMessageThreadService(messageRepo MessageRepository, userRepo UserRepository) *MessageThreadService {
+	return &MessageThreadService{
+		messageRepo: messageRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// Root returns the root of the thread a message belongs to, which is the message itself
+// unless it is a reply
+func (s *MessageThreadService) Root(messageID string) (*Message, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.ReplyToID == nil {
+		return message, nil
+	}
+	return s.getMessage(*message.ReplyToID)
+}
+
+// ReplyTarget returns the root of the thread a reply to a message is posted in. The message
+// must not be deleted and, when channelID is set, must be in that channel.
+func (s *MessageThreadService) ReplyTarget(messageID, channelID string) (*Message, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if channelID != "" && message.ChannelID != channelID {
+		return nil, ErrReplyChannelMismatch
+	}
+	if message.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	if message.ReplyToID == nil {
+		return message, nil
+	}
+	return s.getMessage(*message.ReplyToID)
+}
+
+// Reply stores a user's reply in a thread, given its root from ReplyTarget
+func (s *MessageThreadService) Reply(userID string, root *Message, text string) (*Message, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmptyMessage
+	}
+	if userID == "" {
+		return nil, ErrForbidden
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrForbidden
+	}
+
+	return s.messageRepo.CreateMessage(&Message{
+		MessageText:    text,
+		SenderID:       userID,
+		SenderUsername: user.Username,
+		ChannelID:      root.ChannelID,
+		MessageType:    "user",
+		Type:           "text",
+		ReplyToID:      &root.ID,
+	})
+}
+
+// GetThread returns a thread's root with its reply count and a page of its replies
+func (s *MessageThreadService) GetThread(root *Message, query MessagePageQuery) (*MessageThread, error) {
+	page, err := s.messageRepo.GetThreadReplies(root.ID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := []Message{*root}
+	if err := s.AttachReplyCounts(parent); err != nil {
+		return nil, err
+	}
+
+	return &MessageThread{
+		Parent:     parent[0],
+		Replies:    page.Messages,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		HasMore:    page.HasMore,
+	}, nil
+}
+
+// ThreadContext returns a thread's root and its most recent replies that aren't deleted,
+// at most limit messages oldest first, for ChatGPT context
+func (s *MessageThreadService) ThreadContext(root *Message, limit int) ([]Message, error) {
+	var messages []Message
+	if root.DeletedAt == nil {
+		messages = append(messages, *root)
+		limit--
+	}
+
+	page, err := s.messageRepo.GetThreadReplies(root.ID, MessagePageQuery{Limit: limit, ExcludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	return append(messages, page.Messages...), nil
+}
+
+// AttachReplyCounts fills in ReplyCount on the messages that aren't replies themselves
+func (s *MessageThreadService) AttachReplyCounts(messages []Message) error {
+	var ids []string
+	for _, message := range messages {
+		if message.ReplyToID == nil {
+			ids = append(ids, message.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	counts, err := s.messageRepo.CountReplies(ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].ReplyCount = counts[messages[i].ID]
+	}
+	return nil
+}
+
+// getMessage retrieves a message, returning ErrMessageNotFound if there is none
+func (s *MessageThreadService) getMessage(messageID string) (*Message, error) {
+	message, err := s.messageRepo.GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, ErrMessageNotFound
+	}
+	return message, nil
+}
@@ -0,0 +1,33 @@
+create table if not exists users (
+  id uuid not null default gen_random_uuid(),
+  created_at timestamp with time zone not null default now(),
+  username varchar(24) unique,
+  name varchar(50),
+  wallet_address text null,
+  profile_pic_url text null,
+  bio text null,
+  constraint users_pkey primary key (id)
+);
+
+-- Databases created before migrations have the table without these columns
+alter table users add column if not exists chain_type text null;
+alter table users add column if not exists role text not null default 'user';
+
+-- EVM rows written before chain_type existed
+update users
+set wallet_address = lower(wallet_address), chain_type = 'evm'
+where wallet_address like '0x%' and chain_type is null;
+
+do $$
+begin
+  if not exists (select 1 from pg_constraint where conname = 'users_wallet_key' and conrelid = 'users'::regclass) then
+    alter table users add constraint users_wallet_key unique (chain_type, wallet_address);
+  end if;
+end $$;
+
+do $$
+begin
+  if not exists (select 1 from pg_constraint where conname = 'users_role_check' and conrelid = 'users'::regclass) then
+    alter table users add constraint users_role_check check (role in ('user', 'moderator', 'admin'));
+  end if;
+end $$;
@@ -0,0 +1,18 @@
+create table if not exists messages (
+  id uuid not null default gen_random_uuid(),
+  created_at timestamp with time zone not null default now(),
+  message_text text null,
+  sender_id text null,
+  channel_id text null,
+  message_type text null,
+  sender_username text null,
+  type text null default 'text',
+  stream_message_id text null,
+  reply_to_id uuid null,
+  constraint messages_pkey primary key (id),
+  constraint messages_reply_to_id_fkey foreign key (reply_to_id) references messages (id) on update cascade on delete cascade
+);
+
+create index if not exists messages_channel_id_created_at_idx on messages (channel_id, created_at);
+create index if not exists messages_sender_id_idx on messages (sender_id);
+create index if not exists messages_stream_message_id_idx on messages (stream_message_id);
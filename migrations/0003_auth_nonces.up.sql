@@ -0,0 +1,9 @@
+create table if not exists auth_nonces (
+  nonce text not null,
+  domain text not null,
+  chain_type text not null,
+  chain_id text not null,
+  expires_at timestamp with time zone not null,
+  created_at timestamp with time zone not null default now(),
+  constraint auth_nonces_pkey primary key (nonce)
+);
@@ -0,0 +1,23 @@
+create table if not exists sessions (
+  id uuid not null,
+  user_id uuid not null references users (id) on delete cascade,
+  user_agent text null,
+  ip_address text null,
+  created_at timestamp with time zone not null default now(),
+  last_used_at timestamp with time zone null,
+  expires_at timestamp with time zone not null,
+  revoked_at timestamp with time zone null,
+  revoke_reason text null,
+  constraint sessions_pkey primary key (id)
+);
+
+create index if not exists sessions_user_id_idx on sessions (user_id);
+
+create table if not exists refresh_tokens (
+  token_hash text not null,
+  session_id uuid not null references sessions (id) on delete cascade,
+  created_at timestamp with time zone not null default now(),
+  expires_at timestamp with time zone not null,
+  used_at timestamp with time zone null,
+  constraint refresh_tokens_pkey primary key (token_hash)
+);
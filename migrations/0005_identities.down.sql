@@ -0,0 +1,2 @@
+drop table if exists email_verifications;
+drop table if exists identities;
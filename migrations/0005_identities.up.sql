@@ -0,0 +1,26 @@
+create table if not exists identities (
+  id uuid not null,
+  user_id uuid not null references users (id) on delete cascade,
+  provider text not null,
+  subject text not null,
+  created_at timestamp with time zone not null default now(),
+  constraint identities_pkey primary key (id),
+  constraint identities_provider_subject_key unique (provider, subject)
+);
+
+create index if not exists identities_user_id_idx on identities (user_id);
+
+create table if not exists email_verifications (
+  user_id uuid not null references users (id) on delete cascade,
+  email text not null,
+  code_hash text not null,
+  expires_at timestamp with time zone not null,
+  constraint email_verifications_pkey primary key (user_id, email)
+);
+
+-- Every existing user's primary wallet becomes a linked identity
+insert into identities (id, user_id, provider, subject)
+select gen_random_uuid(), id, chain_type, wallet_address
+from users
+where wallet_address is not null and chain_type is not null
+on conflict do nothing;
@@ -0,0 +1,14 @@
+create table if not exists api_keys (
+  id uuid not null,
+  name text not null,
+  prefix text not null,
+  key_hash text not null,
+  scopes text[] not null,
+  created_by uuid null references users (id) on delete set null,
+  created_at timestamp with time zone not null default now(),
+  last_used_at timestamp with time zone null,
+  expires_at timestamp with time zone null,
+  revoked_at timestamp with time zone null,
+  constraint api_keys_pkey primary key (id),
+  constraint api_keys_key_hash_key unique (key_hash)
+);
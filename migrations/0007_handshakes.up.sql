@@ -0,0 +1,12 @@
+create table if not exists handshakes (
+  id uuid not null default gen_random_uuid(),
+  type text not null,
+  from_uid text not null,
+  to_uid text null,
+  message text null,
+  "timestamp" timestamp with time zone not null default now(),
+  constraint handshakes_pkey primary key (id)
+);
+
+create index if not exists handshakes_from_uid_idx on handshakes (from_uid);
+create index if not exists handshakes_to_uid_idx on handshakes (to_uid);
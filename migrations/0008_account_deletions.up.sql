@@ -0,0 +1,11 @@
+-- No foreign key to users, so jobs outlive the user row they delete
+create table if not exists account_deletions (
+  user_id uuid not null,
+  status text not null,
+  completed_steps text[] not null default '{}',
+  attempts integer not null default 0,
+  last_error text null,
+  created_at timestamp with time zone not null default now(),
+  updated_at timestamp with time zone not null default now(),
+  constraint account_deletions_pkey primary key (user_id)
+);
@@ -0,0 +1,2 @@
+create index if not exists messages_channel_id_created_at_idx on messages (channel_id, created_at);
+drop index if exists messages_channel_id_created_at_id_idx;
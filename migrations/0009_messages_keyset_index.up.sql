@@ -0,0 +1,3 @@
+-- Channel history is paged on (created_at, id), so the index carries id as a tiebreaker
+create index if not exists messages_channel_id_created_at_id_idx on messages (channel_id, created_at, id);
+drop index if exists messages_channel_id_created_at_idx;
@@ -0,0 +1,2 @@
+drop index if exists messages_search_vector_idx;
+alter table messages drop column if exists search_vector;
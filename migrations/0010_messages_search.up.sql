@@ -0,0 +1,5 @@
+-- Full-text search over message text, for /messages/search
+alter table messages add column if not exists search_vector tsvector
+  generated always as (to_tsvector('english', coalesce(message_text, ''))) stored;
+
+create index if not exists messages_search_vector_idx on messages using gin (search_vector);
@@ -0,0 +1,7 @@
+drop table if exists message_revisions;
+
+alter table messages
+  drop column if exists edited_at,
+  drop column if exists deleted_at,
+  drop column if exists deleted_by,
+  drop column if exists delete_reason;
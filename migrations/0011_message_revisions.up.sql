@@ -0,0 +1,19 @@
+-- Edits keep the replaced text as a revision; deletes leave a tombstone row
+alter table messages
+  add column if not exists edited_at timestamp with time zone null,
+  add column if not exists deleted_at timestamp with time zone null,
+  add column if not exists deleted_by text null,
+  add column if not exists delete_reason text null;
+
+create table if not exists message_revisions (
+  id uuid not null default gen_random_uuid(),
+  message_id uuid not null references messages (id) on delete cascade,
+  sender_id text null,
+  message_text text null,
+  edited_by text not null,
+  edited_at timestamp with time zone not null default now(),
+  constraint message_revisions_pkey primary key (id)
+);
+
+create index if not exists message_revisions_message_id_idx on message_revisions (message_id, edited_at);
+create index if not exists message_revisions_sender_id_idx on message_revisions (sender_id);
@@ -0,0 +1 @@
+drop index if exists messages_reply_to_id_created_at_id_idx;
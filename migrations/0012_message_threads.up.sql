@@ -0,0 +1,3 @@
+-- Threads are paged on (created_at, id) like channel history; the index also serves reply counts
+create index if not exists messages_reply_to_id_created_at_id_idx on messages (reply_to_id, created_at, id)
+  where reply_to_id is not null;
@@ -0,0 +1,2 @@
+create index if not exists messages_stream_message_id_idx on messages (stream_message_id);
+drop index if exists messages_stream_message_id_key;
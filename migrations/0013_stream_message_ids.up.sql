@@ -0,0 +1,4 @@
+-- Mirrored Stream Chat messages are stored once per Stream message ID; nulls stay distinct,
+-- so messages that never went through Stream are unaffected
+create unique index if not exists messages_stream_message_id_key on messages (stream_message_id);
+drop index if exists messages_stream_message_id_idx;
@@ -0,0 +1,2 @@
+drop table if exists message_flags;
+drop table if exists message_reactions;
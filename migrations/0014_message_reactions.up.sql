@@ -0,0 +1,20 @@
+create table if not exists message_reactions (
+  message_id uuid not null,
+  user_id text not null,
+  type text not null,
+  created_at timestamp with time zone not null default now(),
+  constraint message_reactions_pkey primary key (message_id, user_id, type),
+  constraint message_reactions_message_id_fkey foreign key (message_id) references messages (id) on delete cascade
+);
+
+create index if not exists message_reactions_user_id_idx on message_reactions (user_id);
+
+create table if not exists message_flags (
+  message_id uuid not null,
+  user_id text not null,
+  created_at timestamp with time zone not null default now(),
+  constraint message_flags_pkey primary key (message_id, user_id),
+  constraint message_flags_message_id_fkey foreign key (message_id) references messages (id) on delete cascade
+);
+
+create index if not exists message_flags_user_id_idx on message_flags (user_id);
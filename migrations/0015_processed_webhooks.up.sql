@@ -0,0 +1,8 @@
+-- Stream Chat webhook IDs that were verified and processed, kept for the dedupe TTL
+create table if not exists processed_webhooks (
+  webhook_id text not null,
+  processed_at timestamp with time zone not null default now(),
+  constraint processed_webhooks_pkey primary key (webhook_id)
+);
+
+create index if not exists processed_webhooks_processed_at_idx on processed_webhooks (processed_at);
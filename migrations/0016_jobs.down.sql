@@ -0,0 +1,2 @@
+drop table if exists dead_letter_jobs;
+drop table if exists jobs;
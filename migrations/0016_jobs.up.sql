@@ -0,0 +1,30 @@
+-- Background jobs. A worker claims a due job by leasing it until locked_until; jobs whose
+-- lease ran out are claimed again, so every job runs at least once.
+create table if not exists jobs (
+  id uuid not null default gen_random_uuid(),
+  kind text not null,
+  payload jsonb not null,
+  attempts integer not null default 0,
+  max_attempts integer not null,
+  run_at timestamp with time zone not null default now(),
+  locked_until timestamp with time zone null,
+  last_error text null,
+  created_at timestamp with time zone not null default now(),
+  constraint jobs_pkey primary key (id)
+);
+
+create index if not exists jobs_run_at_idx on jobs (run_at);
+
+-- Jobs that failed every attempt, kept for inspection and replay
+create table if not exists dead_letter_jobs (
+  id uuid not null,
+  kind text not null,
+  payload jsonb not null,
+  attempts integer not null,
+  last_error text not null,
+  created_at timestamp with time zone not null,
+  failed_at timestamp with time zone not null default now(),
+  constraint dead_letter_jobs_pkey primary key (id)
+);
+
+create index if not exists dead_letter_jobs_failed_at_idx on dead_letter_jobs (failed_at);
@@ -0,0 +1,18 @@
+-- Verified Stream Chat webhooks as received, with how processing went, for inspection and replay
+create table if not exists webhook_deliveries (
+  id uuid not null default gen_random_uuid(),
+  webhook_id text null,
+  event_type text not null,
+  headers jsonb not null default '{}',
+  body text not null,
+  status text not null,
+  attempts integer not null default 0,
+  replay_count integer not null default 0,
+  last_error text null,
+  received_at timestamp with time zone not null default now(),
+  processed_at timestamp with time zone null,
+  constraint webhook_deliveries_pkey primary key (id)
+);
+
+create index if not exists webhook_deliveries_received_at_idx on webhook_deliveries (received_at);
+create index if not exists webhook_deliveries_webhook_id_idx on webhook_deliveries (webhook_id);
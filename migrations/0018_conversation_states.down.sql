@@ -0,0 +1 @@
+drop table if exists conversation_states;
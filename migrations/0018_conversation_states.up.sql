@@ -0,0 +1,11 @@
+-- Where each user's conversation with the chatbot stands, see ConversationMachine
+create table if not exists conversation_states (
+  user_id uuid not null references users (id) on delete cascade,
+  state text not null,
+  proposed_user_id uuid null references users (id) on delete set null,
+  expires_at timestamp with time zone null,
+  updated_at timestamp with time zone not null default now(),
+  constraint conversation_states_pkey primary key (user_id)
+);
+
+create index if not exists conversation_states_proposed_user_id_idx on conversation_states (proposed_user_id);
@@ -0,0 +1,4 @@
+alter table conversation_states add column if not exists proposed_user_id uuid null references users (id) on delete set null;
+create index if not exists conversation_states_proposed_user_id_idx on conversation_states (proposed_user_id);
+
+drop table if exists match_proposals;
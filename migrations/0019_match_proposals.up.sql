@@ -0,0 +1,18 @@
+-- Users the chatbot proposed meeting, kept after they are answered
+create table if not exists match_proposals (
+  id uuid not null default gen_random_uuid(),
+  user_id uuid not null references users (id) on delete cascade,
+  proposed_user_id uuid not null references users (id) on delete cascade,
+  preferences text null,
+  status text not null default 'proposed',
+  created_at timestamp with time zone not null default now(),
+  expires_at timestamp with time zone not null,
+  responded_at timestamp with time zone null,
+  constraint match_proposals_pkey primary key (id)
+);
+
+create index if not exists match_proposals_user_id_created_at_idx on match_proposals (user_id, created_at desc);
+create index if not exists match_proposals_proposed_user_id_idx on match_proposals (proposed_user_id);
+
+-- The open proposal now lives in match_proposals
+alter table conversation_states drop column if exists proposed_user_id;
@@ -0,0 +1 @@
+alter table match_proposals drop column if exists consent_responded_at;
@@ -0,0 +1,2 @@
+-- Proposed users now accept or decline a match before a channel is created
+alter table match_proposals add column if not exists consent_responded_at timestamp with time zone null;
@@ -0,0 +1,2 @@
+alter table users drop column if exists ban_expires_at;
+alter table users drop column if exists banned_at;
@@ -0,0 +1,3 @@
+-- App-wide Stream Chat bans are kept on the user, so banned users can't sign in again
+alter table users add column if not exists banned_at timestamp with time zone null;
+alter table users add column if not exists ban_expires_at timestamp with time zone null;
@@ -0,0 +1 @@
+drop function if exists delete_identity(uuid, uuid);
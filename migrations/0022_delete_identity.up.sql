@@ -0,0 +1,22 @@
+-- Unlinks an identity unless it is the user's last, counting and deleting in one statement.
+-- The user row is locked first so concurrent unlinks can't each leave the other as the last.
+create or replace function delete_identity(p_user_id uuid, p_identity_id uuid)
+returns text
+language plpgsql
+as $$
+begin
+  perform 1 from users where id = p_user_id for update;
+
+  delete from identities
+  where id = p_identity_id and user_id = p_user_id
+    and (select count(*) from identities where user_id = p_user_id) > 1;
+  if found then
+    return 'deleted';
+  end if;
+
+  if exists (select 1 from identities where id = p_identity_id and user_id = p_user_id) then
+    return 'last_identity';
+  end if;
+  return 'not_found';
+end;
+$$;
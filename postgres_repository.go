@@ -0,0 +1,1408 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Columns that UpdateUser, UpdateMessage and UpdateWebhookDelivery may set
+var (
+	userUpdateColumns     = []string{"username", "name", "wallet_address", "chain_type", "role", "profile_pic_url", "bio", "banned_at", "ban_expires_at"}
+	messageUpdateColumns  = []string{"message_text", "sender_id", "channel_id", "message_type", "sender_username", "type", "stream_message_id", "reply_to_id"}
+	deliveryUpdateColumns = []string{"status", "attempts", "replay_count", "last_error", "processed_at"}
+)
+
+// Select lists, in the order the scan functions below read them
+const (
+	userSelect = `id::text, created_at, coalesce(username, ''), coalesce(name, ''), coalesce(wallet_address, ''),
+		coalesce(chain_type, ''), role, coalesce(profile_pic_url, ''), coalesce(bio, ''), banned_at, ban_expires_at`
+	sessionSelect = `id::text, user_id::text, coalesce(user_agent, ''), coalesce(ip_address, ''), created_at,
+		last_used_at, expires_at, revoked_at, coalesce(revoke_reason, '')`
+	apiKeySelect = `id::text, name, prefix, key_hash, scopes, coalesce(created_by::text, ''), created_at,
+		last_used_at, expires_at, revoked_at`
+	identitySelect        = `id::text, user_id::text, provider, subject, created_at`
+	handshakeSelect       = `type, from_uid, coalesce(to_uid, ''), coalesce(message, ''), "timestamp"`
+	accountDeletionSelect = `user_id::text, status, completed_steps, attempts, coalesce(last_error, ''), created_at, updated_at`
+	messageSelect         = `id::text, created_at, coalesce(message_text, ''), coalesce(sender_id, ''), coalesce(channel_id, ''),
+		coalesce(message_type, ''), coalesce(sender_username, ''), coalesce(type, ''), stream_message_id, reply_to_id::text,
+		edited_at, deleted_at, coalesce(deleted_by, ''), coalesce(delete_reason, '')`
+	messageRevisionSelect = `id::text, message_id::text, coalesce(sender_id, ''), coalesce(message_text, ''), edited_by, edited_at`
+	jobSelect             = `id::text, kind, payload, attempts, max_attempts, run_at, locked_until, coalesce(last_error, ''), created_at`
+	conversationSelect    = `user_id::text, state, expires_at, updated_at`
+	proposalSelect        = `id::text, user_id::text, proposed_user_id::text, coalesce(preferences, ''), status, created_at, expires_at, responded_at, consent_responded_at`
+	deliverySelect        = `id::text, coalesce(webhook_id, ''), event_type, headers, body, status, attempts, replay_count,
+		coalesce(last_error, ''), received_at, processed_at`
+)
+
+// NewPostgresPool connects a pool to a Postgres database URL. Pool settings such as
+// pool_max_conns can be given as URL parameters.
+func NewPostgresPool(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	// Prepare each statement once per connection and reuse it from then on
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return pool, nil
+}
+
+// PostgresUserRepository is a UserRepository that talks to Postgres directly over a connection pool
+type PostgresUserRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresUserRepository creates a user repository on a pool
+func NewPostgresUserRepository(pool *pgxpool.Pool) *PostgresUserRepository {
+	return &PostgresUserRepository{
+		pool: pool,
+	}
+}
+
+// Ping checks that the database can be reached
+func (r *PostgresUserRepository) Ping() error {
+	return r.pool.Ping(context.Background())
+}
+
+// GetUserByID retrieves a user by ID
+func (r *PostgresUserRepository) GetUserByID(id string) (*User, error) {
+	return r.queryUser(`select `+userSelect+` from users where id = $1`, id)
+}
+
+// GetUserByUsername retrieves a user by username
+func (r *PostgresUserRepository) GetUserByUsername(username string) (*User, error) {
+	return r.queryUser(`select `+userSelect+` from users where username = $1`, username)
+}
+
+// GetUserByWallet retrieves the user a wallet is linked to, by chain and normalized address.
+// Wallets from before identities existed are found by the user's primary wallet columns.
+func (r *PostgresUserRepository) GetUserByWallet(wallet WalletIdentity) (*User, error) {
+	user, err := r.queryUser(`select `+userSelect+` from users
+		where id in (select user_id from identities where provider = $1 and subject = $2)
+		   or (chain_type = $1 and wallet_address = $2)
+		limit 1`, string(wallet.Chain), wallet.Address)
+	if err != nil || user != nil || wallet.Chain != ChainEVM {
+		return user, err
+	}
+
+	// Rows from before chain_type existed are EVM wallets in whatever case they were
+	// registered in. Claim them for EVM on first sign-in, as migration 0001 does.
+	return r.queryUser(`update users set chain_type = $1, wallet_address = $2
+		where id = (select id from users where chain_type is null and lower(wallet_address) = $2 limit 1)
+		returning `+userSelect, string(ChainEVM), wallet.Address)
+}
+
+// CreateUser creates a user and links its wallet as an identity in one transaction, or
+// returns the existing user if the wallet is already known
+func (r *PostgresUserRepository) CreateUser(user *User) (*User, error) {
+	if err := ValidateUserFields(user.Username, user.Name, user.Bio); err != nil {
+		return nil, err
+	}
+
+	wallet := WalletIdentity{Chain: user.ChainType, Address: user.WalletAddress}
+	if user.WalletAddress != "" {
+		existing, err := r.GetUserByWallet(wallet)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return existing, nil
+		}
+	}
+
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+
+	ctx := context.Background()
+	var created *User
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `insert into users (id, username, name, wallet_address, chain_type, role, profile_pic_url, bio)
+			values ($1, $2, $3, $4, $5, coalesce($6, 'user'), $7, $8)
+			returning `+userSelect,
+			user.ID, nullIfEmpty(user.Username), nullIfEmpty(user.Name), nullIfEmpty(user.WalletAddress),
+			nullIfEmpty(string(user.ChainType)), nullIfEmpty(string(user.Role)),
+			nullIfEmpty(user.ProfilePicURL), nullIfEmpty(user.Bio))
+		if err != nil {
+			return err
+		}
+		created, err = collectFirst(rows, scanUser)
+		if err != nil {
+			return err
+		}
+
+		// Every wallet a user signs in with is also a linked identity
+		if created.WalletAddress == "" {
+			return nil
+		}
+		_, err = tx.Exec(ctx, `insert into identities (id, user_id, provider, subject, created_at) values ($1, $2, $3, $4, $5)`,
+			uuid.New().String(), created.ID, string(created.ChainType), created.WalletAddress, created.CreatedAt)
+		return err
+	})
+	if err != nil {
+		// Another request registered the same wallet first
+		if isUniqueViolation(err) && user.WalletAddress != "" {
+			if existing, lookupErr := r.GetUserByWallet(wallet); lookupErr == nil && existing != nil {
+				return existing, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return created, nil
+}
+
+// UpdateUser updates columns of a user, keyed by column name
+func (r *PostgresUserRepository) UpdateUser(id string, updates map[string]interface{}) (*User, error) {
+	username, _ := updates["username"].(string)
+	name, _ := updates["name"].(string)
+	bio, _ := updates["bio"].(string)
+	if err := ValidateUserFields(username, name, bio); err != nil {
+		return nil, err
+	}
+
+	set, args, err := buildSetClause(updates, userUpdateColumns, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := r.queryUser(`update users set `+set+` where id = $1 returning `+userSelect, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	return user, nil
+}
+
+// GetUsersExcluding gets up to limit users other than excludeUserID
+func (r *PostgresUserRepository) GetUsersExcluding(excludeUserID string, limit int) ([]User, error) {
+	if limit <= 0 {
+		limit = 10 // Default limit
+	}
+
+	rows, err := r.pool.Query(context.Background(),
+		`select `+userSelect+` from users where id::text <> $1 order by created_at limit $2`, excludeUserID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	return collectValues(rows, scanUser)
+}
+
+// DeleteUserRow deletes a user; sessions, identities and other owned rows cascade
+func (r *PostgresUserRepository) DeleteUserRow(id string) error {
+	if _, err := r.pool.Exec(context.Background(), `delete from users where id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// CreateNonce stores a new sign-in nonce
+func (r *PostgresUserRepository) CreateNonce(nonce *AuthNonce) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into auth_nonces (nonce, domain, chain_type, chain_id, expires_at) values ($1, $2, $3, $4, $5)`,
+		nonce.Nonce, nonce.Domain, string(nonce.ChainType), nonce.ChainID, nonce.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store nonce: %w", err)
+	}
+	return nil
+}
+
+// ConsumeNonce atomically deletes a nonce and returns it, or nil if it was never issued or already used
+func (r *PostgresUserRepository) ConsumeNonce(nonce string) (*AuthNonce, error) {
+	var stored AuthNonce
+	err := r.pool.QueryRow(context.Background(),
+		`delete from auth_nonces where nonce = $1 returning nonce, domain, chain_type, chain_id, expires_at, created_at`, nonce).
+		Scan(&stored.Nonce, &stored.Domain, &stored.ChainType, &stored.ChainID, &stored.ExpiresAt, &stored.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume nonce: %w", err)
+	}
+	return &stored, nil
+}
+
+// DeleteExpiredNonces removes nonces that can no longer be used
+func (r *PostgresUserRepository) DeleteExpiredNonces() error {
+	_, err := r.pool.Exec(context.Background(), `delete from auth_nonces where expires_at < now()`)
+	return err
+}
+
+// CreateSession stores a new login session
+func (r *PostgresUserRepository) CreateSession(session *Session) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into sessions (id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at)
+		values ($1, $2, $3, $4, $5, $5, $6)`,
+		session.ID, session.UserID, session.UserAgent, session.IPAddress, session.CreatedAt, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// GetSession retrieves a session by ID
+func (r *PostgresUserRepository) GetSession(id string) (*Session, error) {
+	rows, err := r.pool.Query(context.Background(), `select `+sessionSelect+` from sessions where id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return collectFirst(rows, scanSession)
+}
+
+// ListActiveSessions retrieves a user's sessions that are neither revoked nor expired
+func (r *PostgresUserRepository) ListActiveSessions(userID string) ([]Session, error) {
+	rows, err := r.pool.Query(context.Background(), `select `+sessionSelect+` from sessions
+		where user_id = $1 and revoked_at is null and expires_at > now()
+		order by last_used_at desc`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return collectValues(rows, scanSession)
+}
+
+// TouchSession records session activity and extends its expiry
+func (r *PostgresUserRepository) TouchSession(id string, lastUsedAt, expiresAt time.Time) error {
+	_, err := r.pool.Exec(context.Background(),
+		`update sessions set last_used_at = $2, expires_at = $3 where id = $1`, id, lastUsedAt, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// RevokeSession revokes a session unless it is already revoked
+func (r *PostgresUserRepository) RevokeSession(id, reason string) error {
+	_, err := r.pool.Exec(context.Background(),
+		`update sessions set revoked_at = now(), revoke_reason = $2 where id = $1 and revoked_at is null`, id, reason)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every not yet revoked session of a user
+func (r *PostgresUserRepository) RevokeUserSessions(userID, reason string) error {
+	_, err := r.pool.Exec(context.Background(),
+		`update sessions set revoked_at = now(), revoke_reason = $2 where user_id = $1 and revoked_at is null`, userID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// CreateRefreshToken stores the hash of a newly issued refresh token
+func (r *PostgresUserRepository) CreateRefreshToken(token *RefreshToken) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into refresh_tokens (token_hash, session_id, expires_at) values ($1, $2, $3)`,
+		token.TokenHash, token.SessionID, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token by its hash
+func (r *PostgresUserRepository) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := r.pool.QueryRow(context.Background(),
+		`select token_hash, session_id::text, expires_at, used_at, created_at from refresh_tokens where token_hash = $1`, tokenHash).
+		Scan(&token.TokenHash, &token.SessionID, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed marks an unused refresh token as used, reporting whether this call claimed it
+func (r *PostgresUserRepository) MarkRefreshTokenUsed(tokenHash string) (bool, error) {
+	tag, err := r.pool.Exec(context.Background(),
+		`update refresh_tokens set used_at = now() where token_hash = $1 and used_at is null`, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CreateAPIKey stores a new API key
+func (r *PostgresUserRepository) CreateAPIKey(key *APIKey) error {
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	_, err := r.pool.Exec(context.Background(),
+		`insert into api_keys (id, name, prefix, key_hash, scopes, created_by, created_at, expires_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		key.ID, key.Name, key.Prefix, key.KeyHash, scopes, nullIfEmpty(key.CreatedBy), key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its raw value
+func (r *PostgresUserRepository) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	rows, err := r.pool.Query(context.Background(), `select `+apiKeySelect+` from api_keys where key_hash = $1`, keyHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return collectFirst(rows, scanAPIKey)
+}
+
+// ListAPIKeys retrieves every API key, newest first
+func (r *PostgresUserRepository) ListAPIKeys() ([]APIKey, error) {
+	rows, err := r.pool.Query(context.Background(), `select `+apiKeySelect+` from api_keys order by created_at desc`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return collectValues(rows, scanAPIKey)
+}
+
+// RevokeAPIKey revokes an API key, reporting false if it was missing or already revoked
+func (r *PostgresUserRepository) RevokeAPIKey(id string) (bool, error) {
+	tag, err := r.pool.Exec(context.Background(),
+		`update api_keys set revoked_at = now() where id = $1 and revoked_at is null`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (r *PostgresUserRepository) TouchAPIKey(id string, lastUsedAt time.Time) error {
+	_, err := r.pool.Exec(context.Background(), `update api_keys set last_used_at = $2 where id = $1`, id, lastUsedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	return nil
+}
+
+// CreateIdentity links an identity to a user, failing with ErrIdentityInUse if it is already linked
+func (r *PostgresUserRepository) CreateIdentity(identity *Identity) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into identities (id, user_id, provider, subject, created_at) values ($1, $2, $3, $4, $5)`,
+		identity.ID, identity.UserID, string(identity.Provider), identity.Subject, identity.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrIdentityInUse
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+	return nil
+}
+
+// GetIdentity retrieves an identity by provider and normalized subject
+func (r *PostgresUserRepository) GetIdentity(provider IdentityProvider, subject string) (*Identity, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+identitySelect+` from identities where provider = $1 and subject = $2`, string(provider), subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+	return collectFirst(rows, scanIdentity)
+}
+
+// ListIdentities retrieves every identity linked to a user, oldest first
+func (r *PostgresUserRepository) ListIdentities(userID string) ([]Identity, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+identitySelect+` from identities where user_id = $1 order by created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	return collectValues(rows, scanIdentity)
+}
+
+// DeleteIdentity unlinks one of a user's identities, reporting false if it was not found and
+// ErrLastIdentity if it is their only one. The delete_identity function counts and deletes in
+// one statement, with the user row locked so concurrent unlinks take turns.
+func (r *PostgresUserRepository) DeleteIdentity(userID, identityID string) (bool, error) {
+	var result string
+	err := r.pool.QueryRow(context.Background(), `select delete_identity($1, $2)`, userID, identityID).Scan(&result)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete identity: %w", err)
+	}
+	return deleteIdentityResult(result)
+}
+
+// deleteIdentityResult maps what the delete_identity function returns to DeleteIdentity's results
+func deleteIdentityResult(result string) (bool, error) {
+	switch result {
+	case "deleted":
+		return true, nil
+	case "last_identity":
+		return false, ErrLastIdentity
+	case "not_found":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected delete_identity result %q", result)
+	}
+}
+
+// DeleteIdentities unlinks every identity of a user
+func (r *PostgresUserRepository) DeleteIdentities(userID string) error {
+	if _, err := r.pool.Exec(context.Background(), `delete from identities where user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete identities: %w", err)
+	}
+	return nil
+}
+
+// SaveEmailVerification stores a pending email code, replacing any earlier one for the same user and email
+func (r *PostgresUserRepository) SaveEmailVerification(verification *EmailVerification) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into email_verifications (user_id, email, code_hash, expires_at) values ($1, $2, $3, $4)
+		on conflict (user_id, email) do update set code_hash = excluded.code_hash, expires_at = excluded.expires_at`,
+		verification.UserID, verification.Email, verification.CodeHash, verification.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store email verification: %w", err)
+	}
+	return nil
+}
+
+// ConsumeEmailVerification atomically deletes and returns a pending email code, or nil if there is none
+func (r *PostgresUserRepository) ConsumeEmailVerification(userID, email string) (*EmailVerification, error) {
+	var verification EmailVerification
+	err := r.pool.QueryRow(context.Background(),
+		`delete from email_verifications where user_id = $1 and email = $2
+		returning user_id::text, email, code_hash, expires_at`, userID, email).
+		Scan(&verification.UserID, &verification.Email, &verification.CodeHash, &verification.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume email verification: %w", err)
+	}
+	return &verification, nil
+}
+
+// CreateHandshake stores a handshake event
+func (r *PostgresUserRepository) CreateHandshake(event *HandshakeEvent) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into handshakes (type, from_uid, to_uid, message, "timestamp") values ($1, $2, $3, $4, $5)`,
+		event.Type, event.FromUID, nullIfEmpty(event.ToUID), nullIfEmpty(event.Message), event.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to store handshake: %w", err)
+	}
+	return nil
+}
+
+// ListHandshakes retrieves the handshakes a user sent or received, oldest first
+func (r *PostgresUserRepository) ListHandshakes(userID string) ([]HandshakeEvent, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+handshakeSelect+` from handshakes where from_uid = $1 or to_uid = $1 order by "timestamp"`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list handshakes: %w", err)
+	}
+	return collectValues(rows, func(row pgx.CollectableRow) (HandshakeEvent, error) {
+		var event HandshakeEvent
+		err := row.Scan(&event.Type, &event.FromUID, &event.ToUID, &event.Message, &event.Timestamp)
+		return event, err
+	})
+}
+
+// DeleteHandshakes deletes the handshakes a user sent or received
+func (r *PostgresUserRepository) DeleteHandshakes(userID string) error {
+	if _, err := r.pool.Exec(context.Background(), `delete from handshakes where from_uid = $1 or to_uid = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete handshakes: %w", err)
+	}
+	return nil
+}
+
+// SaveAccountDeletion creates or updates an account deletion job
+func (r *PostgresUserRepository) SaveAccountDeletion(job *AccountDeletion) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into account_deletions (user_id, status, completed_steps, attempts, last_error, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (user_id) do update set status = excluded.status, completed_steps = excluded.completed_steps,
+			attempts = excluded.attempts, last_error = excluded.last_error, updated_at = excluded.updated_at`,
+		job.UserID, job.Status, nonNilStrings(job.CompletedSteps), job.Attempts, nullIfEmpty(job.LastError), job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save account deletion: %w", err)
+	}
+	return nil
+}
+
+// GetAccountDeletion retrieves the deletion job of a user, or nil if there is none
+func (r *PostgresUserRepository) GetAccountDeletion(userID string) (*AccountDeletion, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+accountDeletionSelect+` from account_deletions where user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account deletion: %w", err)
+	}
+	return collectFirst(rows, scanAccountDeletion)
+}
+
+// ListUnfinishedAccountDeletions retrieves deletion jobs that have not completed, oldest first
+func (r *PostgresUserRepository) ListUnfinishedAccountDeletions() ([]AccountDeletion, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+accountDeletionSelect+` from account_deletions where status <> $1 order by created_at`, DeletionCompleted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list account deletions: %w", err)
+	}
+	return collectValues(rows, scanAccountDeletion)
+}
+
+// GetConversationState retrieves a user's chatbot conversation state, or nil if there is none
+func (r *PostgresUserRepository) GetConversationState(userID string) (*ConversationState, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+conversationSelect+` from conversation_states where user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation state: %w", err)
+	}
+	return collectFirst(rows, scanConversationState)
+}
+
+// SaveConversationState creates or updates a user's chatbot conversation state
+func (r *PostgresUserRepository) SaveConversationState(state *ConversationState) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into conversation_states (user_id, state, expires_at, updated_at) values ($1, $2, $3, $4)
+		on conflict (user_id) do update set state = excluded.state, expires_at = excluded.expires_at,
+			updated_at = excluded.updated_at`,
+		state.UserID, state.State, state.ExpiresAt, state.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation state: %w", err)
+	}
+	return nil
+}
+
+// CreateMatchProposal stores a new match proposal, filling in its ID
+func (r *PostgresUserRepository) CreateMatchProposal(proposal *MatchProposal) error {
+	err := r.pool.QueryRow(context.Background(),
+		`insert into match_proposals (user_id, proposed_user_id, preferences, status, created_at, expires_at)
+		values ($1, $2, $3, $4, $5, $6) returning id::text`,
+		proposal.UserID, proposal.ProposedUserID, nullIfEmpty(proposal.Preferences), proposal.Status,
+		proposal.CreatedAt, proposal.ExpiresAt).Scan(&proposal.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create match proposal: %w", err)
+	}
+	return nil
+}
+
+// GetMatchProposal retrieves a match proposal by ID, or nil if there is none
+func (r *PostgresUserRepository) GetMatchProposal(id string) (*MatchProposal, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+proposalSelect+` from match_proposals where id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get match proposal: %w", err)
+	}
+	return collectFirst(rows, scanMatchProposal)
+}
+
+// GetOpenMatchProposal retrieves the newest open proposal to a user, or nil if there is none
+func (r *PostgresUserRepository) GetOpenMatchProposal(userID string) (*MatchProposal, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+proposalSelect+` from match_proposals where user_id = $1 and status = $2
+		order by created_at desc limit 1`, userID, ProposalProposed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open match proposal: %w", err)
+	}
+	return collectFirst(rows, scanMatchProposal)
+}
+
+// ListMatchProposals retrieves the proposals made to a user, newest first
+func (r *PostgresUserRepository) ListMatchProposals(userID string) ([]MatchProposal, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+proposalSelect+` from match_proposals where user_id = $1 order by created_at desc`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list match proposals: %w", err)
+	}
+	return collectValues(rows, scanMatchProposal)
+}
+
+// ResolveMatchProposal records the answer to an open proposal, reporting whether it was still open
+func (r *PostgresUserRepository) ResolveMatchProposal(id, status string, respondedAt time.Time) (bool, error) {
+	tag, err := r.pool.Exec(context.Background(),
+		`update match_proposals set status = $1, responded_at = $2 where id = $3 and status = $4`,
+		status, respondedAt, id, ProposalProposed)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve match proposal: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RequestMatchConsent records that the user accepted an open proposal, reporting whether it was still open
+func (r *PostgresUserRepository) RequestMatchConsent(id string, respondedAt, expiresAt time.Time) (bool, error) {
+	tag, err := r.pool.Exec(context.Background(),
+		`update match_proposals set status = $1, responded_at = $2, expires_at = $3 where id = $4 and status = $5`,
+		ProposalAwaitingConsent, respondedAt, expiresAt, id, ProposalProposed)
+	if err != nil {
+		return false, fmt.Errorf("failed to request match consent: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// AnswerMatchConsent records the proposed user's answer, reporting whether the proposal still awaited it
+func (r *PostgresUserRepository) AnswerMatchConsent(id, status string, respondedAt time.Time) (bool, error) {
+	tag, err := r.pool.Exec(context.Background(),
+		`update match_proposals set status = $1, consent_responded_at = $2 where id = $3 and status = $4`,
+		status, respondedAt, id, ProposalAwaitingConsent)
+	if err != nil {
+		return false, fmt.Errorf("failed to answer match consent: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CancelMatchProposals cancels the proposals made to or about a user that await an answer
+func (r *PostgresUserRepository) CancelMatchProposals(userID string, cancelledAt time.Time) error {
+	_, err := r.pool.Exec(context.Background(),
+		`update match_proposals set status = $1, responded_at = coalesce(responded_at, $2)
+		where status = any($3) and (user_id = $4 or proposed_user_id = $4)`,
+		ProposalCancelled, cancelledAt, []string{ProposalProposed, ProposalAwaitingConsent}, userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel match proposals: %w", err)
+	}
+	return nil
+}
+
+// queryUser runs a query returning at most one user row
+func (r *PostgresUserRepository) queryUser(sql string, args ...interface{}) (*User, error) {
+	rows, err := r.pool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	return collectFirst(rows, scanUser)
+}
+
+// PostgresMessageRepository is a MessageRepository that talks to Postgres directly over a connection pool
+type PostgresMessageRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresMessageRepository creates a message repository on a pool
+func NewPostgresMessageRepository(pool *pgxpool.Pool) *PostgresMessageRepository {
+	return &PostgresMessageRepository{
+		pool: pool,
+	}
+}
+
+// CreateMessage stores a message, filling in the same defaults as the PostgREST backend
+func (r *PostgresMessageRepository) CreateMessage(message *Message) (*Message, error) {
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	if message.MessageType == "" {
+		message.MessageType = "user"
+	}
+	if message.Type == "" {
+		message.Type = "text"
+	}
+
+	rows, err := r.pool.Query(context.Background(),
+		`insert into messages (id, created_at, message_text, sender_id, channel_id, message_type, sender_username, type, stream_message_id, reply_to_id)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		returning `+messageSelect,
+		message.ID, message.CreatedAt, message.MessageText, message.SenderID, message.ChannelID,
+		message.MessageType, message.SenderUsername, message.Type, message.StreamMessageID, message.ReplyToID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message: %w", err)
+	}
+
+	created, err := collectFirst(rows, scanMessage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message: %w", err)
+	}
+	return created, nil
+}
+
+// CreateStreamMessage stores a mirrored Stream Chat message, relying on the unique
+// stream_message_id index to skip messages already stored
+func (r *PostgresMessageRepository) CreateStreamMessage(message *Message) (*Message, bool, error) {
+	if message.StreamMessageID == nil {
+		return nil, false, errors.New("failed to create stream message: stream_message_id is required")
+	}
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	if message.MessageType == "" {
+		message.MessageType = "user"
+	}
+	if message.Type == "" {
+		message.Type = "text"
+	}
+
+	rows, err := r.pool.Query(context.Background(),
+		`insert into messages (id, created_at, message_text, sender_id, channel_id, message_type, sender_username, type, stream_message_id, reply_to_id)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		on conflict (stream_message_id) do nothing
+		returning `+messageSelect,
+		message.ID, message.CreatedAt, message.MessageText, message.SenderID, message.ChannelID,
+		message.MessageType, message.SenderUsername, message.Type, message.StreamMessageID, message.ReplyToID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create stream message: %w", err)
+	}
+	created, err := collectFirst(rows, scanMessage)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create stream message: %w", err)
+	}
+	if created != nil {
+		return created, true, nil
+	}
+
+	existing, err := r.GetMessagesByStreamID(*message.StreamMessageID)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(existing) == 0 {
+		return nil, false, fmt.Errorf("failed to create stream message: %s conflicted but was not found", *message.StreamMessageID)
+	}
+	return &existing[0], false, nil
+}
+
+// GetChannelMessages retrieves a page of a channel's messages, keyed on (created_at, id)
+func (r *PostgresMessageRepository) GetChannelMessages(channelID string, page MessagePageQuery) (*MessagePage, error) {
+	return r.pageMessages(`channel_id = $1`, channelID, page)
+}
+
+// GetThreadReplies retrieves a page of the replies to a message, keyed on (created_at, id)
+func (r *PostgresMessageRepository) GetThreadReplies(parentID string, page MessagePageQuery) (*MessagePage, error) {
+	return r.pageMessages(`reply_to_id = $1::uuid`, parentID, page)
+}
+
+// CountReplies counts the replies to each message that aren't deleted
+func (r *PostgresMessageRepository) CountReplies(messageIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	type replyCount struct {
+		parentID string
+		count    int
+	}
+	rows, err := r.pool.Query(context.Background(),
+		`select reply_to_id::text, count(*) from messages
+		where reply_to_id = any($1::uuid[]) and deleted_at is null
+		group by reply_to_id`, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count replies: %w", err)
+	}
+	values, err := collectValues(rows, func(row pgx.CollectableRow) (replyCount, error) {
+		var value replyCount
+		err := row.Scan(&value.parentID, &value.count)
+		return value, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		counts[value.parentID] = value.count
+	}
+	return counts, nil
+}
+
+// GetRecentChannelMessages retrieves the most recent messages of a channel that aren't deleted, oldest first
+func (r *PostgresMessageRepository) GetRecentChannelMessages(channelID string, limit int) ([]Message, error) {
+	page, err := r.GetChannelMessages(channelID, MessagePageQuery{Limit: limit, ExcludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+	return page.Messages, nil
+}
+
+// GetMessageByID retrieves a specific message by ID
+func (r *PostgresMessageRepository) GetMessageByID(messageID string) (*Message, error) {
+	rows, err := r.pool.Query(context.Background(), `select `+messageSelect+` from messages where id = $1`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return collectFirst(rows, scanMessage)
+}
+
+// GetMessagesByStreamID retrieves messages by Stream Chat message ID
+func (r *PostgresMessageRepository) GetMessagesByStreamID(streamMessageID string) ([]Message, error) {
+	return r.queryMessages(`select `+messageSelect+` from messages where stream_message_id = $1 order by created_at`, streamMessageID)
+}
+
+// GetMessagesBySender retrieves every message a user sent, oldest first
+func (r *PostgresMessageRepository) GetMessagesBySender(senderID string) ([]Message, error) {
+	return r.queryMessages(`select `+messageSelect+` from messages where sender_id = $1 order by created_at`, senderID)
+}
+
+// UpdateMessage updates columns of a message, keyed by column name
+func (r *PostgresMessageRepository) UpdateMessage(messageID string, updates map[string]interface{}) (*Message, error) {
+	set, args, err := buildSetClause(updates, messageUpdateColumns, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(context.Background(), `update messages set `+set+` where id = $1 returning `+messageSelect, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update message: %w", err)
+	}
+	message, err := collectFirst(rows, scanMessage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update message: %w", err)
+	}
+	if message == nil {
+		return nil, fmt.Errorf("message not found")
+	}
+	return message, nil
+}
+
+// DeleteChannelMessages deletes every message in a channel
+func (r *PostgresMessageRepository) DeleteChannelMessages(channelID string) error {
+	if _, err := r.pool.Exec(context.Background(), `delete from messages where channel_id = $1`, channelID); err != nil {
+		return fmt.Errorf("failed to delete channel messages: %w", err)
+	}
+	return nil
+}
+
+// AnonymizeSenderMessages strips the sender and content from every message a user sent,
+// deletes the revisions of those messages and unlinks the user from edits and deletes they made
+func (r *PostgresMessageRepository) AnonymizeSenderMessages(senderID string) error {
+	ctx := context.Background()
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		statements := []string{
+			`delete from message_revisions where sender_id = $1`,
+			`delete from message_reactions where user_id = $1`,
+			`delete from message_flags where user_id = $1`,
+			`update message_revisions set edited_by = $2 where edited_by = $1`,
+			`update messages set deleted_by = $2 where deleted_by = $1`,
+			`update messages set sender_id = $2, sender_username = 'Deleted user', message_text = '[deleted]' where sender_id = $1`,
+		}
+		for _, sql := range statements {
+			if _, err := tx.Exec(ctx, sql, senderID, DeletedUserID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to anonymize messages: %w", err)
+	}
+	return nil
+}
+
+// EditMessage saves a message's text as a revision and replaces it, in one transaction
+func (r *PostgresMessageRepository) EditMessage(messageID, text, editorID string, editedAt time.Time) (*Message, error) {
+	return r.replaceText(messageID, editorID, editedAt,
+		`message_text = $2, edited_at = $3`, text, editedAt)
+}
+
+// TombstoneMessage saves a message's text as a revision, clears it and marks the message deleted
+func (r *PostgresMessageRepository) TombstoneMessage(messageID, deletedBy, reason string, deletedAt time.Time) (*Message, error) {
+	return r.replaceText(messageID, deletedBy, deletedAt,
+		`message_text = '', deleted_at = $2, deleted_by = $3, delete_reason = $4`, deletedAt, deletedBy, nullIfEmpty(reason))
+}
+
+// ListMessageRevisions retrieves the earlier texts of a message, oldest first
+func (r *PostgresMessageRepository) ListMessageRevisions(messageID string) ([]MessageRevision, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+messageRevisionSelect+` from message_revisions where message_id = $1 order by edited_at, id`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message revisions: %w", err)
+	}
+	return collectValues(rows, scanMessageRevision)
+}
+
+// AddReaction stores a reaction unless the user already left it on the message
+func (r *PostgresMessageRepository) AddReaction(reaction *MessageReaction) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into message_reactions (message_id, user_id, type, created_at) values ($1, $2, $3, $4)
+		on conflict do nothing`,
+		reaction.MessageID, reaction.UserID, reaction.Type, reaction.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveReaction deletes a reaction, if it is stored
+func (r *PostgresMessageRepository) RemoveReaction(messageID, userID, reactionType string) error {
+	_, err := r.pool.Exec(context.Background(),
+		`delete from message_reactions where message_id = $1 and user_id = $2 and type = $3`,
+		messageID, userID, reactionType)
+	if err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return nil
+}
+
+// FlagMessage stores a flag unless the user already flagged the message
+func (r *PostgresMessageRepository) FlagMessage(flag *MessageFlag) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into message_flags (message_id, user_id, created_at) values ($1, $2, $3)
+		on conflict do nothing`,
+		flag.MessageID, flag.UserID, flag.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to flag message: %w", err)
+	}
+	return nil
+}
+
+// replaceText locks a message, saves its current text as a revision by editorID and applies
+// set, whose arguments start at $2 after the message ID
+func (r *PostgresMessageRepository) replaceText(messageID, editorID string, at time.Time, set string, args ...interface{}) (*Message, error) {
+	ctx := context.Background()
+
+	var updated *Message
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		var senderID, text string
+		err := tx.QueryRow(ctx, `select coalesce(sender_id, ''), coalesce(message_text, '') from messages where id = $1 for update`,
+			messageID).Scan(&senderID, &text)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `insert into message_revisions (id, message_id, sender_id, message_text, edited_by, edited_at)
+			values ($1, $2, $3, $4, $5, $6)`,
+			uuid.New().String(), messageID, nullIfEmpty(senderID), text, editorID, at)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `update messages set `+set+` where id = $1 returning `+messageSelect,
+			append([]interface{}{messageID}, args...)...)
+		if err != nil {
+			return err
+		}
+		updated, err = collectFirst(rows, scanMessage)
+		return err
+	})
+	if errors.Is(err, ErrMessageNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update message: %w", err)
+	}
+	return updated, nil
+}
+
+// SearchMessages returns messages matching a search, newest first, using the search_vector index
+func (r *PostgresMessageRepository) SearchMessages(query MessageSearchQuery) ([]Message, error) {
+	if len(query.ChannelIDs) == 0 {
+		return []Message{}, nil
+	}
+
+	return r.queryMessages(`select `+messageSelect+` from messages
+		where channel_id = any($1) and deleted_at is null
+			and ($2 = '' or search_vector @@ websearch_to_tsquery('english', $2))
+			and ($3 = '' or sender_id = $3)
+			and ($4 = '' or message_type = $4)
+			and ($5::timestamptz is null or created_at >= $5)
+			and ($6::timestamptz is null or created_at <= $6)
+		order by created_at desc, id desc
+		limit $7`,
+		query.ChannelIDs, query.Text, query.SenderID, query.MessageType, query.From, query.To, query.Limit)
+}
+
+// pageMessages retrieves a page of the messages matching a condition on $1
+func (r *PostgresMessageRepository) pageMessages(condition, value string, page MessagePageQuery) (*MessagePage, error) {
+	sql := `select ` + messageSelect + ` from messages where ` + condition
+	args := []interface{}{value}
+	if page.ExcludeDeleted {
+		sql += ` and deleted_at is null`
+	}
+
+	switch {
+	case page.After != nil:
+		sql += ` and (created_at, id) > ($2, $3::uuid) order by created_at, id limit $4`
+		args = append(args, page.After.CreatedAt, page.After.ID)
+	case page.Before != nil:
+		sql += ` and (created_at, id) < ($2, $3::uuid) order by created_at desc, id desc limit $4`
+		args = append(args, page.Before.CreatedAt, page.Before.ID)
+	default:
+		sql += ` order by created_at desc, id desc limit $2`
+	}
+	args = append(args, page.pageLimit()+1)
+
+	messages, err := r.queryMessages(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return buildMessagePage(messages, page), nil
+}
+
+// queryMessages runs a query returning message rows
+func (r *PostgresMessageRepository) queryMessages(sql string, args ...interface{}) ([]Message, error) {
+	rows, err := r.pool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	return collectValues(rows, scanMessage)
+}
+
+// PostgresWebhookRepository is a WebhookRepository that talks to Postgres directly over a connection pool
+type PostgresWebhookRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresWebhookRepository creates a webhook repository on a pool
+func NewPostgresWebhookRepository(pool *pgxpool.Pool) *PostgresWebhookRepository {
+	return &PostgresWebhookRepository{
+		pool: pool,
+	}
+}
+
+// ClaimWebhook stores a webhook ID unless it was claimed at or after expiredBefore. The
+// insert only takes over an expired row, so of concurrent claims one inserts or updates it.
+func (r *PostgresWebhookRepository) ClaimWebhook(webhookID string, claimedAt, expiredBefore time.Time) (bool, error) {
+	tag, err := r.pool.Exec(context.Background(),
+		`insert into processed_webhooks (webhook_id, processed_at) values ($1, $2)
+		on conflict (webhook_id) do update set processed_at = excluded.processed_at
+		where processed_webhooks.processed_at < $3`,
+		webhookID, claimedAt, expiredBefore)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReleaseWebhook forgets a webhook ID, so it can be claimed again
+func (r *PostgresWebhookRepository) ReleaseWebhook(webhookID string) error {
+	_, err := r.pool.Exec(context.Background(), `delete from processed_webhooks where webhook_id = $1`, webhookID)
+	if err != nil {
+		return fmt.Errorf("failed to release webhook: %w", err)
+	}
+	return nil
+}
+
+// DeleteProcessedWebhooks forgets webhook IDs processed before the given time
+func (r *PostgresWebhookRepository) DeleteProcessedWebhooks(before time.Time) error {
+	_, err := r.pool.Exec(context.Background(), `delete from processed_webhooks where processed_at < $1`, before)
+	if err != nil {
+		return fmt.Errorf("failed to delete processed webhooks: %w", err)
+	}
+	return nil
+}
+
+// CreateWebhookDelivery stores a webhook delivery, filling in its ID
+func (r *PostgresWebhookRepository) CreateWebhookDelivery(delivery *WebhookDelivery) error {
+	err := r.pool.QueryRow(context.Background(),
+		`insert into webhook_deliveries (webhook_id, event_type, headers, body, status, attempts, received_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id::text`,
+		nullIfEmpty(delivery.WebhookID), delivery.EventType, delivery.Headers, delivery.Body, delivery.Status,
+		delivery.Attempts, delivery.ReceivedAt).Scan(&delivery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookDelivery retrieves a webhook delivery by ID
+func (r *PostgresWebhookRepository) GetWebhookDelivery(id string) (*WebhookDelivery, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`select `+deliverySelect+` from webhook_deliveries where id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	return collectFirst(rows, scanWebhookDelivery)
+}
+
+// ListWebhookDeliveries retrieves the webhook deliveries matching a filter, newest first
+func (r *PostgresWebhookRepository) ListWebhookDeliveries(filter WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	rows, err := r.pool.Query(context.Background(), `select `+deliverySelect+` from webhook_deliveries
+		where ($1 = '' or event_type = $1)
+			and ($2 = '' or status = $2)
+			and ($3 = '' or webhook_id = $3)
+			and ($4::timestamptz is null or received_at >= $4)
+			and ($5::timestamptz is null or received_at <= $5)
+		order by received_at desc, id desc
+		limit $6`,
+		filter.EventType, filter.Status, filter.WebhookID, filter.Since, filter.Until, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return collectValues(rows, scanWebhookDelivery)
+}
+
+// UpdateWebhookDelivery applies column updates, keyed by JSON field name, to a webhook delivery
+func (r *PostgresWebhookRepository) UpdateWebhookDelivery(id string, updates map[string]interface{}) error {
+	set, args, err := buildSetClause(updates, deliveryUpdateColumns, id)
+	if err != nil {
+		return err
+	}
+	if _, err := r.pool.Exec(context.Background(), `update webhook_deliveries set `+set+` where id = $1`, args...); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// PostgresJobRepository is a JobRepository that talks to Postgres directly over a connection pool.
+// Workers claim jobs with for update skip locked, so they never wait on each other.
+type PostgresJobRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresJobRepository creates a job repository on a pool
+func NewPostgresJobRepository(pool *pgxpool.Pool) *PostgresJobRepository {
+	return &PostgresJobRepository{
+		pool: pool,
+	}
+}
+
+// EnqueueJob stores a new job
+func (r *PostgresJobRepository) EnqueueJob(job *Job) error {
+	_, err := r.pool.Exec(context.Background(),
+		`insert into jobs (id, kind, payload, attempts, max_attempts, run_at, created_at) values ($1, $2, $3, $4, $5, $6, $7)`,
+		job.ID, job.Kind, job.Payload, job.Attempts, job.MaxAttempts, job.RunAt, job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return nil
+}
+
+// ClaimJob leases the due job that has waited longest
+func (r *PostgresJobRepository) ClaimJob(now, lockedUntil time.Time) (*Job, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`update jobs set attempts = attempts + 1, locked_until = $2
+		where id = (
+			select id from jobs
+			where run_at <= $1 and (locked_until is null or locked_until < $1)
+			order by run_at
+			limit 1
+			for update skip locked
+		)
+		returning `+jobSelect, now, lockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return collectFirst(rows, scanJob)
+}
+
+// CompleteJob deletes a finished job
+func (r *PostgresJobRepository) CompleteJob(jobID string) error {
+	if _, err := r.pool.Exec(context.Background(), `delete from jobs where id = $1`, jobID); err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+	return nil
+}
+
+// RetryJob releases a claimed job to run again at runAt
+func (r *PostgresJobRepository) RetryJob(job *Job, runAt time.Time, lastError string) error {
+	_, err := r.pool.Exec(context.Background(),
+		`update jobs set run_at = $3, locked_until = null, last_error = $4 where id = $1 and attempts = $2`,
+		job.ID, job.Attempts, runAt, lastError)
+	if err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+	return nil
+}
+
+// DeadLetterJob moves a job to the dead letters in one transaction
+func (r *PostgresJobRepository) DeadLetterJob(job *Job, lastError string, failedAt time.Time) error {
+	ctx := context.Background()
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`insert into dead_letter_jobs (id, kind, payload, attempts, last_error, created_at, failed_at)
+			values ($1, $2, $3, $4, $5, $6, $7) on conflict (id) do nothing`,
+			job.ID, job.Kind, job.Payload, job.Attempts, lastError, job.CreatedAt, failedAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `delete from jobs where id = $1`, job.ID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter job: %w", err)
+	}
+	return nil
+}
+
+// buildSetClause turns column updates into "col = $2, ..." with args starting with id as $1.
+// Only the given columns are accepted, since their names end up in the SQL.
+func buildSetClause(updates map[string]interface{}, allowed []string, id string) (string, []interface{}, error) {
+	if len(updates) == 0 {
+		return "", nil, errors.New("no fields to update")
+	}
+
+	columns := make([]string, 0, len(updates))
+	for column := range updates {
+		if !containsString(allowed, column) {
+			return "", nil, fmt.Errorf("column %q cannot be updated", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns) // Same SQL for the same columns, so the prepared statement is reused
+
+	assignments := make([]string, len(columns))
+	args := []interface{}{id}
+	for i, column := range columns {
+		assignments[i] = fmt.Sprintf("%s = $%d", column, i+2)
+
+		// Named string types such as Role are sent as plain text
+		value := updates[column]
+		if v := reflect.ValueOf(value); v.IsValid() && v.Kind() == reflect.String {
+			value = v.String()
+		}
+		args = append(args, value)
+	}
+
+	return strings.Join(assignments, ", "), args, nil
+}
+
+// collectFirst scans the first row, or returns nil if there are none
+func collectFirst[T any](rows pgx.Rows, scan func(pgx.CollectableRow) (T, error)) (*T, error) {
+	values, err := collectValues(rows, scan)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return &values[0], nil
+}
+
+// collectValues scans every row
+func collectValues[T any](rows pgx.Rows, scan func(pgx.CollectableRow) (T, error)) ([]T, error) {
+	values, err := pgx.CollectRows(rows, scan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	return values, nil
+}
+
+// scanUser scans a row selected with userSelect
+func scanUser(row pgx.CollectableRow) (User, error) {
+	var user User
+	var chain, role string
+	err := row.Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Name, &user.WalletAddress,
+		&chain, &role, &user.ProfilePicURL, &user.Bio, &user.BannedAt, &user.BanExpiresAt)
+	user.ChainType = ChainType(chain)
+	user.Role = Role(role)
+	return user, err
+}
+
+// scanSession scans a row selected with sessionSelect
+func scanSession(row pgx.CollectableRow) (Session, error) {
+	var session Session
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.CreatedAt,
+		&session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt, &session.RevokeReason)
+	return session, err
+}
+
+// scanAPIKey scans a row selected with apiKeySelect
+func scanAPIKey(row pgx.CollectableRow) (APIKey, error) {
+	var key APIKey
+	var scopes []string
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy, &key.CreatedAt,
+		&key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt)
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, Permission(scope))
+	}
+	return key, err
+}
+
+// scanIdentity scans a row selected with identitySelect
+func scanIdentity(row pgx.CollectableRow) (Identity, error) {
+	var identity Identity
+	var provider string
+	err := row.Scan(&identity.ID, &identity.UserID, &provider, &identity.Subject, &identity.CreatedAt)
+	identity.Provider = IdentityProvider(provider)
+	return identity, err
+}
+
+// scanAccountDeletion scans a row selected with accountDeletionSelect
+func scanAccountDeletion(row pgx.CollectableRow) (AccountDeletion, error) {
+	var job AccountDeletion
+	err := row.Scan(&job.UserID, &job.Status, &job.CompletedSteps, &job.Attempts, &job.LastError, &job.CreatedAt, &job.UpdatedAt)
+	return job, err
+}
+
+// scanConversationState scans a row selected with conversationSelect
+func scanConversationState(row pgx.CollectableRow) (ConversationState, error) {
+	var state ConversationState
+	err := row.Scan(&state.UserID, &state.State, &state.ExpiresAt, &state.UpdatedAt)
+	return state, err
+}
+
+// scanMatchProposal scans a row selected with proposalSelect
+func scanMatchProposal(row pgx.CollectableRow) (MatchProposal, error) {
+	var proposal MatchProposal
+	err := row.Scan(&proposal.ID, &proposal.UserID, &proposal.ProposedUserID, &proposal.Preferences, &proposal.Status,
+		&proposal.CreatedAt, &proposal.ExpiresAt, &proposal.RespondedAt, &proposal.ConsentRespondedAt)
+	return proposal, err
+}
+
+// scanMessage scans a row selected with messageSelect
+func scanMessage(row pgx.CollectableRow) (Message, error) {
+	var message Message
+	err := row.Scan(&message.ID, &message.CreatedAt, &message.MessageText, &message.SenderID, &message.ChannelID,
+		&message.MessageType, &message.SenderUsername, &message.Type, &message.StreamMessageID, &message.ReplyToID,
+		&message.EditedAt, &message.DeletedAt, &message.DeletedBy, &message.DeleteReason)
+	return message, err
+}
+
+// scanMessageRevision reads a row selected with messageRevisionSelect
+func scanMessageRevision(row pgx.CollectableRow) (MessageRevision, error) {
+	var revision MessageRevision
+	err := row.Scan(&revision.ID, &revision.MessageID, &revision.SenderID, &revision.MessageText, &revision.EditedBy, &revision.EditedAt)
+	return revision, err
+}
+
+// scanJob scans a row selected with jobSelect
+func scanJob(row pgx.CollectableRow) (Job, error) {
+	var job Job
+	err := row.Scan(&job.ID, &job.Kind, &job.Payload, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LockedUntil, &job.LastError, &job.CreatedAt)
+	return job, err
+}
+
+// scanWebhookDelivery scans a row selected with deliverySelect
+func scanWebhookDelivery(row pgx.CollectableRow) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &delivery.Headers, &delivery.Body, &delivery.Status,
+		&delivery.Attempts, &delivery.ReplayCount, &delivery.LastError, &delivery.ReceivedAt, &delivery.ProcessedAt)
+	return delivery, err
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// nullIfEmpty stores empty strings as NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nonNilStrings returns an empty slice instead of nil, for NOT NULL array columns
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// postgrestIdentifier matches the table and column names a PostgRESTQuery accepts
+var postgrestIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// PostgRESTFilter is one column condition, such as id=eq.x
+type PostgRESTFilter struct {
+	column   string
+	operator string
+	value    string // Already in PostgREST syntax, e.g. a quoted list for in
+	quote    bool   // Whether value must be quoted inside or=(...)
+}
+
+// EqFilter matches rows where a column equals a value
+func EqFilter(column, value string) PostgRESTFilter {
+	return PostgRESTFilter{column: column, operator: "eq", value: value, quote: true}
+}
+
+// NeqFilter matches rows where a column does not equal a value
+func NeqFilter(column, value string) PostgRESTFilter {
+	return PostgRESTFilter{column: column, operator: "neq", value: value, quote: true}
+}
+
+// PostgRESTQuery builds the path of a PostgREST request: a table plus filters, ordering
+// and paging. Values are URL-encoded, and quoted where PostgREST treats commas and
+// parentheses as syntax, so they can't add filters or change operators.
+type PostgRESTQuery struct {
+	table  string
+	params []string
+	orders []string
+	err    error
+}
+
+// NewPostgRESTQuery starts a query on a table
+func NewPostgRESTQuery(table string) *PostgRESTQuery {
+	q := &PostgRESTQuery{table: table}
+	q.checkIdentifier(table)
+	return q
+}
+
+// NewPostgRESTRPC starts a call to a database function through /rpc
+func NewPostgRESTRPC(function string) *PostgRESTQuery {
+	q := &PostgRESTQuery{table: "rpc/" + function}
+	q.checkIdentifier(function)
+	return q
+}
+
+// Eq filters to rows where a column equals a value
+func (q *PostgRESTQuery) Eq(column, value string) *PostgRESTQuery {
+	return q.Where(EqFilter(column, value))
+}
+
+// Neq filters to rows where a column does not equal a value
+func (q *PostgRESTQuery) Neq(column, value string) *PostgRESTQuery {
+	return q.Where(NeqFilter(column, value))
+}
+
+// Gt filters to rows where a column is greater than a value
+func (q *PostgRESTQuery) Gt(column, value string) *PostgRESTQuery {
+	return q.Where(PostgRESTFilter{column: column, operator: "gt", value: value, quote: true})
+}
+
+// Lt filters to rows where a column is less than a value
+func (q *PostgRESTQuery) Lt(column, value string) *PostgRESTQuery {
+	return q.Where(PostgRESTFilter{column: column, operator: "lt", value: value, quote: true})
+}
+
+// IsNull filters to rows where a column is null
+func (q *PostgRESTQuery) IsNull(column string) *PostgRESTQuery {
+	return q.Where(PostgRESTFilter{column: column, operator: "is", value: "null"})
+}
+
+// In filters to rows where a column equals one of the values. An empty list matches nothing.
+func (q *PostgRESTQuery) In(column string, values []string) *PostgRESTQuery {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = quotePostgRESTValue(value)
+	}
+	return q.Where(PostgRESTFilter{column: column, operator: "in", value: "(" + strings.Join(quoted, ",") + ")"})
+}
+
+// ILike filters to rows where a column matches a case-insensitive pattern, with * as the wildcard
+func (q *PostgRESTQuery) ILike(column, pattern string) *PostgRESTQuery {
+	return q.Where(PostgRESTFilter{column: column, operator: "ilike", value: pattern, quote: true})
+}
+
+// Where adds a filter
+func (q *PostgRESTQuery) Where(filter PostgRESTFilter) *PostgRESTQuery {
+	q.checkIdentifier(filter.column)
+	q.params = append(q.params, filter.column+"="+url.QueryEscape(filter.operator+"."+filter.value))
+	return q
+}
+
+// Or filters to rows matching any of the filters
+func (q *PostgRESTQuery) Or(filters ...PostgRESTFilter) *PostgRESTQuery {
+	conditions := make([]string, len(filters))
+	for i, filter := range filters {
+		q.checkIdentifier(filter.column)
+		value := filter.value
+		if filter.quote {
+			value = quotePostgRESTValue(value)
+		}
+		conditions[i] = filter.column + "." + filter.operator + "." + value
+	}
+	q.params = append(q.params, "or="+url.QueryEscape("("+strings.Join(conditions, ",")+")"))
+	return q
+}
+
+// Select limits the returned columns
+func (q *PostgRESTQuery) Select(columns ...string) *PostgRESTQuery {
+	for _, column := range columns {
+		q.checkIdentifier(column)
+	}
+	q.params = append(q.params, "select="+strings.Join(columns, ","))
+	return q
+}
+
+// Order sorts by a column; later calls break ties in earlier ones
+func (q *PostgRESTQuery) Order(column string, ascending bool) *PostgRESTQuery {
+	q.checkIdentifier(column)
+	direction := "desc"
+	if ascending {
+		direction = "asc"
+	}
+	q.orders = append(q.orders, column+"."+direction)
+	return q
+}
+
+// Limit caps the number of rows returned
+func (q *PostgRESTQuery) Limit(limit int) *PostgRESTQuery {
+	q.params = append(q.params, "limit="+strconv.Itoa(limit))
+	return q
+}
+
+// Range returns rows from through to, counted from zero and inclusive
+func (q *PostgRESTQuery) Range(from, to int) *PostgRESTQuery {
+	if from < 0 || to < from {
+		q.setErr(fmt.Errorf("invalid range %d-%d", from, to))
+		return q
+	}
+	q.params = append(q.params, "offset="+strconv.Itoa(from), "limit="+strconv.Itoa(to-from+1))
+	return q
+}
+
+// OnConflict makes an insert with resolution=merge-duplicates upsert on these columns
+func (q *PostgRESTQuery) OnConflict(columns ...string) *PostgRESTQuery {
+	for _, column := range columns {
+		q.checkIdentifier(column)
+	}
+	q.params = append(q.params, "on_conflict="+strings.Join(columns, ","))
+	return q
+}
+
+// Path returns the request path relative to /rest/v1/, or the first error in building it
+func (q *PostgRESTQuery) Path() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+
+	params := q.params
+	if len(q.orders) > 0 {
+		params = append(params[:len(params):len(params)], "order="+strings.Join(q.orders, ","))
+	}
+	if len(params) == 0 {
+		return q.table, nil
+	}
+	return q.table + "?" + strings.Join(params, "&"), nil
+}
+
+// checkIdentifier records an error for a table or column name that isn't a plain identifier
+func (q *PostgRESTQuery) checkIdentifier(name string) {
+	if !postgrestIdentifier.MatchString(name) {
+		q.setErr(fmt.Errorf("invalid PostgREST identifier %q", name))
+	}
+}
+
+// setErr keeps the first error
+func (q *PostgRESTQuery) setErr(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// quotePostgRESTValue double-quotes a value for use inside in.(...) or or=(...), where
+// commas, dots and parentheses are otherwise syntax
+func quotePostgRESTValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostgRESTQueryPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *PostgRESTQuery
+		want  string
+	}{
+		{"table only", NewPostgRESTQuery("users"), "users"},
+		{"eq", NewPostgRESTQuery("users").Eq("id", "abc"), "users?id=eq.abc"},
+		{"ampersand", NewPostgRESTQuery("users").Eq("username", "a&role=eq.admin"), "users?username=eq.a%26role%3Deq.admin"},
+		{"comma and paren", NewPostgRESTQuery("users").Eq("name", "a,b)"), "users?name=eq.a%2Cb%29"},
+		{"or injection", NewPostgRESTQuery("users").Neq("id", "x&or=(role.eq.admin)"), "users?id=neq.x%26or%3D%28role.eq.admin%29"},
+		{"space", NewPostgRESTQuery("users").ILike("name", "*a b*"), "users?name=ilike.%2Aa+b%2A"},
+		{"is null", NewPostgRESTQuery("messages").IsNull("deleted_at"), "messages?deleted_at=is.null"},
+		{"in", NewPostgRESTQuery("users").In("id", []string{"a", "b"}), "users?id=in.%28%22a%22%2C%22b%22%29"},
+		{"empty in", NewPostgRESTQuery("users").In("id", nil), "users?id=in.%28%29"},
+		{"order after filters", NewPostgRESTQuery("messages").Order("created_at", false).Eq("channel_id", "c").Order("id", true).Limit(5),
+			"messages?channel_id=eq.c&limit=5&order=created_at.desc,id.asc"},
+		{"range", NewPostgRESTQuery("users").Range(20, 29), "users?offset=20&limit=10"},
+		{"select", NewPostgRESTQuery("users").Select("id", "name"), "users?select=id,name"},
+		{"on conflict", NewPostgRESTQuery("user_identities").OnConflict("provider", "subject"), "user_identities?on_conflict=provider,subject"},
+		{"rpc", NewPostgRESTRPC("delete_identity"), "rpc/delete_identity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.Path()
+			if err != nil {
+				t.Fatalf("Path: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Path = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPostgRESTQueryValuesStayInTheirFilter checks what PostgREST decodes: each value stays
+// one parameter, and inside in and or lists it stays one quoted item
+func TestPostgRESTQueryValuesStayInTheirFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *PostgRESTQuery
+		key   string
+		want  string
+	}{
+		{"eq ampersand", NewPostgRESTQuery("users").Eq("username", "a&role=eq.admin"), "username", "eq.a&role=eq.admin"},
+		{"eq or", NewPostgRESTQuery("users").Eq("username", "x&or=(role.eq.admin)"), "username", "eq.x&or=(role.eq.admin)"},
+		{"in comma", NewPostgRESTQuery("users").In("id", []string{"a,b", "c"}), "id", `in.("a,b","c")`},
+		{"in paren", NewPostgRESTQuery("users").In("id", []string{"a)", "b"}), "id", `in.("a)","b")`},
+		{"in quote", NewPostgRESTQuery("users").In("id", []string{`a"),("b`}), "id", `in.("a\"),(\"b")`},
+		{"in backslash", NewPostgRESTQuery("users").In("id", []string{`a\`, "b"}), "id", `in.("a\\","b")`},
+		{"or values", NewPostgRESTQuery("users").Or(EqFilter("username", "x,role.eq.admin"), NeqFilter("name", "y)")),
+			"or", `(username.eq."x,role.eq.admin",name.neq."y)")`},
+		{"or quote and backslash", NewPostgRESTQuery("users").Or(EqFilter("name", `a\",id.neq.("`)),
+			"or", `(name.eq."a\\\",id.neq.(\"")`},
+		{"or nested or", NewPostgRESTQuery("users").Or(EqFilter("name", "or=(id.neq.0)")), "or", `(name.eq."or=(id.neq.0)")`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := tt.query.Path()
+			if err != nil {
+				t.Fatalf("Path: %v", err)
+			}
+			_, rawQuery, _ := strings.Cut(path, "?")
+			params, err := url.ParseQuery(rawQuery)
+			if err != nil {
+				t.Fatalf("ParseQuery(%s): %v", rawQuery, err)
+			}
+			if len(params) != 1 || len(params[tt.key]) != 1 {
+				t.Fatalf("params = %v, want only %s", params, tt.key)
+			}
+			if got := params.Get(tt.key); got != tt.want {
+				t.Errorf("%s = %s, want %s", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgRESTQueryRejectsBadIdentifiers(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *PostgRESTQuery
+	}{
+		{"table", NewPostgRESTQuery("users?select=*")},
+		{"table path", NewPostgRESTQuery("../users")},
+		{"empty table", NewPostgRESTQuery("")},
+		{"eq column", NewPostgRESTQuery("users").Eq("id=eq.1&role", "admin")},
+		{"uppercase column", NewPostgRESTQuery("users").Eq("Role", "admin")},
+		{"or column", NewPostgRESTQuery("users").Or(EqFilter("id", "1"), EqFilter("role.eq.admin,id", "2"))},
+		{"select star", NewPostgRESTQuery("users").Select("*")},
+		{"select embed", NewPostgRESTQuery("users").Select("id", "sessions(*)")},
+		{"order", NewPostgRESTQuery("users").Order("name.desc,id", true)},
+		{"on conflict", NewPostgRESTQuery("users").OnConflict("id,role")},
+		{"range", NewPostgRESTQuery("users").Range(10, 5)},
+		{"negative range", NewPostgRESTQuery("users").Range(-1, 5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if path, err := tt.query.Path(); err == nil {
+				t.Errorf("Path = %s, want error", path)
+			}
+		})
+	}
+}
+
+// recordedRequest is a request the fake PostgREST server received
+type recordedRequest struct {
+	method string
+	uri    string
+	prefer string
+	body   string
+}
+
+// newTestSupabase returns a Supabase service backed by a server that records each request
+// and answers with a fixed body
+func newTestSupabase(t *testing.T, response string) (*SupabaseService, *[]recordedRequest) {
+	t.Helper()
+	return newRoutedTestSupabase(t, func(req recordedRequest) string { return response })
+}
+
+// newRoutedTestSupabase is newTestSupabase with a response picked per request
+func newRoutedTestSupabase(t *testing.T, respond func(req recordedRequest) string) (*SupabaseService, *[]recordedRequest) {
+	t.Helper()
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := recordedRequest{method: r.Method, uri: r.RequestURI, prefer: r.Header.Get("Prefer"), body: string(body)}
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, respond(req))
+	}))
+	t.Cleanup(server.Close)
+
+	s, err := NewSupabaseService(server.URL, "test-key")
+	if err != nil {
+		t.Fatalf("NewSupabaseService: %v", err)
+	}
+	return s, &requests
+}
+
+func TestSupabaseQueryUsersByField(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"alice", "/rest/v1/users?username=eq.alice"},
+		{"a&role=eq.admin", "/rest/v1/users?username=eq.a%26role%3Deq.admin"},
+		{"x,y)&or=(id.neq.0)", "/rest/v1/users?username=eq.x%2Cy%29%26or%3D%28id.neq.0%29"},
+	}
+
+	for _, tt := range tests {
+		s, requests := newTestSupabase(t, `[]`)
+		user, err := s.GetUserByUsername(tt.username)
+		if err != nil {
+			t.Fatalf("GetUserByUsername(%q): %v", tt.username, err)
+		}
+		if user != nil {
+			t.Errorf("GetUserByUsername(%q) = %+v, want nil", tt.username, user)
+		}
+		if len(*requests) != 1 || (*requests)[0].method != http.MethodGet || (*requests)[0].uri != tt.want {
+			t.Errorf("GetUserByUsername(%q) requests = %+v, want GET %s", tt.username, *requests, tt.want)
+		}
+	}
+}
+
+func TestSupabaseUpdateUser(t *testing.T) {
+	s, requests := newTestSupabase(t, `[{"id":"u1","bio":"hi"}]`)
+
+	user, err := s.UpdateUser("u1&id=neq.u1", map[string]interface{}{"bio": "hi"})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if user.Bio != "hi" {
+		t.Errorf("bio = %q, want hi", user.Bio)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.method != http.MethodPatch || req.uri != "/rest/v1/users?id=eq.u1%26id%3Dneq.u1" {
+		t.Errorf("request = %s %s, want PATCH /rest/v1/users?id=eq.u1%%26id%%3Dneq.u1", req.method, req.uri)
+	}
+	if req.prefer != "return=representation" {
+		t.Errorf("Prefer = %q, want return=representation", req.prefer)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(req.body), &payload); err != nil || len(payload) != 1 || payload["bio"] != "hi" {
+		t.Errorf("body = %s, want {\"bio\":\"hi\"}", req.body)
+	}
+}
+
+func TestSupabaseGetUserByWalletClaimsLegacyRow(t *testing.T) {
+	const address = "0xabcdef0123456789abcdef0123456789abcdef01"
+	legacyLookup := "/rest/v1/users?chain_type=is.null&wallet_address=ilike." + address
+	s, requests := newRoutedTestSupabase(t, func(req recordedRequest) string {
+		if req.method == http.MethodGet && req.uri == legacyLookup {
+			return `[{"id":"u1","wallet_address":"0xABCDEF0123456789abcdef0123456789ABCDEF01"}]`
+		}
+		return `[]`
+	})
+
+	user, err := s.GetUserByWallet(WalletIdentity{Chain: ChainEVM, Address: address})
+	if err != nil {
+		t.Fatalf("GetUserByWallet: %v", err)
+	}
+	if user == nil || user.ID != "u1" || user.ChainType != ChainEVM || user.WalletAddress != address {
+		t.Fatalf("user = %+v, want u1 claimed for %s", user, address)
+	}
+
+	want := []string{
+		"GET /rest/v1/identities?provider=eq.evm&subject=eq." + address,
+		"GET /rest/v1/users?chain_type=eq.evm&wallet_address=eq." + address,
+		"GET " + legacyLookup,
+		"PATCH /rest/v1/users?id=eq.u1&chain_type=is.null",
+	}
+	if len(*requests) != len(want) {
+		t.Fatalf("got %d requests, want %d: %+v", len(*requests), len(want), *requests)
+	}
+	for i, req := range *requests {
+		if got := req.method + " " + req.uri; got != want[i] {
+			t.Errorf("request %d = %s, want %s", i, got, want[i])
+		}
+	}
+	backfill := (*requests)[3].body
+	if backfill != `{"chain_type":"evm","wallet_address":"`+address+`"}` {
+		t.Errorf("backfill = %s", backfill)
+	}
+}
+
+func TestSupabaseDeleteIdentity(t *testing.T) {
+	tests := []struct {
+		response    string
+		wantDeleted bool
+		wantErr     error
+	}{
+		{`"deleted"`, true, nil},
+		{`"not_found"`, false, nil},
+		{`"last_identity"`, false, ErrLastIdentity},
+	}
+
+	for _, tt := range tests {
+		s, requests := newTestSupabase(t, tt.response)
+		deleted, err := s.DeleteIdentity("u1", "i1")
+		if deleted != tt.wantDeleted || !errors.Is(err, tt.wantErr) {
+			t.Errorf("DeleteIdentity with %s = %t, %v, want %t, %v", tt.response, deleted, err, tt.wantDeleted, tt.wantErr)
+		}
+
+		if len(*requests) != 1 {
+			t.Fatalf("got %d requests, want 1", len(*requests))
+		}
+		req := (*requests)[0]
+		if req.method != http.MethodPost || req.uri != "/rest/v1/rpc/delete_identity" || req.body != `{"p_identity_id":"i1","p_user_id":"u1"}` {
+			t.Errorf("request = %s %s %s, want one delete_identity call", req.method, req.uri, req.body)
+		}
+	}
+}
+
+func TestSupabaseGetUsersExcluding(t *testing.T) {
+	tests := []struct {
+		exclude string
+		limit   int
+		want    string
+	}{
+		{"u1", 0, "/rest/v1/users?id=neq.u1&limit=10"},
+		{"u1", 25, "/rest/v1/users?id=neq.u1&limit=25"},
+		{"u1&limit=1000", 5, "/rest/v1/users?id=neq.u1%26limit%3D1000&limit=5"},
+	}
+
+	for _, tt := range tests {
+		s, requests := newTestSupabase(t, `[{"id":"u2"},{"id":"u3"}]`)
+		users, err := s.GetUsersExcluding(tt.exclude, tt.limit)
+		if err != nil {
+			t.Fatalf("GetUsersExcluding(%q, %d): %v", tt.exclude, tt.limit, err)
+		}
+		if len(users) != 2 {
+			t.Errorf("got %d users, want 2", len(users))
+		}
+		if len(*requests) != 1 || (*requests)[0].method != http.MethodGet || (*requests)[0].uri != tt.want {
+			t.Errorf("GetUsersExcluding(%q, %d) requests = %+v, want GET %s", tt.exclude, tt.limit, *requests, tt.want)
+		}
+	}
+}
+
+func TestWebhookServiceClaim(t *testing.T) {
+	tests := []struct {
+		response string
+		want     bool
+	}{
+		{`[{"webhook_id":"wh-1"}]`, true},
+		{`[]`, false},
+	}
+
+	for _, tt := range tests {
+		s, requests := newTestSupabase(t, tt.response)
+		now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		claimed, err := NewWebhookService(s).ClaimWebhook("wh-1", now, now.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("ClaimWebhook: %v", err)
+		}
+		if claimed != tt.want {
+			t.Errorf("ClaimWebhook with response %s = %t, want %t", tt.response, claimed, tt.want)
+		}
+
+		if len(*requests) != 2 {
+			t.Fatalf("got %d requests, want 2", len(*requests))
+		}
+		expired, insert := (*requests)[0], (*requests)[1]
+		if expired.method != http.MethodDelete || expired.uri != "/rest/v1/processed_webhooks?webhook_id=eq.wh-1&processed_at=lt.2026-01-02T02%3A04%3A05Z" {
+			t.Errorf("first request = %s %s, want the expired claim deleted", expired.method, expired.uri)
+		}
+		if insert.method != http.MethodPost || insert.uri != "/rest/v1/processed_webhooks" || insert.prefer != "resolution=ignore-duplicates,return=representation" {
+			t.Errorf("second request = %s %s with Prefer %q, want an insert ignoring duplicates", insert.method, insert.uri, insert.prefer)
+		}
+	}
+}
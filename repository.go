@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Storage backends
+const (
+	StorageSupabase = "supabase" // PostgREST through the Supabase REST API (default)
+	StoragePostgres = "postgres" // Direct connection pool via pgx
+	StorageMemory   = "memory"   // In-process, lost on restart
+)
+
+// StorageConfig selects the storage backend and how to reach it
+type StorageConfig struct {
+	Backend     string
+	SupabaseURL string
+	SupabaseKey string
+	DatabaseURL string // Postgres connection URL for the postgres backend
+}
+
+// StorageConfigFromEnv reads the storage configuration from STORAGE_BACKEND, SUPABASE_URL,
+// SUPABASE_SERVICE_KEY and DATABASE_URL
+func StorageConfigFromEnv() StorageConfig {
+	return StorageConfig{
+		Backend:     os.Getenv("STORAGE_BACKEND"),
+		SupabaseURL: os.Getenv("SUPABASE_URL"),
+		SupabaseKey: os.Getenv("SUPABASE_SERVICE_KEY"),
+		DatabaseURL: os.Getenv("DATABASE_URL"),
+	}
+}
+
+// UserRepository stores users and the records tied to their accounts: sign-in nonces,
+// sessions, API keys, linked identities, handshakes, account deletions, chatbot
+// conversation states and match proposals.
+// Lookups return nil without an error when nothing matches.
+type UserRepository interface {
+	// Ping checks that the store can be reached
+	Ping() error
+
+	// Users
+	GetUserByID(id string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	GetUserByWallet(wallet WalletIdentity) (*User, error)
+	CreateUser(user *User) (*User, error)
+	UpdateUser(id string, updates map[string]interface{}) (*User, error)
+	GetUsersExcluding(excludeUserID string, limit int) ([]User, error)
+	DeleteUserRow(id string) error
+
+	// Sign-in nonces
+	CreateNonce(nonce *AuthNonce) error
+	ConsumeNonce(nonce string) (*AuthNonce, error)
+	DeleteExpiredNonces() error
+
+	// Sessions and refresh tokens
+	CreateSession(session *Session) error
+	GetSession(id string) (*Session, error)
+	ListActiveSessions(userID string) ([]Session, error)
+	TouchSession(id string, lastUsedAt, expiresAt time.Time) error
+	RevokeSession(id, reason string) error
+	RevokeUserSessions(userID, reason string) error
+	CreateRefreshToken(token *RefreshToken) error
+	GetRefreshToken(tokenHash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(tokenHash string) (bool, error)
+
+	// API keys
+	CreateAPIKey(key *APIKey) error
+	GetAPIKeyByHash(keyHash string) (*APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(id string) (bool, error)
+	TouchAPIKey(id string, lastUsedAt time.Time) error
+
+	// Identities and email verification
+	CreateIdentity(identity *Identity) error
+	GetIdentity(provider IdentityProvider, subject string) (*Identity, error)
+	ListIdentities(userID string) ([]Identity, error)
+	DeleteIdentity(userID, identityID string) (bool, error) // ErrLastIdentity for a user's only identity
+	DeleteIdentities(userID string) error
+	SaveEmailVerification(verification *EmailVerification) error
+	ConsumeEmailVerification(userID, email string) (*EmailVerification, error)
+
+	// Handshakes
+	CreateHandshake(event *HandshakeEvent) error
+	ListHandshakes(userID string) ([]HandshakeEvent, error)
+	DeleteHandshakes(userID string) error
+
+	// Account deletions
+	SaveAccountDeletion(job *AccountDeletion) error
+	GetAccountDeletion(userID string) (*AccountDeletion, error)
+	ListUnfinishedAccountDeletions() ([]AccountDeletion, error)
+
+	// Chatbot conversation states
+	GetConversationState(userID string) (*ConversationState, error)
+	SaveConversationState(state *ConversationState) error
+
+	// Match proposals. Resolving only changes a proposal that is still open, requesting and
+	// answering consent one that awaits it, and each reports whether it did.
+	CreateMatchProposal(proposal *MatchProposal) error
+	GetMatchProposal(id string) (*MatchProposal, error)         // nil if there is none
+	GetOpenMatchProposal(userID string) (*MatchProposal, error) // The newest open proposal to a user
+	ListMatchProposals(userID string) ([]MatchProposal, error)  // Proposals to a user, newest first
+	ResolveMatchProposal(id, status string, respondedAt time.Time) (bool, error)
+	// RequestMatchConsent records that the user accepted an open proposal, which now awaits
+	// the proposed user until expiresAt
+	RequestMatchConsent(id string, respondedAt, expiresAt time.Time) (bool, error)
+	AnswerMatchConsent(id, status string, respondedAt time.Time) (bool, error)
+	// CancelMatchProposals cancels the proposals made to or about a user that await an answer
+	CancelMatchProposals(userID string, cancelledAt time.Time) error
+}
+
+// MessageRepository stores chat messages and their edit history. Messages are returned
+// oldest first unless noted. Deleted messages stay as tombstones.
+type MessageRepository interface {
+	CreateMessage(message *Message) (*Message, error)
+	// CreateStreamMessage stores a mirrored Stream Chat message unless one with the same
+	// StreamMessageID exists, returning the stored message and whether it was created
+	CreateStreamMessage(message *Message) (*Message, bool, error)
+	GetChannelMessages(channelID string, query MessagePageQuery) (*MessagePage, error)
+	GetRecentChannelMessages(channelID string, limit int) ([]Message, error)
+	GetMessageByID(messageID string) (*Message, error)
+	GetMessagesByStreamID(streamMessageID string) ([]Message, error)
+	GetMessagesBySender(senderID string) ([]Message, error)
+	UpdateMessage(messageID string, updates map[string]interface{}) (*Message, error)
+	DeleteChannelMessages(channelID string) error
+	AnonymizeSenderMessages(senderID string) error
+
+	// Replies point at the root message of their thread
+	GetThreadReplies(parentID string, query MessagePageQuery) (*MessagePage, error)
+	CountReplies(messageIDs []string) (map[string]int, error) // Replies that aren't deleted, by parent ID
+
+	// Edits and tombstones save the text they replace as a revision. Both return
+	// ErrMessageNotFound for unknown messages.
+	EditMessage(messageID, text, editorID string, editedAt time.Time) (*Message, error)
+	TombstoneMessage(messageID, deletedBy, reason string, deletedAt time.Time) (*Message, error)
+	ListMessageRevisions(messageID string) ([]MessageRevision, error)
+
+	// Reactions and flags mirrored from Stream Chat. Adding one that is already stored
+	// changes nothing.
+	AddReaction(reaction *MessageReaction) error
+	RemoveReaction(messageID, userID, reactionType string) error
+	FlagMessage(flag *MessageFlag) error
+
+	// SearchMessages returns messages in the query's channels matching its text and filters,
+	// newest first. Empty text matches every message.
+	SearchMessages(query MessageSearchQuery) ([]Message, error)
+}
+
+// WebhookRepository stores the webhooks Stream Chat delivered and which were processed.
+// Lookups return nil without an error when nothing matches.
+type WebhookRepository interface {
+	// Processed webhook IDs, for deduplicating Stream's retries. ClaimWebhook stores an ID
+	// and reports whether it was free: never claimed, or last claimed before expiredBefore.
+	// Of concurrent claims of one ID, only one succeeds.
+	ClaimWebhook(webhookID string, claimedAt, expiredBefore time.Time) (bool, error)
+	ReleaseWebhook(webhookID string) error
+	DeleteProcessedWebhooks(before time.Time) error
+
+	// Deliveries of verified webhooks, for inspection and replay
+	CreateWebhookDelivery(delivery *WebhookDelivery) error
+	GetWebhookDelivery(id string) (*WebhookDelivery, error)
+	ListWebhookDeliveries(filter WebhookDeliveryFilter) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(id string, updates map[string]interface{}) error
+}
+
+// JobRepository stores the job queue and the jobs that failed every attempt
+type JobRepository interface {
+	EnqueueJob(job *Job) error
+	// ClaimJob leases the next due job until lockedUntil and counts the attempt, returning
+	// nil when no job is due. Jobs whose lease ran out are due again.
+	ClaimJob(now, lockedUntil time.Time) (*Job, error)
+	CompleteJob(jobID string) error
+	// RetryJob releases a claimed job to run again at runAt. It does nothing if the job was
+	// claimed again since, after its lease ran out.
+	RetryJob(job *Job, runAt time.Time, lastError string) error
+	// DeadLetterJob moves a job to the dead letters
+	DeadLetterJob(job *Job, lastError string, failedAt time.Time) error
+}
+
+// Compile-time checks that the storage backends implement the repositories
+var (
+	_ UserRepository    = (*SupabaseService)(nil)
+	_ MessageRepository = (*MessageService)(nil)
+	_ WebhookRepository = (*WebhookService)(nil)
+	_ JobRepository     = (*JobService)(nil)
+	_ UserRepository    = (*PostgresUserRepository)(nil)
+	_ MessageRepository = (*PostgresMessageRepository)(nil)
+	_ WebhookRepository = (*PostgresWebhookRepository)(nil)
+	_ JobRepository     = (*PostgresJobRepository)(nil)
+	_ UserRepository    = (*MemoryUserRepository)(nil)
+	_ MessageRepository = (*MemoryMessageRepository)(nil)
+	_ WebhookRepository = (*MemoryWebhookRepository)(nil)
+	_ JobRepository     = (*MemoryJobRepository)(nil)
+)
+
+// Repositories are the repositories of one storage backend
+type Repositories struct {
+	Users    UserRepository
+	Messages MessageRepository
+	Webhooks WebhookRepository
+	Jobs     JobRepository
+	Close    func() // Releases the backend's connections
+}
+
+// OpenRepositories connects to the configured storage backend
+func OpenRepositories(ctx context.Context, config StorageConfig) (*Repositories, error) {
+	switch config.Backend {
+	case "", StorageSupabase:
+		supabaseService, err := NewSupabaseService(config.SupabaseURL, config.SupabaseKey)
+		if err != nil {
+			return nil, err
+		}
+		return &Repositories{
+			Users:    supabaseService,
+			Messages: NewMessageService(supabaseService.client),
+			Webhooks: NewWebhookService(supabaseService),
+			Jobs:     NewJobService(supabaseService.client),
+			Close:    func() {},
+		}, nil
+
+	case StoragePostgres:
+		if config.DatabaseURL == "" {
+			return nil, fmt.Errorf("DATABASE_URL is required for the %s storage backend", StoragePostgres)
+		}
+		pool, err := NewPostgresPool(ctx, config.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return &Repositories{
+			Users:    NewPostgresUserRepository(pool),
+			Messages: NewPostgresMessageRepository(pool),
+			Webhooks: NewPostgresWebhookRepository(pool),
+			Jobs:     NewPostgresJobRepository(pool),
+			Close:    pool.Close,
+		}, nil
+
+	case StorageMemory:
+		return &Repositories{
+			Users:    NewMemoryUserRepository(),
+			Messages: NewMemoryMessageRepository(),
+			Webhooks: NewMemoryWebhookRepository(),
+			Jobs:     NewMemoryJobRepository(),
+			Close:    func() {},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+}
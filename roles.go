@@ -0,0 +1,91 @@
+package main
+
+import "fmt"
+
+// Role is a user's global role; it is stored on the user and carried in access tokens
+type Role string
+
+// Supported roles
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is an action a role may be allowed to perform
+type Permission string
+
+// Supported permissions. API key scopes use the same names.
+const (
+	PermissionChat             Permission = "chat:write"
+	PermissionReadMessages     Permission = "messages:read" // Read any channel, not just ones the caller is in
+	PermissionModerateMessages Permission = "messages:moderate"
+	PermissionPublishHandshake Permission = "handshake:publish"
+	PermissionAdminUsers       Permission = "users:admin"
+)
+
+// allPermissions lists every known permission
+var allPermissions = []Permission{
+	PermissionChat,
+	PermissionReadMessages,
+	PermissionModerateMessages,
+	PermissionPublishHandshake,
+	PermissionAdminUsers,
+}
+
+// rolePermissions lists what each role is allowed to do
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      {PermissionChat},
+	RoleModerator: {PermissionChat, PermissionReadMessages, PermissionModerateMessages},
+	RoleAdmin:     allPermissions,
+}
+
+// ParseRole validates a role name
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := rolePermissions[role]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return role, nil
+}
+
+// ParsePermission validates a permission or API key scope name
+func ParsePermission(s string) (Permission, error) {
+	permission := Permission(s)
+	for _, p := range allPermissions {
+		if p == permission {
+			return permission, nil
+		}
+	}
+	return "", fmt.Errorf("unknown permission %q", s)
+}
+
+// OrDefault returns the role, or RoleUser for users created before roles existed
+func (r Role) OrDefault() Role {
+	if r == "" {
+		return RoleUser
+	}
+	return r
+}
+
+// Can reports whether the role grants a permission
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r.OrDefault()] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamRole returns the Stream Chat global role matching the role
+func (r Role) StreamRole() string {
+	switch r.OrDefault() {
+	case RoleAdmin:
+		return "admin"
+	case RoleModerator:
+		return "moderator"
+	default:
+		return "user"
+	}
+}
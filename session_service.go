@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session errors
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// SessionService manages login sessions and their rotating refresh tokens
+type SessionService struct {
+	userRepo UserRepository
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(userRepo UserRepository) *SessionService {
+	return &SessionService{
+		userRepo: userRepo,
+	}
+}
+
+// CreateSession starts a new session for a user and returns its first refresh token
+func (s *SessionService) CreateSession(userID string, client ClientInfo) (*Session, string, error) {
+	now := time.Now().UTC()
+	session := &Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+		CreatedAt:  now,
+		LastUsedAt: &now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+
+	if err := s.userRepo.CreateSession(session); err != nil {
+		return nil, "", err
+	}
+
+	refreshToken, err := s.issueRefreshToken(session.ID, session.ExpiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. Each refresh token can
+// only be used once; presenting a used token revokes the whole session, since it
+// means the token was stolen or replayed.
+func (s *SessionService) RotateRefreshToken(refreshToken string) (*Session, string, error) {
+	tokenHash := hashToken(refreshToken)
+
+	stored, err := s.userRepo.GetRefreshToken(tokenHash)
+	if err != nil {
+		return nil, "", err
+	}
+	if stored == nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil {
+		s.revokeForReuse(stored.SessionID)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	session, err := s.GetActiveSession(stored.SessionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if session == nil || time.Now().After(stored.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	// Mark as used only if nobody else did first; losing this race is also reuse
+	claimed, err := s.userRepo.MarkRefreshTokenUsed(tokenHash)
+	if err != nil {
+		return nil, "", err
+	}
+	if !claimed {
+		s.revokeForReuse(stored.SessionID)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	// Slide the session forward with the new refresh token
+	now := time.Now().UTC()
+	session.LastUsedAt = &now
+	session.ExpiresAt = now.Add(RefreshTokenTTL)
+	if err := s.userRepo.TouchSession(session.ID, now, session.ExpiresAt); err != nil {
+		return nil, "", err
+	}
+
+	newToken, err := s.issueRefreshToken(session.ID, session.ExpiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, newToken, nil
+}
+
+// GetActiveSession returns a session if it exists, is not revoked and has not expired
+func (s *SessionService) GetActiveSession(sessionID string) (*Session, error) {
+	session, err := s.userRepo.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// ListSessions returns the active sessions of a user
+func (s *SessionService) ListSessions(userID string) ([]Session, error) {
+	return s.userRepo.ListActiveSessions(userID)
+}
+
+// RevokeSession revokes one of the user's sessions
+func (s *SessionService) RevokeSession(userID, sessionID, reason string) error {
+	session, err := s.userRepo.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	return s.userRepo.RevokeSession(sessionID, reason)
+}
+
+// RevokeAllSessions revokes every session of a user
+func (s *SessionService) RevokeAllSessions(userID, reason string) error {
+	return s.userRepo.RevokeUserSessions(userID, reason)
+}
+
+// revokeForReuse revokes a session after refresh token reuse was detected
+func (s *SessionService) revokeForReuse(sessionID string) {
+	log.Printf("[AUTH] Refresh token reuse detected for session %s, revoking", sessionID)
+	if err := s.userRepo.RevokeSession(sessionID, "refresh_token_reuse"); err != nil {
+		log.Printf("[AUTH] Failed to revoke session %s: %v", sessionID, err)
+	}
+}
+
+// issueRefreshToken generates and stores a new refresh token for a session
+func (s *SessionService) issueRefreshToken(sessionID string, expiresAt time.Time) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := s.userRepo.CreateRefreshToken(&RefreshToken{
+		TokenHash: hashToken(token),
+		SessionID: sessionID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// hashToken hashes a refresh token or API key for storage; only hashes are persisted
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// SIWE (EIP-4361) settings
+const (
+	siweHeaderMarker = " wants you to sign in with your "
+	siweHeaderSuffix = " account:"
+	siweVersion      = "1"
+	nonceAlphabet    = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// siweChains maps the account name in the message header to a chain type.
+// Sign-In with Solana reuses the EIP-4361 layout with "Solana account".
+var siweChains = map[string]ChainType{
+	"Ethereum": ChainEVM,
+	"Solana":   ChainSolana,
+}
+
+// SIWEMessage represents a parsed EIP-4361 Sign-In with Ethereum (or Solana) message
+type SIWEMessage struct {
+	Chain          ChainType
+	Domain         string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        string // Numeric for EVM chains, cluster name (e.g. "mainnet") for Solana
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// ParseSIWEMessage parses the plain-text EIP-4361 message a wallet signed
+func ParseSIWEMessage(raw string) (*SIWEMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	if len(lines) < 2 {
+		return nil, errors.New("malformed SIWE message")
+	}
+
+	// First line: "{domain} wants you to sign in with your {Ethereum|Solana} account:"
+	domain, account, found := strings.Cut(lines[0], siweHeaderMarker)
+	if !found || !strings.HasSuffix(account, siweHeaderSuffix) {
+		return nil, errors.New("malformed SIWE message: invalid header")
+	}
+	chain, ok := siweChains[strings.TrimSuffix(account, siweHeaderSuffix)]
+	if !ok {
+		return nil, errors.New("malformed SIWE message: unsupported account type")
+	}
+	if i := strings.Index(domain, "://"); i >= 0 {
+		domain = domain[i+3:]
+	}
+
+	msg := &SIWEMessage{
+		Chain:   chain,
+		Domain:  domain,
+		Address: strings.TrimSpace(lines[1]),
+	}
+	if msg.Address == "" {
+		return nil, errors.New("malformed SIWE message: missing address")
+	}
+
+	var statement []string
+	inResources := false
+	for _, line := range lines[2:] {
+		if inResources {
+			if strings.HasPrefix(line, "- ") {
+				msg.Resources = append(msg.Resources, strings.TrimPrefix(line, "- "))
+				continue
+			}
+			inResources = false
+		}
+
+		key, value, found := strings.Cut(line, ": ")
+		if !found {
+			if line == "Resources:" {
+				inResources = true
+			} else if line != "" && msg.URI == "" {
+				statement = append(statement, line)
+			}
+			continue
+		}
+
+		var err error
+		switch key {
+		case "URI":
+			msg.URI = value
+		case "Version":
+			msg.Version = value
+		case "Chain ID":
+			msg.ChainID = value
+		case "Nonce":
+			msg.Nonce = value
+		case "Issued At":
+			msg.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case "Expiration Time":
+			var t time.Time
+			t, err = time.Parse(time.RFC3339, value)
+			msg.ExpirationTime = &t
+		case "Not Before":
+			var t time.Time
+			t, err = time.Parse(time.RFC3339, value)
+			msg.NotBefore = &t
+		case "Request ID":
+			msg.RequestID = value
+		default:
+			if msg.URI == "" {
+				statement = append(statement, line)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed SIWE message: invalid %s: %w", key, err)
+		}
+	}
+	msg.Statement = strings.Join(statement, "\n")
+
+	if msg.URI == "" || msg.Version == "" || msg.ChainID == "" || msg.Nonce == "" || msg.IssuedAt.IsZero() {
+		return nil, errors.New("malformed SIWE message: missing required field")
+	}
+
+	return msg, nil
+}
+
+// Validate checks the message against the expected domain, chain and current time
+func (m *SIWEMessage) Validate(domain, chainID string, now time.Time) error {
+	if m.Version != siweVersion {
+		return fmt.Errorf("unsupported SIWE version %q", m.Version)
+	}
+	if !strings.EqualFold(m.Domain, domain) {
+		return fmt.Errorf("domain mismatch: message is for %q", m.Domain)
+	}
+	if m.ChainID != chainID {
+		return fmt.Errorf("chain ID mismatch: message is for chain %s", m.ChainID)
+	}
+	if m.ExpirationTime != nil && now.After(*m.ExpirationTime) {
+		return errors.New("SIWE message has expired")
+	}
+	if m.NotBefore != nil && now.Before(*m.NotBefore) {
+		return errors.New("SIWE message is not yet valid")
+	}
+	return nil
+}
+
+// RecoverEthereumAddress recovers the signer address of an EIP-191 personal_sign signature
+func RecoverEthereumAddress(message, signatureHex string) (string, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(signatureHex, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if len(sig) != 65 {
+		return "", fmt.Errorf("invalid signature length %d", len(sig))
+	}
+
+	// Wallets return r || s || v with v either 0/1 or 27/28
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return "", errors.New("invalid signature recovery id")
+	}
+
+	// RecoverCompact expects the recovery code first: 27 + v for uncompressed keys
+	compact := make([]byte, 65)
+	compact[0] = 27 + v
+	copy(compact[1:], sig[:64])
+
+	pubKey, _, err := ecdsa.RecoverCompact(compact, personalSignHash(message))
+	if err != nil {
+		return "", fmt.Errorf("failed to recover public key: %w", err)
+	}
+
+	// Address is the last 20 bytes of keccak256(X || Y)
+	addr := keccak256(pubKey.SerializeUncompressed()[1:])[12:]
+	return ChecksumAddress("0x" + hex.EncodeToString(addr)), nil
+}
+
+// ChecksumAddress returns the EIP-55 mixed-case form of a hex address
+func ChecksumAddress(address string) string {
+	lower := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X"))
+	hash := hex.EncodeToString(keccak256([]byte(lower)))
+
+	var b strings.Builder
+	b.WriteString("0x")
+	for i, c := range lower {
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' {
+			b.WriteRune(c - 32)
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// GenerateNonce returns a random alphanumeric nonce suitable for SIWE
+func GenerateNonce(length int) (string, error) {
+	max := big.NewInt(int64(len(nonceAlphabet)))
+	nonce := make([]byte, length)
+	for i := range nonce {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		nonce[i] = nonceAlphabet[n.Int64()]
+	}
+	return string(nonce), nil
+}
+
+// personalSignHash hashes a message the way eth_sign / personal_sign does
+func personalSignHash(message string) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(message))
+	return keccak256([]byte(prefix + message))
+}
+
+// keccak256 computes the legacy Keccak-256 hash used by Ethereum
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// isHexAddress reports whether s looks like a 0x-prefixed 20 byte hex address
+func isHexAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// StreamEventHandlers keep local state in step with Stream Chat events other than the
+// chatbot's replies: mirrored messages, reactions, flags, membership changes and users
+// deleted, banned or unbanned in Stream
+type StreamEventHandlers struct {
+	mirrorService  *StreamMirrorService
+	messageRepo    MessageRepository
+	userRepo       UserRepository
+	accountService *AccountService
+	sessionService *SessionService
+}
+
+// NewStreamEventHandlers creates the Stream Chat event handlers
+func NewStreamEventHandlers(mirrorService *StreamMirrorService, messageRepo MessageRepository, userRepo UserRepository, accountService *AccountService, sessionService *SessionService) *StreamEventHandlers {
+	return &StreamEventHandlers{
+		mirrorService:  mirrorService,
+		messageRepo:    messageRepo,
+		userRepo:       userRepo,
+		accountService: accountService,
+		sessionService: sessionService,
+	}
+}
+
+// Register adds the handlers to a dispatcher. Messages are mirrored first, so handlers
+// registered later for the same events see them stored.
+func (h *StreamEventHandlers) Register(dispatcher *WebhookDispatcher) {
+	dispatcher.Register("message.new", h.mirrorMessage)
+	dispatcher.Register("message.updated", h.mirrorMessage)
+	dispatcher.Register("message.deleted", h.mirrorMessage)
+	dispatcher.Register("message.flagged", h.flagMessage)
+	dispatcher.Register("reaction.new", h.addReaction)
+	dispatcher.Register("reaction.deleted", h.removeReaction)
+	dispatcher.Register("member.added", h.recordMembership)
+	dispatcher.Register("member.removed", h.recordMembership)
+	dispatcher.Register("channel.created", h.recordMembership)
+	dispatcher.Register("user.deleted", h.deleteUser)
+	dispatcher.Register("user.banned", h.banUser)
+	dispatcher.Register("user.unbanned", h.unbanUser)
+}
+
+// mirrorMessage stores new, edited and deleted messages
+func (h *StreamEventHandlers) mirrorMessage(ctx context.Context, event *StreamWebhookEvent) error {
+	return h.mirrorService.HandleEvent(event)
+}
+
+// addReaction stores a reaction on a mirrored message
+func (h *StreamEventHandlers) addReaction(ctx context.Context, event *StreamWebhookEvent) error {
+	if event.Reaction == nil {
+		return nil
+	}
+	message, err := h.reactedMessage(event)
+	if err != nil || message == nil {
+		return err
+	}
+
+	return h.messageRepo.AddReaction(&MessageReaction{
+		MessageID: message.ID,
+		UserID:    event.Reaction.UserID,
+		Type:      event.Reaction.Type,
+		CreatedAt: streamTime(event.Reaction.CreatedAt),
+	})
+}
+
+// removeReaction deletes a reaction from a mirrored message
+func (h *StreamEventHandlers) removeReaction(ctx context.Context, event *StreamWebhookEvent) error {
+	if event.Reaction == nil {
+		return nil
+	}
+	message, err := h.mirrorService.lookup(event.Reaction.MessageID)
+	if err != nil || message == nil {
+		return err
+	}
+	return h.messageRepo.RemoveReaction(message.ID, event.Reaction.UserID, event.Reaction.Type)
+}
+
+// reactedMessage returns the stored message a reaction is on, mirroring it first when the
+// event carries it. Reactions on messages that were never mirrored are skipped.
+func (h *StreamEventHandlers) reactedMessage(event *StreamWebhookEvent) (*Message, error) {
+	if event.Message != nil {
+		return h.mirrorService.Stored(*event.Message, eventChannelID(event))
+	}
+
+	message, err := h.mirrorService.lookup(event.Reaction.MessageID)
+	if err == nil && message == nil {
+		log.Printf("[WEBHOOK] Skipping reaction on unknown message %s", event.Reaction.MessageID)
+	}
+	return message, err
+}
+
+// flagMessage records a user's report of a message for moderators
+func (h *StreamEventHandlers) flagMessage(ctx context.Context, event *StreamWebhookEvent) error {
+	if event.Message == nil || event.User == nil {
+		return nil
+	}
+	message, err := h.mirrorService.Stored(*event.Message, eventChannelID(event))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[MODERATION] Message %s in channel %s flagged by %s", message.ID, message.ChannelID, event.User.ID)
+	return h.messageRepo.FlagMessage(&MessageFlag{
+		MessageID: message.ID,
+		UserID:    event.User.ID,
+		CreatedAt: streamTime(event.CreatedAt),
+	})
+}
+
+// recordMembership stores a system message in the channel's history when a channel is
+// created or a member joins or leaves. The system message gets a Stream ID made from the
+// event, so a retried webhook stores nothing new.
+func (h *StreamEventHandlers) recordMembership(ctx context.Context, event *StreamWebhookEvent) error {
+	user := event.User
+	if event.Member != nil {
+		user = event.Member.User
+		if user == nil {
+			user = &StreamUser{ID: event.Member.UserID}
+		}
+	}
+	channelID := eventChannelID(event)
+	if user == nil || user.ID == "" || channelID == "" || isStreamBot(user.ID) {
+		return nil
+	}
+
+	name := user.Name
+	if name == "" {
+		name = user.ID
+	}
+	var text string
+	switch event.Type {
+	case "channel.created":
+		text = fmt.Sprintf("%s created the channel", name)
+	case "member.added":
+		text = fmt.Sprintf("%s joined the channel", name)
+	case "member.removed":
+		text = fmt.Sprintf("%s left the channel", name)
+	}
+
+	streamMessageID := fmt.Sprintf("%s:%s:%s:%s", event.Type, channelID, user.ID, event.CreatedAt)
+	_, _, err := h.messageRepo.CreateStreamMessage(&Message{
+		MessageText:     text,
+		SenderID:        user.ID,
+		SenderUsername:  name,
+		ChannelID:       channelID,
+		MessageType:     "system",
+		Type:            "text",
+		StreamMessageID: &streamMessageID,
+		CreatedAt:       streamTime(event.CreatedAt),
+	})
+	return err
+}
+
+// deleteUser starts deleting the local account of a user deleted in Stream Chat
+func (h *StreamEventHandlers) deleteUser(ctx context.Context, event *StreamWebhookEvent) error {
+	if event.User == nil || isStreamBot(event.User.ID) {
+		return nil
+	}
+	user, err := h.userRepo.GetUserByID(event.User.ID)
+	if err != nil || user == nil {
+		return err
+	}
+
+	log.Printf("[ACCOUNT] User %s was deleted in Stream Chat, deleting local account", user.ID)
+	_, err = h.accountService.RequestDeletion(user.ID)
+	return err
+}
+
+// banUser records an app-wide ban on the user and signs them out, so they can't sign in
+// again until it ends. Channel bans only keep the user out of that channel, which Stream
+// enforces.
+func (h *StreamEventHandlers) banUser(ctx context.Context, event *StreamWebhookEvent) error {
+	if event.User == nil || event.ChannelID != "" || event.CID != "" {
+		return nil
+	}
+
+	var expiresAt *time.Time
+	if event.Expiration != "" {
+		expiration, err := time.Parse(time.RFC3339, event.Expiration)
+		if err != nil {
+			return fmt.Errorf("invalid ban expiration %q: %w", event.Expiration, err)
+		}
+		expiresAt = &expiration
+	}
+	bannedAt := time.Now().UTC()
+	if err := h.setBan(event.User.ID, &bannedAt, expiresAt); err != nil {
+		return err
+	}
+
+	log.Printf("[AUTH] User %s was banned in Stream Chat (reason: %q), revoking sessions", event.User.ID, event.Reason)
+	return h.sessionService.RevokeAllSessions(event.User.ID, "banned")
+}
+
+// unbanUser lifts an app-wide ban, letting the user sign in again
+func (h *StreamEventHandlers) unbanUser(ctx context.Context, event *StreamWebhookEvent) error {
+	if event.User == nil || event.ChannelID != "" || event.CID != "" {
+		return nil
+	}
+
+	log.Printf("[AUTH] User %s was unbanned in Stream Chat", event.User.ID)
+	return h.setBan(event.User.ID, nil, nil)
+}
+
+// setBan stores when a local user was banned and when the ban ends. Users only in Stream
+// have nothing to update.
+func (h *StreamEventHandlers) setBan(userID string, bannedAt, expiresAt *time.Time) error {
+	user, err := h.userRepo.GetUserByID(userID)
+	if err != nil || user == nil {
+		return err
+	}
+	_, err = h.userRepo.UpdateUser(userID, map[string]interface{}{
+		"banned_at":      bannedAt,
+		"ban_expires_at": expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record ban of %s: %w", userID, err)
+	}
+	return nil
+}
@@ -11,40 +11,35 @@ import (
 type StreamHandler struct {
 	streamService *StreamService
 	authService   *AuthService
+	authorizer    *Authorizer
 }
 
 // NewStreamHandler creates a new Stream handler
-func NewStreamHandler(streamService *StreamService, authService *AuthService) *StreamHandler {
+func NewStreamHandler(streamService *StreamService, authService *AuthService, authorizer *Authorizer) *StreamHandler {
 	return &StreamHandler{
 		streamService: streamService,
 		authService:   authService,
+		authorizer:    authorizer,
 	}
 }
 
 // GenerateToken handles Stream token generation requests
 // @Summary Generate Stream Chat token
-// @Description Generate a Stream Chat token for a user
+// @Description Generate a Stream Chat token for the authenticated user
 // @Tags Stream Chat
-// @Accept json
 // @Produce json
-// @Param request body TokenRequest true "Token generation request"
+// @Security Bearer
 // @Success 200 {object} TokenResponse "Successfully generated token"
-// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not a user"
 // @Failure 404 {object} ErrorResponse "User not found"
 // @Failure 500 {object} ErrorResponse "Token generation failed"
 // @Router /stream/token [post]
 func (h *StreamHandler) GenerateToken(c *gin.Context) {
-	var req TokenRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "invalid_request",
-			Message: err.Error(),
-		})
-		return
-	}
+	userID := CallerID(c)
 
 	// Validate user exists in our system
-	_, err := h.authService.GetUser(req.UserID)
+	_, err := h.authService.GetUser(userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{
 			Error:   "user_not_found",
@@ -54,7 +49,7 @@ func (h *StreamHandler) GenerateToken(c *gin.Context) {
 	}
 
 	// Generate Stream token
-	token, err := h.streamService.CreateToken(req.UserID, nil)
+	token, err := h.streamService.CreateToken(userID, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:   "token_generation_failed",
@@ -65,15 +60,14 @@ func (h *StreamHandler) GenerateToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, TokenResponse{
 		Token:  token,
-		UserID: req.UserID,
+		UserID: userID,
 	})
 }
 
 // GenerateTokenWithExpiry handles Stream token generation with expiration
 func (h *StreamHandler) GenerateTokenWithExpiry(c *gin.Context) {
 	var req struct {
-		UserID     string `json:"user_id" binding:"required"`
-		ExpiryTime int64  `json:"expiry_time,omitempty"` // Unix timestamp
+		ExpiryTime int64 `json:"expiry_time,omitempty"` // Unix timestamp
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -84,8 +78,10 @@ func (h *StreamHandler) GenerateTokenWithExpiry(c *gin.Context) {
 		return
 	}
 
+	userID := CallerID(c)
+
 	// Validate user exists
-	_, err := h.authService.GetUser(req.UserID)
+	_, err := h.authService.GetUser(userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{
 			Error:   "user_not_found",
@@ -101,7 +97,7 @@ func (h *StreamHandler) GenerateTokenWithExpiry(c *gin.Context) {
 	}
 
 	// Generate Stream token
-	token, err := h.streamService.CreateToken(req.UserID, expiry)
+	token, err := h.streamService.CreateToken(userID, expiry)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:   "token_generation_failed",
@@ -112,19 +108,22 @@ func (h *StreamHandler) GenerateTokenWithExpiry(c *gin.Context) {
 
 	c.JSON(http.StatusOK, TokenResponse{
 		Token:  token,
-		UserID: req.UserID,
+		UserID: userID,
 	})
 }
 
 // CreateOrUpdateUser handles Stream user creation/update
 // @Summary Create or update Stream user
-// @Description Create or update a user in Stream Chat
+// @Description Create or update the authenticated user in Stream Chat
 // @Tags Stream Chat
 // @Accept json
 // @Produce json
+// @Security Bearer
 // @Param request body StreamUserRequest true "User creation/update request"
 // @Success 200 {object} object{message=string,user_id=string} "User created/updated successfully"
 // @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Cannot update another user"
 // @Failure 500 {object} ErrorResponse "Stream user creation failed"
 // @Router /stream/user [post]
 func (h *StreamHandler) CreateOrUpdateUser(c *gin.Context) {
@@ -137,7 +136,18 @@ func (h *StreamHandler) CreateOrUpdateUser(c *gin.Context) {
 		return
 	}
 
-	// Create user object
+	// Users may only update themselves unless they hold users:admin; the ID defaults to the caller
+	if req.ID == "" {
+		req.ID = CallerID(c)
+	}
+	if req.ID == "" || !CallerCan(c, PermissionAdminUsers) {
+		if err := h.authorizer.AuthorizeUser(CallerID(c), req.ID); err != nil {
+			RespondAuthorizationError(c, err)
+			return
+		}
+	}
+
+	// Create user object; the role is never taken from the request
 	user := &User{
 		ID:            req.ID,
 		Username:      req.Username,
@@ -145,6 +155,11 @@ func (h *StreamHandler) CreateOrUpdateUser(c *gin.Context) {
 		ProfilePicURL: req.Image,
 	}
 
+	localUser, localErr := h.authService.GetUser(req.ID)
+	if localErr == nil {
+		user.Role = localUser.Role
+	}
+
 	// Create or update user in Stream
 	if err := h.streamService.CreateOrUpdateUser(c.Request.Context(), user); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
@@ -155,7 +170,7 @@ func (h *StreamHandler) CreateOrUpdateUser(c *gin.Context) {
 	}
 
 	// Also update in local auth service if user exists
-	if localUser, err := h.authService.GetUser(req.ID); err == nil {
+	if localErr == nil {
 		updates := map[string]interface{}{
 			"name":     req.Name,
 			"username": req.Username,
@@ -165,7 +180,6 @@ func (h *StreamHandler) CreateOrUpdateUser(c *gin.Context) {
 		}
 		
 		h.authService.UpdateUser(req.ID, updates)
-		_ = localUser // avoid unused variable warning
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -174,10 +188,9 @@ func (h *StreamHandler) CreateOrUpdateUser(c *gin.Context) {
 	})
 }
 
-// RevokeUserToken handles token revocation for a user
+// RevokeUserToken handles token revocation for the authenticated user
 func (h *StreamHandler) RevokeUserToken(c *gin.Context) {
 	var req struct {
-		UserID     string `json:"user_id" binding:"required"`
 		RevokeTime *int64 `json:"revoke_time,omitempty"` // Unix timestamp, null to undo revocation
 	}
 
@@ -195,8 +208,10 @@ func (h *StreamHandler) RevokeUserToken(c *gin.Context) {
 		revokeTime = &t
 	}
 
+	userID := CallerID(c)
+
 	// Revoke token in Stream
-	if err := h.streamService.RevokeUserToken(c.Request.Context(), req.UserID, revokeTime); err != nil {
+	if err := h.streamService.RevokeUserToken(c.Request.Context(), userID, revokeTime); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error:   "token_revocation_failed",
 			Message: err.Error(),
@@ -211,7 +226,7 @@ func (h *StreamHandler) RevokeUserToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": message,
-		"user_id": req.UserID,
+		"user_id": userID,
 	})
 }
 
@@ -224,10 +239,12 @@ func (h *StreamHandler) RevokeUserToken(c *gin.Context) {
 // @Param user_id path string true "User ID"
 // @Success 200 {array} StreamChannel "User channels"
 // @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Not the caller's user ID"
 // @Failure 404 {object} ErrorResponse "User not found"
 // @Failure 500 {object} ErrorResponse "Failed to retrieve channels"
 // @Router /stream/channels/{user_id} [get]
 func (h *StreamHandler) GetUserChannels(c *gin.Context) {
+	// Ownership is enforced by Authorizer.RequireUserParam on the route
 	userID := c.Param("user_id")
 	
 	// Validate user exists in our system
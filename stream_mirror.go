@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Outcomes of mirroring a Stream Chat message
+const (
+	mirrorCreated   = "created"
+	mirrorEdited    = "edited"
+	mirrorDeleted   = "deleted"
+	mirrorUnchanged = "unchanged"
+)
+
+// BackfillStats counts the messages a backfill read and what it changed
+type BackfillStats struct {
+	Channels int
+	Messages int
+	Created  int
+	Edited   int
+	Deleted  int
+}
+
+// StreamMirrorService keeps the messages table in step with Stream Chat. Stored messages are
+// matched on stream_message_id, so replaying an event or backfilling twice changes nothing.
+type StreamMirrorService struct {
+	messageRepo   MessageRepository
+	streamService *StreamService
+}
+
+// NewStreamMirrorService creates a new Stream Chat mirror service
+func NewStreamMirrorService(messageRepo MessageRepository, streamService *StreamService) *StreamMirrorService {
+	return &StreamMirrorService{
+		messageRepo:   messageRepo,
+		streamService: streamService,
+	}
+}
+
+// HandleEvent mirrors a message.new, message.updated or message.deleted webhook event,
+// ignoring other events
+func (s *StreamMirrorService) HandleEvent(event *StreamWebhookEvent) error {
+	if event.Message == nil {
+		return nil
+	}
+	message := *event.Message
+	channelID := eventChannelID(event)
+
+	var err error
+	switch event.Type {
+	case "message.new":
+		_, err = s.mirror(message, channelID, false, "")
+	case "message.updated":
+		_, err = s.mirror(message, channelID, true, "")
+	case "message.deleted":
+		message.Type = "deleted"
+		if message.DeletedAt == "" {
+			message.DeletedAt = event.CreatedAt
+		}
+		deletedBy := ""
+		if event.User != nil {
+			deletedBy = event.User.ID
+		}
+		_, err = s.mirror(message, channelID, true, deletedBy)
+	}
+	return err
+}
+
+// Stored mirrors a Stream Chat message, as HandleEvent does for message.updated, and returns
+// the stored copy
+func (s *StreamMirrorService) Stored(message StreamMessage, channelID string) (*Message, error) {
+	if _, err := s.mirror(message, channelID, true, ""); err != nil {
+		return nil, err
+	}
+	return s.lookup(message.ID)
+}
+
+// lookup returns the stored copy of a Stream Chat message, or nil if it hasn't been mirrored
+func (s *StreamMirrorService) lookup(streamMessageID string) (*Message, error) {
+	messages, err := s.messageRepo.GetMessagesByStreamID(streamMessageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return &messages[0], nil
+}
+
+// Backfill reads the history of Stream Chat messaging channels, every one or those with the
+// given IDs, and mirrors each message including thread replies
+func (s *StreamMirrorService) Backfill(ctx context.Context, channelIDs []string) (BackfillStats, error) {
+	var stats BackfillStats
+	for offset := 0; ; offset += streamChannelPageSize {
+		channels, err := s.streamService.ListMessagingChannels(ctx, channelIDs, offset)
+		if err != nil {
+			return stats, fmt.Errorf("failed to list channels: %w", err)
+		}
+
+		for _, channel := range channels {
+			if err := s.backfillChannel(ctx, channel, &stats); err != nil {
+				return stats, fmt.Errorf("failed to backfill %s: %w", channel.CID, err)
+			}
+			stats.Channels++
+		}
+
+		if len(channels) < streamChannelPageSize {
+			return stats, nil
+		}
+	}
+}
+
+// backfillChannel mirrors a channel's messages oldest first, so thread parents are stored
+// before their replies
+func (s *StreamMirrorService) backfillChannel(ctx context.Context, channel StreamChannel, stats *BackfillStats) error {
+	messages, err := readHistory(func(beforeID string) ([]StreamMessage, error) {
+		return s.streamService.GetChannelMessages(ctx, channel.Type, channel.ID, beforeID)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err := s.backfillMessage(message, channel.ID, stats); err != nil {
+			return err
+		}
+		if message.ReplyCount == 0 {
+			continue
+		}
+
+		replies, err := readHistory(func(beforeID string) ([]StreamMessage, error) {
+			return s.streamService.GetReplies(ctx, channel.Type, channel.ID, message.ID, beforeID)
+		})
+		if err != nil {
+			return err
+		}
+		for _, reply := range replies {
+			if err := s.backfillMessage(reply, channel.ID, stats); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backfillMessage mirrors a message read from history and counts the outcome
+func (s *StreamMirrorService) backfillMessage(message StreamMessage, channelID string, stats *BackfillStats) error {
+	outcome, err := s.mirror(message, channelID, true, "")
+	if err != nil {
+		return err
+	}
+
+	stats.Messages++
+	switch outcome {
+	case mirrorCreated:
+		stats.Created++
+	case mirrorEdited:
+		stats.Edited++
+	case mirrorDeleted:
+		stats.Deleted++
+	}
+	return nil
+}
+
+// mirror stores a Stream Chat message if it is new, then brings the stored copy up to date:
+// deleted messages become tombstones, and when current is set the text is replaced by an
+// edit. Tombstones are never changed again.
+func (s *StreamMirrorService) mirror(message StreamMessage, channelID string, current bool, deletedBy string) (string, error) {
+	local, err := s.localMessage(message, channelID)
+	if err != nil {
+		return "", err
+	}
+
+	stored, created, err := s.messageRepo.CreateStreamMessage(local)
+	if err != nil {
+		return "", err
+	}
+	if stored.DeletedAt != nil {
+		return mirrorUnchanged, nil
+	}
+
+	if message.DeletedAt != "" || message.Type == "deleted" {
+		if deletedBy == "" {
+			deletedBy = message.User.ID
+		}
+		if _, err := s.messageRepo.TombstoneMessage(stored.ID, deletedBy, "", streamTime(message.DeletedAt)); err != nil {
+			return "", err
+		}
+		return mirrorDeleted, nil
+	}
+
+	if created {
+		return mirrorCreated, nil
+	}
+	if current && stored.MessageText != message.Text {
+		if _, err := s.messageRepo.EditMessage(stored.ID, message.Text, message.User.ID, streamTime(message.UpdatedAt)); err != nil {
+			return "", err
+		}
+		return mirrorEdited, nil
+	}
+	return mirrorUnchanged, nil
+}
+
+// localMessage converts a Stream Chat message to a stored message, linking thread replies
+// to their parent if it has been mirrored
+func (s *StreamMirrorService) localMessage(message StreamMessage, channelID string) (*Message, error) {
+	streamMessageID := message.ID
+	local := &Message{
+		MessageText:     message.Text,
+		SenderID:        message.User.ID,
+		SenderUsername:  message.User.Username,
+		ChannelID:       channelID,
+		MessageType:     "user",
+		Type:            "text",
+		StreamMessageID: &streamMessageID,
+		CreatedAt:       streamTime(message.CreatedAt),
+	}
+	if local.SenderUsername == "" {
+		local.SenderUsername = message.User.Name
+	}
+
+	switch {
+	case isStreamBot(message.User.ID):
+		local.MessageType = "assistant"
+	case message.Type == "system":
+		local.MessageType = "system"
+	}
+
+	if message.Text == "" {
+		for _, attachment := range message.Attachments {
+			if attachment.Type == "image" {
+				local.Type = "image"
+				break
+			}
+		}
+	}
+
+	if message.ParentID != "" {
+		parent, err := s.lookup(message.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil {
+			local.ReplyToID = &parent.ID
+		}
+	}
+	return local, nil
+}
+
+// readHistory reads every page of a message history, newest page first, and returns the
+// messages oldest first
+func readHistory(page func(beforeID string) ([]StreamMessage, error)) ([]StreamMessage, error) {
+	var pages [][]StreamMessage
+	beforeID := ""
+	for {
+		messages, err := page(beforeID)
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) > 0 {
+			pages = append(pages, messages)
+			beforeID = messages[0].ID
+		}
+		if len(messages) < streamMessagePageSize {
+			break
+		}
+	}
+
+	var history []StreamMessage
+	for i := len(pages) - 1; i >= 0; i-- {
+		history = append(history, pages[i]...)
+	}
+	return history, nil
+}
+
+// eventChannelID returns the bare ID of the channel an event happened in
+func eventChannelID(event *StreamWebhookEvent) string {
+	switch {
+	case event.Channel != nil && event.Channel.ID != "":
+		return event.Channel.ID
+	case event.ChannelID != "":
+		return event.ChannelID
+	case event.Message != nil && event.Message.ChannelID != "":
+		return event.Message.ChannelID
+	case event.CID != "":
+		return event.CID[strings.Index(event.CID, ":")+1:]
+	case event.Message != nil:
+		return event.Message.CID[strings.Index(event.Message.CID, ":")+1:]
+	default:
+		return ""
+	}
+}
+
+// streamTime parses a Stream Chat timestamp, returning the current time if there is none
+func streamTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return t
+}
+
+// isStreamBot reports whether a Stream Chat user is one of the bots
+func isStreamBot(userID string) bool {
+	return userID == "chatbot" || userID == "ai-assistant"
+}
+
+// runBackfill implements the backfill command, mirroring the history of every Stream Chat
+// messaging channel, or of the channels whose IDs are given, into the configured storage
+func runBackfill(channelIDs []string) int {
+	config := StorageConfigFromEnv()
+	if config.Backend == StorageMemory {
+		fmt.Fprintln(os.Stderr, "backfill needs the supabase or postgres storage backend")
+		return 1
+	}
+
+	ctx := context.Background()
+	repos, err := OpenRepositories(ctx, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer repos.Close()
+
+	streamService := NewStreamService(os.Getenv("STREAM_API_KEY"), os.Getenv("STREAM_SECRET"))
+	stats, err := NewStreamMirrorService(repos.Messages, streamService).Backfill(ctx, channelIDs)
+	fmt.Printf("read %d messages from %d channels: %d created, %d edited, %d deleted\n",
+		stats.Messages, stats.Channels, stats.Created, stats.Edited, stats.Deleted)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
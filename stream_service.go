@@ -6,11 +6,22 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	stream "github.com/GetStream/stream-chat-go/v5"
 )
 
+// ErrStreamUserNotFound is returned when a user does not exist in Stream Chat
+var ErrStreamUserNotFound = errors.New("user not found")
+
+// Page sizes for reading Stream Chat history
+const (
+	streamChannelPageSize = 30 // Most channels QueryChannels returns at once
+	streamMessagePageSize = 100
+)
+
 // StreamService handles Stream Chat operations
 type StreamService struct {
 	client *stream.Client
@@ -50,7 +61,7 @@ func (s *StreamService) CreateOrUpdateUser(ctx context.Context, user *User) erro
 	streamUser := &stream.User{
 		ID:     user.ID,
 		Name:   user.Name,
-		Role:   "user",
+		Role:   user.Role.StreamRole(),
 		Online: true, // Set user as online when they login
 	}
 
@@ -62,6 +73,7 @@ func (s *StreamService) CreateOrUpdateUser(ctx context.Context, user *User) erro
 	if user.WalletAddress != "" {
 		streamUser.ExtraData = map[string]interface{}{
 			"wallet_address": user.WalletAddress,
+			"chain_type":     user.ChainType,
 		}
 	}
 
@@ -81,7 +93,7 @@ func (s *StreamService) GetUser(ctx context.Context, userID string) (*stream.Use
 	}
 
 	if len(users.Users) == 0 {
-		return nil, errors.New("user not found")
+		return nil, ErrStreamUserNotFound
 	}
 
 	return users.Users[0], nil
@@ -167,6 +179,35 @@ Just include your name and upload a picture. What would you like to share?`,
 
 // SendMessage sends a message to a Stream Chat channel
 func (s *StreamService) SendMessage(cid, text, senderID string) error {
+	return s.SendMessageWithAttachments(cid, text, senderID, nil)
+}
+
+// SendMessageWithAttachments sends a message with attachments, such as action buttons, to a
+// Stream Chat channel
+func (s *StreamService) SendMessageWithAttachments(cid, text, senderID string, attachments []StreamAttachment) error {
+	message := &stream.Message{
+		Text: text,
+		User: &stream.User{ID: senderID},
+	}
+	for _, attachment := range attachments {
+		message.Attachments = append(message.Attachments, toStreamAttachment(attachment))
+	}
+	return s.send(cid, senderID, message)
+}
+
+// SendReply sends a message to a Stream Chat channel in the thread of the message with the
+// Stream ID parentID
+func (s *StreamService) SendReply(cid, parentID, text, senderID string) error {
+	return s.send(cid, senderID, &stream.Message{
+		Text:     text,
+		User:     &stream.User{ID: senderID},
+		ParentID: parentID,
+	})
+}
+
+// send sends a message to a Stream Chat channel as senderID, creating the sender as a bot
+// user if needed
+func (s *StreamService) send(cid, senderID string, message *stream.Message) error {
 	ctx := context.Background()
 
 	// Parse CID to extract channel type and ID
@@ -202,11 +243,6 @@ func (s *StreamService) SendMessage(cid, text, senderID string) error {
 	s.client.UpsertUser(ctx, botUser)
 
 	// Send message
-	message := &stream.Message{
-		Text: text,
-		User: &stream.User{ID: senderID},
-	}
-
 	_, err := channel.SendMessage(ctx, message, senderID)
 	if err != nil {
 		log.Printf("[STREAM] Failed to send message: %v", err)
@@ -261,10 +297,14 @@ func (s *StreamService) GetUserChannels(ctx context.Context, userID string) ([]S
 // HasAIChannel checks if a user has any AI chat channels
 func (s *StreamService) HasAIChannel(ctx context.Context, userID string) (bool, error) {
 	// Try to query the specific AI channel for this user
-	aiChannelID := "ai-chat-" + userID
+	return s.IsChannelMember(ctx, "ai-chat-"+userID, userID)
+}
+
+// IsChannelMember checks if a user is a member of the channel with the given ID
+func (s *StreamService) IsChannelMember(ctx context.Context, channelID, userID string) (bool, error) {
 	channels, err := s.client.QueryChannels(ctx, &stream.QueryOption{
 		Filter: map[string]interface{}{
-			"id": aiChannelID,
+			"id": channelID,
 			"members": map[string]interface{}{
 				"$in": []string{userID},
 			},
@@ -305,6 +345,190 @@ func (s *StreamService) CreateUserMatchChannel(ctx context.Context, user1ID, use
 	return channelID, nil
 }
 
+// GetMatchChannels retrieves the match channels a user is a member of
+func (s *StreamService) GetMatchChannels(ctx context.Context, userID string) ([]StreamChannel, error) {
+	channels, err := s.GetUserChannels(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []StreamChannel
+	for _, channel := range channels {
+		if strings.HasPrefix(channel.ID, "match-") {
+			matches = append(matches, channel)
+		}
+	}
+
+	return matches, nil
+}
+
+// DeleteChannel hard-deletes a messaging channel, doing nothing if it doesn't exist
+func (s *StreamService) DeleteChannel(ctx context.Context, channelID string) error {
+	channels, err := s.client.QueryChannels(ctx, &stream.QueryOption{
+		Filter: map[string]interface{}{
+			"id": channelID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(channels.Channels) == 0 {
+		return nil
+	}
+
+	_, err = s.client.DeleteChannels(ctx, []string{"messaging:" + channelID}, true)
+	return err
+}
+
+// HardDeleteUser permanently deletes a user and their messages from Stream Chat,
+// doing nothing if the user doesn't exist
+func (s *StreamService) HardDeleteUser(ctx context.Context, userID string) error {
+	if _, err := s.GetUser(ctx, userID); err != nil {
+		if errors.Is(err, ErrStreamUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	_, err := s.client.DeleteUser(ctx, userID,
+		stream.DeleteUserWithHardDelete(),
+		stream.DeleteUserWithMarkMessagesDeleted(),
+	)
+	return err
+}
+
+// ListMessagingChannels returns a page of messaging channels, oldest first, only those with
+// the given IDs when any are passed
+func (s *StreamService) ListMessagingChannels(ctx context.Context, channelIDs []string, offset int) ([]StreamChannel, error) {
+	filter := map[string]interface{}{"type": "messaging"}
+	if len(channelIDs) > 0 {
+		filter["id"] = map[string]interface{}{"$in": channelIDs}
+	}
+
+	channels, err := s.client.QueryChannels(ctx, &stream.QueryOption{
+		Filter: filter,
+		Limit:  streamChannelPageSize,
+		Offset: offset,
+	}, &stream.SortOption{Field: "created_at", Direction: 1})
+	if err != nil {
+		return nil, err
+	}
+
+	page := make([]StreamChannel, 0, len(channels.Channels))
+	for _, channel := range channels.Channels {
+		page = append(page, StreamChannel{
+			ID:   channel.ID,
+			Type: channel.Type,
+			CID:  channel.CID,
+		})
+	}
+	return page, nil
+}
+
+// GetChannelMessages returns a page of a channel's messages older than beforeID, or the
+// newest without one, oldest first. Thread replies are only included if shown in the channel.
+func (s *StreamService) GetChannelMessages(ctx context.Context, channelType, channelID, beforeID string) ([]StreamMessage, error) {
+	response, err := s.client.Channel(channelType, channelID).Query(ctx, &stream.QueryRequest{
+		State: true,
+		Messages: &stream.MessagePaginationParamsRequest{
+			PaginationParamsRequest: stream.PaginationParamsRequest{Limit: streamMessagePageSize, IDLT: beforeID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return streamMessagesFromSDK(response.Messages), nil
+}
+
+// GetReplies returns a page of the thread replies to a message older than beforeID, or the
+// newest without one, oldest first
+func (s *StreamService) GetReplies(ctx context.Context, channelType, channelID, parentID, beforeID string) ([]StreamMessage, error) {
+	options := map[string][]string{"limit": {strconv.Itoa(streamMessagePageSize)}}
+	if beforeID != "" {
+		options["id_lt"] = []string{beforeID}
+	}
+
+	response, err := s.client.Channel(channelType, channelID).GetReplies(ctx, parentID, options)
+	if err != nil {
+		return nil, err
+	}
+	return streamMessagesFromSDK(response.Messages), nil
+}
+
+// streamMessagesFromSDK converts Stream SDK messages to the shape webhooks deliver them in
+func streamMessagesFromSDK(messages []*stream.Message) []StreamMessage {
+	converted := make([]StreamMessage, 0, len(messages))
+	for _, message := range messages {
+		m := StreamMessage{
+			ID:         message.ID,
+			Text:       message.Text,
+			HTML:       message.HTML,
+			Type:       string(message.Type),
+			ParentID:   message.ParentID,
+			ReplyCount: message.ReplyCount,
+		}
+		if message.User != nil {
+			m.User = StreamUser{
+				ID:    message.User.ID,
+				Name:  message.User.Name,
+				Image: message.User.Image,
+				Role:  message.User.Role,
+			}
+		}
+		for _, attachment := range message.Attachments {
+			m.Attachments = append(m.Attachments, StreamAttachment{
+				Type:     attachment.Type,
+				Title:    attachment.Title,
+				Text:     attachment.Text,
+				ImageURL: attachment.ImageURL,
+				ThumbURL: attachment.ThumbURL,
+				AssetURL: attachment.AssetURL,
+			})
+		}
+		if message.CreatedAt != nil {
+			m.CreatedAt = message.CreatedAt.Format(time.RFC3339Nano)
+		}
+		if message.UpdatedAt != nil {
+			m.UpdatedAt = message.UpdatedAt.Format(time.RFC3339Nano)
+		}
+		if message.DeletedAt != nil {
+			m.DeletedAt = message.DeletedAt.Format(time.RFC3339Nano)
+		}
+		converted = append(converted, m)
+	}
+	return converted
+}
+
+// toStreamAttachment converts an attachment to the Stream SDK's. The SDK has no fields for
+// action buttons, form fields, fallback text or colour, so those go in ExtraData, which the
+// SDK sends as top-level attachment fields.
+func toStreamAttachment(attachment StreamAttachment) *stream.Attachment {
+	converted := &stream.Attachment{
+		Type:        attachment.Type,
+		Text:        attachment.Text,
+		Title:       attachment.Title,
+		TitleLink:   attachment.TitleLink,
+		ImageURL:    attachment.ImageURL,
+		ThumbURL:    attachment.ThumbURL,
+		AssetURL:    attachment.AssetURL,
+		OGScrapeURL: attachment.OgScrapeURL,
+		ExtraData:   make(map[string]interface{}),
+	}
+	if attachment.Fallback != "" {
+		converted.ExtraData["fallback"] = attachment.Fallback
+	}
+	if attachment.Color != "" {
+		converted.ExtraData["color"] = attachment.Color
+	}
+	if len(attachment.Actions) > 0 {
+		converted.ExtraData["actions"] = attachment.Actions
+	}
+	if len(attachment.Fields) > 0 {
+		converted.ExtraData["fields"] = attachment.Fields
+	}
+	return converted
+}
+
 // configureWebhook configures the webhook URL in Stream Chat app settings
 func (s *StreamService) configureWebhook() {
 	webhookBaseURL := os.Getenv("WEBHOOK_BASE_URL")
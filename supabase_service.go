@@ -6,12 +6,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	supa "github.com/supabase-community/supabase-go"
 )
 
-// SupabaseService handles Supabase database operations
+// SupabaseService handles Supabase database operations; it is the PostgREST UserRepository
 type SupabaseService struct {
 	client *supa.Client
 	url    string
@@ -32,45 +33,27 @@ func NewSupabaseService(url, key string) (*SupabaseService, error) {
 	}, nil
 }
 
-// queryUsersByField retrieves users by a specific field using direct HTTP
+// queryUsersByField retrieves the user whose field equals a value
 func (s *SupabaseService) queryUsersByField(field, value string) (*User, error) {
-	url := fmt.Sprintf("%s/rest/v1/users?%s=eq.%s", s.url, field, value)
-	
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	
-	req.Header.Set("apikey", s.key)
-	req.Header.Set("Authorization", "Bearer "+s.key)
-	req.Header.Set("Content-Type", "application/json")
-	
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	body, err := io.ReadAll(resp.Body)
+	return s.queryUser(NewPostgRESTQuery("users").Eq(field, value))
+}
+
+// queryUser returns the first user matching a query, or nil if there is none
+func (s *SupabaseService) queryUser(query *PostgRESTQuery) (*User, error) {
+	body, _, err := s.doRequest("GET", query, nil, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, err
 	}
-	
+
 	var users []User
-	err = json.Unmarshal(body, &users)
-	if err != nil {
+	if err := json.Unmarshal(body, &users); err != nil {
 		return nil, fmt.Errorf("failed to decode user: %w", err)
 	}
-	
+
 	if len(users) == 0 {
 		return nil, nil // User not found
 	}
-	
+
 	return &users[0], nil
 }
 
@@ -79,9 +62,36 @@ func (s *SupabaseService) GetUserByUsername(username string) (*User, error) {
 	return s.queryUsersByField("username", username)
 }
 
-// GetUserByWallet retrieves a user by wallet address
-func (s *SupabaseService) GetUserByWallet(walletAddress string) (*User, error) {
-	return s.queryUsersByField("wallet_address", walletAddress)
+// GetUserByWallet retrieves the user a wallet is linked to, by chain and normalized address
+func (s *SupabaseService) GetUserByWallet(wallet WalletIdentity) (*User, error) {
+	identity, err := s.GetIdentity(IdentityProvider(wallet.Chain), wallet.Address)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		return s.GetUserByID(identity.UserID)
+	}
+
+	// Fall back to the primary wallet column for users created before identities existed
+	user, err := s.queryUser(NewPostgRESTQuery("users").Eq("chain_type", string(wallet.Chain)).Eq("wallet_address", wallet.Address))
+	if err != nil || user != nil || wallet.Chain != ChainEVM {
+		return user, err
+	}
+
+	// Rows from before chain_type existed are EVM wallets in whatever case they were
+	// registered in. Claim them for EVM on first sign-in, as migration 0001 does.
+	legacy, err := s.queryUser(NewPostgRESTQuery("users").IsNull("chain_type").ILike("wallet_address", wallet.Address))
+	if err != nil || legacy == nil {
+		return nil, err
+	}
+	backfill := NewPostgRESTQuery("users").Eq("id", legacy.ID).IsNull("chain_type")
+	updates := map[string]interface{}{"chain_type": string(ChainEVM), "wallet_address": wallet.Address}
+	if _, _, err := s.doRequest("PATCH", backfill, updates, ""); err != nil {
+		return nil, fmt.Errorf("failed to backfill legacy wallet: %w", err)
+	}
+	legacy.ChainType = ChainEVM
+	legacy.WalletAddress = wallet.Address
+	return legacy, nil
 }
 
 // GetUserByID retrieves a user by ID
@@ -93,7 +103,7 @@ func (s *SupabaseService) GetUserByID(id string) (*User, error) {
 func (s *SupabaseService) CreateUserWithUpsert(user *User) (*User, error) {
 	// First check if user with wallet address already exists
 	if user.WalletAddress != "" {
-		existingUser, err := s.GetUserByWallet(user.WalletAddress)
+		existingUser, err := s.GetUserByWallet(WalletIdentity{Chain: user.ChainType, Address: user.WalletAddress})
 		if err != nil {
 			// Continue with creation attempt
 		} else if existingUser != nil {
@@ -133,6 +143,10 @@ func (s *SupabaseService) createUserInternal(user *User) (*User, error) {
 	}
 	if user.WalletAddress != "" {
 		userData["wallet_address"] = user.WalletAddress
+		userData["chain_type"] = user.ChainType
+	}
+	if user.Role != "" {
+		userData["role"] = user.Role
 	}
 	if user.ProfilePicURL != "" {
 		userData["profile_pic_url"] = user.ProfilePicURL
@@ -184,8 +198,23 @@ func (s *SupabaseService) createUserInternal(user *User) (*User, error) {
 	if len(createdUsers) == 0 {
 		return nil, fmt.Errorf("user creation failed - no data returned")
 	}
+	createdUser := &createdUsers[0]
+	
+	// Every wallet a user signs in with is also a linked identity
+	if createdUser.WalletAddress != "" {
+		err := s.CreateIdentity(&Identity{
+			ID:        uuid.New().String(),
+			UserID:    createdUser.ID,
+			Provider:  IdentityProvider(createdUser.ChainType),
+			Subject:   createdUser.WalletAddress,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 	
-	return &createdUsers[0], nil
+	return createdUser, nil
 }
 
 // UpdateUser updates an existing user using direct HTTP
@@ -199,49 +228,20 @@ func (s *SupabaseService) UpdateUser(id string, updates map[string]interface{})
 		return nil, err
 	}
 	
-	updatesJSON, err := json.Marshal(updates)
+	body, _, err := s.doRequest("PATCH", NewPostgRESTQuery("users").Eq("id", id), updates, "return=representation")
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal updates: %w", err)
+		return nil, fmt.Errorf("update failed: %w", err)
 	}
-	
-	url := fmt.Sprintf("%s/rest/v1/users?id=eq.%s", s.url, id)
-	
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(updatesJSON))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	
-	req.Header.Set("apikey", s.key)
-	req.Header.Set("Authorization", "Bearer "+s.key)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation")
-	
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("update failed with status %d: %s", resp.StatusCode, string(body))
-	}
-	
+
 	var updatedUsers []User
-	err = json.Unmarshal(body, &updatedUsers)
-	if err != nil {
+	if err := json.Unmarshal(body, &updatedUsers); err != nil {
 		return nil, fmt.Errorf("failed to decode updated user: %w", err)
 	}
-	
+
 	if len(updatedUsers) == 0 {
 		return nil, fmt.Errorf("user not found")
 	}
-	
+
 	return &updatedUsers[0], nil
 }
 
@@ -251,56 +251,751 @@ func (s *SupabaseService) GetUsersExcluding(excludeUserID string, limit int) ([]
 		limit = 10 // Default limit
 	}
 	
-	url := fmt.Sprintf("%s/rest/v1/users?id=neq.%s&limit=%d", s.url, excludeUserID, limit)
-	
-	req, err := http.NewRequest("GET", url, nil)
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("users").Neq("id", excludeUserID).Limit(limit), nil, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
+	}
+
+	var users []User
+	if err := json.Unmarshal(body, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode users: %w", err)
+	}
+
+	return users, nil
+}
+
+// UserExists checks if a user exists by wallet only (usernames are not unique)
+func (s *SupabaseService) UserExists(wallet WalletIdentity) (bool, error) {
+	// Only check wallet address for uniqueness, not username
+	if wallet.Address != "" {
+		user, err := s.GetUserByWallet(wallet)
+		if err != nil {
+			return false, err
+		}
+		if user != nil {
+			return true, nil
+		}
+		return false, nil
 	}
 	
+	// If no wallet address provided, user doesn't exist (we need wallet for uniqueness)
+	return false, nil
+}
+
+// Ping checks that the users table can be queried
+func (s *SupabaseService) Ping() error {
+	if _, _, err := s.doRequest("GET", NewPostgRESTQuery("users").Select("id").Limit(1), nil, ""); err != nil {
+		return fmt.Errorf("failed to reach Supabase: %w", err)
+	}
+	return nil
+}
+
+// doRequest sends a PostgREST request for a query and returns the raw body
+func (s *SupabaseService) doRequest(method string, query *PostgRESTQuery, payload interface{}, prefer string) ([]byte, int, error) {
+	path, err := query.Path()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var reqBody io.Reader
+	if payload != nil {
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		reqBody = bytes.NewBuffer(payloadJSON)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/rest/v1/%s", s.url, path), reqBody)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
 	req.Header.Set("apikey", s.key)
 	req.Header.Set("Authorization", "Bearer "+s.key)
 	req.Header.Set("Content-Type", "application/json")
-	
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, 0, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
-	
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
 	}
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, resp.StatusCode, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
 	}
-	
-	var users []User
-	err = json.Unmarshal(body, &users)
+
+	return body, resp.StatusCode, nil
+}
+
+// CreateNonce stores a new sign-in nonce
+func (s *SupabaseService) CreateNonce(nonce *AuthNonce) error {
+	_, _, err := s.doRequest("POST", NewPostgRESTQuery("auth_nonces"), map[string]interface{}{
+		"nonce":      nonce.Nonce,
+		"domain":     nonce.Domain,
+		"chain_type": nonce.ChainType,
+		"chain_id":   nonce.ChainID,
+		"expires_at": nonce.ExpiresAt.UTC().Format(time.RFC3339),
+	}, "return=minimal")
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode users: %w", err)
+		return fmt.Errorf("failed to store nonce: %w", err)
 	}
-	
-	return users, nil
+	return nil
 }
 
-// UserExists checks if a user exists by wallet address only (usernames are not unique)
-func (s *SupabaseService) UserExists(username, walletAddress string) (bool, error) {
-	// Only check wallet address for uniqueness, not username
-	if walletAddress != "" {
-		user, err := s.GetUserByWallet(walletAddress)
-		if err != nil {
-			return false, err
-		}
-		if user != nil {
-			return true, nil
+// ConsumeNonce atomically deletes a nonce and returns it, or nil if it was never issued or already used
+func (s *SupabaseService) ConsumeNonce(nonce string) (*AuthNonce, error) {
+	body, _, err := s.doRequest("DELETE", NewPostgRESTQuery("auth_nonces").Eq("nonce", nonce), nil, "return=representation")
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume nonce: %w", err)
+	}
+
+	var nonces []AuthNonce
+	if err := json.Unmarshal(body, &nonces); err != nil {
+		return nil, fmt.Errorf("failed to decode nonce: %w", err)
+	}
+
+	if len(nonces) == 0 {
+		return nil, nil
+	}
+
+	return &nonces[0], nil
+}
+
+// DeleteExpiredNonces removes nonces that can no longer be used
+func (s *SupabaseService) DeleteExpiredNonces() error {
+	cutoff := time.Now().UTC().Format(time.RFC3339)
+	_, _, err := s.doRequest("DELETE", NewPostgRESTQuery("auth_nonces").Lt("expires_at", cutoff), nil, "return=minimal")
+	return err
+}
+
+// CreateSession stores a new login session
+func (s *SupabaseService) CreateSession(session *Session) error {
+	_, _, err := s.doRequest("POST", NewPostgRESTQuery("sessions"), map[string]interface{}{
+		"id":           session.ID,
+		"user_id":      session.UserID,
+		"user_agent":   session.UserAgent,
+		"ip_address":   session.IPAddress,
+		"last_used_at": session.CreatedAt.Format(time.RFC3339),
+		"expires_at":   session.ExpiresAt.Format(time.RFC3339),
+	}, "return=minimal")
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// GetSession retrieves a session by ID
+func (s *SupabaseService) GetSession(id string) (*Session, error) {
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("sessions").Eq("id", id), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var sessions []Session
+	if err := json.Unmarshal(body, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+
+	return &sessions[0], nil
+}
+
+// ListActiveSessions retrieves a user's sessions that are neither revoked nor expired
+func (s *SupabaseService) ListActiveSessions(userID string) ([]Session, error) {
+	query := NewPostgRESTQuery("sessions").
+		Eq("user_id", userID).
+		IsNull("revoked_at").
+		Gt("expires_at", time.Now().UTC().Format(time.RFC3339)).
+		Order("last_used_at", false)
+
+	body, _, err := s.doRequest("GET", query, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var sessions []Session
+	if err := json.Unmarshal(body, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records session activity and extends its expiry
+func (s *SupabaseService) TouchSession(id string, lastUsedAt, expiresAt time.Time) error {
+	_, _, err := s.doRequest("PATCH", NewPostgRESTQuery("sessions").Eq("id", id), map[string]interface{}{
+		"last_used_at": lastUsedAt.Format(time.RFC3339),
+		"expires_at":   expiresAt.Format(time.RFC3339),
+	}, "return=minimal")
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// RevokeSession revokes a session unless it is already revoked
+func (s *SupabaseService) RevokeSession(id, reason string) error {
+	return s.revokeSessions("id", id, reason)
+}
+
+// RevokeUserSessions revokes every not yet revoked session of a user
+func (s *SupabaseService) RevokeUserSessions(userID, reason string) error {
+	return s.revokeSessions("user_id", userID, reason)
+}
+
+// revokeSessions revokes all not yet revoked sessions where field equals value
+func (s *SupabaseService) revokeSessions(field, value, reason string) error {
+	query := NewPostgRESTQuery("sessions").Eq(field, value).IsNull("revoked_at")
+	_, _, err := s.doRequest("PATCH", query, map[string]interface{}{
+		"revoked_at":    time.Now().UTC().Format(time.RFC3339),
+		"revoke_reason": reason,
+	}, "return=minimal")
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// CreateRefreshToken stores the hash of a newly issued refresh token
+func (s *SupabaseService) CreateRefreshToken(token *RefreshToken) error {
+	_, _, err := s.doRequest("POST", NewPostgRESTQuery("refresh_tokens"), map[string]interface{}{
+		"token_hash": token.TokenHash,
+		"session_id": token.SessionID,
+		"expires_at": token.ExpiresAt.Format(time.RFC3339),
+	}, "return=minimal")
+	if err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token by its hash
+func (s *SupabaseService) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("refresh_tokens").Eq("token_hash", tokenHash), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	var tokens []RefreshToken
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode refresh token: %w", err)
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	return &tokens[0], nil
+}
+
+// MarkRefreshTokenUsed marks an unused refresh token as used, reporting whether this call claimed it
+func (s *SupabaseService) MarkRefreshTokenUsed(tokenHash string) (bool, error) {
+	query := NewPostgRESTQuery("refresh_tokens").Eq("token_hash", tokenHash).IsNull("used_at")
+	body, _, err := s.doRequest("PATCH", query, map[string]interface{}{
+		"used_at": time.Now().UTC().Format(time.RFC3339),
+	}, "return=representation")
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+
+	var tokens []RefreshToken
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return false, fmt.Errorf("failed to decode refresh token: %w", err)
+	}
+
+	return len(tokens) > 0, nil
+}
+
+// CreateAPIKey stores a new API key
+func (s *SupabaseService) CreateAPIKey(key *APIKey) error {
+	data := map[string]interface{}{
+		"id":         key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"key_hash":   key.KeyHash,
+		"scopes":     key.Scopes,
+		"created_at": key.CreatedAt.Format(time.RFC3339),
+	}
+	if key.CreatedBy != "" {
+		data["created_by"] = key.CreatedBy
+	}
+	if key.ExpiresAt != nil {
+		data["expires_at"] = key.ExpiresAt.Format(time.RFC3339)
+	}
+
+	if _, _, err := s.doRequest("POST", NewPostgRESTQuery("api_keys"), data, "return=minimal"); err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its raw value
+func (s *SupabaseService) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("api_keys").Eq("key_hash", keyHash), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode API key: %w", err)
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	return &keys[0], nil
+}
+
+// ListAPIKeys retrieves every API key, newest first
+func (s *SupabaseService) ListAPIKeys() ([]APIKey, error) {
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("api_keys").Order("created_at", false), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key, reporting false if it was missing or already revoked
+func (s *SupabaseService) RevokeAPIKey(id string) (bool, error) {
+	query := NewPostgRESTQuery("api_keys").Eq("id", id).IsNull("revoked_at")
+	body, _, err := s.doRequest("PATCH", query, map[string]interface{}{
+		"revoked_at": time.Now().UTC().Format(time.RFC3339),
+	}, "return=representation")
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return false, fmt.Errorf("failed to decode API key: %w", err)
+	}
+
+	return len(keys) > 0, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *SupabaseService) TouchAPIKey(id string, lastUsedAt time.Time) error {
+	_, _, err := s.doRequest("PATCH", NewPostgRESTQuery("api_keys").Eq("id", id), map[string]interface{}{
+		"last_used_at": lastUsedAt.Format(time.RFC3339),
+	}, "return=minimal")
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	return nil
+}
+
+// CreateIdentity links an identity to a user, failing with ErrIdentityInUse if it is already linked
+func (s *SupabaseService) CreateIdentity(identity *Identity) error {
+	_, status, err := s.doRequest("POST", NewPostgRESTQuery("identities"), map[string]interface{}{
+		"id":         identity.ID,
+		"user_id":    identity.UserID,
+		"provider":   identity.Provider,
+		"subject":    identity.Subject,
+		"created_at": identity.CreatedAt.Format(time.RFC3339),
+	}, "return=minimal")
+	if status == http.StatusConflict {
+		return ErrIdentityInUse
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+	return nil
+}
+
+// GetIdentity retrieves an identity by provider and normalized subject
+func (s *SupabaseService) GetIdentity(provider IdentityProvider, subject string) (*Identity, error) {
+	query := NewPostgRESTQuery("identities").Eq("provider", string(provider)).Eq("subject", subject)
+	body, _, err := s.doRequest("GET", query, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	var identities []Identity
+	if err := json.Unmarshal(body, &identities); err != nil {
+		return nil, fmt.Errorf("failed to decode identity: %w", err)
+	}
+
+	if len(identities) == 0 {
+		return nil, nil
+	}
+
+	return &identities[0], nil
+}
+
+// ListIdentities retrieves every identity linked to a user, oldest first
+func (s *SupabaseService) ListIdentities(userID string) ([]Identity, error) {
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("identities").Eq("user_id", userID).Order("created_at", true), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+
+	var identities []Identity
+	if err := json.Unmarshal(body, &identities); err != nil {
+		return nil, fmt.Errorf("failed to decode identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// DeleteIdentity unlinks one of a user's identities, reporting false if it was not found and
+// ErrLastIdentity if it is their only one. The delete_identity function counts and deletes in
+// one statement, so concurrent unlinks can't leave the user without an identity.
+func (s *SupabaseService) DeleteIdentity(userID, identityID string) (bool, error) {
+	body, _, err := s.doRequest("POST", NewPostgRESTRPC("delete_identity"), map[string]string{
+		"p_user_id":     userID,
+		"p_identity_id": identityID,
+	}, "")
+	if err != nil {
+		return false, fmt.Errorf("failed to delete identity: %w", err)
+	}
+
+	var result string
+	if err := json.Unmarshal(body, &result); err != nil {
+		return false, fmt.Errorf("failed to decode delete_identity result: %w", err)
+	}
+	return deleteIdentityResult(result)
+}
+
+// SaveEmailVerification stores a pending email code, replacing any earlier one for the same user and email
+func (s *SupabaseService) SaveEmailVerification(verification *EmailVerification) error {
+	_, _, err := s.doRequest("POST", NewPostgRESTQuery("email_verifications").OnConflict("user_id", "email"), map[string]interface{}{
+		"user_id":    verification.UserID,
+		"email":      verification.Email,
+		"code_hash":  verification.CodeHash,
+		"expires_at": verification.ExpiresAt.Format(time.RFC3339),
+	}, "resolution=merge-duplicates,return=minimal")
+	if err != nil {
+		return fmt.Errorf("failed to store email verification: %w", err)
+	}
+	return nil
+}
+
+// ConsumeEmailVerification atomically deletes and returns a pending email code, or nil if there is none
+func (s *SupabaseService) ConsumeEmailVerification(userID, email string) (*EmailVerification, error) {
+	query := NewPostgRESTQuery("email_verifications").Eq("user_id", userID).Eq("email", email)
+	body, _, err := s.doRequest("DELETE", query, nil, "return=representation")
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume email verification: %w", err)
+	}
+
+	var verifications []EmailVerification
+	if err := json.Unmarshal(body, &verifications); err != nil {
+		return nil, fmt.Errorf("failed to decode email verification: %w", err)
+	}
+
+	if len(verifications) == 0 {
+		return nil, nil
+	}
+
+	return &verifications[0], nil
+}
+
+// DeleteUserRow deletes a user; sessions, identities and other owned rows cascade
+func (s *SupabaseService) DeleteUserRow(id string) error {
+	if _, _, err := s.doRequest("DELETE", NewPostgRESTQuery("users").Eq("id", id), nil, "return=minimal"); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// DeleteIdentities unlinks every identity of a user
+func (s *SupabaseService) DeleteIdentities(userID string) error {
+	if _, _, err := s.doRequest("DELETE", NewPostgRESTQuery("identities").Eq("user_id", userID), nil, "return=minimal"); err != nil {
+		return fmt.Errorf("failed to delete identities: %w", err)
+	}
+	return nil
+}
+
+// CreateHandshake stores a handshake event
+func (s *SupabaseService) CreateHandshake(event *HandshakeEvent) error {
+	if _, _, err := s.doRequest("POST", NewPostgRESTQuery("handshakes"), event, "return=minimal"); err != nil {
+		return fmt.Errorf("failed to store handshake: %w", err)
+	}
+	return nil
+}
+
+// ListHandshakes retrieves the handshakes a user sent or received, oldest first
+func (s *SupabaseService) ListHandshakes(userID string) ([]HandshakeEvent, error) {
+	query := NewPostgRESTQuery("handshakes").
+		Or(EqFilter("from_uid", userID), EqFilter("to_uid", userID)).
+		Order("timestamp", true)
+
+	body, _, err := s.doRequest("GET", query, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list handshakes: %w", err)
+	}
+
+	var events []HandshakeEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode handshakes: %w", err)
+	}
+
+	return events, nil
+}
+
+// DeleteHandshakes deletes the handshakes a user sent or received
+func (s *SupabaseService) DeleteHandshakes(userID string) error {
+	query := NewPostgRESTQuery("handshakes").Or(EqFilter("from_uid", userID), EqFilter("to_uid", userID))
+	if _, _, err := s.doRequest("DELETE", query, nil, "return=minimal"); err != nil {
+		return fmt.Errorf("failed to delete handshakes: %w", err)
+	}
+	return nil
+}
+
+// SaveAccountDeletion creates or updates an account deletion job
+func (s *SupabaseService) SaveAccountDeletion(job *AccountDeletion) error {
+	_, _, err := s.doRequest("POST", NewPostgRESTQuery("account_deletions").OnConflict("user_id"), map[string]interface{}{
+		"user_id":         job.UserID,
+		"status":          job.Status,
+		"completed_steps": job.CompletedSteps,
+		"attempts":        job.Attempts,
+		"last_error":      job.LastError,
+		"created_at":      job.CreatedAt.Format(time.RFC3339),
+		"updated_at":      job.UpdatedAt.Format(time.RFC3339),
+	}, "resolution=merge-duplicates,return=minimal")
+	if err != nil {
+		return fmt.Errorf("failed to save account deletion: %w", err)
+	}
+	return nil
+}
+
+// GetAccountDeletion retrieves the deletion job of a user, or nil if there is none
+func (s *SupabaseService) GetAccountDeletion(userID string) (*AccountDeletion, error) {
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("account_deletions").Eq("user_id", userID), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account deletion: %w", err)
+	}
+
+	var jobs []AccountDeletion
+	if err := json.Unmarshal(body, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode account deletion: %w", err)
+	}
+
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	return &jobs[0], nil
+}
+
+// ListUnfinishedAccountDeletions retrieves deletion jobs that have not completed, oldest first
+func (s *SupabaseService) ListUnfinishedAccountDeletions() ([]AccountDeletion, error) {
+	query := NewPostgRESTQuery("account_deletions").Neq("status", DeletionCompleted).Order("created_at", true)
+	body, _, err := s.doRequest("GET", query, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list account deletions: %w", err)
+	}
+
+	var jobs []AccountDeletion
+	if err := json.Unmarshal(body, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode account deletions: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// GetConversationState retrieves a user's chatbot conversation state, or nil if there is none
+func (s *SupabaseService) GetConversationState(userID string) (*ConversationState, error) {
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("conversation_states").Eq("user_id", userID), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation state: %w", err)
+	}
+
+	var states []ConversationState
+	if err := json.Unmarshal(body, &states); err != nil {
+		return nil, fmt.Errorf("failed to decode conversation state: %w", err)
+	}
+
+	if len(states) == 0 {
+		return nil, nil
+	}
+
+	return &states[0], nil
+}
+
+// SaveConversationState creates or updates a user's chatbot conversation state
+func (s *SupabaseService) SaveConversationState(state *ConversationState) error {
+	row := map[string]interface{}{
+		"user_id":    state.UserID,
+		"state":      state.State,
+		"expires_at": nil,
+		"updated_at": state.UpdatedAt.Format(time.RFC3339),
+	}
+	if state.ExpiresAt != nil {
+		row["expires_at"] = state.ExpiresAt.Format(time.RFC3339)
+	}
+
+	_, _, err := s.doRequest("POST", NewPostgRESTQuery("conversation_states").OnConflict("user_id"), row,
+		"resolution=merge-duplicates,return=minimal")
+	if err != nil {
+		return fmt.Errorf("failed to save conversation state: %w", err)
+	}
+	return nil
+}
+
+// CreateMatchProposal stores a new match proposal, filling in its ID
+func (s *SupabaseService) CreateMatchProposal(proposal *MatchProposal) error {
+	body, _, err := s.doRequest("POST", NewPostgRESTQuery("match_proposals"), map[string]interface{}{
+		"user_id":          proposal.UserID,
+		"proposed_user_id": proposal.ProposedUserID,
+		"preferences":      proposal.Preferences,
+		"status":           proposal.Status,
+		"created_at":       proposal.CreatedAt.Format(time.RFC3339Nano),
+		"expires_at":       proposal.ExpiresAt.Format(time.RFC3339Nano),
+	}, "return=representation")
+	if err != nil {
+		return fmt.Errorf("failed to create match proposal: %w", err)
+	}
+
+	var created []MatchProposal
+	if err := json.Unmarshal(body, &created); err != nil {
+		return fmt.Errorf("failed to decode match proposal: %w", err)
+	}
+	if len(created) == 0 {
+		return fmt.Errorf("failed to create match proposal: no row returned")
+	}
+
+	proposal.ID = created[0].ID
+	return nil
+}
+
+// GetMatchProposal retrieves a match proposal by ID, or nil if there is none
+func (s *SupabaseService) GetMatchProposal(id string) (*MatchProposal, error) {
+	body, _, err := s.doRequest("GET", NewPostgRESTQuery("match_proposals").Eq("id", id), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get match proposal: %w", err)
+	}
+
+	var proposals []MatchProposal
+	if err := json.Unmarshal(body, &proposals); err != nil {
+		return nil, fmt.Errorf("failed to decode match proposal: %w", err)
+	}
+
+	if len(proposals) == 0 {
+		return nil, nil
+	}
+
+	return &proposals[0], nil
+}
+
+// GetOpenMatchProposal retrieves the newest open proposal to a user, or nil if there is none
+func (s *SupabaseService) GetOpenMatchProposal(userID string) (*MatchProposal, error) {
+	query := NewPostgRESTQuery("match_proposals").
+		Eq("user_id", userID).
+		Eq("status", ProposalProposed).
+		Order("created_at", false).
+		Limit(1)
+	body, _, err := s.doRequest("GET", query, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open match proposal: %w", err)
+	}
+
+	var proposals []MatchProposal
+	if err := json.Unmarshal(body, &proposals); err != nil {
+		return nil, fmt.Errorf("failed to decode match proposal: %w", err)
+	}
+
+	if len(proposals) == 0 {
+		return nil, nil
+	}
+
+	return &proposals[0], nil
+}
+
+// ListMatchProposals retrieves the proposals made to a user, newest first
+func (s *SupabaseService) ListMatchProposals(userID string) ([]MatchProposal, error) {
+	query := NewPostgRESTQuery("match_proposals").Eq("user_id", userID).Order("created_at", false)
+	body, _, err := s.doRequest("GET", query, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list match proposals: %w", err)
+	}
+
+	proposals := []MatchProposal{}
+	if err := json.Unmarshal(body, &proposals); err != nil {
+		return nil, fmt.Errorf("failed to decode match proposals: %w", err)
+	}
+
+	return proposals, nil
+}
+
+// ResolveMatchProposal records the answer to an open proposal, reporting whether it was still open
+func (s *SupabaseService) ResolveMatchProposal(id, status string, respondedAt time.Time) (bool, error) {
+	return s.updateMatchProposal(id, ProposalProposed, map[string]interface{}{
+		"status":       status,
+		"responded_at": respondedAt.Format(time.RFC3339Nano),
+	})
+}
+
+// RequestMatchConsent records that the user accepted an open proposal, reporting whether it was still open
+func (s *SupabaseService) RequestMatchConsent(id string, respondedAt, expiresAt time.Time) (bool, error) {
+	return s.updateMatchProposal(id, ProposalProposed, map[string]interface{}{
+		"status":       ProposalAwaitingConsent,
+		"responded_at": respondedAt.Format(time.RFC3339Nano),
+		"expires_at":   expiresAt.Format(time.RFC3339Nano),
+	})
+}
+
+// AnswerMatchConsent records the proposed user's answer, reporting whether the proposal still awaited it
+func (s *SupabaseService) AnswerMatchConsent(id, status string, respondedAt time.Time) (bool, error) {
+	return s.updateMatchProposal(id, ProposalAwaitingConsent, map[string]interface{}{
+		"status":               status,
+		"consent_responded_at": respondedAt.Format(time.RFC3339Nano),
+	})
+}
+
+// updateMatchProposal updates a proposal if it has the given status, reporting whether it did
+func (s *SupabaseService) updateMatchProposal(id, status string, updates map[string]interface{}) (bool, error) {
+	query := NewPostgRESTQuery("match_proposals").Eq("id", id).Eq("status", status)
+	body, _, err := s.doRequest("PATCH", query, updates, "return=representation")
+	if err != nil {
+		return false, fmt.Errorf("failed to update match proposal: %w", err)
+	}
+
+	var updated []MatchProposal
+	if err := json.Unmarshal(body, &updated); err != nil {
+		return false, fmt.Errorf("failed to decode match proposal: %w", err)
+	}
+
+	return len(updated) > 0, nil
+}
+
+// CancelMatchProposals cancels the proposals made to or about a user that await an answer.
+// Proposals awaiting consent keep the time the user accepted them.
+func (s *SupabaseService) CancelMatchProposals(userID string, cancelledAt time.Time) error {
+	for status, updates := range map[string]map[string]interface{}{
+		ProposalProposed: {
+			"status":       ProposalCancelled,
+			"responded_at": cancelledAt.Format(time.RFC3339Nano),
+		},
+		ProposalAwaitingConsent: {"status": ProposalCancelled},
+	} {
+		query := NewPostgRESTQuery("match_proposals").
+			Eq("status", status).
+			Or(EqFilter("user_id", userID), EqFilter("proposed_user_id", userID))
+		if _, _, err := s.doRequest("PATCH", query, updates, "return=minimal"); err != nil {
+			return fmt.Errorf("failed to cancel match proposals: %w", err)
 		}
-		return false, nil
 	}
-	
-	// If no wallet address provided, user doesn't exist (we need wallet for uniqueness)
-	return false, nil
-}
\ No newline at end of file
+	return nil
+}
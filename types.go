@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -19,9 +20,30 @@ const (
 	// Pagination defaults
 	DefaultMessageLimit = 50
 	DefaultContextLimit = 20
+	MaxMessageLimit     = 200
 	
 	// JWT settings
 	DefaultJWTSecret = "default-secret-key-change-in-production"
+	AccessTokenTTL   = 15 * time.Minute
+	RefreshTokenTTL  = 30 * 24 * time.Hour
+
+	// Sign-In with Ethereum settings
+	DefaultSIWEDomain    = "localhost:8080"
+	DefaultSIWEChainID   = 1
+	DefaultSolanaCluster = "mainnet"
+	NonceLength          = 16
+	NonceTTL             = 10 * time.Minute
+
+	// Linked identity settings
+	EmailCodeLength      = 6
+	EmailVerificationTTL = 15 * time.Minute
+
+	// Account deletion settings
+	DeletedUserID = "deleted-user" // Sender ID of anonymized messages
+
+	// API key settings
+	APIKeyPrefix        = "smk_"
+	APIKeyTouchInterval = time.Minute // Minimum gap between last_used_at writes
 )
 
 // ValidateUserFields validates user input fields
@@ -46,28 +68,56 @@ type User struct {
 	ID            string    `json:"id" db:"id"`
 	Username      string    `json:"username" db:"username"`
 	Name          string    `json:"name" db:"name"`
-	WalletAddress string    `json:"wallet_address,omitempty" db:"wallet_address"`
+	WalletAddress string    `json:"wallet_address,omitempty" db:"wallet_address"` // Normalized per chain, see WalletVerifier
+	ChainType     ChainType `json:"chain_type,omitempty" db:"chain_type"`
+	Role          Role      `json:"role,omitempty" db:"role"` // Only changeable through the admin role endpoint
 	ProfilePicURL string    `json:"profile_pic_url,omitempty" db:"profile_pic_url"`
 	Bio           string    `json:"bio,omitempty" db:"bio"`
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	// Set while the user is banned from the whole app in Stream Chat; a nil BanExpiresAt
+	// means until they are unbanned
+	BannedAt     *time.Time `json:"banned_at,omitempty" db:"banned_at"`
+	BanExpiresAt *time.Time `json:"ban_expires_at,omitempty" db:"ban_expires_at"`
+}
+
+// IsBanned reports whether the user is banned at a time
+func (u *User) IsBanned(at time.Time) bool {
+	return u.BannedAt != nil && (u.BanExpiresAt == nil || at.Before(*u.BanExpiresAt))
 }
 
 // LoginRequest represents the login request payload
 type LoginRequest struct {
-	WalletAddress string `json:"wallet_address" binding:"required"`
+	Message   string `json:"message" binding:"required"`   // EIP-4361 message issued for a nonce from /auth/nonce
+	Signature string `json:"signature" binding:"required"` // 0x-prefixed personal_sign signature of Message
 }
 
 // RegisterRequest represents the registration request payload
 type RegisterRequest struct {
 	Name          string `json:"name,omitempty"`
-	WalletAddress string `json:"wallet_address" binding:"required"`
+	Message       string `json:"message" binding:"required"`
+	Signature     string `json:"signature" binding:"required"`
 	ProfilePicURL string `json:"profile_pic_url,omitempty"`
 	Bio           string `json:"bio,omitempty"`
 }
 
-// TokenRequest represents the token generation request
-type TokenRequest struct {
-	UserID string `json:"user_id" binding:"required"`
+// AuthNonce represents a single-use sign-in nonce
+type AuthNonce struct {
+	Nonce     string    `json:"nonce" db:"nonce"`
+	Domain    string    `json:"domain" db:"domain"`
+	ChainType ChainType `json:"chain_type" db:"chain_type"`
+	ChainID   string    `json:"chain_id" db:"chain_id"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at,omitempty" db:"created_at"`
+}
+
+// NonceResponse represents the nonce a wallet must include in its SIWE message
+type NonceResponse struct {
+	Nonce     string    `json:"nonce"`
+	Domain    string    `json:"domain"`
+	ChainType ChainType `json:"chain_type"`
+	ChainID   string    `json:"chain_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // TokenResponse represents the token response
@@ -78,18 +128,262 @@ type TokenResponse struct {
 
 // AuthResponse represents the authentication response
 type AuthResponse struct {
-	User        User   `json:"user"`
-	Token       string `json:"token"`
-	StreamToken string `json:"stream_token"`
+	User         User      `json:"user"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // Access token expiry
+	StreamToken  string    `json:"stream_token"`
+}
+
+// TokenPair is a short-lived access token and the refresh token that renews it
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	SessionID    string    `json:"session_id"`
+}
+
+// ClientInfo describes the client a session was created from
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Session represents a login session; access tokens carry its ID so it can be revoked
+type Session struct {
+	ID           string     `json:"id" db:"id"`
+	UserID       string     `json:"user_id" db:"user_id"`
+	UserAgent    string     `json:"user_agent,omitempty" db:"user_agent"`
+	IPAddress    string     `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokeReason string     `json:"revoke_reason,omitempty" db:"revoke_reason"`
+	Current      bool       `json:"current"` // Set when listing: the session of the calling token
+}
+
+// RefreshToken represents a stored (hashed) refresh token
+type RefreshToken struct {
+	TokenHash string     `json:"token_hash" db:"token_hash"`
+	SessionID string     `json:"session_id" db:"session_id"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at,omitempty" db:"created_at"`
+}
+
+// RefreshRequest represents a token refresh request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest represents a logout request
+type LogoutRequest struct {
+	AllSessions bool `json:"all_sessions,omitempty"` // Revoke every session of the user, not just this one
+}
+
+// IdentityProvider names what an identity proves control of: a wallet chain or email
+type IdentityProvider string
+
+// ProviderEmail is the provider of email identities; wallet identities use their ChainType
+const ProviderEmail IdentityProvider = "email"
+
+// Identity is a wallet or email linked to a user; a user may have several
+type Identity struct {
+	ID        string           `json:"id" db:"id"`
+	UserID    string           `json:"user_id" db:"user_id"`
+	Provider  IdentityProvider `json:"provider" db:"provider"`
+	Subject   string           `json:"subject" db:"subject"` // Normalized wallet address or lowercase email
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+}
+
+// EmailVerification is a pending, single-use code proving control of an email address
+type EmailVerification struct {
+	UserID    string    `json:"user_id" db:"user_id"`
+	Email     string    `json:"email" db:"email"`
+	CodeHash  string    `json:"code_hash" db:"code_hash"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// LinkWalletRequest links another wallet to the logged-in user
+type LinkWalletRequest struct {
+	Message   string `json:"message" binding:"required"`   // SIWE/SIWS message signed by the new wallet
+	Signature string `json:"signature" binding:"required"` // Signature of Message
+}
+
+// LinkEmailRequest starts linking an email address to the logged-in user
+type LinkEmailRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// VerifyEmailRequest completes linking an email address with the code sent to it
+type VerifyEmailRequest struct {
+	Email string `json:"email" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// Account deletion job statuses
+const (
+	DeletionPending   = "pending"
+	DeletionRunning   = "running"
+	DeletionFailed    = "failed"
+	DeletionCompleted = "completed"
+)
+
+// AccountDeletion tracks a resumable account deletion; finished steps are skipped on retry
+type AccountDeletion struct {
+	UserID         string    `json:"user_id" db:"user_id"`
+	Status         string    `json:"status" db:"status"`
+	CompletedSteps []string  `json:"completed_steps" db:"completed_steps"`
+	Attempts       int       `json:"attempts" db:"attempts"`
+	LastError      string    `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Chatbot conversation states, see ConversationMachine
+const (
+	ConversationOnboarding     = "onboarding"      // Profile incomplete, not yet greeted
+	ConversationAwaitingName   = "awaiting_name"   // Asked for the user's name
+	ConversationAwaitingPhoto  = "awaiting_photo"  // Asked for a profile picture
+	ConversationIdle           = "idle"            // Profile complete, chatting
+	ConversationMatchProposed  = "match_proposed"  // Waiting for a yes or no to the open MatchProposal
+	ConversationMatchConfirmed = "match_confirmed" // Accepted the last proposal, which now awaits the other user
+)
+
+// ConversationState is where a user's conversation with the chatbot stands. Onboarding
+// states with an ExpiresAt fall back once it passes.
+type ConversationState struct {
+	UserID    string     `json:"user_id" db:"user_id"`
+	State     string     `json:"state" db:"state"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Match proposal statuses. Proposed proposals await the user, and awaiting_consent ones
+// the proposed user; a channel is only created once both accept.
+const (
+	ProposalProposed        = "proposed"
+	ProposalAwaitingConsent = "awaiting_consent" // The user accepted, the proposed user hasn't answered
+	ProposalAccepted        = "accepted"         // Both users accepted and were connected
+	ProposalDeclined        = "declined"         // The user declined
+	ProposalRejected        = "rejected"         // The proposed user declined
+	ProposalExpired         = "expired"          // Not answered before ExpiresAt
+	ProposalCancelled       = "cancelled"        // Either user left, was deleted or was banned
+)
+
+// MatchProposal is a user the chatbot suggested meeting, with both users' answers. Past
+// proposals are kept, so declined users aren't suggested again.
+type MatchProposal struct {
+	ID                 string     `json:"id" db:"id"`
+	UserID             string     `json:"user_id" db:"user_id"`
+	ProposedUserID     string     `json:"proposed_user_id" db:"proposed_user_id"`
+	Preferences        string     `json:"preferences,omitempty" db:"preferences"` // What the user asked for
+	Status             string     `json:"status" db:"status"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt          time.Time  `json:"expires_at" db:"expires_at"` // When the pending answer is due
+	RespondedAt        *time.Time `json:"responded_at,omitempty" db:"responded_at"`
+	ConsentRespondedAt *time.Time `json:"consent_responded_at,omitempty" db:"consent_responded_at"` // When the proposed user answered
+}
+
+// Job is a unit of background work in the job queue. A claimed job is leased to one worker
+// until LockedUntil; Attempts counts claims, including the current one.
+type Job struct {
+	ID          string          `json:"id" db:"id"`
+	Kind        string          `json:"kind" db:"kind"` // Selects the handler, see JobQueue.Handle
+	Payload     json.RawMessage `json:"payload" db:"payload" swaggertype:"object"`
+	Attempts    int             `json:"attempts" db:"attempts"`
+	MaxAttempts int             `json:"max_attempts" db:"max_attempts"`
+	RunAt       time.Time       `json:"run_at" db:"run_at"` // Not claimed before this
+	LockedUntil *time.Time      `json:"locked_until,omitempty" db:"locked_until"`
+	LastError   string          `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
+// DeadLetterJob is a job that failed every attempt
+type DeadLetterJob struct {
+	ID        string          `json:"id" db:"id"`
+	Kind      string          `json:"kind" db:"kind"`
+	Payload   json.RawMessage `json:"payload" db:"payload" swaggertype:"object"`
+	Attempts  int             `json:"attempts" db:"attempts"`
+	LastError string          `json:"last_error" db:"last_error"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+	FailedAt  time.Time       `json:"failed_at" db:"failed_at"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryQueued       = "queued"
+	DeliveryProcessed    = "processed"
+	DeliveryFailed       = "failed" // Will be retried
+	DeliveryDeadLettered = "dead_lettered"
+	DeliveryDuplicate    = "duplicate" // A retry of a webhook already queued, not processed again
+)
+
+// WebhookDelivery is a verified Stream Chat webhook as it was received, with the outcome of
+// processing it
+type WebhookDelivery struct {
+	ID          string            `json:"id" db:"id"`
+	WebhookID   string            `json:"webhook_id,omitempty" db:"webhook_id"` // X-Webhook-Id
+	EventType   string            `json:"event_type" db:"event_type"`
+	Headers     map[string]string `json:"headers" db:"headers"`
+	Body        string            `json:"body" db:"body"` // Raw request body
+	Status      string            `json:"status" db:"status"`
+	Attempts    int               `json:"attempts" db:"attempts"` // Processing attempts, replays included
+	ReplayCount int               `json:"replay_count" db:"replay_count"`
+	LastError   string            `json:"last_error,omitempty" db:"last_error"`
+	ReceivedAt  time.Time         `json:"received_at" db:"received_at"`
+	ProcessedAt *time.Time        `json:"processed_at,omitempty" db:"processed_at"`
+}
+
+// WebhookDeliveryFilter selects webhook deliveries, newest first. Empty fields match everything.
+type WebhookDeliveryFilter struct {
+	EventType string
+	Status    string
+	WebhookID string
+	Since     *time.Time // Received at or after
+	Until     *time.Time // Received at or before
+	Limit     int
+}
+
+// APIKey represents a hashed, scoped credential for service-to-service calls
+type APIKey struct {
+	ID         string       `json:"id" db:"id"`
+	Name       string       `json:"name" db:"name"`
+	Prefix     string       `json:"prefix" db:"prefix"` // First characters of the key, to tell keys apart
+	KeyHash    string       `json:"-" db:"key_hash"`
+	Scopes     []Permission `json:"scopes" db:"scopes"`
+	CreatedBy  string       `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt  *time.Time   `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// CreateAPIKeyRequest represents a request to create an API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0 means the key never expires
+}
+
+// CreateAPIKeyResponse returns a new API key; the raw key is never shown again
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
 }
 
 // StreamUserRequest represents the Stream user creation/update request
 type StreamUserRequest struct {
-	ID       string `json:"id" binding:"required"`
+	ID       string `json:"id,omitempty"` // Defaults to the authenticated user
 	Username string `json:"username" binding:"required"`
 	Name     string `json:"name" binding:"required"`
 	Image    string `json:"image,omitempty"`
-	Role     string `json:"role,omitempty"`
+}
+
+// UpdateRoleRequest represents an admin request to change a user's role
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"` // "user", "moderator" or "admin"
 }
 
 // Message represents a chat message in the system
@@ -103,21 +397,96 @@ type Message struct {
 	SenderUsername  string     `json:"sender_username" db:"sender_username"`
 	Type            string     `json:"type" db:"type"` // 'text', 'image', etc.
 	StreamMessageID *string    `json:"stream_message_id,omitempty" db:"stream_message_id"`
-	ReplyToID       *string    `json:"reply_to_id,omitempty" db:"reply_to_id"`
+	ReplyToID       *string    `json:"reply_to_id,omitempty" db:"reply_to_id"` // Root of the thread the message replies in
+	EditedAt        *time.Time `json:"edited_at,omitempty" db:"edited_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty" db:"deleted_at"` // Set on tombstones, whose text is cleared
+	DeletedBy       string     `json:"deleted_by,omitempty" db:"deleted_by"`
+	DeleteReason    string     `json:"delete_reason,omitempty" db:"delete_reason"`
+	ReplyCount      int        `json:"reply_count,omitempty" db:"-"` // Replies that aren't deleted, filled in for channel pages and threads
+}
+
+// MessageRevision is the text a message had before an edit or delete replaced it
+type MessageRevision struct {
+	ID          string    `json:"id" db:"id"`
+	MessageID   string    `json:"message_id" db:"message_id"`
+	SenderID    string    `json:"sender_id" db:"sender_id"` // Author of the message
+	MessageText string    `json:"message_text" db:"message_text"`
+	EditedBy    string    `json:"edited_by" db:"edited_by"` // Who replaced the text
+	EditedAt    time.Time `json:"edited_at" db:"edited_at"`
+}
+
+// MessageReaction is a reaction a user left on a message in Stream Chat
+type MessageReaction struct {
+	MessageID string    `json:"message_id" db:"message_id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Type      string    `json:"type" db:"type"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// MessageFlag is a user's report of a message to moderators in Stream Chat
+type MessageFlag struct {
+	MessageID string    `json:"message_id" db:"message_id"`
+	UserID    string    `json:"user_id" db:"user_id"` // Who flagged the message
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// MessagePageQuery selects a page of a channel's history or a thread's replies. With Before it returns the newest
+// messages older than the cursor, with After the oldest messages newer than it, and with
+// neither the newest messages.
+type MessagePageQuery struct {
+	Limit          int
+	Before         *MessageCursor
+	After          *MessageCursor
+	ExcludeDeleted bool // Leave out tombstones
+}
+
+// MessagePage is a page of channel messages, oldest first
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor,omitempty"` // Pass as after to get newer messages
+	PrevCursor string    `json:"prev_cursor,omitempty"` // Pass as before to get older messages
+	HasMore    bool      `json:"has_more"`              // More messages exist in the direction paged
+}
+
+// MessageThread is a message and a page of its replies, oldest first
+type MessageThread struct {
+	Parent     Message   `json:"parent"`
+	Replies    []Message `json:"replies"`
+	NextCursor string    `json:"next_cursor,omitempty"` // Pass as after to get newer replies
+	PrevCursor string    `json:"prev_cursor,omitempty"` // Pass as before to get older replies
+	HasMore    bool      `json:"has_more"`              // More replies exist in the direction paged
+}
+
+// ReplyRequest represents a request to reply in a message's thread
+type ReplyRequest struct {
+	MessageText string `json:"message_text" binding:"required"`
+}
+
+// EditMessageRequest represents a request to edit a message
+type EditMessageRequest struct {
+	MessageText string `json:"message_text" binding:"required"`
+}
+
+// DeleteMessageRequest represents a request to delete a message
+type DeleteMessageRequest struct {
+	Reason string `json:"reason,omitempty"` // Required when a moderator deletes another user's message
 }
 
 // ChatbotRequest represents a request to the chatbot
 type ChatbotRequest struct {
 	ChannelID string `json:"channel_id" binding:"required"`
 	Message   string `json:"message" binding:"required"`
-	UserID    string `json:"user_id" binding:"required"`
-	Model     string `json:"model,omitempty"` // "gpt-3.5-turbo" or "gpt-4", defaults to gpt-3.5-turbo
+	Model     string `json:"model,omitempty"`                                // "gpt-3.5-turbo" or "gpt-4", defaults to gpt-3.5-turbo
+	ReplyToID string `json:"reply_to_id,omitempty" binding:"omitempty,uuid"` // Reply in the thread of this message, using the thread as context
+	// Images sent with the message, such as the profile picture during onboarding
+	Attachments []StreamMessageAttachment `json:"attachments,omitempty"`
 }
 
 // ChatbotResponse represents a chatbot response
 type ChatbotResponse struct {
-	Response  string `json:"response"`
-	MessageID string `json:"message_id,omitempty"`
+	Response  string  `json:"response"`
+	MessageID string  `json:"message_id,omitempty"`
+	ReplyToID *string `json:"reply_to_id,omitempty"` // Thread the response was posted in
 }
 
 // ErrorResponse represents an error response
@@ -134,9 +503,29 @@ type StreamWebhookEvent struct {
 	User        *StreamUser            `json:"user,omitempty"`
 	CreatedAt   string                 `json:"created_at,omitempty"`
 	CID         string                 `json:"cid,omitempty"`
+	ChannelID   string                 `json:"channel_id,omitempty"`
+	Reaction    *StreamReaction        `json:"reaction,omitempty"`
+	Member      *StreamMember          `json:"member,omitempty"`
+	Reason      string                 `json:"reason,omitempty"`     // Given with bans
+	Expiration  string                 `json:"expiration,omitempty"` // When a timed ban ends
 	RequestInfo *StreamRequestInfo     `json:"request_info,omitempty"`
 }
 
+// StreamReaction represents a reaction from a Stream Chat webhook
+type StreamReaction struct {
+	MessageID string `json:"message_id"`
+	UserID    string `json:"user_id"`
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// StreamMember represents a channel member from a Stream Chat webhook
+type StreamMember struct {
+	UserID string      `json:"user_id"`
+	User   *StreamUser `json:"user,omitempty"`
+	Role   string      `json:"role,omitempty"`
+}
+
 // StreamMessage represents a message from Stream Chat webhook
 type StreamMessage struct {
 	ID          string             `json:"id"`
@@ -151,6 +540,9 @@ type StreamMessage struct {
 	Type        string             `json:"type"`
 	Command     string             `json:"command,omitempty"`
 	Args        string             `json:"args,omitempty"`
+	ParentID    string             `json:"parent_id,omitempty"` // Stream ID of the message this replies to in a thread
+	ReplyCount  int                `json:"reply_count,omitempty"`
+	DeletedAt   string             `json:"deleted_at,omitempty"`
 }
 
 // StreamUser represents a user from Stream Chat
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mr-tron/base58"
+)
+
+// ChainType identifies the blockchain family a wallet belongs to
+type ChainType string
+
+// Supported wallet chains
+const (
+	ChainEVM    ChainType = "evm"
+	ChainSolana ChainType = "solana"
+)
+
+// WalletIdentity is a wallet address qualified by the chain it lives on
+type WalletIdentity struct {
+	Chain   ChainType `json:"chain_type"`
+	Address string    `json:"wallet_address"` // Normalized form, see WalletVerifier.NormalizeAddress
+}
+
+// WalletVerifier validates addresses and signatures for one chain
+type WalletVerifier interface {
+	// NormalizeAddress returns the canonical stored form of an address, so the
+	// same wallet always maps to the same string regardless of how it was typed
+	NormalizeAddress(address string) (string, error)
+	// VerifySignature checks that signature is a valid signature of message by address
+	VerifySignature(address, message, signature string) error
+}
+
+// walletVerifiers maps each supported chain to its verifier
+var walletVerifiers = map[ChainType]WalletVerifier{
+	ChainEVM:    evmVerifier{},
+	ChainSolana: solanaVerifier{},
+}
+
+// GetWalletVerifier returns the verifier for a chain
+func GetWalletVerifier(chain ChainType) (WalletVerifier, error) {
+	verifier, ok := walletVerifiers[chain]
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain type %q", chain)
+	}
+	return verifier, nil
+}
+
+// NewWalletIdentity validates and normalizes an address for the given chain
+func NewWalletIdentity(chain ChainType, address string) (WalletIdentity, error) {
+	if chain == "" {
+		chain = ChainEVM
+	}
+
+	verifier, err := GetWalletVerifier(chain)
+	if err != nil {
+		return WalletIdentity{}, err
+	}
+
+	normalized, err := verifier.NormalizeAddress(address)
+	if err != nil {
+		return WalletIdentity{}, err
+	}
+
+	return WalletIdentity{Chain: chain, Address: normalized}, nil
+}
+
+// evmVerifier handles Ethereum and other EVM chains (secp256k1, EIP-191 personal_sign)
+type evmVerifier struct{}
+
+// NormalizeAddress lower-cases EVM addresses; EIP-55 casing is only a checksum
+func (evmVerifier) NormalizeAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if len(address) == 42 && strings.HasPrefix(address, "0X") {
+		address = "0x" + address[2:]
+	}
+	if !isHexAddress(address) {
+		return "", fmt.Errorf("invalid EVM address %q", address)
+	}
+	return strings.ToLower(address), nil
+}
+
+// VerifySignature recovers the signer of a personal_sign signature and compares addresses
+func (v evmVerifier) VerifySignature(address, message, signature string) error {
+	expected, err := v.NormalizeAddress(address)
+	if err != nil {
+		return err
+	}
+
+	recovered, err := RecoverEthereumAddress(message, signature)
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(recovered) != expected {
+		return fmt.Errorf("signature does not match address %s", address)
+	}
+	return nil
+}
+
+// solanaVerifier handles Solana wallets (ed25519 keys, base58 encoded)
+type solanaVerifier struct{}
+
+// NormalizeAddress re-encodes the decoded public key so the address is in canonical base58
+func (solanaVerifier) NormalizeAddress(address string) (string, error) {
+	pubKey, err := decodeSolanaPublicKey(address)
+	if err != nil {
+		return "", err
+	}
+	return base58.Encode(pubKey), nil
+}
+
+// VerifySignature checks a base58 encoded ed25519 signature of the raw message bytes
+func (solanaVerifier) VerifySignature(address, message, signature string) error {
+	pubKey, err := decodeSolanaPublicKey(address)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base58.Decode(strings.TrimSpace(signature))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature length %d", len(sig))
+	}
+
+	if !ed25519.Verify(pubKey, []byte(message), sig) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// decodeSolanaPublicKey decodes a base58 Solana address into an ed25519 public key
+func decodeSolanaPublicKey(address string) (ed25519.PublicKey, error) {
+	decoded, err := base58.Decode(strings.TrimSpace(address))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Solana address %q: %w", address, err)
+	}
+	if len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Solana address %q: wrong length", address)
+	}
+	return ed25519.PublicKey(decoded), nil
+}
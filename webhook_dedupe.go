@@ -0,0 +1,153 @@
+package main
+
+import (
+	"container/list"
+	"log"
+	"sync"
+	"time"
+)
+
+// Webhook deduplication defaults. Stream retries a failed webhook within minutes, so a day
+// covers every retry with room to spare.
+const (
+	webhookDedupeTTL      = 24 * time.Hour
+	webhookDedupeCapacity = 10000            // Webhook IDs the in-memory store keeps
+	webhookDedupePrune    = 10 * time.Minute // How often the persistent store deletes expired IDs
+)
+
+// WebhookDedupeStore remembers the IDs of webhooks that were processed, for TTL, so Stream's
+// retries of them can be acknowledged without processing them again. Stores are safe for
+// concurrent use.
+type WebhookDedupeStore interface {
+	// Claim records a webhook ID and reports whether this call recorded it, or false if it
+	// was claimed within the TTL. Of concurrent claims of one ID, only one succeeds.
+	Claim(webhookID string) (bool, error)
+	// Release forgets a claimed ID, so that a retry of a webhook that failed is processed
+	Release(webhookID string) error
+}
+
+// Compile-time checks that the dedupe stores implement WebhookDedupeStore
+var (
+	_ WebhookDedupeStore = (*LRUWebhookDedupeStore)(nil)
+	_ WebhookDedupeStore = (*PersistentWebhookDedupeStore)(nil)
+)
+
+// LRUWebhookDedupeStore keeps webhook IDs in memory, evicting expired IDs and, past its
+// capacity, the least recently recorded. IDs are lost on restart.
+type LRUWebhookDedupeStore struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List               // Front is the most recently recorded
+	entries  map[string]*list.Element // Values are *dedupeEntry
+}
+
+type dedupeEntry struct {
+	webhookID  string
+	recordedAt time.Time
+}
+
+// NewLRUWebhookDedupeStore creates an in-memory dedupe store holding at most capacity IDs
+func NewLRUWebhookDedupeStore(capacity int, ttl time.Duration) *LRUWebhookDedupeStore {
+	return &LRUWebhookDedupeStore{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Claim remembers a webhook ID unless it was recorded within the TTL, evicting the oldest
+// IDs past the store's capacity
+func (s *LRUWebhookDedupeStore) Claim(webhookID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictExpired()
+	if _, ok := s.entries[webhookID]; ok {
+		return false, nil
+	}
+
+	s.entries[webhookID] = s.order.PushFront(&dedupeEntry{webhookID: webhookID, recordedAt: time.Now()})
+	for s.order.Len() > s.capacity {
+		s.evict(s.order.Back())
+	}
+	return true, nil
+}
+
+// Release forgets a webhook ID
+func (s *LRUWebhookDedupeStore) Release(webhookID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[webhookID]; ok {
+		s.evict(element)
+	}
+	return nil
+}
+
+// evictExpired drops IDs older than the TTL, which are all at the back of the list. The
+// caller must hold the lock.
+func (s *LRUWebhookDedupeStore) evictExpired() {
+	cutoff := time.Now().Add(-s.ttl)
+	for element := s.order.Back(); element != nil; element = s.order.Back() {
+		if element.Value.(*dedupeEntry).recordedAt.After(cutoff) {
+			return
+		}
+		s.evict(element)
+	}
+}
+
+// evict drops one ID. The caller must hold the lock.
+func (s *LRUWebhookDedupeStore) evict(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*dedupeEntry).webhookID)
+}
+
+// PersistentWebhookDedupeStore keeps webhook IDs in the database, so they survive restarts
+// and are shared between replicas. Expired IDs are deleted every few minutes as IDs are
+// recorded.
+type PersistentWebhookDedupeStore struct {
+	webhookRepo WebhookRepository
+	ttl         time.Duration
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// NewPersistentWebhookDedupeStore creates a dedupe store on a webhook repository
+func NewPersistentWebhookDedupeStore(webhookRepo WebhookRepository, ttl time.Duration) *PersistentWebhookDedupeStore {
+	return &PersistentWebhookDedupeStore{
+		webhookRepo: webhookRepo,
+		ttl:         ttl,
+	}
+}
+
+// Claim remembers a webhook ID unless it was recorded within the TTL
+func (s *PersistentWebhookDedupeStore) Claim(webhookID string) (bool, error) {
+	now := time.Now()
+	claimed, err := s.webhookRepo.ClaimWebhook(webhookID, now, now.Add(-s.ttl))
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	prune := now.Sub(s.lastPruned) >= webhookDedupePrune
+	if prune {
+		s.lastPruned = now
+	}
+	s.mu.Unlock()
+
+	// Opportunistically clean up expired IDs
+	if prune {
+		if err := s.webhookRepo.DeleteProcessedWebhooks(now.Add(-s.ttl)); err != nil {
+			log.Printf("[WEBHOOK] Failed to delete expired webhook IDs: %v", err)
+		}
+	}
+	return claimed, nil
+}
+
+// Release forgets a webhook ID
+func (s *PersistentWebhookDedupeStore) Release(webhookID string) error {
+	return s.webhookRepo.ReleaseWebhook(webhookID)
+}
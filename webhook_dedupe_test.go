@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func dedupeStores() map[string]func(ttl time.Duration) WebhookDedupeStore {
+	return map[string]func(ttl time.Duration) WebhookDedupeStore{
+		"lru": func(ttl time.Duration) WebhookDedupeStore {
+			return NewLRUWebhookDedupeStore(100, ttl)
+		},
+		"persistent": func(ttl time.Duration) WebhookDedupeStore {
+			return NewPersistentWebhookDedupeStore(NewMemoryWebhookRepository(), ttl)
+		},
+	}
+}
+
+func TestWebhookDedupeClaimIsAtomic(t *testing.T) {
+	for name, newStore := range dedupeStores() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(time.Hour)
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			claims := 0
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					claimed, err := store.Claim("wh-1")
+					if err != nil {
+						t.Errorf("Claim: %v", err)
+					}
+					if claimed {
+						mu.Lock()
+						claims++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if claims != 1 {
+				t.Errorf("%d concurrent claims succeeded, want 1", claims)
+			}
+		})
+	}
+}
+
+func TestWebhookDedupeRelease(t *testing.T) {
+	for name, newStore := range dedupeStores() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(time.Hour)
+
+			if claimed, _ := store.Claim("wh-1"); !claimed {
+				t.Fatal("first Claim failed")
+			}
+			if err := store.Release("wh-1"); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+			if claimed, _ := store.Claim("wh-1"); !claimed {
+				t.Error("Claim after Release failed")
+			}
+		})
+	}
+}
+
+func TestWebhookDedupeClaimExpires(t *testing.T) {
+	for name, newStore := range dedupeStores() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(10 * time.Millisecond)
+
+			if claimed, _ := store.Claim("wh-1"); !claimed {
+				t.Fatal("first Claim failed")
+			}
+			if claimed, _ := store.Claim("wh-1"); claimed {
+				t.Error("second Claim within the TTL succeeded")
+			}
+			time.Sleep(20 * time.Millisecond)
+			if claimed, _ := store.Claim("wh-1"); !claimed {
+				t.Error("Claim after the TTL failed")
+			}
+		})
+	}
+}
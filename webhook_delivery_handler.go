@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookDeliveryHandler handles inspecting and replaying stored Stream Chat webhooks
+type WebhookDeliveryHandler struct {
+	deliveryService *WebhookDeliveryService
+}
+
+// NewWebhookDeliveryHandler creates a new webhook delivery handler
+func NewWebhookDeliveryHandler(deliveryService *WebhookDeliveryService) *WebhookDeliveryHandler {
+	return &WebhookDeliveryHandler{
+		deliveryService: deliveryService,
+	}
+}
+
+// ListDeliveries handles listing stored webhooks
+// @Summary List webhook deliveries
+// @Description List verified Stream Chat webhooks as they were received, newest first, with the outcome of processing them. Requires the users:admin permission.
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param event_type query string false "Only this event type, e.g. message.new"
+// @Param status query string false "Only this status (queued, processed, failed, dead_lettered, duplicate)"
+// @Param webhook_id query string false "Only deliveries with this X-Webhook-Id"
+// @Param since query string false "Only webhooks received at or after this RFC 3339 time"
+// @Param until query string false "Only webhooks received at or before this RFC 3339 time"
+// @Param limit query int false "Number of results (max 200)" default(50)
+// @Success 200 {array} WebhookDelivery "Webhook deliveries"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 500 {object} ErrorResponse "Failed to list deliveries"
+// @Router /admin/webhooks [get]
+func (h *WebhookDeliveryHandler) ListDeliveries(c *gin.Context) {
+	filter := WebhookDeliveryFilter{
+		EventType: c.Query("event_type"),
+		Status:    c.Query("status"),
+		WebhookID: c.Query("webhook_id"),
+	}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := parseIntParam(l); err == nil && parsed > 0 {
+			filter.Limit = parsed
+		}
+	}
+
+	for _, bound := range []struct {
+		param string
+		dst   **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_date",
+				Message: bound.param + " must be an RFC 3339 time, e.g. 2024-01-02T15:04:05Z",
+			})
+			return
+		}
+		*bound.dst = &t
+	}
+
+	deliveries, err := h.deliveryService.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "failed_to_list_deliveries",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayDelivery handles replaying a stored webhook
+// @Summary Replay webhook delivery
+// @Description Queue a stored webhook to be processed again through the event handlers, skipping webhook deduplication. Works for dead-lettered and processed webhooks alike. Requires the users:admin permission.
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param delivery_id path string true "Webhook delivery ID"
+// @Success 202 {object} Job "Replay queued"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden"
+// @Failure 404 {object} ErrorResponse "Delivery not found"
+// @Failure 500 {object} ErrorResponse "Failed to queue replay"
+// @Router /admin/webhooks/{delivery_id}/replay [post]
+func (h *WebhookDeliveryHandler) ReplayDelivery(c *gin.Context) {
+	job, err := h.deliveryService.Replay(c.Param("delivery_id"))
+	if err != nil {
+		if errors.Is(err, ErrDeliveryNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "delivery_not_found", Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "replay_failed", Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook delivery list limits
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+// streamWebhookJob is the kind of job that processes a stored Stream Chat webhook
+const streamWebhookJob = "stream_webhook"
+
+// ErrDeliveryNotFound is returned when a webhook delivery doesn't exist
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// webhookJobPayload is the payload of a stream_webhook job
+type webhookJobPayload struct {
+	DeliveryID string `json:"delivery_id"`
+	Replay     bool   `json:"replay,omitempty"`
+}
+
+// webhookReplayKey marks the context of handlers running for a replayed webhook
+type webhookReplayKey struct{}
+
+// IsWebhookReplay reports whether event handlers are running for a replayed webhook
+func IsWebhookReplay(ctx context.Context) bool {
+	replay, _ := ctx.Value(webhookReplayKey{}).(bool)
+	return replay
+}
+
+// WebhookDeliveryService stores verified Stream Chat webhooks, processes them on the job
+// queue through the dispatcher and records the outcome, and replays stored webhooks
+type WebhookDeliveryService struct {
+	webhookRepo WebhookRepository
+	dispatcher  *WebhookDispatcher
+	jobQueue    *JobQueue
+}
+
+// NewWebhookDeliveryService creates a webhook delivery service, registering webhook
+// processing with the job queue
+func NewWebhookDeliveryService(webhookRepo WebhookRepository, dispatcher *WebhookDispatcher, jobQueue *JobQueue) *WebhookDeliveryService {
+	s := &WebhookDeliveryService{
+		webhookRepo: webhookRepo,
+		dispatcher:  dispatcher,
+		jobQueue:    jobQueue,
+	}
+	jobQueue.Handle(streamWebhookJob, s.process)
+	return s
+}
+
+// Accept stores a verified webhook and queues it for processing
+func (s *WebhookDeliveryService) Accept(webhookID, eventType string, headers map[string]string, body []byte) (*WebhookDelivery, error) {
+	delivery, err := s.store(webhookID, eventType, headers, body, DeliveryQueued)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.jobQueue.Enqueue(streamWebhookJob, webhookJobPayload{DeliveryID: delivery.ID}); err != nil {
+		s.update(delivery.ID, map[string]interface{}{"status": DeliveryFailed, "last_error": err.Error()})
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// RecordDuplicate stores a verified webhook that won't be processed, because Stream resent
+// one that was already queued
+func (s *WebhookDeliveryService) RecordDuplicate(webhookID, eventType string, headers map[string]string, body []byte) error {
+	_, err := s.store(webhookID, eventType, headers, body, DeliveryDuplicate)
+	return err
+}
+
+// List returns the webhook deliveries matching a filter, newest first
+func (s *WebhookDeliveryService) List(filter WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultDeliveryLimit
+	}
+	if filter.Limit > maxDeliveryLimit {
+		filter.Limit = maxDeliveryLimit
+	}
+	return s.webhookRepo.ListWebhookDeliveries(filter)
+}
+
+// Replay queues a stored webhook to be processed again through the dispatcher. Replays
+// skip webhook deduplication and are marked in the logs.
+func (s *WebhookDeliveryService) Replay(deliveryID string) (*Job, error) {
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+	delivery, err := s.webhookRepo.GetWebhookDelivery(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, ErrDeliveryNotFound
+	}
+
+	err = s.webhookRepo.UpdateWebhookDelivery(delivery.ID, map[string]interface{}{
+		"status":       DeliveryQueued,
+		"replay_count": delivery.ReplayCount + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.jobQueue.Enqueue(streamWebhookJob, webhookJobPayload{DeliveryID: delivery.ID, Replay: true})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[WEBHOOK] [REPLAY] Queued replay %d of delivery %s (%s event) as job %s",
+		delivery.ReplayCount+1, delivery.ID, delivery.EventType, job.ID)
+	return job, nil
+}
+
+// process runs the dispatcher's handlers for a queued webhook and records the outcome
+func (s *WebhookDeliveryService) process(ctx context.Context, job *Job) error {
+	var payload webhookJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse job payload: %w", err)
+	}
+
+	delivery, err := s.webhookRepo.GetWebhookDelivery(payload.DeliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery == nil {
+		return fmt.Errorf("%w: %s", ErrDeliveryNotFound, payload.DeliveryID)
+	}
+
+	var event StreamWebhookEvent
+	if err := json.Unmarshal([]byte(delivery.Body), &event); err != nil {
+		return fmt.Errorf("failed to parse webhook payload: %w", err)
+	}
+
+	if payload.Replay {
+		ctx = context.WithValue(ctx, webhookReplayKey{}, true)
+		log.Printf("[WEBHOOK] [REPLAY] Replaying delivery %s (%s event), attempt %d",
+			delivery.ID, event.Type, job.Attempts)
+	}
+
+	err = s.dispatcher.Dispatch(ctx, &event)
+
+	updates := map[string]interface{}{"attempts": delivery.Attempts + 1}
+	switch {
+	case err == nil:
+		updates["status"] = DeliveryProcessed
+		updates["last_error"] = nil
+		updates["processed_at"] = time.Now().UTC()
+	case job.Attempts >= job.MaxAttempts:
+		updates["status"] = DeliveryDeadLettered
+		updates["last_error"] = err.Error()
+	default:
+		updates["status"] = DeliveryFailed
+		updates["last_error"] = err.Error()
+	}
+	s.update(delivery.ID, updates)
+	return err
+}
+
+// store saves a verified webhook with the given status
+func (s *WebhookDeliveryService) store(webhookID, eventType string, headers map[string]string, body []byte, status string) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{
+		WebhookID:  webhookID,
+		EventType:  eventType,
+		Headers:    headers,
+		Body:       string(body),
+		Status:     status,
+		ReceivedAt: time.Now().UTC(),
+	}
+	if err := s.webhookRepo.CreateWebhookDelivery(delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// update records a change to a delivery, logging failures: the outcome is for people
+// reading it later and must not fail the job
+func (s *WebhookDeliveryService) update(deliveryID string, updates map[string]interface{}) {
+	if err := s.webhookRepo.UpdateWebhookDelivery(deliveryID, updates); err != nil {
+		log.Printf("[WEBHOOK] Failed to update delivery %s: %v", deliveryID, err)
+	}
+}
+
+// runWebhookCommand implements the webhook command. `webhook replay --id <delivery-id>`
+// queues a stored webhook to be replayed by the server's job queue workers, through the
+// same dispatcher that processed it.
+func runWebhookCommand(args []string) int {
+	if len(args) == 0 || args[0] != "replay" {
+		fmt.Fprintln(os.Stderr, "usage: webhook replay --id <delivery-id> [--id <delivery-id>...]")
+		return 2
+	}
+
+	var ids deliveryIDs
+	flags := flag.NewFlagSet("webhook replay", flag.ContinueOnError)
+	flags.Var(&ids, "id", "ID of a stored webhook delivery to replay; repeat for several")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(os.Stderr, "webhook replay needs at least one --id")
+		return 2
+	}
+
+	config := StorageConfigFromEnv()
+	if config.Backend == StorageMemory {
+		fmt.Fprintln(os.Stderr, "webhook replay needs the supabase or postgres storage backend")
+		return 1
+	}
+
+	repos, err := OpenRepositories(context.Background(), config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer repos.Close()
+
+	// The workers of a running server pick the jobs up; this process only queues them
+	deliveryService := NewWebhookDeliveryService(repos.Webhooks, NewWebhookDispatcher(), NewJobQueue(repos.Jobs))
+	status := 0
+	queued := 0
+	for _, id := range ids {
+		job, err := deliveryService.Replay(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to queue replay of %s: %v\n", id, err)
+			status = 1
+			continue
+		}
+		fmt.Printf("queued replay of %s as job %s (not run yet)\n", id, job.ID)
+		queued++
+	}
+	if queued > 0 {
+		fmt.Printf("%d replay(s) queued only: they run when a server with job workers is running against this database\n", queued)
+	}
+	return status
+}
+
+// deliveryIDs collects repeated --id flags
+type deliveryIDs []string
+
+func (ids *deliveryIDs) String() string {
+	return strings.Join(*ids, ",")
+}
+
+func (ids *deliveryIDs) Set(value string) error {
+	*ids = append(*ids, value)
+	return nil
+}
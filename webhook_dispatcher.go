@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// StreamEventHandler handles one Stream Chat webhook event. Handlers may see the same event
+// more than once, when Stream retries a webhook, so they must be idempotent.
+type StreamEventHandler func(ctx context.Context, event *StreamWebhookEvent) error
+
+// WebhookDispatcher routes Stream Chat webhook events to the handlers registered for their type
+type WebhookDispatcher struct {
+	mu       sync.RWMutex
+	handlers map[string][]StreamEventHandler
+}
+
+// NewWebhookDispatcher creates a dispatcher with no handlers
+func NewWebhookDispatcher() *WebhookDispatcher {
+	return &WebhookDispatcher{
+		handlers: make(map[string][]StreamEventHandler),
+	}
+}
+
+// Register adds a handler for an event type. Handlers run in the order they were registered.
+func (d *WebhookDispatcher) Register(eventType string, handler StreamEventHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[eventType] = append(d.handlers[eventType], handler)
+}
+
+// Dispatch runs the handlers registered for an event's type, stopping at the first error.
+// Events with no handlers are ignored.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context, event *StreamWebhookEvent) error {
+	d.mu.RLock()
+	handlers := d.handlers[event.Type]
+	d.mu.RUnlock()
+
+	if len(handlers) == 0 {
+		log.Printf("[WEBHOOK] No handlers for event type %s", event.Type)
+		return nil
+	}
+
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			return fmt.Errorf("failed to handle %s event: %w", event.Type, err)
+		}
+	}
+	return nil
+}
@@ -10,30 +10,56 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sashabaranov/go-openai"
 )
 
 // WebhookHandler handles Stream Chat webhook events
 type WebhookHandler struct {
-	chatGPTService         *ChatGPTService
-	streamService          *StreamService
-	authService            *AuthService
-	processedWebhooks      map[string]bool  // Track processed webhook IDs for deduplication
-	pendingRecommendations map[string]*User // Track user recommendations pending confirmation
+	chatGPTService  *ChatGPTService
+	streamService   *StreamService
+	authService     *AuthService
+	dispatcher      *WebhookDispatcher
+	dedupeStore     WebhookDedupeStore
+	deliveryService *WebhookDeliveryService
+	conversations   *ConversationMachine
+	mirror          *StreamMirrorService
+	threadService   *MessageThreadService
 }
 
-// NewWebhookHandler creates a new webhook handler
-func NewWebhookHandler(chatGPTService *ChatGPTService, streamService *StreamService, authService *AuthService) *WebhookHandler {
-	return &WebhookHandler{
-		chatGPTService:         chatGPTService,
-		streamService:          streamService,
-		authService:            authService,
-		processedWebhooks:      make(map[string]bool),
-		pendingRecommendations: make(map[string]*User),
+// NewWebhookHandler creates a new webhook handler, registering its chatbot and matching
+// handlers with the dispatcher
+func NewWebhookHandler(chatGPTService *ChatGPTService, streamService *StreamService, authService *AuthService, dispatcher *WebhookDispatcher, dedupeStore WebhookDedupeStore, deliveryService *WebhookDeliveryService, conversations *ConversationMachine, mirror *StreamMirrorService, threadService *MessageThreadService) *WebhookHandler {
+	h := &WebhookHandler{
+		chatGPTService:  chatGPTService,
+		streamService:   streamService,
+		authService:     authService,
+		dispatcher:      dispatcher,
+		dedupeStore:     dedupeStore,
+		deliveryService: deliveryService,
+		conversations:   conversations,
+		mirror:          mirror,
+		threadService:   threadService,
 	}
+
+	dispatcher.Register("message.new", h.respondToMessage)
+	dispatcher.Register("user.deleted", h.cancelPendingMatches)
+	dispatcher.Register("user.banned", h.cancelPendingMatches)
+	return h
 }
 
 // HandleStreamWebhook processes incoming Stream Chat webhook events
+// @Summary Stream Chat webhook
+// @Description Receive a webhook from Stream Chat. The X-Signature header must be the hex HMAC-SHA256 of the body with the Stream secret. Verified events are stored and queued for the event handlers, and a retry of an X-Webhook-Id already queued is answered already_processed.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Param X-Signature header string true "HMAC-SHA256 of the body"
+// @Param X-Webhook-Id header string false "Stream's ID of the webhook, used to drop retries"
+// @Param request body StreamWebhookEvent true "Webhook event"
+// @Success 200 {object} object{status=string} "Webhook queued or already processed"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Invalid API key or signature"
+// @Failure 500 {object} ErrorResponse "Failed to queue event"
+// @Router /webhooks/stream [post]
 func (h *WebhookHandler) HandleStreamWebhook(c *gin.Context) {
 	log.Printf("[WEBHOOK] Incoming webhook request from %s", c.ClientIP())
 
@@ -42,13 +68,12 @@ func (h *WebhookHandler) HandleStreamWebhook(c *gin.Context) {
 	apiKey := c.GetHeader("X-Api-Key")
 	signature := c.GetHeader("X-Signature")
 
-	log.Printf("[WEBHOOK] Headers - Webhook-Id: %s, Api-Key: %s, Signature present: %t",
-		webhookID, apiKey, signature != "")
+	log.Printf("[WEBHOOK] Headers - Webhook-Id: %s, Api-Key present: %t, Signature present: %t",
+		webhookID, apiKey != "", signature != "")
 
-	// Validate X-Api-Key header matches our Stream API key
+	// Validate X-Api-Key header matches our Stream API key. Neither key is logged.
 	if apiKey != "" && apiKey != h.streamService.GetAPIKey() {
-		log.Printf("[WEBHOOK] API key validation failed - received: %s, expected: %s",
-			apiKey, h.streamService.GetAPIKey())
+		log.Printf("[WEBHOOK] API key validation failed")
 		c.JSON(http.StatusUnauthorized, ErrorResponse{
 			Error:   "invalid_api_key",
 			Message: "API key validation failed",
@@ -56,19 +81,6 @@ func (h *WebhookHandler) HandleStreamWebhook(c *gin.Context) {
 		return
 	}
 
-	// Check for duplicate webhook processing using X-Webhook-Id
-	if webhookID != "" {
-		if h.processedWebhooks[webhookID] {
-			log.Printf("[WEBHOOK] Duplicate webhook detected - already processed: %s", webhookID)
-			// Already processed this webhook, return success to avoid retries
-			c.JSON(http.StatusOK, gin.H{"status": "already_processed"})
-			return
-		}
-		// Mark as processed
-		h.processedWebhooks[webhookID] = true
-		log.Printf("[WEBHOOK] Marked webhook as processed: %s", webhookID)
-	}
-
 	// Read raw body for signature verification
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -107,7 +119,6 @@ func (h *WebhookHandler) HandleStreamWebhook(c *gin.Context) {
 	var event StreamWebhookEvent
 	if err := json.Unmarshal(body, &event); err != nil {
 		log.Printf("[WEBHOOK] Failed to parse JSON payload: %v", err)
-		log.Printf("[WEBHOOK] Raw body: %s", string(body))
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error:   "invalid_json",
 			Message: "Failed to parse webhook payload",
@@ -117,54 +128,138 @@ func (h *WebhookHandler) HandleStreamWebhook(c *gin.Context) {
 
 	log.Printf("[WEBHOOK] Event parsed successfully - Type: %s", event.Type)
 	if event.Message != nil {
-		log.Printf("[WEBHOOK] Message from user: %s, text: %s",
-			event.Message.User.ID, event.Message.Text)
+		log.Printf("[WEBHOOK] Message %s from user: %s, text: %d bytes",
+			event.Message.ID, event.Message.User.ID, len(event.Message.Text))
 	}
 	if event.Channel != nil {
 		log.Printf("[WEBHOOK] Channel: %s, CID: %s", event.Channel.ID, event.Channel.CID)
 	}
 
-	// Only process new messages
-	if event.Type == "message.new" && event.Message != nil {
-		log.Printf("[WEBHOOK] Processing new message event")
-		h.handleNewMessage(event.Message, event.Channel)
-	} else {
-		log.Printf("[WEBHOOK] Skipping event - Type: %s, Message present: %t",
-			event.Type, event.Message != nil)
+	headers := deliveryHeaders(c.Request.Header)
+
+	// Check for duplicate webhook processing using X-Webhook-Id. IDs are only claimed once
+	// the webhook is verified and released if it can't be queued, so forged or failed
+	// requests can't burn an ID. The claim is atomic, so concurrent retries queue it once.
+	claimed := false
+	if webhookID != "" {
+		var err error
+		claimed, err = h.dedupeStore.Claim(webhookID)
+		if err != nil {
+			// Handlers are idempotent, so processing a duplicate is safer than dropping a webhook
+			log.Printf("[WEBHOOK] Failed to check webhook %s for duplicates: %v", webhookID, err)
+		} else if !claimed {
+			log.Printf("[WEBHOOK] Duplicate webhook detected - already processed: %s", webhookID)
+			if err := h.deliveryService.RecordDuplicate(webhookID, event.Type, headers, body); err != nil {
+				log.Printf("[WEBHOOK] Failed to store duplicate webhook %s: %v", webhookID, err)
+			}
+			// Already processed this webhook, return success to avoid retries
+			c.JSON(http.StatusOK, gin.H{"status": "already_processed"})
+			return
+		}
+	}
+
+	// Store and queue the event and acknowledge it at once, so slow handlers such as the
+	// chatbot's OpenAI calls don't make Stream time out and retry. Once queued, the job queue
+	// retries the event until it succeeds or is dead-lettered.
+	delivery, err := h.deliveryService.Accept(webhookID, event.Type, headers, body)
+	if err != nil {
+		log.Printf("[WEBHOOK] Failed to queue %s event: %v", event.Type, err)
+		if claimed {
+			if err := h.dedupeStore.Release(webhookID); err != nil {
+				log.Printf("[WEBHOOK] Failed to release webhook %s: %v", webhookID, err)
+			}
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "enqueue_failed",
+			Message: "Failed to queue webhook event",
+		})
+		return
 	}
+	log.Printf("[WEBHOOK] Queued %s event as delivery %s", event.Type, delivery.ID)
 
 	log.Printf("[WEBHOOK] Request processed successfully")
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	c.JSON(http.StatusOK, gin.H{"status": "queued"})
 }
 
-// handleNewMessage processes new messages and generates GPT responses
-func (h *WebhookHandler) handleNewMessage(message *StreamMessage, channel *StreamChannel) {
+// respondToMessage answers new messages in AI chat channels. Failures worth retrying are
+// returned, so the job queue retries the reply and dead-letters it if it keeps failing.
+func (h *WebhookHandler) respondToMessage(ctx context.Context, event *StreamWebhookEvent) error {
+	if event.Message == nil || event.Channel == nil {
+		return nil
+	}
+
+	// A retried job or a concurrent delivery must not answer the same message twice,
+	// though a replay may. The claim is released if the reply fails, so it is retried.
+	replyKey := "reply:" + event.Message.ID
+	claimed := false
+	if IsWebhookReplay(ctx) {
+		log.Printf("[WEBHOOK] [REPLAY] Answering message %s again", event.Message.ID)
+	} else {
+		var err error
+		claimed, err = h.dedupeStore.Claim(replyKey)
+		if err != nil {
+			log.Printf("[WEBHOOK] Failed to claim reply to message %s: %v", event.Message.ID, err)
+		} else if !claimed {
+			log.Printf("[WEBHOOK] Already answered message %s", event.Message.ID)
+			return nil
+		}
+	}
+
+	log.Printf("[WEBHOOK] Processing new message event")
+	if err := h.handleNewMessage(ctx, event.Message, event.Channel); err != nil {
+		if claimed {
+			if err := h.dedupeStore.Release(replyKey); err != nil {
+				log.Printf("[WEBHOOK] Failed to release reply to message %s: %v", event.Message.ID, err)
+			}
+		}
+		return fmt.Errorf("failed to answer message %s: %w", event.Message.ID, err)
+	}
+	return nil
+}
+
+// cancelPendingMatches drops matches proposed to or about a user who was deleted or banned
+// app-wide. Pending proposals have no channel yet, so channel bans leave them alone.
+func (h *WebhookHandler) cancelPendingMatches(ctx context.Context, event *StreamWebhookEvent) error {
+	if event.User == nil || event.ChannelID != "" || event.CID != "" {
+		return nil
+	}
+	userID := event.User.ID
+
+	if err := h.conversations.CancelProposals(userID); err != nil {
+		return err
+	}
+	log.Printf("[MATCHING] Cancelled match proposals to or about %s", userID)
+	return nil
+}
+
+// handleNewMessage moves the sender's conversation along and answers in the channel, or in
+// the thread the message replies in, with a GPT response to messages the conversation
+// machine leaves to small talk. Replies in a thread get the thread as context. It returns
+// failures worth retrying: storage and Stream errors, and transient OpenAI errors.
+func (h *WebhookHandler) handleNewMessage(ctx context.Context, message *StreamMessage, channel *StreamChannel) error {
 	log.Printf("[MESSAGE] Processing message from user: %s, role: %s",
 		message.User.ID, message.User.Role)
 	log.Printf("[MESSAGE] Channel: %s, CID: %s", channel.ID, channel.CID)
-	log.Printf("[MESSAGE] Message text: %s", message.Text)
 
-	// Skip messages from bots to avoid loops
-	if message.User.Role == "admin" || message.User.ID == "chatbot" || message.User.ID == "ai-assistant" {
+	// Skip messages from bots to avoid loops; human admins share the bots' Stream role
+	if isStreamBot(message.User.ID) {
 		log.Printf("[MESSAGE] Skipping bot message from %s (role: %s)",
 			message.User.ID, message.User.Role)
-		return
+		return nil
 	}
 
 	// Only respond in AI chat channels (channels with ID starting with "ai-chat-")
 	if len(channel.ID) < 8 || channel.ID[:8] != "ai-chat-" {
 		log.Printf("[MESSAGE] Skipping non-AI channel: %s", channel.ID)
-		return
+		return nil
 	}
 
-	// Get user from database to check profile setup
+	// Get user from database to drive their conversation
 	user, err := h.authService.GetUser(message.User.ID)
 	if err != nil {
 		log.Printf("[MESSAGE] Error getting user from database: %v", err)
 		// Continue with default behavior
-	} else if h.chatGPTService.NeedsProfileSetup(user) {
-		log.Printf("[MESSAGE] User needs profile setup: %s", user.ID)
-
+	} else {
 		// Convert Stream attachments to our format
 		var attachments []StreamMessageAttachment
 		for _, att := range message.Attachments {
@@ -176,244 +271,102 @@ func (h *WebhookHandler) handleNewMessage(message *StreamMessage, channel *Strea
 			}
 		}
 
-		// Try to parse profile information from message
-		profile, parseErr := h.chatGPTService.ParseProfileFromStreamMessage(message.Text, attachments)
-		if parseErr != nil {
-			log.Printf("[MESSAGE] Error parsing profile: %v", parseErr)
-			// Send profile setup request
-			response, genErr := h.chatGPTService.GenerateProfileSetupResponse(user)
-			if genErr != nil {
-				response = "Hi! Welcome to the chat! To get started, I need to set up your profile. Please share your name and upload a profile picture. What's your name?"
-			}
-
-			err = h.streamService.SendMessage(channel.CID, response, "ai-assistant")
-			if err != nil {
-				log.Printf("[MESSAGE] Error sending profile setup request: %v", err)
-			} else {
-				log.Printf("[MESSAGE] Profile setup request sent successfully")
-			}
-			return
-		}
-
-		// Validate parsed profile data
-		if validateErr := h.chatGPTService.ValidateProfileData(profile); validateErr != nil {
-			response := fmt.Sprintf("I need a bit more information to set up your profile. %s Please make sure to include your name and upload a profile picture!", validateErr.Error())
-
-			err = h.streamService.SendMessage(channel.CID, response, "ai-assistant")
-			if err != nil {
-				log.Printf("[MESSAGE] Error sending profile validation error: %v", err)
-			} else {
-				log.Printf("[MESSAGE] Profile validation error sent successfully")
-			}
-			return
+		reply, err := h.conversations.Handle(ctx, user, ConversationInput{Text: message.Text, Attachments: attachments})
+		if err != nil {
+			return fmt.Errorf("failed to handle conversation: %w", err)
 		}
-
-		// If we have complete profile data, update the user
-		if h.chatGPTService.IsProfileComplete(profile) {
-			log.Printf("[MESSAGE] Updating user profile: Name=%s, PicURL=%s, Bio=%s",
-				profile.Name, profile.ProfilePicURL, profile.Bio)
-
-			if updateErr := h.chatGPTService.UpdateUserProfileInDB(user.ID, profile, h.authService.supabaseService, h.streamService); updateErr != nil {
-				log.Printf("[MESSAGE] Error updating user profile: %v", updateErr)
-				response := "I'm sorry, there was an error setting up your profile. Please try again."
-				h.streamService.SendMessage(channel.CID, response, "ai-assistant")
-				return
-			}
-
-			// Generate confirmation message
-			response := h.chatGPTService.GenerateProfileConfirmationMessage(profile)
-
-			err = h.streamService.SendMessage(channel.CID, response, "ai-assistant")
-			if err != nil {
-				log.Printf("[MESSAGE] Error sending profile confirmation: %v", err)
-			} else {
-				log.Printf("[MESSAGE] Profile confirmation sent successfully")
+		if reply.Handled {
+			if err := h.send(channel.CID, message.ParentID, reply.Text); err != nil {
+				return fmt.Errorf("failed to send conversation reply: %w", err)
 			}
-			return
-		}
-
-		// If profile is not complete, ask for more information
-		response := "I still need a bit more information. Please make sure to share your name and upload a profile picture!"
-		err = h.streamService.SendMessage(channel.CID, response, "ai-assistant")
-		if err != nil {
-			log.Printf("[MESSAGE] Error sending incomplete profile message: %v", err)
-		} else {
-			log.Printf("[MESSAGE] Incomplete profile message sent successfully")
+			log.Printf("[MESSAGE] Conversation reply sent successfully to channel: %s", channel.CID)
+			return nil
 		}
-		return
 	}
 
-	log.Printf("[MESSAGE] Generating AI response for message: %s", message.Text)
-
-	// Check if user is looking to meet someone (after profile is set up)
-	if h.isMatchingRequest(message.Text) {
-		log.Printf("[MESSAGE] Processing matching request from user: %s", message.User.ID)
-		h.handleMatchingRequest(message.Text, message.User.ID, channel.CID)
-		return
+	recentMessages, err := h.threadContext(message)
+	if err != nil {
+		return err
 	}
 
-	// Check if user is confirming they want to meet someone
-	if h.isConfirmationMessage(message.Text) {
-		log.Printf("[MESSAGE] Processing meeting confirmation from user: %s", message.User.ID)
-		h.handleMeetingConfirmation(message.User.ID, channel.CID)
-		return
-	}
+	log.Printf("[MESSAGE] Generating AI response for message: %s", message.ID)
 
 	// Generate GPT response
-	aiResponse, err := h.chatGPTService.GenerateResponse(nil, message.Text, "gpt-3.5-turbo")
+	aiResponse, err := h.chatGPTService.GenerateResponse(recentMessages, message.Text, "gpt-3.5-turbo")
 	if err != nil {
+		if IsTransientOpenAIError(err) {
+			return err
+		}
+		// Retrying won't fix a bad request or key, so apologize instead
 		log.Printf("[MESSAGE] Error generating AI response: %v", err)
 		aiResponse = "I'm sorry, I'm having trouble processing your request right now."
 	}
 
-	log.Printf("[MESSAGE] Generated AI response: %s", aiResponse)
+	log.Printf("[MESSAGE] Generated AI response of %d bytes", len(aiResponse))
 
 	// Send response back to Stream Chat
-	err = h.streamService.SendMessage(channel.CID, aiResponse, "ai-assistant")
-	if err != nil {
-		log.Printf("[MESSAGE] Error sending AI response: %v", err)
-	} else {
-		log.Printf("[MESSAGE] AI response sent successfully to channel: %s", channel.CID)
+	if err := h.send(channel.CID, message.ParentID, aiResponse); err != nil {
+		return fmt.Errorf("failed to send AI response: %w", err)
 	}
+	log.Printf("[MESSAGE] AI response sent successfully to channel: %s", channel.CID)
+	return nil
 }
 
-// isMatchingRequest uses AI to determine if the user wants to meet someone
-func (h *WebhookHandler) isMatchingRequest(text string) bool {
-	systemPrompt := `You are an AI that determines if a user is asking to meet or connect with other people. 
-
-Look for requests like:
-- Wanting to meet someone with specific interests/qualities
-- Looking for connections or introductions
-- Asking for recommendations for people to talk to
-- Expressing loneliness or desire for social connections
-- Asking about finding friends, dates, or conversation partners
-
-Respond with only "YES" if they want to meet someone, or "NO" if they don't.`
-
-	request := openai.ChatCompletionRequest{
-		Model: openai.GPT3Dot5Turbo,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: systemPrompt,
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: fmt.Sprintf("User message: \"%s\"", text),
-			},
-		},
-		MaxTokens:   10,
-		Temperature: 0.1,
+// threadContext returns the thread a message replies in as ChatGPT context, without the
+// message itself, which is the prompt. Messages outside threads and threads that weren't
+// mirrored get none.
+func (h *WebhookHandler) threadContext(message *StreamMessage) ([]Message, error) {
+	if message.ParentID == "" {
+		return nil, nil
 	}
 
-	resp, err := h.chatGPTService.client.CreateChatCompletion(context.Background(), request)
+	parent, err := h.mirror.lookup(message.ParentID)
 	if err != nil {
-		log.Printf("[MATCHING] Error checking if matching request: %v", err)
-		return false
-	}
-
-	if len(resp.Choices) == 0 {
-		return false
+		return nil, fmt.Errorf("failed to look up thread %s: %w", message.ParentID, err)
 	}
-
-	response := strings.ToUpper(strings.TrimSpace(resp.Choices[0].Message.Content))
-	return response == "YES"
-}
-
-// isConfirmationMessage checks if the user is confirming they want to meet someone
-func (h *WebhookHandler) isConfirmationMessage(text string) bool {
-	text = strings.ToLower(strings.TrimSpace(text))
-	confirmationWords := []string{"yes", "yeah", "yep", "sure", "okay", "ok", "connect", "meet them"}
-
-	for _, word := range confirmationWords {
-		if text == word || strings.HasPrefix(text, word+" ") || strings.HasSuffix(text, " "+word) {
-			return true
-		}
+	if parent == nil {
+		log.Printf("[MESSAGE] Thread %s isn't mirrored, answering without context", message.ParentID)
+		return nil, nil
 	}
-	return false
-}
 
-// handleMatchingRequest processes user's request to meet someone
-func (h *WebhookHandler) handleMatchingRequest(preferences, userID, channelCID string) {
-	log.Printf("[MATCHING] Processing matching request for user %s with preferences: %s", userID, preferences)
-
-	// Get recommendation from ChatGPT service
-	log.Printf("[MATCHING] for user %s with preferences: %s", userID, preferences)
-	recommendedUser, err := h.chatGPTService.RecommendUser(preferences, userID, h.authService.supabaseService)
+	root, err := h.threadService.Root(parent.ID)
 	if err != nil {
-		log.Printf("[MATCHING] Error getting recommendation: %v", err)
-		response := "I'm sorry, I couldn't find anyone matching your preferences right now. There might not be other users available, or you might want to try describing what you're looking for differently."
-		h.streamService.SendMessage(channelCID, response, "ai-assistant")
-		return
-	}
-
-	// Store the recommendation for later confirmation
-	h.pendingRecommendations[userID] = recommendedUser
-
-	// Generate and send recommendation message
-	response := h.chatGPTService.GenerateMatchResponse(recommendedUser)
-	err = h.streamService.SendMessage(channelCID, response, "ai-assistant")
-	if err != nil {
-		log.Printf("[MATCHING] Error sending recommendation: %v", err)
-	} else {
-		log.Printf("[MATCHING] Sent recommendation for user %s: %s", recommendedUser.Name, recommendedUser.ID)
+		return nil, fmt.Errorf("failed to get thread %s: %w", message.ParentID, err)
 	}
-}
-
-// handleMeetingConfirmation processes user's confirmation to meet someone
-func (h *WebhookHandler) handleMeetingConfirmation(userID, channelCID string) {
-	log.Printf("[MATCHING] Processing meeting confirmation for user %s", userID)
-
-	// Get the pending recommendation
-	recommendedUser, exists := h.pendingRecommendations[userID]
-	if !exists {
-		log.Printf("[MATCHING] No pending recommendation found for user %s", userID)
-		response := "I don't have any pending introductions for you. Try asking me to find someone for you to meet!"
-		h.streamService.SendMessage(channelCID, response, "ai-assistant")
-		return
-	}
-
-	// Create a new channel between the two users
-	matchChannelID, err := h.streamService.CreateUserMatchChannel(context.Background(), userID, recommendedUser.ID)
+	thread, err := h.threadService.ThreadContext(root, DefaultContextLimit)
 	if err != nil {
-		log.Printf("[MATCHING] Error creating match channel: %v", err)
-		response := "I'm sorry, there was an error creating your chat. Please try again later."
-		h.streamService.SendMessage(channelCID, response, "ai-assistant")
-		return
+		return nil, fmt.Errorf("failed to get thread %s: %w", message.ParentID, err)
 	}
 
-	// Get current user info for the introduction message
-	currentUser, err := h.authService.GetUser(userID)
-	if err != nil {
-		log.Printf("[MATCHING] Error getting current user info: %v", err)
-		currentUser = &User{ID: userID, Name: "Unknown"}
+	// The mirror stored the message before this handler ran
+	var previous []Message
+	for _, m := range thread {
+		if m.StreamMessageID == nil || *m.StreamMessageID != message.ID {
+			previous = append(previous, m)
+		}
 	}
+	return previous, nil
+}
 
-	// Send introduction message to the new channel
-	introMessage := fmt.Sprintf(`Hi! I'm Oliver, and I've connected you two because I thought you might hit it off!
-
-👋 %s, meet %s
-👋 %s, meet %s
-
-Feel free to introduce yourselves and start chatting. Have fun getting to know each other!`,
-		currentUser.Name, recommendedUser.Name,
-		recommendedUser.Name, currentUser.Name)
-
-	matchChannelCID := fmt.Sprintf("messaging:%s", matchChannelID)
-	err = h.streamService.SendMessage(matchChannelCID, introMessage, "ai-assistant")
-	if err != nil {
-		log.Printf("[MATCHING] Error sending introduction message: %v", err)
+// send posts a chatbot message in a channel, in the thread of parentID if it's set
+func (h *WebhookHandler) send(cid, parentID, text string) error {
+	if parentID != "" {
+		return h.streamService.SendReply(cid, parentID, text, "ai-assistant")
 	}
+	return h.streamService.SendMessage(cid, text, "ai-assistant")
+}
 
-	// Send confirmation to the original AI chat
-	confirmationResponse := fmt.Sprintf("Perfect! I've created a chat between you and %s. Check your channels to start the conversation!", recommendedUser.Name)
-	err = h.streamService.SendMessage(channelCID, confirmationResponse, "ai-assistant")
-	if err != nil {
-		log.Printf("[MATCHING] Error sending confirmation: %v", err)
-	} else {
-		log.Printf("[MATCHING] Successfully connected users %s and %s", userID, recommendedUser.ID)
+// deliveryHeaders picks the headers stored with a webhook delivery: Stream's X- headers,
+// which include the signature, and the content type and user agent
+func deliveryHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for name, values := range header {
+		if len(values) == 0 {
+			continue
+		}
+		if strings.HasPrefix(name, "X-") || name == "Content-Type" || name == "User-Agent" {
+			headers[name] = values[0]
+		}
 	}
-
-	// Clean up the pending recommendation
-	delete(h.pendingRecommendations, userID)
+	return headers
 }
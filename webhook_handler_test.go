@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// webhookHarness runs Stream Chat webhooks through the handler, job queue and dispatcher
+// on the memory repositories, with fake OpenAI and Stream APIs
+type webhookHarness struct {
+	router      *gin.Engine
+	dispatcher  *WebhookDispatcher
+	jobQueue    *JobQueue
+	jobRepo     *MemoryJobRepository
+	webhookRepo *MemoryWebhookRepository
+	userRepo    *MemoryUserRepository
+	messageRepo *MemoryMessageRepository
+	stream      *fakeStream
+	openAI      *fakeOpenAI
+}
+
+func newWebhookHarness(t *testing.T, reply func(req openai.ChatCompletionRequest) string) *webhookHarness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	authService, userRepo := newTestAuthService(t)
+	streamService, stream := newFakeStream(t)
+	chatGPTService, openAI := newFakeOpenAI(t, reply)
+	messageRepo := NewMemoryMessageRepository()
+
+	dispatcher := NewWebhookDispatcher()
+	mirror := NewStreamMirrorService(messageRepo, streamService)
+	NewStreamEventHandlers(mirror, messageRepo, userRepo, nil, NewSessionService(userRepo)).Register(dispatcher)
+	jobRepo := NewMemoryJobRepository()
+	jobQueue := NewJobQueue(jobRepo)
+	webhookRepo := NewMemoryWebhookRepository()
+	deliveryService := NewWebhookDeliveryService(webhookRepo, dispatcher, jobQueue)
+	conversations := NewConversationMachine(userRepo, chatGPTService, streamService, NewMatchConsentService(userRepo, streamService, jobQueue))
+	handler := NewWebhookHandler(chatGPTService, streamService, authService, dispatcher, NewLRUWebhookDedupeStore(100, time.Hour), deliveryService, conversations, mirror, NewMessageThreadService(messageRepo, userRepo))
+	router := gin.New()
+	router.POST("/webhooks/stream", handler.HandleStreamWebhook)
+
+	return &webhookHarness{
+		router:      router,
+		dispatcher:  dispatcher,
+		jobQueue:    jobQueue,
+		jobRepo:     jobRepo,
+		webhookRepo: webhookRepo,
+		userRepo:    userRepo,
+		messageRepo: messageRepo,
+		stream:      stream,
+		openAI:      openAI,
+	}
+}
+
+// createUser stores a user whose profile is set up, so the chatbot answers them freely
+func (h *webhookHarness) createUser(t *testing.T) *User {
+	t.Helper()
+	user, err := h.userRepo.CreateUser(&User{
+		WalletAddress: "0x0000000000000000000000000000000000000001",
+		ChainType:     ChainEVM,
+		Name:          "Alice",
+		ProfilePicURL: "https://example.com/alice.png",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user
+}
+
+// post sends a webhook signed with the Stream secret
+func (h *webhookHarness) post(t *testing.T, webhookID string, event interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte(testStreamSecret))
+	mac.Write(body)
+	return h.postSigned(webhookID, body, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (h *webhookHarness) postSigned(webhookID string, body []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/stream", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", testStreamKey)
+	req.Header.Set("X-Signature", signature)
+	if webhookID != "" {
+		req.Header.Set("X-Webhook-Id", webhookID)
+	}
+	rec := httptest.NewRecorder()
+	h.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// runJobs runs the jobs that are due, as a worker would
+func (h *webhookHarness) runJobs(t *testing.T) int {
+	t.Helper()
+	ran := 0
+	for {
+		now := time.Now().UTC()
+		job, err := h.jobRepo.ClaimJob(now, now.Add(jobLease))
+		if err != nil {
+			t.Fatalf("ClaimJob: %v", err)
+		}
+		if job == nil {
+			return ran
+		}
+		h.jobQueue.run(context.Background(), job)
+		ran++
+	}
+}
+
+// delivery returns the only stored delivery of an event type
+func (h *webhookHarness) delivery(t *testing.T, eventType string) WebhookDelivery {
+	t.Helper()
+	deliveries, err := h.webhookRepo.ListWebhookDeliveries(WebhookDeliveryFilter{EventType: eventType, Limit: 10})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d %s deliveries, want 1", len(deliveries), eventType)
+	}
+	return deliveries[0]
+}
+
+func newMessageEvent(userID, channelID, messageID, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "message.new",
+		"cid":        "messaging:" + channelID,
+		"channel_id": channelID,
+		"channel":    map[string]interface{}{"id": channelID, "cid": "messaging:" + channelID, "type": "messaging"},
+		"message": map[string]interface{}{
+			"id":         messageID,
+			"text":       text,
+			"type":       "regular",
+			"created_at": "2026-01-02T03:04:05Z",
+			"user":       map[string]interface{}{"id": userID, "name": "Alice"},
+		},
+	}
+}
+
+func TestWebhookAnswersAIChatMessages(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string {
+		if strings.Contains(req.Messages[0].Content, `"YES"`) {
+			return ""
+		}
+		return "Happy to help!"
+	})
+	user := h.createUser(t)
+	channelID := "ai-chat-" + user.ID
+
+	rec := h.post(t, "wh-1", newMessageEvent(user.ID, channelID, "msg-1", "Any tips for today?"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if ran := h.runJobs(t); ran != 1 {
+		t.Fatalf("ran %d jobs, want 1", ran)
+	}
+
+	if sent := h.stream.sentMessages("messaging", channelID); len(sent) != 1 || sent[0] != "Happy to help!" {
+		t.Errorf("sent %q, want the model's reply", sent)
+	}
+	if got := h.openAI.lastUserMessage(); got != "Any tips for today?" {
+		t.Errorf("OpenAI was asked %q", got)
+	}
+}
+
+func TestWebhookAnswersThreadRepliesInTheThread(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "Try the noodle bar." })
+	user := h.createUser(t)
+	channelID := "ai-chat-" + user.ID
+
+	h.post(t, "wh-1", newMessageEvent(user.ID, channelID, "msg-1", "Where should we eat?"))
+	h.runJobs(t)
+	reply := newMessageEvent(user.ID, channelID, "msg-2", "Somewhere cheap")
+	reply["message"].(map[string]interface{})["parent_id"] = "msg-1"
+	h.post(t, "wh-2", reply)
+	h.runJobs(t)
+
+	// The thread is the context of the answer
+	sent := h.openAI.requests[len(h.openAI.requests)-1].Messages
+	if len(sent) < 3 || !strings.Contains(sent[len(sent)-2].Content, "Where should we eat?") {
+		t.Errorf("context = %+v, want the thread root before the prompt", sent)
+	}
+
+	last := h.stream.requests[len(h.stream.requests)-1]
+	if last.path != "/channels/messaging/"+channelID+"/message" || !strings.Contains(last.body, `"parent_id":"msg-1"`) {
+		t.Errorf("last Stream request = %s %s, want a message in the thread of msg-1", last.method, last.path)
+	}
+}
+
+func TestWebhookMirrorsMessages(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "" })
+
+	if rec := h.post(t, "wh-1", newMessageEvent("user-1", "general", "msg-1", "hello")); rec.Code != http.StatusOK {
+		t.Fatalf("message.new: status %d: %s", rec.Code, rec.Body.String())
+	}
+	h.runJobs(t)
+	stored, err := h.messageRepo.GetMessagesByStreamID("msg-1")
+	if err != nil {
+		t.Fatalf("GetMessagesByStreamID: %v", err)
+	}
+	if len(stored) != 1 || stored[0].MessageText != "hello" || stored[0].SenderID != "user-1" {
+		t.Fatalf("stored messages = %+v, want one \"hello\" from user-1", stored)
+	}
+	if delivery := h.delivery(t, "message.new"); delivery.Status != DeliveryProcessed || delivery.Attempts != 1 {
+		t.Errorf("delivery status %s after %d attempts, want %s after 1", delivery.Status, delivery.Attempts, DeliveryProcessed)
+	}
+
+	edit := newMessageEvent("user-1", "general", "msg-1", "hello again")
+	edit["type"] = "message.updated"
+	h.post(t, "wh-2", edit)
+	h.runJobs(t)
+	stored, _ = h.messageRepo.GetMessagesByStreamID("msg-1")
+	if len(stored) != 1 || stored[0].MessageText != "hello again" {
+		t.Errorf("stored messages after edit = %+v, want one \"hello again\"", stored)
+	}
+}
+
+func TestWebhookStoresReactions(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "" })
+	h.post(t, "wh-1", newMessageEvent("user-1", "general", "msg-1", "hello"))
+
+	reaction := map[string]interface{}{"message_id": "msg-1", "user_id": "user-2", "type": "like"}
+	h.post(t, "wh-2", map[string]interface{}{"type": "reaction.new", "cid": "messaging:general", "reaction": reaction})
+	// A retried webhook with a new ID stores nothing new
+	h.post(t, "wh-3", map[string]interface{}{"type": "reaction.new", "cid": "messaging:general", "reaction": reaction})
+	h.runJobs(t)
+
+	if got := len(h.messageRepo.reactions); got != 1 {
+		t.Fatalf("stored %d reactions, want 1", got)
+	}
+
+	h.post(t, "wh-4", map[string]interface{}{"type": "reaction.deleted", "cid": "messaging:general", "reaction": reaction})
+	h.runJobs(t)
+	if got := len(h.messageRepo.reactions); got != 0 {
+		t.Errorf("stored %d reactions after reaction.deleted, want 0", got)
+	}
+}
+
+func TestWebhookSkipsOtherChannels(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "Hi!" })
+	user := h.createUser(t)
+
+	if rec := h.post(t, "wh-1", newMessageEvent(user.ID, "general", "msg-1", "Hello all")); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	// Nor does the chatbot answer itself
+	h.post(t, "wh-2", newMessageEvent("ai-assistant", "ai-chat-"+user.ID, "msg-2", "Hi!"))
+	h.runJobs(t)
+
+	if len(h.openAI.requests) != 0 {
+		t.Errorf("OpenAI called %d times, want 0", len(h.openAI.requests))
+	}
+	if len(h.stream.sentMessages("messaging", "general")) != 0 || len(h.stream.sentMessages("messaging", "ai-chat-"+user.ID)) != 0 {
+		t.Error("chatbot answered a message it should skip")
+	}
+}
+
+func TestWebhookDuplicateIsNotAnsweredTwice(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "" })
+	user := h.createUser(t)
+	channelID := "ai-chat-" + user.ID
+	event := newMessageEvent(user.ID, channelID, "msg-1", "Hello")
+
+	h.post(t, "wh-1", event)
+	rec := h.post(t, "wh-1", event)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "already_processed") {
+		t.Fatalf("duplicate: status %d: %s, want already_processed", rec.Code, rec.Body.String())
+	}
+	if ran := h.runJobs(t); ran != 1 {
+		t.Errorf("ran %d jobs, want 1", ran)
+	}
+
+	deliveries, err := h.webhookRepo.ListWebhookDeliveries(WebhookDeliveryFilter{Status: DeliveryDuplicate, Limit: 10})
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Errorf("got %d duplicate deliveries, want 1", len(deliveries))
+	}
+	if sent := h.stream.sentMessages("messaging", channelID); len(sent) != 1 {
+		t.Errorf("sent %d replies, want 1", len(sent))
+	}
+}
+
+func TestWebhookRejectsInvalidSignature(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "Hi!" })
+	user := h.createUser(t)
+
+	body, _ := json.Marshal(newMessageEvent(user.ID, "ai-chat-"+user.ID, "msg-1", "Hello"))
+	if rec := h.postSigned("wh-1", body, "deadbeef"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if ran := h.runJobs(t); ran != 0 {
+		t.Errorf("ran %d jobs, want 0", ran)
+	}
+
+	// A forged request doesn't burn the webhook ID
+	if rec := h.post(t, "wh-1", newMessageEvent(user.ID, "ai-chat-"+user.ID, "msg-1", "Hello")); strings.Contains(rec.Body.String(), "already_processed") {
+		t.Error("webhook ID of a forged request was recorded")
+	}
+}
+
+func TestWebhookHandlerFailureIsRetried(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "" })
+	calls := 0
+	h.dispatcher.Register("test.failing", func(ctx context.Context, event *StreamWebhookEvent) error {
+		calls++
+		return errors.New("boom")
+	})
+
+	h.post(t, "wh-1", map[string]interface{}{"type": "test.failing"})
+	h.runJobs(t)
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	delivery := h.delivery(t, "test.failing")
+	if delivery.Status != DeliveryFailed || !strings.Contains(delivery.LastError, "boom") {
+		t.Errorf("delivery status %s with error %q, want %s with the handler's error", delivery.Status, delivery.LastError, DeliveryFailed)
+	}
+}
+
+func TestWebhookBanAndUnban(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "" })
+	user := h.createUser(t)
+	session, _, err := NewSessionService(h.userRepo).CreateSession(user.ID, ClientInfo{})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	h.post(t, "wh-1", map[string]interface{}{
+		"type":       "user.banned",
+		"user":       map[string]interface{}{"id": user.ID},
+		"reason":     "spam",
+		"expiration": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+	// Channel bans leave the user alone
+	h.post(t, "wh-2", map[string]interface{}{
+		"type": "user.banned",
+		"cid":  "messaging:general",
+		"user": map[string]interface{}{"id": user.ID},
+	})
+	h.runJobs(t)
+
+	banned, _ := h.userRepo.GetUserByID(user.ID)
+	if !banned.IsBanned(time.Now()) || banned.BanExpiresAt == nil {
+		t.Errorf("user banned_at %v, ban_expires_at %v, want a timed ban", banned.BannedAt, banned.BanExpiresAt)
+	}
+	if revoked, _ := h.userRepo.GetSession(session.ID); revoked.RevokedAt == nil || revoked.RevokeReason != "banned" {
+		t.Errorf("session revoked at %v for %q, want revoked for banned", revoked.RevokedAt, revoked.RevokeReason)
+	}
+
+	h.post(t, "wh-3", map[string]interface{}{
+		"type": "user.unbanned",
+		"user": map[string]interface{}{"id": user.ID},
+	})
+	h.runJobs(t)
+
+	unbanned, _ := h.userRepo.GetUserByID(user.ID)
+	if unbanned.IsBanned(time.Now()) || unbanned.BannedAt != nil {
+		t.Errorf("user still banned at %v after user.unbanned", unbanned.BannedAt)
+	}
+}
+
+func TestWebhookBanCancelsPendingMatches(t *testing.T) {
+	h := newWebhookHarness(t, func(req openai.ChatCompletionRequest) string { return "" })
+	user := h.createUser(t)
+	other, err := h.userRepo.CreateUser(&User{WalletAddress: "0x0000000000000000000000000000000000000002", ChainType: ChainEVM})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	proposal := &MatchProposal{
+		UserID:         other.ID,
+		ProposedUserID: user.ID,
+		Status:         ProposalProposed,
+		CreatedAt:      time.Now().UTC(),
+		ExpiresAt:      time.Now().Add(time.Hour).UTC(),
+	}
+	if err := h.userRepo.CreateMatchProposal(proposal); err != nil {
+		t.Fatalf("CreateMatchProposal: %v", err)
+	}
+
+	// Leaving a channel or a channel ban keeps the proposal open
+	h.post(t, "wh-1", map[string]interface{}{
+		"type":       "member.removed",
+		"channel_id": "general",
+		"member":     map[string]interface{}{"user_id": user.ID},
+		"user":       map[string]interface{}{"id": user.ID},
+	})
+	h.post(t, "wh-2", map[string]interface{}{
+		"type": "user.banned",
+		"cid":  "messaging:general",
+		"user": map[string]interface{}{"id": user.ID},
+	})
+	h.runJobs(t)
+	if got, _ := h.userRepo.GetMatchProposal(proposal.ID); got.Status != ProposalProposed {
+		t.Fatalf("proposal %s after leaving a channel, want %s", got.Status, ProposalProposed)
+	}
+
+	h.post(t, "wh-3", map[string]interface{}{
+		"type": "user.banned",
+		"user": map[string]interface{}{"id": user.ID},
+	})
+	h.runJobs(t)
+	if got, _ := h.userRepo.GetMatchProposal(proposal.ID); got.Status != ProposalCancelled {
+		t.Errorf("proposal %s after an app-wide ban, want %s", got.Status, ProposalCancelled)
+	}
+}
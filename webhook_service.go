@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+	supa "github.com/supabase-community/supabase-go"
+)
+
+// WebhookService handles webhook database operations; it is the PostgREST WebhookRepository
+type WebhookService struct {
+	client   *supa.Client
+	supabase *SupabaseService // For requests the client can't make, such as ignoring duplicates
+}
+
+// NewWebhookService creates a new webhook service instance
+func NewWebhookService(supabaseService *SupabaseService) *WebhookService {
+	return &WebhookService{
+		client:   supabaseService.client,
+		supabase: supabaseService,
+	}
+}
+
+// ClaimWebhook stores a webhook ID unless it was claimed at or after expiredBefore. An
+// expired row is deleted first; the insert then ignores duplicates and returns only a row
+// it inserted, so of concurrent claims one succeeds.
+func (s *WebhookService) ClaimWebhook(webhookID string, claimedAt, expiredBefore time.Time) (bool, error) {
+	expired := NewPostgRESTQuery("processed_webhooks").
+		Eq("webhook_id", webhookID).
+		Lt("processed_at", expiredBefore.UTC().Format(time.RFC3339Nano))
+	if _, _, err := s.supabase.doRequest("DELETE", expired, nil, "return=minimal"); err != nil {
+		return false, fmt.Errorf("failed to delete expired webhook claim: %w", err)
+	}
+
+	body, _, err := s.supabase.doRequest("POST", NewPostgRESTQuery("processed_webhooks"), map[string]interface{}{
+		"webhook_id":   webhookID,
+		"processed_at": claimedAt.UTC().Format(time.RFC3339Nano),
+	}, "resolution=ignore-duplicates,return=representation")
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook: %w", err)
+	}
+
+	var inserted []struct {
+		WebhookID string `json:"webhook_id"`
+	}
+	if err := json.Unmarshal(body, &inserted); err != nil {
+		return false, fmt.Errorf("failed to decode webhook claim: %w", err)
+	}
+	return len(inserted) > 0, nil
+}
+
+// ReleaseWebhook forgets a webhook ID, so it can be claimed again
+func (s *WebhookService) ReleaseWebhook(webhookID string) error {
+	_, _, err := s.client.From("processed_webhooks").
+		Delete("minimal", "").
+		Eq("webhook_id", webhookID).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to release webhook: %w", err)
+	}
+	return nil
+}
+
+// DeleteProcessedWebhooks forgets webhook IDs processed before the given time
+func (s *WebhookService) DeleteProcessedWebhooks(before time.Time) error {
+	_, _, err := s.client.From("processed_webhooks").
+		Delete("minimal", "").
+		Lt("processed_at", before.UTC().Format(time.RFC3339Nano)).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to delete processed webhooks: %w", err)
+	}
+	return nil
+}
+
+// CreateWebhookDelivery stores a webhook delivery, filling in its ID
+func (s *WebhookService) CreateWebhookDelivery(delivery *WebhookDelivery) error {
+	row := map[string]interface{}{
+		"event_type":  delivery.EventType,
+		"headers":     delivery.Headers,
+		"body":        delivery.Body,
+		"status":      delivery.Status,
+		"attempts":    delivery.Attempts,
+		"received_at": delivery.ReceivedAt.UTC().Format(time.RFC3339Nano),
+	}
+	if delivery.WebhookID != "" {
+		row["webhook_id"] = delivery.WebhookID
+	}
+
+	result, _, err := s.client.From("webhook_deliveries").
+		Insert(row, false, "", "", "").
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+
+	var created []WebhookDelivery
+	if err := json.Unmarshal(result, &created); err != nil {
+		return fmt.Errorf("failed to decode webhook delivery: %w", err)
+	}
+	if len(created) == 0 {
+		return fmt.Errorf("failed to create webhook delivery: no row returned")
+	}
+	delivery.ID = created[0].ID
+	return nil
+}
+
+// GetWebhookDelivery retrieves a webhook delivery by ID
+func (s *WebhookService) GetWebhookDelivery(id string) (*WebhookDelivery, error) {
+	result, _, err := s.client.From("webhook_deliveries").
+		Select("*", "", false).
+		Eq("id", id).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+
+	var deliveries []WebhookDelivery
+	if err := json.Unmarshal(result, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook delivery: %w", err)
+	}
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+	return &deliveries[0], nil
+}
+
+// ListWebhookDeliveries retrieves the webhook deliveries matching a filter, newest first
+func (s *WebhookService) ListWebhookDeliveries(filter WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	query := s.client.From("webhook_deliveries").Select("*", "", false)
+	if filter.EventType != "" {
+		query = query.Eq("event_type", filter.EventType)
+	}
+	if filter.Status != "" {
+		query = query.Eq("status", filter.Status)
+	}
+	if filter.WebhookID != "" {
+		query = query.Eq("webhook_id", filter.WebhookID)
+	}
+	if filter.Since != nil {
+		query = query.Gte("received_at", filter.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if filter.Until != nil {
+		// Filters are keyed by column, so the upper bound can't be a second received_at filter
+		query = query.Or("received_at.lte."+quotePostgRESTValue(filter.Until.UTC().Format(time.RFC3339Nano)), "")
+	}
+
+	newestFirst := &postgrest.OrderOpts{Ascending: false}
+	result, _, err := query.
+		Order("received_at", newestFirst).
+		Order("id", newestFirst).
+		Limit(filter.Limit, "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	deliveries := []WebhookDelivery{}
+	if err := json.Unmarshal(result, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery applies column updates, keyed by JSON field name, to a webhook delivery
+func (s *WebhookService) UpdateWebhookDelivery(id string, updates map[string]interface{}) error {
+	_, _, err := s.client.From("webhook_deliveries").
+		Update(updates, "minimal", "").
+		Eq("id", id).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}